@@ -34,10 +34,55 @@ const (
 
 	apiPrefix = "/api/v1"
 
-	epQuery       = apiPrefix + "/query"
-	epQueryRange  = apiPrefix + "/query_range"
-	epLabelValues = apiPrefix + "/label/:name/values"
-	epSeries      = apiPrefix + "/series"
+	epQuery           = apiPrefix + "/query"
+	epQueryRange      = apiPrefix + "/query_range"
+	epLabelValues     = apiPrefix + "/label/:name/values"
+	epSeries          = apiPrefix + "/series"
+	epTargets         = apiPrefix + "/targets"
+	epRules           = apiPrefix + "/rules"
+	epAlerts          = apiPrefix + "/alerts"
+	epSnapshot        = apiPrefix + "/admin/tsdb/snapshot"
+	epDeleteSeries    = apiPrefix + "/admin/tsdb/delete_series"
+	epCleanTombstones = apiPrefix + "/admin/tsdb/clean_tombstones"
+)
+
+// HealthStatus models the health status of a scrape target.
+type HealthStatus string
+
+// Possible values for HealthStatus.
+const (
+	HealthGood    HealthStatus = "up"
+	HealthUnknown HealthStatus = "unknown"
+	HealthBad     HealthStatus = "down"
+)
+
+// RuleHealth models the health status of a rule.
+type RuleHealth string
+
+// Possible values for RuleHealth.
+const (
+	RuleHealthGood    RuleHealth = "ok"
+	RuleHealthUnknown RuleHealth = "unknown"
+	RuleHealthBad     RuleHealth = "err"
+)
+
+// RuleType models the type of a rule.
+type RuleType string
+
+// Possible values for RuleType.
+const (
+	RuleTypeRecording RuleType = "recording"
+	RuleTypeAlerting  RuleType = "alerting"
+)
+
+// AlertState models the state of an alert.
+type AlertState string
+
+// Possible values for AlertState.
+const (
+	AlertStateFiring   AlertState = "firing"
+	AlertStateInactive AlertState = "inactive"
+	AlertStatePending  AlertState = "pending"
 )
 
 // ErrorType models the different API error types.
@@ -78,6 +123,149 @@ type API interface {
 	QueryRange(ctx context.Context, query string, r Range) (model.Value, error)
 	// LabelValues performs a query for the values of the given label.
 	LabelValues(ctx context.Context, label string) (model.LabelValues, error)
+	// Series finds series by label matchers.
+	Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, error)
+	// Targets returns an overview of the current state of the Prometheus
+	// target discovery.
+	Targets(ctx context.Context) (TargetsResult, error)
+	// Rules returns a list of alerting and recording rules that are
+	// currently loaded.
+	Rules(ctx context.Context) (RulesResult, error)
+	// Alerts returns a list of all active alerts.
+	Alerts(ctx context.Context) (AlertsResult, error)
+	// Snapshot creates a snapshot of all current data into
+	// snapshots/<datetime>-<rand> under the TSDB's data directory. Requires
+	// the admin APIs to be enabled on the server.
+	Snapshot(ctx context.Context, skipHead bool) (SnapshotResult, error)
+	// DeleteSeries deletes data for a selection of series in a time range.
+	// Requires the admin APIs to be enabled on the server.
+	DeleteSeries(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) error
+	// CleanTombstones removes the deleted data from disk and cleans up the
+	// existing tombstones. Requires the admin APIs to be enabled on the
+	// server.
+	CleanTombstones(ctx context.Context) error
+}
+
+// TargetsResult contains the result from querying the targets endpoint.
+type TargetsResult struct {
+	Active  []ActiveTarget  `json:"activeTargets"`
+	Dropped []DroppedTarget `json:"droppedTargets"`
+}
+
+// ActiveTarget models an active Prometheus scrape target.
+type ActiveTarget struct {
+	DiscoveredLabels map[string]string `json:"discoveredLabels"`
+	Labels           model.LabelSet    `json:"labels"`
+	ScrapeURL        string            `json:"scrapeUrl"`
+	LastError        string            `json:"lastError"`
+	LastScrape       time.Time         `json:"lastScrape"`
+	Health           HealthStatus      `json:"health"`
+}
+
+// DroppedTarget models a target dropped by relabelling.
+type DroppedTarget struct {
+	DiscoveredLabels map[string]string `json:"discoveredLabels"`
+}
+
+// AlertsResult contains the result from querying the alerts endpoint.
+type AlertsResult struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+// Alert models an active alert.
+type Alert struct {
+	ActiveAt    time.Time      `json:"activeAt"`
+	Annotations model.LabelSet `json:"annotations"`
+	Labels      model.LabelSet `json:"labels"`
+	State       AlertState     `json:"state"`
+	// Value is the value of the alerting expression at the last
+	// evaluation, as formatted by the server.
+	Value string `json:"value"`
+}
+
+// RulesResult contains the result from querying the rules endpoint.
+type RulesResult struct {
+	Groups []RuleGroup `json:"groups"`
+}
+
+// RuleGroup models a rule group that contains a set of recording and alerting
+// rules.
+type RuleGroup struct {
+	Name     string  `json:"name"`
+	File     string  `json:"file"`
+	Interval float64 `json:"interval"`
+	// Rules contains AlertingRule and RecordingRule values.
+	Rules []interface{} `json:"rules"`
+}
+
+// AlertingRule models an alerting rule.
+type AlertingRule struct {
+	Name        string         `json:"name"`
+	Query       string         `json:"query"`
+	Duration    float64        `json:"duration"`
+	Labels      model.LabelSet `json:"labels"`
+	Annotations model.LabelSet `json:"annotations"`
+	Alerts      []Alert        `json:"alerts"`
+	Health      RuleHealth     `json:"health"`
+	LastError   string         `json:"lastError,omitempty"`
+}
+
+// RecordingRule models a recording rule.
+type RecordingRule struct {
+	Name      string         `json:"name"`
+	Query     string         `json:"query"`
+	Labels    model.LabelSet `json:"labels,omitempty"`
+	Health    RuleHealth     `json:"health"`
+	LastError string         `json:"lastError,omitempty"`
+}
+
+func (rg *RuleGroup) UnmarshalJSON(b []byte) error {
+	v := struct {
+		Name     string            `json:"name"`
+		File     string            `json:"file"`
+		Interval float64           `json:"interval"`
+		Rules    []json.RawMessage `json:"rules"`
+	}{}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	rg.Name = v.Name
+	rg.File = v.File
+	rg.Interval = v.Interval
+	rg.Rules = make([]interface{}, 0, len(v.Rules))
+
+	for _, rule := range v.Rules {
+		var rt struct {
+			Type RuleType `json:"type"`
+		}
+		if err := json.Unmarshal(rule, &rt); err != nil {
+			return err
+		}
+		switch rt.Type {
+		case RuleTypeAlerting:
+			var ar AlertingRule
+			if err := json.Unmarshal(rule, &ar); err != nil {
+				return err
+			}
+			rg.Rules = append(rg.Rules, ar)
+		case RuleTypeRecording:
+			var rr RecordingRule
+			if err := json.Unmarshal(rule, &rr); err != nil {
+				return err
+			}
+			rg.Rules = append(rg.Rules, rr)
+		default:
+			return fmt.Errorf("unexpected rule type %q", rt.Type)
+		}
+	}
+	return nil
+}
+
+// SnapshotResult contains the result from creating a TSDB snapshot.
+type SnapshotResult struct {
+	Name string `json:"name"`
 }
 
 // queryResult contains result data for a query.
@@ -206,6 +394,113 @@ func (h *httpAPI) LabelValues(ctx context.Context, label string) (model.LabelVal
 	return labelValues, err
 }
 
+func (h *httpAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, error) {
+	u := h.client.URL(epSeries, nil)
+	q := u.Query()
+
+	for _, m := range matches {
+		q.Add("match[]", m)
+	}
+	q.Set("start", startTime.Format(time.RFC3339Nano))
+	q.Set("end", endTime.Format(time.RFC3339Nano))
+
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	_, body, err := h.client.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var mset []model.LabelSet
+	err = json.Unmarshal(body, &mset)
+	return mset, err
+}
+
+func (h *httpAPI) Targets(ctx context.Context) (TargetsResult, error) {
+	var res TargetsResult
+	err := h.get(ctx, epTargets, &res)
+	return res, err
+}
+
+func (h *httpAPI) Rules(ctx context.Context) (RulesResult, error) {
+	var res RulesResult
+	err := h.get(ctx, epRules, &res)
+	return res, err
+}
+
+func (h *httpAPI) Alerts(ctx context.Context) (AlertsResult, error) {
+	var res AlertsResult
+	err := h.get(ctx, epAlerts, &res)
+	return res, err
+}
+
+func (h *httpAPI) Snapshot(ctx context.Context, skipHead bool) (SnapshotResult, error) {
+	u := h.client.URL(epSnapshot, nil)
+	q := u.Query()
+	q.Set("skip_head", strconv.FormatBool(skipHead))
+	u.RawQuery = q.Encode()
+
+	var res SnapshotResult
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	if err != nil {
+		return res, err
+	}
+	_, body, err := h.client.Do(ctx, req)
+	if err != nil {
+		return res, err
+	}
+	err = json.Unmarshal(body, &res)
+	return res, err
+}
+
+func (h *httpAPI) DeleteSeries(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) error {
+	u := h.client.URL(epDeleteSeries, nil)
+	q := u.Query()
+
+	for _, m := range matches {
+		q.Add("match[]", m)
+	}
+	q.Set("start", startTime.Format(time.RFC3339Nano))
+	q.Set("end", endTime.Format(time.RFC3339Nano))
+
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	_, _, err = h.client.Do(ctx, req)
+	return err
+}
+
+func (h *httpAPI) CleanTombstones(ctx context.Context) error {
+	u := h.client.URL(epCleanTombstones, nil)
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	_, _, err = h.client.Do(ctx, req)
+	return err
+}
+
+// get performs a GET request against the provided endpoint and decodes the
+// response data into v.
+func (h *httpAPI) get(ctx context.Context, ep string, v interface{}) error {
+	u := h.client.URL(ep, nil)
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	_, body, err := h.client.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
 // apiClient wraps a regular client and processes successful API responses.
 // Successful also includes responses that errored at the API level.
 type apiClient struct {
@@ -112,6 +112,50 @@ func TestAPIs(t *testing.T) {
 		}
 	}
 
+	doSeries := func(matcher string, startTime time.Time, endTime time.Time) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			return queryAPI.Series(context.Background(), []string{matcher}, startTime, endTime)
+		}
+	}
+
+	doTargets := func() func() (interface{}, error) {
+		return func() (interface{}, error) {
+			return queryAPI.Targets(context.Background())
+		}
+	}
+
+	doRules := func() func() (interface{}, error) {
+		return func() (interface{}, error) {
+			return queryAPI.Rules(context.Background())
+		}
+	}
+
+	doAlerts := func() func() (interface{}, error) {
+		return func() (interface{}, error) {
+			return queryAPI.Alerts(context.Background())
+		}
+	}
+
+	doSnapshot := func(skipHead bool) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			return queryAPI.Snapshot(context.Background(), skipHead)
+		}
+	}
+
+	doDeleteSeries := func(matcher string, startTime time.Time, endTime time.Time) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			return nil, queryAPI.DeleteSeries(context.Background(), []string{matcher}, startTime, endTime)
+		}
+	}
+
+	doCleanTombstones := func() func() (interface{}, error) {
+		return func() (interface{}, error) {
+			return nil, queryAPI.CleanTombstones(context.Background())
+		}
+	}
+
+	fixedTime := time.Date(2017, 11, 23, 10, 20, 30, 0, time.UTC)
+
 	queryTests := []apiTest{
 		{
 			do: doQuery("2", testTime),
@@ -181,6 +225,291 @@ func TestAPIs(t *testing.T) {
 			reqPath:   "/api/v1/label/mylabel/values",
 			err:       fmt.Errorf("some error"),
 		},
+
+		{
+			do: doSeries("up", testTime.Add(-time.Minute), testTime),
+			inRes: []map[string]string{
+				{
+					"__name__": "up",
+					"job":      "prometheus",
+					"instance": "localhost:9090",
+				},
+			},
+			reqMethod: "GET",
+			reqPath:   "/api/v1/series",
+			res: []model.LabelSet{
+				{
+					"__name__": "up",
+					"job":      "prometheus",
+					"instance": "localhost:9090",
+				},
+			},
+		},
+
+		{
+			do:        doSeries("up", testTime.Add(-time.Minute), testTime),
+			inErr:     fmt.Errorf("some error"),
+			reqMethod: "GET",
+			reqPath:   "/api/v1/series",
+			err:       fmt.Errorf("some error"),
+		},
+
+		{
+			do: doTargets(),
+			inRes: map[string]interface{}{
+				"activeTargets": []map[string]interface{}{
+					{
+						"discoveredLabels": map[string]string{
+							"__address__": "127.0.0.1:9090",
+							"job":         "prometheus",
+						},
+						"labels": map[string]string{
+							"instance": "127.0.0.1:9090",
+							"job":      "prometheus",
+						},
+						"scrapeUrl":  "http://127.0.0.1:9090/metrics",
+						"lastError":  "error while scraping target",
+						"lastScrape": fixedTime.Format(time.RFC3339Nano),
+						"health":     "up",
+					},
+				},
+				"droppedTargets": []map[string]interface{}{
+					{
+						"discoveredLabels": map[string]string{
+							"__address__": "127.0.0.1:9100",
+							"job":         "node",
+						},
+					},
+				},
+			},
+			reqMethod: "GET",
+			reqPath:   "/api/v1/targets",
+			res: TargetsResult{
+				Active: []ActiveTarget{
+					{
+						DiscoveredLabels: map[string]string{
+							"__address__": "127.0.0.1:9090",
+							"job":         "prometheus",
+						},
+						Labels: model.LabelSet{
+							"instance": "127.0.0.1:9090",
+							"job":      "prometheus",
+						},
+						ScrapeURL:  "http://127.0.0.1:9090/metrics",
+						LastError:  "error while scraping target",
+						LastScrape: fixedTime,
+						Health:     HealthGood,
+					},
+				},
+				Dropped: []DroppedTarget{
+					{
+						DiscoveredLabels: map[string]string{
+							"__address__": "127.0.0.1:9100",
+							"job":         "node",
+						},
+					},
+				},
+			},
+		},
+
+		{
+			do: doRules(),
+			inRes: map[string]interface{}{
+				"groups": []map[string]interface{}{
+					{
+						"name":     "example",
+						"file":     "/rules.yaml",
+						"interval": 60,
+						"rules": []map[string]interface{}{
+							{
+								"type":     "alerting",
+								"name":     "HighRequestLatency",
+								"query":    "job:request_latency_seconds:mean5m{job=\"myjob\"} > 0.5",
+								"duration": 600,
+								"labels": map[string]string{
+									"severity": "page",
+								},
+								"annotations": map[string]string{
+									"summary": "High request latency",
+								},
+								"alerts": []map[string]interface{}{
+									{
+										"activeAt": fixedTime.Format(time.RFC3339Nano),
+										"labels": map[string]string{
+											"alertname": "HighRequestLatency",
+										},
+										"annotations": map[string]string{
+											"summary": "High request latency",
+										},
+										"state": "firing",
+										"value": "1e+00",
+									},
+								},
+								"health": "ok",
+							},
+							{
+								"type":   "recording",
+								"name":   "job:http_inprogress_requests:sum",
+								"query":  "sum(http_inprogress_requests) by (job)",
+								"health": "ok",
+							},
+						},
+					},
+				},
+			},
+			reqMethod: "GET",
+			reqPath:   "/api/v1/rules",
+			res: RulesResult{
+				Groups: []RuleGroup{
+					{
+						Name:     "example",
+						File:     "/rules.yaml",
+						Interval: 60,
+						Rules: []interface{}{
+							AlertingRule{
+								Name:     "HighRequestLatency",
+								Query:    "job:request_latency_seconds:mean5m{job=\"myjob\"} > 0.5",
+								Duration: 600,
+								Labels: model.LabelSet{
+									"severity": "page",
+								},
+								Annotations: model.LabelSet{
+									"summary": "High request latency",
+								},
+								Alerts: []Alert{
+									{
+										ActiveAt: fixedTime,
+										Labels: model.LabelSet{
+											"alertname": "HighRequestLatency",
+										},
+										Annotations: model.LabelSet{
+											"summary": "High request latency",
+										},
+										State: AlertStateFiring,
+										Value: "1e+00",
+									},
+								},
+								Health: RuleHealthGood,
+							},
+							RecordingRule{
+								Name:   "job:http_inprogress_requests:sum",
+								Query:  "sum(http_inprogress_requests) by (job)",
+								Health: RuleHealthGood,
+							},
+						},
+					},
+				},
+			},
+		},
+
+		{
+			do: doRules(),
+			inRes: map[string]interface{}{
+				"groups": []map[string]interface{}{
+					{
+						"name":  "example",
+						"rules": []map[string]interface{}{{"type": "bogus"}},
+					},
+				},
+			},
+			reqMethod: "GET",
+			reqPath:   "/api/v1/rules",
+			err:       fmt.Errorf(`unexpected rule type "bogus"`),
+		},
+
+		{
+			do: doAlerts(),
+			inRes: map[string]interface{}{
+				"alerts": []map[string]interface{}{
+					{
+						"activeAt": fixedTime.Format(time.RFC3339Nano),
+						"labels": map[string]string{
+							"alertname": "InstanceDown",
+						},
+						"state": "pending",
+						"value": "0e+00",
+					},
+				},
+			},
+			reqMethod: "GET",
+			reqPath:   "/api/v1/alerts",
+			res: AlertsResult{
+				Alerts: []Alert{
+					{
+						ActiveAt: fixedTime,
+						Labels: model.LabelSet{
+							"alertname": "InstanceDown",
+						},
+						State: AlertStatePending,
+						Value: "0e+00",
+					},
+				},
+			},
+		},
+
+		{
+			do:        doAlerts(),
+			inErr:     fmt.Errorf("some error"),
+			reqMethod: "GET",
+			reqPath:   "/api/v1/alerts",
+			err:       fmt.Errorf("some error"),
+		},
+
+		{
+			do: doSnapshot(true),
+			inRes: map[string]string{
+				"name": "20171210T211224Z-2be650b6d019eb54",
+			},
+			reqMethod: "POST",
+			reqPath:   "/api/v1/admin/tsdb/snapshot",
+			reqParam: url.Values{
+				"skip_head": []string{"true"},
+			},
+			res: SnapshotResult{
+				Name: "20171210T211224Z-2be650b6d019eb54",
+			},
+		},
+
+		{
+			do:        doSnapshot(false),
+			inErr:     fmt.Errorf("some error"),
+			reqMethod: "POST",
+			reqPath:   "/api/v1/admin/tsdb/snapshot",
+			err:       fmt.Errorf("some error"),
+		},
+
+		{
+			do:        doDeleteSeries("up", testTime.Add(-time.Minute), testTime),
+			reqMethod: "POST",
+			reqPath:   "/api/v1/admin/tsdb/delete_series",
+			reqParam: url.Values{
+				"match[]": []string{"up"},
+				"start":   []string{testTime.Add(-time.Minute).Format(time.RFC3339Nano)},
+				"end":     []string{testTime.Format(time.RFC3339Nano)},
+			},
+		},
+
+		{
+			do:        doDeleteSeries("up", testTime.Add(-time.Minute), testTime),
+			inErr:     fmt.Errorf("some error"),
+			reqMethod: "POST",
+			reqPath:   "/api/v1/admin/tsdb/delete_series",
+			err:       fmt.Errorf("some error"),
+		},
+
+		{
+			do:        doCleanTombstones(),
+			reqMethod: "POST",
+			reqPath:   "/api/v1/admin/tsdb/clean_tombstones",
+		},
+
+		{
+			do:        doCleanTombstones(),
+			inErr:     fmt.Errorf("some error"),
+			reqMethod: "POST",
+			reqPath:   "/api/v1/admin/tsdb/clean_tombstones",
+			err:       fmt.Errorf("some error"),
+		},
 	}
 
 	var tests []apiTest
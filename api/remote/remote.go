@@ -0,0 +1,248 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.7
+
+// Package remote provides a client that pushes metrics directly to an endpoint
+// implementing the receiving side of the Prometheus remote-write protocol (like
+// a Prometheus server with the remote-write receiver enabled or one of the
+// many long-term storage systems). It is meant for batch jobs and serverless
+// workloads that cannot be scraped but that should not use the Pushgateway.
+//
+// Note that pushing via remote write bypasses the usual Prometheus data model
+// to a certain extent: There is no target, and thus no "up" metric and no
+// automatic "job" and "instance" labels. Add identifying labels yourself,
+// e.g. by wrapping the Registerer with prometheus.WrapRegistererWith.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultMinBackoff = 30 * time.Millisecond
+	defaultMaxBackoff = 5 * time.Second
+)
+
+// Config defines configuration parameters for a new Client.
+type Config struct {
+	// Address is the URL of the remote-write endpoint, e.g.
+	// "http://prometheus:9090/api/v1/write".
+	Address string
+
+	// RoundTripper is used by the Client to drive HTTP requests. If not
+	// provided, api.DefaultRoundTripper is used.
+	RoundTripper http.RoundTripper
+
+	// MaxRetries is the maximum number of times a failed push is retried.
+	// Pushes are only retried if they have failed because of a network
+	// error or an HTTP status code of 429 or 5xx. Zero means no retries.
+	MaxRetries int
+	// MinBackoff is the time to wait before the first retry. It is doubled
+	// for each further retry up to MaxBackoff. The defaults are 30ms and
+	// 5s, respectively.
+	MinBackoff, MaxBackoff time.Duration
+}
+
+// Client pushes metrics to a remote-write endpoint. Create instances with
+// NewClient. It is safe to use a Client from multiple goroutines.
+type Client struct {
+	url                    string
+	client                 http.Client
+	maxRetries             int
+	minBackoff, maxBackoff time.Duration
+}
+
+// NewClient returns a new Client for the provided Config.
+func NewClient(cfg Config) (*Client, error) {
+	if _, err := url.Parse(cfg.Address); err != nil {
+		return nil, err
+	}
+	rt := cfg.RoundTripper
+	if rt == nil {
+		rt = api.DefaultRoundTripper
+	}
+	c := &Client{
+		url:        cfg.Address,
+		client:     http.Client{Transport: rt},
+		maxRetries: cfg.MaxRetries,
+		minBackoff: cfg.MinBackoff,
+		maxBackoff: cfg.MaxBackoff,
+	}
+	if c.minBackoff <= 0 {
+		c.minBackoff = defaultMinBackoff
+	}
+	if c.maxBackoff <= 0 {
+		c.maxBackoff = defaultMaxBackoff
+	}
+	return c, nil
+}
+
+// Push gathers from the provided Gatherer and pushes the result to the
+// remote-write endpoint, see PushMetricFamilies.
+func (c *Client) Push(ctx context.Context, g prometheus.Gatherer) error {
+	mfs, err := g.Gather()
+	if err != nil {
+		return fmt.Errorf("gathering metrics failed: %s", err)
+	}
+	return c.PushMetricFamilies(ctx, mfs)
+}
+
+// PushMetricFamilies converts the provided MetricFamilies into remote-write
+// samples and pushes them to the remote-write endpoint, retrying as
+// configured. Histograms and summaries are broken down into their individual
+// series (buckets, quantiles, sum, and count) as in the text exposition
+// format. Samples without an explicit timestamp get the current time as their
+// timestamp.
+func (c *Client) PushMetricFamilies(ctx context.Context, mfs []*dto.MetricFamily) error {
+	samples, err := expfmt.ExtractSamples(
+		&expfmt.DecodeOptions{Timestamp: model.Now()}, mfs...,
+	)
+	if err != nil {
+		return fmt.Errorf("converting metrics failed: %s", err)
+	}
+	data, err := proto.Marshal(toWriteRequest(samples))
+	if err != nil {
+		return fmt.Errorf("encoding metrics failed: %s", err)
+	}
+	body := snappyEncode(data)
+
+	backoff := c.minBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := c.send(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= c.maxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// send sends the provided request body once. It returns whether it makes sense
+// to retry in case of an error.
+func (c *Client) send(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("unexpected status code %d while pushing to %s: %s", resp.StatusCode, c.url, msg)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5, err
+}
+
+// The following types mirror the messages of the remote-write protocol as
+// defined in prompb/remote.proto and prompb/types.proto of the Prometheus
+// server. They are marshaled via reflection on their struct tags.
+
+type writeRequest struct {
+	Timeseries []*timeSeries `protobuf:"bytes,1,rep,name=timeseries,proto3"`
+}
+
+func (m *writeRequest) Reset()         { *m = writeRequest{} }
+func (m *writeRequest) String() string { return proto.CompactTextString(m) }
+func (*writeRequest) ProtoMessage()    {}
+
+type timeSeries struct {
+	Labels  []*label  `protobuf:"bytes,1,rep,name=labels,proto3"`
+	Samples []*sample `protobuf:"bytes,2,rep,name=samples,proto3"`
+}
+
+func (m *timeSeries) Reset()         { *m = timeSeries{} }
+func (m *timeSeries) String() string { return proto.CompactTextString(m) }
+func (*timeSeries) ProtoMessage()    {}
+
+type label struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *label) Reset()         { *m = label{} }
+func (m *label) String() string { return proto.CompactTextString(m) }
+func (*label) ProtoMessage()    {}
+
+type sample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3"`
+}
+
+func (m *sample) Reset()         { *m = sample{} }
+func (m *sample) String() string { return proto.CompactTextString(m) }
+func (*sample) ProtoMessage()    {}
+
+// toWriteRequest converts the provided samples into a writeRequest with one
+// time series per sample. The labels of each time series are sorted by name,
+// as required by the protocol.
+func toWriteRequest(samples model.Vector) *writeRequest {
+	req := &writeRequest{Timeseries: make([]*timeSeries, 0, len(samples))}
+	for _, s := range samples {
+		names := make([]string, 0, len(s.Metric))
+		for name := range s.Metric {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+		ts := &timeSeries{
+			Labels: make([]*label, 0, len(names)),
+			Samples: []*sample{{
+				Value:     float64(s.Value),
+				Timestamp: int64(s.Timestamp),
+			}},
+		}
+		for _, name := range names {
+			ts.Labels = append(ts.Labels, &label{
+				Name:  name,
+				Value: string(s.Metric[model.LabelName(name)]),
+			})
+		}
+		req.Timeseries = append(req.Timeseries, ts)
+	}
+	return req
+}
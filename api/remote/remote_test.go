@@ -0,0 +1,157 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.7
+
+package remote
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// testReceiver is a remote-write endpoint that answers with the status codes
+// in codes (one per request, the last one repeatedly) and records the
+// received write requests.
+type testReceiver struct {
+	t     *testing.T
+	mtx   sync.Mutex
+	codes []int
+	reqs  []*writeRequest
+}
+
+func (r *testReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if got, want := req.Header.Get("Content-Encoding"), "snappy"; got != want {
+		r.t.Errorf("got Content-Encoding %q, want %q", got, want)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	data, err := snappyDecode(body)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	wr := &writeRequest{}
+	if err := proto.Unmarshal(data, wr); err != nil {
+		r.t.Fatal(err)
+	}
+	r.reqs = append(r.reqs, wr)
+
+	code := r.codes[0]
+	if len(r.codes) > 1 {
+		r.codes = r.codes[1:]
+	}
+	w.WriteHeader(code)
+}
+
+func TestPush(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "jobs_total", Help: "help"},
+		[]string{"zone", "app"},
+	)
+	reg.MustRegister(c)
+	c.WithLabelValues("eu", "batch").Add(3)
+
+	receiver := &testReceiver{t: t, codes: []int{http.StatusNoContent}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	client, err := NewClient(Config{Address: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	if err := client.Push(context.Background(), reg); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(receiver.reqs), 1; got != want {
+		t.Fatalf("got %d requests, want %d", got, want)
+	}
+	series := receiver.reqs[0].Timeseries
+	if got, want := len(series), 1; got != want {
+		t.Fatalf("got %d time series, want %d", got, want)
+	}
+	var names []string
+	for _, l := range series[0].Labels {
+		names = append(names, l.Name+"="+l.Value)
+	}
+	wantNames := []string{"__name__=jobs_total", "app=batch", "zone=eu"}
+	if len(names) != len(wantNames) {
+		t.Fatalf("got labels %v, want %v", names, wantNames)
+	}
+	for i := range names {
+		if names[i] != wantNames[i] {
+			t.Errorf("got labels %v, want %v", names, wantNames)
+			break
+		}
+	}
+	s := series[0].Samples[0]
+	if got, want := s.Value, 3.0; got != want {
+		t.Errorf("got value %v, want %v", got, want)
+	}
+	if min := before.UnixNano() / int64(time.Millisecond); s.Timestamp < min {
+		t.Errorf("got timestamp %d, want at least %d", s.Timestamp, min)
+	}
+}
+
+func TestPushRetries(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "g", Help: "help"}))
+
+	scenarios := []struct {
+		codes        []int
+		maxRetries   int
+		wantErr      bool
+		wantRequests int
+	}{
+		{codes: []int{500, 429, 200}, maxRetries: 2, wantErr: false, wantRequests: 3},
+		{codes: []int{500, 500, 200}, maxRetries: 1, wantErr: true, wantRequests: 2},
+		{codes: []int{400, 200}, maxRetries: 3, wantErr: true, wantRequests: 1},
+		{codes: []int{503}, maxRetries: 0, wantErr: true, wantRequests: 1},
+	}
+	for i, s := range scenarios {
+		receiver := &testReceiver{t: t, codes: s.codes}
+		server := httptest.NewServer(receiver)
+		client, err := NewClient(Config{
+			Address:    server.URL,
+			MaxRetries: s.maxRetries,
+			MinBackoff: time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.Push(context.Background(), reg)
+		if gotErr := err != nil; gotErr != s.wantErr {
+			t.Errorf("%d. got error %v, want error %t", i, err, s.wantErr)
+		}
+		if got := len(receiver.reqs); got != s.wantRequests {
+			t.Errorf("%d. got %d requests, want %d", i, got, s.wantRequests)
+		}
+		server.Close()
+	}
+}
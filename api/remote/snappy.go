@@ -0,0 +1,96 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import "encoding/binary"
+
+// This file implements a simple encoder for the snappy block format (see
+// https://github.com/google/snappy/blob/master/format_description.txt), which
+// is the compression mandated by the remote-write protocol. It only emits
+// literals and copies with 2-byte offsets, which every snappy decoder
+// understands. It compresses less well than the reference implementation, but
+// it avoids an additional dependency.
+
+const (
+	snappyMinMatch  = 4
+	snappyMaxOffset = 1<<16 - 1
+	snappyMaxCopy   = 64
+	snappyTableBits = 14
+)
+
+// snappyEncode returns the provided data encoded in the snappy block format.
+func snappyEncode(src []byte) []byte {
+	dst := make([]byte, binary.MaxVarintLen64, len(src)/2+binary.MaxVarintLen64)
+	dst = dst[:binary.PutUvarint(dst, uint64(len(src)))]
+
+	var (
+		table [1 << snappyTableBits]int // Positions in src plus one.
+		lit   int                       // Start of the pending literal.
+		i     int
+	)
+	for i+snappyMinMatch <= len(src) {
+		cur := binary.LittleEndian.Uint32(src[i:])
+		h := (cur * 0x1e35a7bd) >> (32 - snappyTableBits)
+		cand := table[h] - 1
+		table[h] = i + 1
+		if cand < 0 || i-cand > snappyMaxOffset || binary.LittleEndian.Uint32(src[cand:]) != cur {
+			i++
+			continue
+		}
+		length := snappyMinMatch
+		for i+length < len(src) && src[cand+length] == src[i+length] {
+			length++
+		}
+		dst = snappyEmitLiteral(dst, src[lit:i])
+		dst = snappyEmitCopy(dst, i-cand, length)
+		i += length
+		lit = i
+	}
+	return snappyEmitLiteral(dst, src[lit:])
+}
+
+// snappyEmitLiteral appends the provided literal to dst.
+func snappyEmitLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// snappyEmitCopy appends copies of the provided length from the provided
+// offset to dst.
+func snappyEmitCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		n := length
+		if n > snappyMaxCopy {
+			n = snappyMaxCopy
+		}
+		dst = append(dst, byte(n-1)<<2|2, byte(offset), byte(offset>>8))
+		length -= n
+	}
+	return dst
+}
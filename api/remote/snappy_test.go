@@ -0,0 +1,183 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// snappyDecode decodes data in the snappy block format. It is only meant for
+// testing and does not guard against malformed input.
+func snappyDecode(src []byte) ([]byte, error) {
+	n, l := binary.Uvarint(src)
+	if l <= 0 {
+		return nil, errors.New("invalid length")
+	}
+	src = src[l:]
+	dst := make([]byte, 0, n)
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 3 {
+		case 0:
+			length := int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				extra := length - 59
+				length = 0
+				for i := 0; i < extra; i++ {
+					length |= int(src[i]) << (8 * uint(i))
+				}
+				src = src[extra:]
+			}
+			length++
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+		default:
+			var length, offset int
+			switch tag & 3 {
+			case 1:
+				length = int(tag>>2&7) + 4
+				offset = int(tag>>5)<<8 | int(src[1])
+				src = src[2:]
+			case 2:
+				length = int(tag>>2) + 1
+				offset = int(binary.LittleEndian.Uint16(src[1:]))
+				src = src[3:]
+			case 3:
+				length = int(tag>>2) + 1
+				offset = int(binary.LittleEndian.Uint32(src[1:]))
+				src = src[5:]
+			}
+			if offset == 0 || offset > len(dst) {
+				return nil, errors.New("invalid offset")
+			}
+			for i := 0; i < length; i++ {
+				dst = append(dst, dst[len(dst)-offset])
+			}
+		}
+	}
+	if uint64(len(dst)) != n {
+		return nil, errors.New("length mismatch")
+	}
+	return dst, nil
+}
+
+func TestSnappyEncode(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(42)).Read(random)
+
+	inputs := [][]byte{
+		nil,
+		[]byte("a"),
+		[]byte("abcd"),
+		[]byte(strings.Repeat("a", 1000)),
+		[]byte(strings.Repeat(`http_requests_total{code="200",method="get"} 42`, 500)),
+		random,
+	}
+	for i, in := range inputs {
+		enc := snappyEncode(in)
+		dec, err := snappyDecode(enc)
+		if err != nil {
+			t.Errorf("%d. decoding failed: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(dec, in) {
+			t.Errorf("%d. round trip changed the data", i)
+		}
+	}
+
+	repetitive := inputs[4]
+	if got, limit := len(snappyEncode(repetitive)), len(repetitive)/10; got > limit {
+		t.Errorf("got %d bytes for repetitive input of %d bytes, want at most %d", got, len(repetitive), limit)
+	}
+}
+
+// TestSnappyGoldenVectors checks snappyDecode and snappyEncode against the
+// reference implementation. The ref vectors have been created with Encode of
+// github.com/golang/snappy v0.0.4, and the enc vectors have been verified to
+// decode to the respective input with Decode of the same package.
+func TestSnappyGoldenVectors(t *testing.T) {
+	vectors := []struct {
+		in, ref, enc string
+	}{
+		{
+			in:  "",
+			ref: "\x00",
+			enc: "\x00",
+		},
+		{
+			in:  "a",
+			ref: "\x01\x00\x61",
+			enc: "\x01\x00\x61",
+		},
+		{
+			in:  strings.Repeat("a", 100),
+			ref: "\x64\x00\x61\xfe\x01\x00\x8a\x01\x00",
+			enc: "\x64\x00\x61\xfe\x01\x00\x8a\x01\x00",
+		},
+		{
+			in:  strings.Repeat("abc", 30),
+			ref: "\x5a\x08\x61\x62\x63\xfe\x03\x00\x5a\x03\x00",
+			enc: "\x5a\x08\x61\x62\x63\xfe\x03\x00\x5a\x03\x00",
+		},
+		{
+			in: "foo_total 1\nfoo_total 2\n",
+			ref: "\x18\x5c\x66\x6f\x6f\x5f\x74\x6f\x74\x61\x6c\x20\x31\x0a\x66\x6f" +
+				"\x6f\x5f\x74\x6f\x74\x61\x6c\x20\x32\x0a",
+			enc: "\x18\x2c\x66\x6f\x6f\x5f\x74\x6f\x74\x61\x6c\x20\x31\x0a\x26\x0c" +
+				"\x00\x04\x32\x0a",
+		},
+		{
+			in: "the quick brown fox jumps over the lazy dog, " +
+				"the lazy dog sleeps, the quick fox runs",
+			ref: "\x54\x78\x74\x68\x65\x20\x71\x75\x69\x63\x6b\x20\x62\x72\x6f\x77" +
+				"\x6e\x20\x66\x6f\x78\x20\x6a\x75\x6d\x70\x73\x20\x6f\x76\x65\x72" +
+				"\x20\x01\x1f\x20\x6c\x61\x7a\x79\x20\x64\x6f\x67\x2c\x32\x0e\x00" +
+				"\x18\x20\x73\x6c\x65\x65\x70\x73\x09\x15\x34\x71\x75\x69\x63\x6b" +
+				"\x20\x66\x6f\x78\x20\x72\x75\x6e\x73",
+			enc: "\x54\x78\x74\x68\x65\x20\x71\x75\x69\x63\x6b\x20\x62\x72\x6f\x77" +
+				"\x6e\x20\x66\x6f\x78\x20\x6a\x75\x6d\x70\x73\x20\x6f\x76\x65\x72" +
+				"\x20\x0e\x1f\x00\x20\x6c\x61\x7a\x79\x20\x64\x6f\x67\x2c\x32\x0e" +
+				"\x00\x18\x20\x73\x6c\x65\x65\x70\x73\x16\x15\x00\x16\x42\x00\x0e" +
+				"\x3c\x00\x0c\x72\x75\x6e\x73",
+		},
+		{
+			in: "http_requests_total{code=\"200\"} 1\n" +
+				"http_requests_total{code=\"500\"} 2\n",
+			ref: "\x44\x88\x68\x74\x74\x70\x5f\x72\x65\x71\x75\x65\x73\x74\x73\x5f" +
+				"\x74\x6f\x74\x61\x6c\x7b\x63\x6f\x64\x65\x3d\x22\x32\x30\x30\x22" +
+				"\x7d\x20\x31\x0a\x68\x62\x22\x00\x1c\x35\x30\x30\x22\x7d\x20\x32" +
+				"\x0a",
+			enc: "\x44\x84\x68\x74\x74\x70\x5f\x72\x65\x71\x75\x65\x73\x74\x73\x5f" +
+				"\x74\x6f\x74\x61\x6c\x7b\x63\x6f\x64\x65\x3d\x22\x32\x30\x30\x22" +
+				"\x7d\x20\x31\x0a\x66\x22\x00\x00\x35\x12\x22\x00\x04\x32\x0a",
+		},
+	}
+	for i, v := range vectors {
+		dec, err := snappyDecode([]byte(v.ref))
+		if err != nil {
+			t.Errorf("%d. decoding reference vector failed: %s", i, err)
+		} else if string(dec) != v.in {
+			t.Errorf("%d. decoding reference vector: got %q, want %q", i, dec, v.in)
+		}
+		if got := string(snappyEncode([]byte(v.in))); got != v.enc {
+			t.Errorf("%d. encoding: got %q, want %q", i, got, v.enc)
+		}
+	}
+}
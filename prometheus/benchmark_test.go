@@ -56,6 +56,25 @@ func BenchmarkCounterWithLabelValuesConcurrent(b *testing.B) {
 	wg.Wait()
 }
 
+func BenchmarkCounterWithPreparedLabelValues(b *testing.B) {
+	m := NewCounterVec(
+		CounterOpts{
+			Name: "benchmark_counter",
+			Help: "A counter to benchmark it.",
+		},
+		[]string{"one", "two", "three"},
+	)
+	p, err := m.PrepareLabelValues("eins", "zwei", "drei")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.WithPreparedLabelValues(p).Inc()
+	}
+}
+
 func BenchmarkCounterWithMappedLabels(b *testing.B) {
 	m := NewCounterVec(
 		CounterOpts{
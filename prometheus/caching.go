@@ -0,0 +1,142 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// CachingGathererOpts configures a CachingGatherer.
+type CachingGathererOpts struct {
+	// MaxAge is the duration after which the cached result of the wrapped
+	// Gatherer is considered stale. A Gather call encountering a stale
+	// result gathers from the wrapped Gatherer again. If MaxAge is zero,
+	// the cached result never becomes stale, i.e. the wrapped Gatherer is
+	// only called upon the first Gather call and upon each call of
+	// Refresh.
+	MaxAge time.Duration
+	// Clock is used to tell the age of the cached result. The default value
+	// is the DefaultClock at creation time of the CachingGatherer.
+	Clock Clock
+}
+
+// CachingGatherer is a Gatherer that wraps another Gatherer and caches its
+// result, i.e. the MetricFamilies and the error returned by it. It is meant for
+// exporters with a very large number of metrics (or with expensive
+// Collectors), which would otherwise collect everything anew upon each scrape,
+// possibly from multiple Prometheus servers.
+//
+// The cached result is refreshed by the first Gather call after the result has
+// become older than the configured MaxAge or by calling Refresh (e.g. from a
+// goroutine on a fixed interval, which takes the cost of collection off the
+// scrape path). Only one call of the wrapped Gatherer happens at a time.
+// Concurrent Gather calls requiring a refresh wait for it and all return the
+// refreshed result.
+//
+// The MetricFamilies returned by Gather are shared between all callers until
+// the next refresh. They must therefore not be modified.
+//
+// Use NewCachingGatherer to create instances.
+type CachingGatherer struct {
+	gatherer Gatherer
+	maxAge   time.Duration
+	clock    Clock
+
+	refreshMtx sync.Mutex // Serializes calls of the wrapped Gatherer.
+
+	mtx    sync.RWMutex // Protects result.
+	result *gatherResult
+}
+
+// gatherResult is the result of one call of the wrapped Gatherer.
+type gatherResult struct {
+	mfs      []*dto.MetricFamily
+	err      error
+	gathered time.Time
+}
+
+// NewCachingGatherer returns a CachingGatherer wrapping the provided Gatherer.
+// The wrapped Gatherer is not called before the first call of Gather or
+// Refresh.
+func NewCachingGatherer(g Gatherer, opts CachingGathererOpts) *CachingGatherer {
+	if opts.Clock == nil {
+		opts.Clock = DefaultClock()
+	}
+	return &CachingGatherer{
+		gatherer: g,
+		maxAge:   opts.MaxAge,
+		clock:    opts.Clock,
+	}
+}
+
+// Gather implements Gatherer. It returns the cached result of the wrapped
+// Gatherer, which is refreshed first if there is none yet or if it is stale.
+func (cg *CachingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	if r := cg.fresh(); r != nil {
+		return r.mfs, r.err
+	}
+
+	cg.refreshMtx.Lock()
+	defer cg.refreshMtx.Unlock()
+	// Another goroutine might have refreshed in the meantime.
+	if r := cg.fresh(); r != nil {
+		return r.mfs, r.err
+	}
+	r := cg.refresh()
+	return r.mfs, r.err
+}
+
+// Refresh gathers from the wrapped Gatherer and caches the result, regardless
+// of the age of the currently cached result. It returns the error returned by
+// the wrapped Gatherer.
+func (cg *CachingGatherer) Refresh() error {
+	cg.refreshMtx.Lock()
+	defer cg.refreshMtx.Unlock()
+	return cg.refresh().err
+}
+
+// fresh returns the cached result if it exists and is not stale. Otherwise, it
+// returns nil.
+func (cg *CachingGatherer) fresh() *gatherResult {
+	cg.mtx.RLock()
+	r := cg.result
+	cg.mtx.RUnlock()
+
+	if r == nil {
+		return nil
+	}
+	if cg.maxAge > 0 && cg.clock.Now().Sub(r.gathered) >= cg.maxAge {
+		return nil
+	}
+	return r
+}
+
+// refresh calls the wrapped Gatherer and caches the result. Must be called
+// with refreshMtx held.
+func (cg *CachingGatherer) refresh() *gatherResult {
+	mfs, err := cg.gatherer.Gather()
+	r := &gatherResult{
+		mfs:      mfs,
+		err:      err,
+		gathered: cg.clock.Now(),
+	}
+
+	cg.mtx.Lock()
+	cg.result = r
+	cg.mtx.Unlock()
+	return r
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCachingGatherer(t *testing.T) {
+	var (
+		now     = time.Unix(1000, 0)
+		calls   int
+		errGath = errors.New("gather error")
+		retErr  error
+		g       = GathererFunc(func() ([]*dto.MetricFamily, error) {
+			calls++
+			return []*dto.MetricFamily{}, retErr
+		})
+		cg = NewCachingGatherer(g, CachingGathererOpts{
+			MaxAge: time.Minute,
+			Clock:  ClockFunc(func() time.Time { return now }),
+		})
+	)
+
+	gather := func(wantCalls int, wantErr error) {
+		if _, err := cg.Gather(); err != wantErr {
+			t.Errorf("got error %v, want %v", err, wantErr)
+		}
+		if calls != wantCalls {
+			t.Errorf("got %d calls of the wrapped Gatherer, want %d", calls, wantCalls)
+		}
+	}
+
+	if calls != 0 {
+		t.Errorf("wrapped Gatherer called upon creation")
+	}
+	gather(1, nil)
+	now = now.Add(30 * time.Second)
+	gather(1, nil)
+	now = now.Add(30 * time.Second)
+	gather(2, nil)
+
+	// Errors are cached, too.
+	retErr = errGath
+	if err := cg.Refresh(); err != errGath {
+		t.Errorf("got error %v from Refresh, want %v", err, errGath)
+	}
+	gather(3, errGath)
+	retErr = nil
+	gather(3, errGath)
+	now = now.Add(time.Minute)
+	gather(4, nil)
+}
+
+func TestCachingGathererConcurrency(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		calls int
+		g     = GathererFunc(func() ([]*dto.MetricFamily, error) {
+			mtx.Lock()
+			calls++
+			mtx.Unlock()
+			return nil, nil
+		})
+		cg = NewCachingGatherer(g, CachingGathererOpts{})
+		wg sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cg.Gather()
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("got %d calls of the wrapped Gatherer, want 1", calls)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the interface that wraps the Now method. It is used by the
+// time-based functionality of this package (like Timer, the age buckets of a
+// Summary, or Gauge.SetToCurrentTime) to tell the current time. Outside of
+// tests, there is usually no need to use anything but the DefaultClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// The ClockFunc type is an adapter to allow the use of ordinary functions as
+// Clocks. If f is a function with the appropriate signature, ClockFunc(f) is a
+// Clock that calls f.
+type ClockFunc func() time.Time
+
+// Now calls f(). It implements Clock.
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// defaultClock holds the DefaultClock wrapped in a clockHolder, as an
+// atomic.Value requires all stored values to be of the same concrete type.
+var defaultClock atomic.Value
+
+// clockHolder wraps a Clock to be stored in defaultClock.
+type clockHolder struct {
+	Clock
+}
+
+func init() {
+	defaultClock.Store(clockHolder{realClock{}})
+}
+
+// DefaultClock returns the Clock used by the time-based functionality of this
+// package if no Clock is provided explicitly. Initially, it is the real-time
+// clock (i.e. it returns time.Now()).
+//
+// Timers and Summaries pick up the DefaultClock upon creation, while
+// Gauge.SetToCurrentTime uses the DefaultClock at the time it is called.
+func DefaultClock() Clock {
+	return defaultClock.Load().(clockHolder).Clock
+}
+
+// SetDefaultClock replaces the DefaultClock with the provided Clock. It is
+// meant to be used in tests to make time-based metrics deterministic. It is
+// safe to call concurrently with the use of metrics, but metrics created before
+// keep the Clock they have picked up upon creation (see DefaultClock).
+// SetDefaultClock panics if c is nil.
+func SetDefaultClock(c Clock) {
+	if c == nil {
+		panic("nil Clock")
+	}
+	defaultClock.Store(clockHolder{c})
+}
+
+// realClock is a Clock that tells the real time.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
@@ -13,6 +13,8 @@
 
 package prometheus
 
+import "context"
+
 // Collector is the interface implemented by anything that can be used by
 // Prometheus to collect metrics. A Collector has to be registered for
 // collection. See Registerer.Register.
@@ -50,6 +52,22 @@ type Collector interface {
 	Collect(chan<- Metric)
 }
 
+// ContextCollector is a Collector that takes into account the Context of a
+// gathering, e.g. to stop collecting once the deadline of a scrape has passed
+// (see promhttp.HandlerOpts.ScrapeTimeoutOffset). A Registry calls
+// CollectWithContext instead of Collect, passing in the Context provided to
+// GatherWithContext (or context.Background() in case of Gather), possibly with
+// a shorter deadline if a collector timeout is configured (see
+// WithCollectorTimeout). The Collect method is still used by anything unaware
+// of ContextCollectors (including the wrappers created with WrapRegistererWith
+// and WrapRegistererWithPrefix).
+type ContextCollector interface {
+	Collector
+	// CollectWithContext works like Collect but additionally receives the
+	// Context of the gathering.
+	CollectWithContext(ctx context.Context, ch chan<- Metric)
+}
+
 // selfCollector implements Collector for a single Metric so that the Metric
 // collects itself. Add it as an anonymous field to a struct that implements
 // Metric, and call init with the Metric itself as an argument.
@@ -0,0 +1,58 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// buildInfoLabels are the label names of the go_build_info metric, in the
+// order of the values returned by readBuildInfo.
+var buildInfoLabels = []string{"path", "version", "checksum", "vcs_revision", "vcs_time", "vcs_modified"}
+
+type buildInfoCollector struct {
+	desc   *prometheus.Desc
+	metric prometheus.Metric
+}
+
+// NewBuildInfoCollector returns a Collector that exports a go_build_info
+// metric with a constant value of 1, labeled with the main module path,
+// version, and checksum as well as the VCS revision, commit time, and
+// modification state the binary was built from. The information is read once,
+// upon creation of the Collector, from the build information embedded into the
+// binary.
+//
+// The information is only read with Go1.18 or later, which is the first
+// version to embed VCS information. Labels for information not available (e.g.
+// the VCS labels of a binary built outside of a repository, or all labels with
+// earlier Go versions) are set to "unknown".
+func NewBuildInfoCollector() prometheus.Collector {
+	desc := prometheus.NewDesc(
+		"go_build_info",
+		"Build information about the main Go module.",
+		buildInfoLabels, nil,
+	)
+	return &buildInfoCollector{
+		desc:   desc,
+		metric: prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, readBuildInfo()...),
+	}
+}
+
+// Describe implements Collector.
+func (c *buildInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements Collector.
+func (c *buildInfoCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- c.metric
+}
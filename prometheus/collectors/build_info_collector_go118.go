@@ -0,0 +1,49 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.18
+
+package collectors
+
+import "runtime/debug"
+
+// readBuildInfo returns the values of the labels in buildInfoLabels.
+func readBuildInfo() []string {
+	path, version, sum := "unknown", "unknown", "unknown"
+	revision, time, modified := "unknown", "unknown", "unknown"
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return []string{path, version, sum, revision, time, modified}
+	}
+	if bi.Main.Path != "" {
+		path = bi.Main.Path
+	}
+	if bi.Main.Version != "" {
+		version = bi.Main.Version
+	}
+	if bi.Main.Sum != "" {
+		sum = bi.Main.Sum
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.time":
+			time = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+	return []string{path, version, sum, revision, time, modified}
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.11
+
+package collectors
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDBStatsCollector(t *testing.T) {
+	stats := sql.DBStats{
+		MaxOpenConnections: 10,
+		OpenConnections:    3,
+		InUse:              2,
+		Idle:               1,
+		WaitCount:          5,
+		WaitDuration:       1500 * time.Millisecond,
+		MaxIdleClosed:      4,
+		MaxLifetimeClosed:  6,
+	}
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(
+		NewDBStatsCollectorFunc(func() sql.DBStats { return stats }, "db_A"),
+		NewDBStatsCollectorFunc(func() sql.DBStats { return sql.DBStats{} }, "db_B"),
+	)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"go_sql_max_open_connections":        10,
+		"go_sql_open_connections":            3,
+		"go_sql_in_use_connections":          2,
+		"go_sql_idle_connections":            1,
+		"go_sql_wait_count_total":            5,
+		"go_sql_wait_duration_seconds_total": 1.5,
+		"go_sql_max_idle_closed_total":       4,
+		"go_sql_max_lifetime_closed_total":   6,
+	}
+	for _, mf := range mfs {
+		if len(mf.GetMetric()) != 2 {
+			t.Errorf("%s: got %d metrics, want 2", mf.GetName(), len(mf.GetMetric()))
+			continue
+		}
+		wantValue, ok := want[mf.GetName()]
+		if !ok {
+			continue
+		}
+		delete(want, mf.GetName())
+		m := mf.GetMetric()[0]
+		if got := m.GetLabel()[0].GetValue(); got != "db_A" {
+			t.Errorf("%s: got db_name %q, want %q", mf.GetName(), got, "db_A")
+		}
+		got := m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		if got != wantValue {
+			t.Errorf("%s: got %v, want %v", mf.GetName(), got, wantValue)
+		}
+	}
+	for name := range want {
+		t.Errorf("metric %s missing", name)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import "regexp"
+
+// GoRuntimeMetricsRule selects metrics provided by the runtime/metrics package
+// for collection by the Collector returned by NewGoCollector.
+type GoRuntimeMetricsRule struct {
+	// Matcher is matched against the runtime/metrics name of a metric,
+	// e.g. "/sched/latencies:seconds".
+	Matcher *regexp.Regexp
+}
+
+// Predefined GoRuntimeMetricsRules for use with
+// WithGoCollectorRuntimeMetrics.
+var (
+	// MetricsAll selects all metrics provided by runtime/metrics.
+	MetricsAll = GoRuntimeMetricsRule{regexp.MustCompile("/.*")}
+	// MetricsGC selects the garbage collector metrics, including the
+	// histogram of GC pause latencies.
+	MetricsGC = GoRuntimeMetricsRule{regexp.MustCompile(`^/gc/.*`)}
+	// MetricsMemory selects the memory metrics, in particular the
+	// breakdown of the memory used by the Go runtime into classes.
+	MetricsMemory = GoRuntimeMetricsRule{regexp.MustCompile(`^/memory/classes/.*`)}
+	// MetricsScheduler selects the scheduler metrics, including the
+	// histogram of scheduling latencies of goroutines.
+	MetricsScheduler = GoRuntimeMetricsRule{regexp.MustCompile(`^/sched/.*`)}
+)
+
+// GoCollectionOption configures the Collector returned by NewGoCollector.
+type GoCollectionOption func(*goOptions)
+
+type goOptions struct {
+	runtimeMetricsRules []GoRuntimeMetricsRule
+}
+
+// WithGoCollectorRuntimeMetrics returns a GoCollectionOption that makes the
+// Collector additionally expose all metrics provided by the runtime/metrics
+// package whose names match any of the provided rules. The option can be
+// given repeatedly, in which case the rules are combined.
+//
+// The runtime/metrics package requires Go1.16 or later. With earlier Go
+// versions, the option has no effect.
+func WithGoCollectorRuntimeMetrics(rules ...GoRuntimeMetricsRule) GoCollectionOption {
+	return func(o *goOptions) {
+		o.runtimeMetricsRules = append(o.runtimeMetricsRules, rules...)
+	}
+}
+
+// matches returns whether the provided runtime/metrics name matches any of
+// the configured rules.
+func (o *goOptions) matches(name string) bool {
+	for _, r := range o.runtimeMetricsRules {
+		if r.Matcher.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
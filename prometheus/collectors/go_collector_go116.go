@@ -0,0 +1,163 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.16
+
+package collectors
+
+import (
+	"math"
+	"runtime/metrics"
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type goCollector struct {
+	base prometheus.Collector
+
+	// samples, descs, and kinds are indexed in parallel. samples is only
+	// used as a template, as Collect may be called concurrently.
+	samples []metrics.Sample
+	descs   []*prometheus.Desc
+	kinds   []prometheus.ValueType
+}
+
+// NewGoCollector returns a Collector which exports metrics about the current
+// Go process. Without options, it exports the same metrics as
+// prometheus.NewGoCollector. With WithGoCollectorRuntimeMetrics, it
+// additionally exports the selected metrics of the runtime/metrics package,
+// e.g. the histograms of scheduler and GC pause latencies.
+//
+// The name of a metric from runtime/metrics is derived from its name in
+// runtime/metrics by prefixing it with "go", replacing all characters invalid
+// in a metric name with underscores, and appending the unit, e.g.
+// "/sched/latencies:seconds" becomes "go_sched_latencies_seconds". Cumulative
+// metrics are exposed as counters with a "_total" suffix, distributions as
+// histograms. As runtime/metrics does not provide the sum of a distribution,
+// the sum of the histogram is estimated from the bucket boundaries.
+func NewGoCollector(opts ...GoCollectionOption) prometheus.Collector {
+	o := &goOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	c := &goCollector{base: prometheus.NewGoCollector()}
+	for _, d := range metrics.All() {
+		if !o.matches(d.Name) {
+			continue
+		}
+		var valType prometheus.ValueType
+		switch d.Kind {
+		case metrics.KindUint64, metrics.KindFloat64:
+			valType = prometheus.GaugeValue
+			if d.Cumulative {
+				valType = prometheus.CounterValue
+			}
+		case metrics.KindFloat64Histogram:
+			// Not used, Collect handles histograms by sample kind.
+			valType = prometheus.UntypedValue
+		default:
+			continue
+		}
+		name := runtimeMetricName(d.Name, valType == prometheus.CounterValue)
+		c.samples = append(c.samples, metrics.Sample{Name: d.Name})
+		c.descs = append(c.descs, prometheus.NewDesc(name, d.Description, nil, nil))
+		c.kinds = append(c.kinds, valType)
+	}
+	return c
+}
+
+// Describe implements Collector.
+func (c *goCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.base.Describe(ch)
+	for _, d := range c.descs {
+		ch <- d
+	}
+}
+
+// Collect implements Collector.
+func (c *goCollector) Collect(ch chan<- prometheus.Metric) {
+	c.base.Collect(ch)
+	if len(c.samples) == 0 {
+		return
+	}
+
+	samples := make([]metrics.Sample, len(c.samples))
+	copy(samples, c.samples)
+	metrics.Read(samples)
+
+	for i, s := range samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			ch <- prometheus.MustNewConstMetric(c.descs[i], c.kinds[i], float64(s.Value.Uint64()))
+		case metrics.KindFloat64:
+			ch <- prometheus.MustNewConstMetric(c.descs[i], c.kinds[i], s.Value.Float64())
+		case metrics.KindFloat64Histogram:
+			count, sum, buckets := histogramValues(s.Value.Float64Histogram())
+			ch <- prometheus.MustNewConstHistogram(c.descs[i], count, sum, buckets)
+		}
+	}
+}
+
+// runtimeMetricName converts a runtime/metrics name like
+// "/gc/heap/allocs:bytes" into a Prometheus metric name like
+// "go_gc_heap_allocs_bytes".
+func runtimeMetricName(name string, counter bool) string {
+	path, unit := name, ""
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		path, unit = name[:i], name[i+1:]
+	}
+	mapped := "go" + strings.Map(sanitizeRune, path)
+	if unit != "" && !strings.HasSuffix(mapped, "_"+unit) {
+		mapped += "_" + strings.Map(sanitizeRune, unit)
+	}
+	if counter && !strings.HasSuffix(mapped, "_total") {
+		mapped += "_total"
+	}
+	return mapped
+}
+
+func sanitizeRune(r rune) rune {
+	if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+		return r
+	}
+	return '_'
+}
+
+// histogramValues converts a runtime/metrics histogram into the values needed
+// for a constant Prometheus histogram. The sum is estimated from the midpoints
+// of the buckets (or their finite boundary if the other one is infinite).
+func histogramValues(h *metrics.Float64Histogram) (count uint64, sum float64, buckets map[float64]uint64) {
+	buckets = make(map[float64]uint64, len(h.Counts))
+	for i, n := range h.Counts {
+		lower, upper := h.Buckets[i], h.Buckets[i+1]
+		count += n
+		if !math.IsInf(upper, 1) {
+			buckets[upper] = count
+		}
+		if n == 0 {
+			continue
+		}
+		switch {
+		case math.IsInf(lower, -1):
+			sum += upper * float64(n)
+		case math.IsInf(upper, 1):
+			sum += lower * float64(n)
+		default:
+			sum += (lower + upper) / 2 * float64(n)
+		}
+	}
+	return count, sum, buckets
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.16
+
+package collectors
+
+import (
+	"math"
+	"runtime/metrics"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestGoCollectorRuntimeMetrics(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(NewGoCollector(WithGoCollectorRuntimeMetrics(MetricsAll)))
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, mf := range mfs {
+		found[mf.GetName()] = true
+	}
+	for _, name := range []string{
+		"go_goroutines",
+		"go_memstats_alloc_bytes",
+		"go_sched_latencies_seconds",
+		"go_gc_cycles_total_gc_cycles_total",
+	} {
+		if !found[name] {
+			t.Errorf("metric %s not found", name)
+		}
+	}
+}
+
+func TestGoCollectorRuntimeMetricsRules(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(NewGoCollector(WithGoCollectorRuntimeMetrics(MetricsScheduler)))
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if name := mf.GetName(); strings.HasPrefix(name, "go_gc_") && name != "go_gc_duration_seconds" {
+			t.Errorf("unexpected GC metric %s with scheduler rule only", name)
+		}
+	}
+
+	// Without rules, the collector behaves like the classic one.
+	classic := prometheus.NewPedanticRegistry()
+	classic.MustRegister(NewGoCollector())
+	classicMFs, err := classic.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range classicMFs {
+		if mf.GetName() == "go_sched_latencies_seconds" {
+			t.Error("unexpected runtime/metrics metric without rules")
+		}
+	}
+}
+
+func TestRuntimeMetricName(t *testing.T) {
+	scenarios := []struct {
+		in      string
+		counter bool
+		want    string
+	}{
+		{"/sched/latencies:seconds", false, "go_sched_latencies_seconds"},
+		{"/gc/heap/allocs:bytes", true, "go_gc_heap_allocs_bytes_total"},
+		{"/memory/classes/heap/free:bytes", false, "go_memory_classes_heap_free_bytes"},
+		{"/gc/cycles/total:gc-cycles", true, "go_gc_cycles_total_gc_cycles_total"},
+		{"/sched/goroutines:goroutines", false, "go_sched_goroutines"},
+	}
+	for _, s := range scenarios {
+		if got := runtimeMetricName(s.in, s.counter); got != s.want {
+			t.Errorf("%s: want %q, got %q", s.in, s.want, got)
+		}
+	}
+}
+
+func TestHistogramValues(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{1, 2, 3},
+		Buckets: []float64{math.Inf(-1), 1, 2, math.Inf(1)},
+	}
+	count, sum, buckets := histogramValues(h)
+	if count != 6 {
+		t.Errorf("want count 6, got %d", count)
+	}
+	if want := 1*1 + 2*1.5 + 3*2.0; sum != want {
+		t.Errorf("want sum %v, got %v", want, sum)
+	}
+	if len(buckets) != 2 || buckets[1] != 1 || buckets[2] != 3 {
+		t.Errorf("unexpected buckets %v", buckets)
+	}
+}
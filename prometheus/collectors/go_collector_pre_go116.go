@@ -0,0 +1,25 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !go1.16
+
+package collectors
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// NewGoCollector returns a Collector which exports metrics about the current
+// Go process, like prometheus.NewGoCollector does. With Go versions before
+// Go1.16, runtime/metrics is not available, and all options are ignored.
+func NewGoCollector(opts ...GoCollectionOption) prometheus.Collector {
+	return prometheus.NewGoCollector()
+}
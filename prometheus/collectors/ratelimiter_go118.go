@@ -0,0 +1,77 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.18
+
+package collectors
+
+import (
+	"golang.org/x/time/rate"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type rateLimiterCollector struct {
+	limiter                      *rate.Limiter
+	limitDesc, burstDesc, tokens *prometheus.Desc
+}
+
+// NewRateLimiterCollector returns a Collector exposing the state of the
+// provided token-bucket rate limiter as three gauges:
+//
+//   <name>_rate_limit: the maximum rate of events per second
+//   <name>_rate_burst: the maximum burst size
+//   <name>_rate_tokens: the number of tokens currently available
+//
+// All values are read from the limiter at collection time. If limiter is nil,
+// the Collector still describes the three metrics but collects nothing.
+//
+// NewRateLimiterCollector requires Go1.18 or later as current versions of
+// golang.org/x/time do not support older Go versions.
+func NewRateLimiterCollector(name string, limiter *rate.Limiter) prometheus.Collector {
+	return &rateLimiterCollector{
+		limiter: limiter,
+		limitDesc: prometheus.NewDesc(
+			name+"_rate_limit",
+			"Maximum rate of events per second allowed by the rate limiter.",
+			nil, nil,
+		),
+		burstDesc: prometheus.NewDesc(
+			name+"_rate_burst",
+			"Maximum burst size allowed by the rate limiter.",
+			nil, nil,
+		),
+		tokens: prometheus.NewDesc(
+			name+"_rate_tokens",
+			"Number of tokens currently available in the rate limiter.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe implements Collector.
+func (c *rateLimiterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.limitDesc
+	ch <- c.burstDesc
+	ch <- c.tokens
+}
+
+// Collect implements Collector.
+func (c *rateLimiterCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.limiter == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.limitDesc, prometheus.GaugeValue, float64(c.limiter.Limit()))
+	ch <- prometheus.MustNewConstMetric(c.burstDesc, prometheus.GaugeValue, float64(c.limiter.Burst()))
+	ch <- prometheus.MustNewConstMetric(c.tokens, prometheus.GaugeValue, c.limiter.Tokens())
+}
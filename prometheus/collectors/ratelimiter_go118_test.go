@@ -0,0 +1,64 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.18
+
+package collectors
+
+import (
+	"testing"
+
+	"golang.org/x/time/rate"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRateLimiterCollector(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(NewRateLimiterCollector("api", rate.NewLimiter(5, 10)))
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		got[mf.GetName()] = mf.GetMetric()[0].GetGauge().GetValue()
+	}
+	if got, want := len(got), 3; got != want {
+		t.Fatalf("got %d metric families, want %d", got, want)
+	}
+	if got, want := got["api_rate_limit"], 5.; got != want {
+		t.Errorf("got limit %v, want %v", got, want)
+	}
+	if got, want := got["api_rate_burst"], 10.; got != want {
+		t.Errorf("got burst %v, want %v", got, want)
+	}
+	// A fresh limiter starts with a full bucket.
+	if got, want := got["api_rate_tokens"], 10.; got != want {
+		t.Errorf("got tokens %v, want %v", got, want)
+	}
+}
+
+func TestRateLimiterCollectorNil(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(NewRateLimiterCollector("api", nil))
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 0 {
+		t.Errorf("got %d metric families for nil limiter, want none", len(mfs))
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type textfileCollector struct {
+	dir             string
+	mtimeDesc       *prometheus.Desc
+	scrapeErrorDesc *prometheus.Desc
+}
+
+// NewTextfileCollector returns a Collector that reads all files with the
+// suffix ".prom" in the provided directory upon each collection, parses them
+// as the Prometheus text format, and exposes the metrics contained, just like
+// the textfile collector of the node_exporter. This allows scripts running
+// alongside a Go program (e.g. cron jobs) to contribute metrics to the
+// program's metrics endpoint. To avoid exposing partially written files, the
+// scripts should write into a temporary file in the same directory first and
+// then rename it.
+//
+// In addition, the Collector exposes the metric textfile_mtime_seconds with
+// the modification time of each file that was read successfully, labeled by
+// the file name, and the metric textfile_scrape_error, which is 1 if any of
+// the files could not be read or was invalid, and 0 otherwise. Such files are
+// skipped entirely. A file is invalid if it cannot be parsed, if it contains
+// samples with timestamps, or if it contains a metric family that has been
+// read from another file with a different type or help string.
+//
+// As the metrics contained in the files are unknown upfront, the Collector
+// only describes the two metrics above. A pedantic Registry therefore rejects
+// the metrics from the files. Metrics from the files that collide with other
+// metrics of the Registry make the gathering fail.
+func NewTextfileCollector(dir string) prometheus.Collector {
+	return &textfileCollector{
+		dir: dir,
+		mtimeDesc: prometheus.NewDesc(
+			"textfile_mtime_seconds",
+			"Unix time of the last modification of a textfile.",
+			[]string{"file"}, nil,
+		),
+		scrapeErrorDesc: prometheus.NewDesc(
+			"textfile_scrape_error",
+			"1 if there was an error reading or parsing a textfile, 0 otherwise.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe implements Collector.
+func (c *textfileCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.mtimeDesc
+	ch <- c.scrapeErrorDesc
+}
+
+// Collect implements Collector.
+func (c *textfileCollector) Collect(ch chan<- prometheus.Metric) {
+	scrapeError := 0.
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.prom"))
+	if err != nil {
+		scrapeError = 1
+	}
+	sort.Strings(paths)
+
+	families := map[string]*dto.MetricFamily{}
+	for _, path := range paths {
+		metrics, mtime, err := readTextfile(path, families)
+		if err != nil {
+			scrapeError = 1
+			continue
+		}
+		for _, m := range metrics {
+			ch <- m
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.mtimeDesc, prometheus.GaugeValue,
+			float64(mtime.UnixNano())/1e9, filepath.Base(path),
+		)
+	}
+	ch <- prometheus.MustNewConstMetric(c.scrapeErrorDesc, prometheus.GaugeValue, scrapeError)
+}
+
+// readTextfile reads and validates the textfile with the provided path and
+// returns the contained Metrics and the modification time of the file. The
+// MetricFamilies read from other files so far are used to check for
+// consistency. If the file is valid, its MetricFamilies are added to them.
+func readTextfile(path string, families map[string]*dto.MetricFamily) ([]prometheus.Metric, time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	mfs, err := prometheus.ParseText(f)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("parsing %s failed: %s", path, err)
+	}
+	var metrics []prometheus.Metric
+	for _, mf := range mfs {
+		if other, ok := families[mf.GetName()]; ok &&
+			(other.GetType() != mf.GetType() || other.GetHelp() != mf.GetHelp()) {
+			return nil, time.Time{}, fmt.Errorf("metric family %q in %s is inconsistent with other textfiles", mf.GetName(), path)
+		}
+		for _, m := range mf.GetMetric() {
+			if m.TimestampMs != nil {
+				return nil, time.Time{}, fmt.Errorf("metric family %q in %s has samples with timestamps", mf.GetName(), path)
+			}
+		}
+		ms, err := prometheus.MetricsFromFamily(mf)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("invalid metric family in %s: %s", path, err)
+		}
+		metrics = append(metrics, ms...)
+	}
+	for _, mf := range mfs {
+		families[mf.GetName()] = mf
+	}
+	return metrics, fi.ModTime(), nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func writeTextfile(t *testing.T, dir, name, content string, mtime time.Time) {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTextfileCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "textfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mtime := time.Unix(1500000000, 0)
+	writeTextfile(t, dir, "a.prom", `# HELP backup_last_success_seconds Time of the last successful backup.
+# TYPE backup_last_success_seconds gauge
+backup_last_success_seconds{job="db"} 1.4999e+09
+`, mtime)
+	writeTextfile(t, dir, "b.prom", `# HELP backup_last_success_seconds Time of the last successful backup.
+# TYPE backup_last_success_seconds gauge
+backup_last_success_seconds{job="files"} 1.4998e+09
+`, mtime)
+	writeTextfile(t, dir, "ignored.txt", "not_a_metric 1\n", mtime)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(NewTextfileCollector(dir))
+
+	values := func() map[string]float64 {
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := map[string]float64{}
+		for _, mf := range mfs {
+			for _, m := range mf.GetMetric() {
+				key := mf.GetName()
+				for _, lp := range m.GetLabel() {
+					key += "/" + lp.GetValue()
+				}
+				result[key] = m.GetGauge().GetValue()
+			}
+		}
+		return result
+	}
+
+	got := values()
+	want := map[string]float64{
+		"backup_last_success_seconds/db":    1.4999e+09,
+		"backup_last_success_seconds/files": 1.4998e+09,
+		"textfile_mtime_seconds/a.prom":     1500000000,
+		"textfile_mtime_seconds/b.prom":     1500000000,
+		"textfile_scrape_error":             0,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("got %s = %v, want %v", k, got[k], v)
+		}
+	}
+
+	// Invalid files are skipped and reported.
+	for name, content := range map[string]string{
+		"c.prom": "invalid {\n",
+		"d.prom": "# HELP backup_last_success_seconds Different help.\n# TYPE backup_last_success_seconds gauge\nbackup_last_success_seconds{job=\"x\"} 1\n",
+		"e.prom": "with_timestamp 1 1500000000000\n",
+	} {
+		writeTextfile(t, dir, name, content, mtime)
+	}
+	got = values()
+	if got["textfile_scrape_error"] != 1 {
+		t.Error("expected textfile_scrape_error to be 1")
+	}
+	for _, k := range []string{"textfile_mtime_seconds/c.prom", "textfile_mtime_seconds/d.prom", "backup_last_success_seconds/x", "with_timestamp"} {
+		if _, ok := got[k]; ok {
+			t.Errorf("expected %s to be skipped", k)
+		}
+	}
+	if _, ok := got["backup_last_success_seconds/db"]; !ok {
+		t.Error("expected metrics of valid files to be still exposed")
+	}
+}
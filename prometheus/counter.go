@@ -14,6 +14,7 @@
 package prometheus
 
 import (
+	"context"
 	"errors"
 )
 
@@ -54,6 +55,30 @@ func NewCounter(opts CounterOpts) Counter {
 	return result
 }
 
+// NewCounterWithContext creates a new Counter based on the provided CounterOpts
+// and registers it with the provided Registerer. Once the provided Context is
+// done, the Counter is unregistered from the Registerer again. This is useful to
+// tie the lifetime of a Counter to the lifetime of a component (e.g. a
+// subsystem that can be shut down) without leaking the registration.
+//
+// The Context has to be cancellable (or have a deadline), as a goroutine waits
+// for it to be done. With a Context that is never done (like
+// context.Background()), the Counter simply stays registered. If reg is a
+// *Registry, the Counter is only unregistered if it is still registered itself,
+// i.e. an equal Counter registered after unregistering this one manually is not
+// affected.
+//
+// The Counter itself stays usable after unregistration, but it is not exported
+// anymore. An error is returned (and nothing is registered) if the
+// registration fails.
+func NewCounterWithContext(ctx context.Context, reg Registerer, opts CounterOpts) (Counter, error) {
+	c := NewCounter(opts)
+	if err := registerWithContext(ctx, reg, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 type counter struct {
 	value
 }
@@ -84,7 +109,7 @@ func NewCounterVec(opts CounterOpts, labelNames []string) *CounterVec {
 		opts.ConstLabels,
 	)
 	return &CounterVec{
-		metricVec: newMetricVec(desc, func(lvs ...string) Metric {
+		metricVec: newMetricVec(desc, Opts(opts).vecOpts(), func(lvs ...string) Metric {
 			result := &counter{value: value{
 				desc:       desc,
 				valType:    CounterValue,
@@ -162,6 +187,45 @@ func (m *CounterVec) With(labels Labels) Counter {
 	return m.metricVec.with(labels).(Counter)
 }
 
+// WithPreparedLabelValues returns the Counter for the provided PreparedLabelValues
+// (see PrepareLabelValues). If the Counter does not exist (anymore), a new Counter is
+// created. It panics if the PreparedLabelValues have been prepared by a
+// different CounterVec (curried versions of the same CounterVec are fine).
+func (m *CounterVec) WithPreparedLabelValues(p PreparedLabelValues) Counter {
+	return m.metricVec.withPreparedLabelValues(p).(Counter)
+}
+
+// CurryWith returns a vector curried with the provided labels, i.e. the
+// returned vector has those labels pre-set for all labeled operations performed
+// on it. The cardinality of the curried vector is reduced accordingly. The
+// order of the remaining labels stays the same (just with the curried labels
+// taken out of the sequence – which is relevant for the
+// (GetMetric)WithLabelValues methods). It is possible to curry a curried
+// vector, but only with labels not yet used for currying before.
+//
+// The metrics contained in the CounterVec are shared between the curried and
+// uncurried vectors. They are just accessed differently. Curried and uncurried
+// vectors behave identically in terms of collection. Only one must be
+// registered with a given registry (usually the uncurried version). The Reset
+// method deletes all metrics, even if called on a curried vector.
+func (m *CounterVec) CurryWith(labels Labels) (*CounterVec, error) {
+	vec, err := m.curryWith(labels)
+	if vec != nil {
+		return &CounterVec{vec}, err
+	}
+	return nil, err
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *CounterVec) MustCurryWith(labels Labels) *CounterVec {
+	vec, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return vec
+}
+
 // CounterFunc is a Counter whose value is determined at collect time by calling a
 // provided function.
 //
@@ -187,3 +251,15 @@ func NewCounterFunc(opts CounterOpts, function func() float64) CounterFunc {
 		opts.ConstLabels,
 	), CounterValue, function)
 }
+
+// NewCounterFuncWithContext works like NewCounterFunc, but the provided
+// function receives the Context of the gathering and may return an error, see
+// NewGaugeFuncWithContext for details.
+func NewCounterFuncWithContext(opts CounterOpts, function func(context.Context) (float64, error)) CounterFunc {
+	return newContextValueFunc(NewDesc(
+		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		opts.Help,
+		nil,
+		opts.ConstLabels,
+	), CounterValue, function)
+}
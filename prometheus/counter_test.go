@@ -14,9 +14,11 @@
 package prometheus
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"testing"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
 )
@@ -112,3 +114,71 @@ func expectPanic(t *testing.T, op func(), errorMsg string) {
 
 	op()
 }
+
+// unregisterNotifier is a Registerer that reports each successful
+// unregistration on a channel.
+type unregisterNotifier struct {
+	Registerer
+	unregistered chan Collector
+}
+
+func (r unregisterNotifier) Unregister(c Collector) bool {
+	ok := r.Registerer.Unregister(c)
+	if ok {
+		r.unregistered <- c
+	}
+	return ok
+}
+
+func TestNewCounterWithContext(t *testing.T) {
+	reg := unregisterNotifier{
+		Registerer:   NewRegistry(),
+		unregistered: make(chan Collector, 1),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c, err := NewCounterWithContext(ctx, reg, CounterOpts{Name: "test", Help: "test help"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCounterWithContext(ctx, reg, CounterOpts{Name: "test", Help: "test help"}); err == nil {
+		t.Error("expected error when registering an equal counter")
+	}
+
+	cancel()
+	select {
+	case got := <-reg.unregistered:
+		if got != c {
+			t.Error("unexpected collector unregistered")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("counter not unregistered after context cancellation")
+	}
+	if err := reg.Register(c); err != nil {
+		t.Errorf("re-registering counter after cancellation failed: %s", err)
+	}
+}
+
+func TestRegisterWithContextReplaced(t *testing.T) {
+	reg := NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, err := NewCounterWithContext(ctx, reg, CounterOpts{Name: "test", Help: "test help"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reg.Unregister(c) {
+		t.Fatal("unregistering counter failed")
+	}
+	replacement := NewCounter(CounterOpts{Name: "test", Help: "test help"})
+	reg.MustRegister(replacement)
+
+	id, descIDs := describeCollector(c)
+	if reg.unregisterIfSame(id, descIDs, c) {
+		t.Error("equal replacement counter unregistered")
+	}
+	if !reg.unregisterIfSame(id, descIDs, replacement) {
+		t.Error("replacement counter not unregistered")
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DeltaGatherer is a Gatherer that wraps another Gatherer and converts the
+// values of all Counters gathered from it into deltas, i.e. each Counter value
+// returned by its Gather method is the increase of the Counter since the
+// previous call of Gather. All other metric types are passed through
+// unchanged.
+//
+// A DeltaGatherer is meant for push-based integrations with backends that
+// expect delta counters rather than cumulative ones (e.g. StatsD). The
+// Prometheus server itself expects cumulative counters, so never expose the
+// output of a DeltaGatherer to be scraped by Prometheus.
+//
+// The state of a DeltaGatherer (the Counter values seen during the previous
+// Gather call) is kept per DeltaGatherer instance. If multiple push targets
+// need independent deltas, create one DeltaGatherer for each of them.
+//
+// The deltas are calculated as follows:
+//
+// A Counter seen for the first time (or for the first time after it had
+// disappeared) reports its full value.
+//
+// A Counter with a value lower than during the previous Gather call is assumed
+// to have been reset (e.g. by a restart of the process it is mirrored from) and
+// reports its full (new) value.
+//
+// A Counter that has disappeared is forgotten and simply not reported
+// anymore. However, if the wrapped Gatherer returns an error, Counters missing
+// from its (partial) result are remembered, as they are most likely missing
+// because of the error. Once they reappear, only their increase is reported.
+//
+// Use NewDeltaGatherer to create instances.
+type DeltaGatherer struct {
+	gatherer Gatherer
+
+	mtx  sync.Mutex
+	last map[string]float64
+}
+
+// NewDeltaGatherer returns a DeltaGatherer wrapping the provided Gatherer.
+func NewDeltaGatherer(g Gatherer) *DeltaGatherer {
+	return &DeltaGatherer{
+		gatherer: g,
+		last:     map[string]float64{},
+	}
+}
+
+// Gather implements Gatherer. Errors from the wrapped Gatherer are passed
+// through. The returned MetricFamilies are copies wherever values are changed,
+// i.e. the MetricFamilies returned by the wrapped Gatherer are not modified.
+func (dg *DeltaGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := dg.gatherer.Gather()
+
+	dg.mtx.Lock()
+	defer dg.mtx.Unlock()
+
+	var (
+		current = make(map[string]float64, len(dg.last))
+		result  = make([]*dto.MetricFamily, 0, len(mfs))
+		buf     bytes.Buffer
+	)
+	for _, mf := range mfs {
+		if mf.GetType() != dto.MetricType_COUNTER {
+			result = append(result, mf)
+			continue
+		}
+		deltaMF := &dto.MetricFamily{
+			Name:   mf.Name,
+			Help:   mf.Help,
+			Type:   mf.Type,
+			Metric: make([]*dto.Metric, 0, len(mf.Metric)),
+		}
+		for _, m := range mf.Metric {
+			key := seriesKey(&buf, mf.GetName(), m.Label)
+			v := m.GetCounter().GetValue()
+			current[key] = v
+			delta := v
+			if last, ok := dg.last[key]; ok && last <= v {
+				delta = v - last
+			}
+			deltaMF.Metric = append(deltaMF.Metric, &dto.Metric{
+				Label:       m.Label,
+				Counter:     &dto.Counter{Value: proto.Float64(delta)},
+				TimestampMs: m.TimestampMs,
+			})
+		}
+		result = append(result, deltaMF)
+	}
+	if err != nil {
+		// Series might be missing because of the error. Remember
+		// them to not report their full value once they reappear.
+		for key, v := range current {
+			dg.last[key] = v
+		}
+		return result, err
+	}
+	// Only keep what has been seen now, so that disappeared series are
+	// forgotten.
+	dg.last = current
+	return result, err
+}
+
+// seriesKey returns a string uniquely identifying the series with the provided
+// metric name and label pairs. The provided buffer is used as scratch space.
+func seriesKey(buf *bytes.Buffer, name string, labelPairs []*dto.LabelPair) string {
+	buf.Reset()
+	buf.WriteString(name)
+	for _, lp := range labelPairs {
+		buf.WriteByte(separatorByte)
+		buf.WriteString(lp.GetName())
+		buf.WriteByte(separatorByte)
+		buf.WriteString(lp.GetValue())
+	}
+	return buf.String()
+}
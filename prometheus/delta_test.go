@@ -0,0 +1,179 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestDeltaGatherer(t *testing.T) {
+	var (
+		reg   = NewRegistry()
+		cnt   = NewCounterVec(CounterOpts{Name: "test_total", Help: "help"}, []string{"l"})
+		gauge = NewGauge(GaugeOpts{Name: "test_gauge", Help: "help"})
+		dg    = NewDeltaGatherer(reg)
+	)
+	reg.MustRegister(cnt, gauge)
+
+	gatherValues := func() map[string]float64 {
+		mfs, err := dg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := map[string]float64{}
+		for _, mf := range mfs {
+			for _, m := range mf.GetMetric() {
+				switch mf.GetType() {
+				case dto.MetricType_COUNTER:
+					values[mf.GetName()+"/"+m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+				case dto.MetricType_GAUGE:
+					values[mf.GetName()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+		return values
+	}
+
+	cnt.WithLabelValues("a").Add(3)
+	gauge.Set(5)
+	scenarios := []struct {
+		before func()
+		want   map[string]float64
+	}{
+		{ // New series report their full value.
+			before: func() {},
+			want:   map[string]float64{"test_total/a": 3, "test_gauge": 5},
+		},
+		{ // Deltas for counters, gauges unchanged.
+			before: func() {
+				cnt.WithLabelValues("a").Add(2)
+				cnt.WithLabelValues("b").Add(7)
+			},
+			want: map[string]float64{"test_total/a": 2, "test_total/b": 7, "test_gauge": 5},
+		},
+		{ // Disappeared series are forgotten.
+			before: func() {
+				cnt.DeleteLabelValues("a")
+			},
+			want: map[string]float64{"test_total/b": 0, "test_gauge": 5},
+		},
+		{ // Reappearing series report their full value again.
+			before: func() {
+				cnt.WithLabelValues("a").Add(1)
+			},
+			want: map[string]float64{"test_total/a": 1, "test_total/b": 0, "test_gauge": 5},
+		},
+		{ // Resets report the new full value.
+			before: func() {
+				cnt.DeleteLabelValues("b")
+				cnt.WithLabelValues("b")
+				cnt.WithLabelValues("a").Add(1)
+			},
+			want: map[string]float64{"test_total/a": 1, "test_total/b": 0, "test_gauge": 5},
+		},
+	}
+
+	for i, s := range scenarios {
+		s.before()
+		got := gatherValues()
+		if len(got) != len(s.want) {
+			t.Errorf("%d. got %v, want %v", i, got, s.want)
+			continue
+		}
+		for k, v := range s.want {
+			if got[k] != v {
+				t.Errorf("%d. got %v, want %v", i, got, s.want)
+				break
+			}
+		}
+	}
+}
+
+func TestDeltaGathererResetAndErrors(t *testing.T) {
+	var (
+		values map[string]float64
+		err    error
+	)
+	dg := NewDeltaGatherer(GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mf := &dto.MetricFamily{
+			Name: proto.String("test_total"),
+			Help: proto.String("help"),
+			Type: dto.MetricType_COUNTER.Enum(),
+		}
+		for _, l := range []string{"a", "b"} {
+			if v, ok := values[l]; ok {
+				mf.Metric = append(mf.Metric, &dto.Metric{
+					Label:   []*dto.LabelPair{{Name: proto.String("l"), Value: proto.String(l)}},
+					Counter: &dto.Counter{Value: proto.Float64(v)},
+				})
+			}
+		}
+		return []*dto.MetricFamily{mf}, err
+	}))
+
+	scenarios := []struct {
+		values  map[string]float64
+		err     error
+		want    map[string]float64
+		comment string
+	}{
+		{
+			values:  map[string]float64{"a": 10, "b": 20},
+			want:    map[string]float64{"a": 10, "b": 20},
+			comment: "new series report their full value",
+		},
+		{
+			values:  map[string]float64{"a": 4, "b": 25},
+			want:    map[string]float64{"a": 4, "b": 5},
+			comment: "a reset to a positive value reports the new full value",
+		},
+		{
+			values:  map[string]float64{"a": 6},
+			err:     errors.New("collect error"),
+			want:    map[string]float64{"a": 2},
+			comment: "series missing because of an error",
+		},
+		{
+			values:  map[string]float64{"a": 7, "b": 28},
+			want:    map[string]float64{"a": 1, "b": 3},
+			comment: "series reappearing after an error report their increase",
+		},
+	}
+	for _, s := range scenarios {
+		values, err = s.values, s.err
+		mfs, gotErr := dg.Gather()
+		if gotErr != s.err {
+			t.Errorf("%s: got error %v, want %v", s.comment, gotErr, s.err)
+		}
+		got := map[string]float64{}
+		for _, m := range mfs[0].GetMetric() {
+			got[m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+		}
+		if len(got) != len(s.want) {
+			t.Errorf("%s: got %v, want %v", s.comment, got, s.want)
+			continue
+		}
+		for k, v := range s.want {
+			if got[k] != v {
+				t.Errorf("%s: got %v, want %v", s.comment, got, s.want)
+				break
+			}
+		}
+	}
+}
@@ -20,7 +20,6 @@ import (
 	"strings"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/prometheus/common/model"
 
 	dto "github.com/prometheus/client_model/go"
 )
@@ -85,7 +84,7 @@ func NewDesc(fqName, help string, variableLabels []string, constLabels Labels) *
 		d.err = errors.New("empty help string")
 		return d
 	}
-	if !model.IsValidMetricName(model.LabelValue(fqName)) {
+	if !isValidMetricName(fqName) {
 		d.err = fmt.Errorf("%q is not a valid metric name", fqName)
 		return d
 	}
@@ -161,6 +160,23 @@ func NewDesc(fqName, help string, variableLabels []string, constLabels Labels) *
 	return d
 }
 
+// NewDescChecked works like NewDesc, but instead of recording an error in the
+// returned Desc (to be reported only on registration time), it returns the
+// error directly, together with a nil Desc. The checks are the same as
+// performed by NewDesc, i.e. fqName must be a valid metric name, help must not
+// be empty, all label names must be valid, constant and variable label names
+// must not overlap, and constant label values must be valid UTF-8.
+//
+// NewDescChecked is useful for Collectors that create their Descs dynamically
+// (e.g. from configuration) and want to handle invalid input gracefully.
+func NewDescChecked(fqName, help string, variableLabels []string, constLabels Labels) (*Desc, error) {
+	d := NewDesc(fqName, help, variableLabels, constLabels)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return d, nil
+}
+
 // NewInvalidDesc returns an invalid descriptor, i.e. a descriptor with the
 // provided error set. If a collector returning such a descriptor is registered,
 // registration will fail with the provided error. NewInvalidDesc can be used by
@@ -171,6 +187,39 @@ func NewInvalidDesc(err error) *Desc {
 	}
 }
 
+// FQName returns the fully-qualified name of the Desc.
+func (d *Desc) FQName() string {
+	return d.fqName
+}
+
+// Help returns the help string of the Desc.
+func (d *Desc) Help() string {
+	return d.help
+}
+
+// VariableLabels returns the names of the variable labels of the Desc, in the
+// order they were provided to NewDesc. The returned slice is a copy and can be
+// modified by the caller.
+func (d *Desc) VariableLabels() []string {
+	return append([]string(nil), d.variableLabels...)
+}
+
+// ConstLabels returns the constant labels of the Desc. The returned Labels are
+// a copy and can be modified by the caller.
+func (d *Desc) ConstLabels() Labels {
+	labels := make(Labels, len(d.constLabelPairs))
+	for _, lp := range d.constLabelPairs {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	return labels
+}
+
+// Err returns the error that occurred during construction of the Desc (and
+// that is reported on registration time), or nil if the Desc is valid.
+func (d *Desc) Err() error {
+	return d.err
+}
+
 func (d *Desc) String() string {
 	lpStrings := make([]string, 0, len(d.constLabelPairs))
 	for _, lp := range d.constLabelPairs {
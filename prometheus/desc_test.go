@@ -1,6 +1,7 @@
 package prometheus
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -15,3 +16,99 @@ func TestNewDescInvalidLabelValues(t *testing.T) {
 		t.Errorf("NewDesc: expected error because: %s", desc.err)
 	}
 }
+
+func TestNewDescChecked(t *testing.T) {
+	scenarios := []struct {
+		fqName         string
+		help           string
+		variableLabels []string
+		constLabels    Labels
+		wantErr        bool
+	}{
+		{
+			fqName:         "valid",
+			help:           "helpful",
+			variableLabels: []string{"a"},
+			constLabels:    Labels{"b": "c"},
+		},
+		{
+			fqName:  "invalid-name",
+			help:    "helpful",
+			wantErr: true,
+		},
+		{
+			fqName:  "empty_help",
+			wantErr: true,
+		},
+		{
+			fqName:         "invalid_label_name",
+			help:           "helpful",
+			variableLabels: []string{"__reserved"},
+			wantErr:        true,
+		},
+		{
+			fqName:         "overlapping_labels",
+			help:           "helpful",
+			variableLabels: []string{"a"},
+			constLabels:    Labels{"a": "b"},
+			wantErr:        true,
+		},
+	}
+
+	for i, s := range scenarios {
+		desc, err := NewDescChecked(s.fqName, s.help, s.variableLabels, s.constLabels)
+		if s.wantErr {
+			if err == nil {
+				t.Errorf("%d. expected error, got none", i)
+			}
+			if desc != nil {
+				t.Errorf("%d. expected nil Desc, got %s", i, desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s", i, err)
+		}
+		if desc == nil {
+			t.Errorf("%d. expected Desc, got nil", i)
+		}
+	}
+}
+
+func TestDescAccessors(t *testing.T) {
+	desc := NewDesc(
+		"ns_requests_total",
+		"Total requests.",
+		[]string{"method", "code"},
+		Labels{"zone": "eu", "app": "api"},
+	)
+	if got, want := desc.FQName(), "ns_requests_total"; got != want {
+		t.Errorf("got fqName %q, want %q", got, want)
+	}
+	if got, want := desc.Help(), "Total requests."; got != want {
+		t.Errorf("got help %q, want %q", got, want)
+	}
+	if got, want := desc.VariableLabels(), []string{"method", "code"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got variable labels %v, want %v", got, want)
+	}
+	if got, want := desc.ConstLabels(), (Labels{"zone": "eu", "app": "api"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got const labels %v, want %v", got, want)
+	}
+	if err := desc.Err(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	// Modifying the returned values must not affect the Desc.
+	desc.VariableLabels()[0] = "changed"
+	desc.ConstLabels()["zone"] = "changed"
+	if got := desc.VariableLabels()[0]; got != "method" {
+		t.Errorf("variable labels were modified, got %q", got)
+	}
+	if got := desc.ConstLabels()["zone"]; got != "eu" {
+		t.Errorf("const labels were modified, got %q", got)
+	}
+
+	if err := NewDesc("invalid name", "help", nil, nil).Err(); err == nil {
+		t.Error("expected error for invalid Desc")
+	}
+}
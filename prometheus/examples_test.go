@@ -21,6 +21,7 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
@@ -627,6 +628,36 @@ func ExampleNewConstHistogram() {
 	// >
 }
 
+func ExampleNewMetricWithTimestamp() {
+	desc := prometheus.NewDesc(
+		"temperature_kelvin",
+		"Current temperature in Kelvin.",
+		nil, nil,
+	)
+
+	// Create a constant gauge from values we got from an external
+	// temperature reporting system. Those values are reported with a (tiny)
+	// delay, i.e. they describe the past. Thus, we create the gauge with the
+	// timestamp of the measurement.
+	s := prometheus.NewMetricWithTimestamp(
+		time.Date(2009, time.November, 10, 23, 0, 0, 12345678, time.UTC),
+		prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 298.15),
+	)
+
+	// Just for demonstration, let's check the state of the gauge by
+	// (ab)using its Write method (which is usually only used by Prometheus
+	// internally).
+	metric := &dto.Metric{}
+	s.Write(metric)
+	fmt.Println(proto.MarshalTextString(metric))
+
+	// Output:
+	// gauge: <
+	//   value: 298.15
+	// >
+	// timestamp_ms: 1257894000012
+}
+
 func ExampleAlreadyRegisteredError() {
 	reqCounter := prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "requests_total",
@@ -13,6 +13,12 @@
 
 package prometheus
 
+import (
+	"context"
+	"math"
+	"sync/atomic"
+)
+
 // Gauge is a Metric that represents a single numerical value that can
 // arbitrarily go up and down.
 //
@@ -44,6 +50,22 @@ type Gauge interface {
 	SetToCurrentTime()
 }
 
+// MaxMinSetter is implemented by the Gauges created by this package (including
+// those in a GaugeVec). Use a type assertion to access it.
+type MaxMinSetter interface {
+	// SetMax sets the Gauge to the given value if it is greater than the
+	// current value, atomically and without any locking. This is meant
+	// for Gauges tracking a high-water mark across goroutines. Note that a
+	// Gauge starts at 0. A NaN is never greater than any value, and no
+	// value is greater than a current value of NaN.
+	SetMax(float64)
+	// SetMin works like SetMax but sets the Gauge to the given value if it
+	// is smaller than the current value. As a Gauge starts at 0, use Set
+	// first to initialize a Gauge tracking a low-water mark of positive
+	// values.
+	SetMin(float64)
+}
+
 // GaugeOpts is an alias for Opts. See there for doc comments.
 type GaugeOpts Opts
 
@@ -57,6 +79,18 @@ func NewGauge(opts GaugeOpts) Gauge {
 	), GaugeValue, 0)
 }
 
+// NewGaugeWithContext creates a new Gauge based on the provided GaugeOpts and
+// registers it with the provided Registerer. Once the provided Context is done,
+// the Gauge is unregistered from the Registerer again. See
+// NewCounterWithContext for details.
+func NewGaugeWithContext(ctx context.Context, reg Registerer, opts GaugeOpts) (Gauge, error) {
+	g := NewGauge(opts)
+	if err := registerWithContext(ctx, reg, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
 // GaugeVec is a Collector that bundles a set of Gauges that all share the same
 // Desc, but have different values for their variable labels. This is used if
 // you want to count the same thing partitioned by various dimensions
@@ -76,12 +110,113 @@ func NewGaugeVec(opts GaugeOpts, labelNames []string) *GaugeVec {
 		opts.ConstLabels,
 	)
 	return &GaugeVec{
-		metricVec: newMetricVec(desc, func(lvs ...string) Metric {
+		metricVec: newMetricVec(desc, Opts(opts).vecOpts(), func(lvs ...string) Metric {
 			return newValue(desc, GaugeValue, 0, lvs...)
 		}),
 	}
 }
 
+// NewAutoDeleteGaugeVec creates a new GaugeVec based on the provided GaugeOpts
+// and partitioned by the given label names. In contrast to a GaugeVec created
+// with NewGaugeVec, a Gauge in the returned GaugeVec is deleted from the
+// GaugeVec as soon as one of its methods (Set, Inc, Dec, Add, Sub) results in
+// a value of exactly zero. This is meant for reference-counting style gauges
+// (e.g. active connections by pool), which would otherwise leave a stale
+// zero-valued series behind for each label combination ever used.
+//
+// A Gauge retrieved from the GaugeVec (e.g. via WithLabelValues) stays usable
+// after its deletion. Any later change re-adds it to the GaugeVec (or, if a
+// Gauge with the same label values has been created in the meantime, the change
+// is applied to that Gauge instead). Thus, a decrement to zero and a concurrent
+// increment never lose the series. To guarantee that, every change of a Gauge
+// in the returned GaugeVec locks the whole GaugeVec, which is more expensive
+// than changing a Gauge of a regular GaugeVec.
+//
+// Note that a Gauge newly created via WithLabelValues and friends starts at
+// zero and is only deleted once it is changed to zero again.
+func NewAutoDeleteGaugeVec(opts GaugeOpts, labelNames []string) *GaugeVec {
+	desc := NewDesc(
+		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		opts.Help,
+		labelNames,
+		opts.ConstLabels,
+	)
+	v := &GaugeVec{}
+	v.metricVec = newMetricVec(desc, Opts(opts).vecOpts(), func(lvs ...string) Metric {
+		return &autoDeleteGauge{
+			value: newValue(desc, GaugeValue, 0, lvs...),
+			vec:   v.metricVec,
+			lvs:   lvs,
+		}
+	})
+	return v
+}
+
+// autoDeleteGauge is a Gauge that deletes itself from its metricVec once its
+// value changes to zero. See NewAutoDeleteGaugeVec.
+type autoDeleteGauge struct {
+	*value
+	vec *metricVec
+	lvs []string
+}
+
+func (g *autoDeleteGauge) Set(val float64) {
+	g.update(func(v *value) { v.Set(val) })
+}
+
+func (g *autoDeleteGauge) SetToCurrentTime() {
+	g.update(func(v *value) { v.SetToCurrentTime() })
+}
+
+func (g *autoDeleteGauge) SetMax(val float64) {
+	g.update(func(v *value) { v.SetMax(val) })
+}
+
+func (g *autoDeleteGauge) SetMin(val float64) {
+	g.update(func(v *value) { v.SetMin(val) })
+}
+
+func (g *autoDeleteGauge) Inc() {
+	g.Add(1)
+}
+
+func (g *autoDeleteGauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *autoDeleteGauge) Add(val float64) {
+	g.update(func(v *value) { v.Add(val) })
+}
+
+func (g *autoDeleteGauge) Sub(val float64) {
+	g.Add(val * -1)
+}
+
+// update applies f to the Gauge currently stored in the metricVec under the
+// label values of g (re-adding g if there is none) and deletes that Gauge from
+// the metricVec if its value is zero afterwards.
+func (g *autoDeleteGauge) update(f func(*value)) {
+	m := g.vec
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	// The label values have been validated upon creation of g, so no error
+	// can happen here.
+	h, _ := m.hashLabelValues(g.lvs)
+	target := g
+	if metric, ok := m.getMetricWithHashAndLabelValues(h, g.lvs); ok {
+		target = metric.(*autoDeleteGauge)
+	} else if !m.addChildWithinLimit(h, g.lvs, g) {
+		// Re-adding g would exceed MaxLabelSets, so g stays detached.
+		f(g.value)
+		return
+	}
+	f(target.value)
+	if math.Float64frombits(atomic.LoadUint64(&target.valBits)) == 0 {
+		m.deleteByHashWithLabelValues(h, g.lvs)
+	}
+}
+
 // GetMetricWithLabelValues returns the Gauge for the given slice of label
 // values (same order as the VariableLabels in Desc). If that combination of
 // label values is accessed for the first time, a new Gauge is created.
@@ -148,6 +283,45 @@ func (m *GaugeVec) With(labels Labels) Gauge {
 	return m.metricVec.with(labels).(Gauge)
 }
 
+// WithPreparedLabelValues returns the Gauge for the provided PreparedLabelValues
+// (see PrepareLabelValues). If the Gauge does not exist (anymore), a new Gauge is
+// created. It panics if the PreparedLabelValues have been prepared by a
+// different GaugeVec (curried versions of the same GaugeVec are fine).
+func (m *GaugeVec) WithPreparedLabelValues(p PreparedLabelValues) Gauge {
+	return m.metricVec.withPreparedLabelValues(p).(Gauge)
+}
+
+// CurryWith returns a vector curried with the provided labels, i.e. the
+// returned vector has those labels pre-set for all labeled operations performed
+// on it. The cardinality of the curried vector is reduced accordingly. The
+// order of the remaining labels stays the same (just with the curried labels
+// taken out of the sequence – which is relevant for the
+// (GetMetric)WithLabelValues methods). It is possible to curry a curried
+// vector, but only with labels not yet used for currying before.
+//
+// The metrics contained in the GaugeVec are shared between the curried and
+// uncurried vectors. They are just accessed differently. Curried and uncurried
+// vectors behave identically in terms of collection. Only one must be
+// registered with a given registry (usually the uncurried version). The Reset
+// method deletes all metrics, even if called on a curried vector.
+func (m *GaugeVec) CurryWith(labels Labels) (*GaugeVec, error) {
+	vec, err := m.curryWith(labels)
+	if vec != nil {
+		return &GaugeVec{vec}, err
+	}
+	return nil, err
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *GaugeVec) MustCurryWith(labels Labels) *GaugeVec {
+	vec, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return vec
+}
+
 // GaugeFunc is a Gauge whose value is determined at collect time by calling a
 // provided function.
 //
@@ -171,3 +345,20 @@ func NewGaugeFunc(opts GaugeOpts, function func() float64) GaugeFunc {
 		opts.ConstLabels,
 	), GaugeValue, function)
 }
+
+// NewGaugeFuncWithContext works like NewGaugeFunc, but the provided function
+// receives the Context of the gathering and may return an error. The returned
+// GaugeFunc is a ContextCollector, i.e. a Registry calls the function with the
+// Context provided to GatherWithContext, so that the function can honor the
+// deadline of a scrape (see promhttp.HandlerOpts.ScrapeTimeoutOffset). An
+// error returned by the function is reported by Gather as a CollectError for
+// the Desc of the GaugeFunc, and no value is exposed for it. The function
+// must be concurrency-safe.
+func NewGaugeFuncWithContext(opts GaugeOpts, function func(context.Context) (float64, error)) GaugeFunc {
+	return newContextValueFunc(NewDesc(
+		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		opts.Help,
+		nil,
+		opts.ConstLabels,
+	), GaugeValue, function)
+}
@@ -14,6 +14,8 @@
 package prometheus
 
 import (
+	"context"
+	"errors"
 	"math"
 	"math/rand"
 	"sync"
@@ -182,6 +184,61 @@ func TestGaugeFunc(t *testing.T) {
 	}
 }
 
+func TestGaugeFuncWithContext(t *testing.T) {
+	type ctxKey struct{}
+	var fail bool
+	gf := NewGaugeFuncWithContext(
+		GaugeOpts{
+			Name:        "test_name",
+			Help:        "test help",
+			ConstLabels: Labels{"a": "1"},
+		},
+		func(ctx context.Context) (float64, error) {
+			if fail {
+				return 0, errors.New("downstream unavailable")
+			}
+			if v, ok := ctx.Value(ctxKey{}).(float64); ok {
+				return v, nil
+			}
+			return 1, nil
+		},
+	)
+
+	m := &dto.Metric{}
+	if err := gf.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := `label:<name:"a" value:"1" > gauge:<value:1 > `, m.String(); expected != got {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	reg := NewRegistry()
+	reg.MustRegister(gf)
+	mfs, err := reg.GatherWithContext(context.WithValue(context.Background(), ctxKey{}, 42.0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 42.0, mfs[0].GetMetric()[0].GetGauge().GetValue(); expected != got {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	fail = true
+	mfs, err = reg.Gather()
+	collectErr, ok := err.(CollectError)
+	if !ok {
+		t.Fatalf("expected CollectError, got %v", err)
+	}
+	if collectErr.Desc != gf.Desc() {
+		t.Errorf("expected error for %s, got error for %s", gf.Desc(), collectErr.Desc)
+	}
+	if len(mfs) != 0 {
+		t.Errorf("expected no metric families, got %v", mfs)
+	}
+	if err := gf.Write(m); err == nil {
+		t.Error("expected error from Write")
+	}
+}
+
 func TestGaugeSetCurrentTime(t *testing.T) {
 	g := NewGauge(GaugeOpts{
 		Name: "test_name",
@@ -200,3 +257,140 @@ func TestGaugeSetCurrentTime(t *testing.T) {
 		t.Errorf("Gauge set to current time deviates from current time by more than 5s, delta is %f seconds", delta)
 	}
 }
+
+func TestGaugeSetMaxMin(t *testing.T) {
+	gauge := NewGauge(GaugeOpts{
+		Name: "test_name",
+		Help: "test help",
+	})
+	g := gauge.(MaxMinSetter)
+	value := func() float64 {
+		m := &dto.Metric{}
+		gauge.Write(m)
+		return m.GetGauge().GetValue()
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		go func(v float64) {
+			defer wg.Done()
+			g.SetMax(v)
+		}(float64(i))
+	}
+	wg.Wait()
+	if got, want := value(), 100.; got != want {
+		t.Errorf("after SetMax, got %v, want %v", got, want)
+	}
+	g.SetMax(42)
+	if got, want := value(), 100.; got != want {
+		t.Errorf("after SetMax with smaller value, got %v, want %v", got, want)
+	}
+
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		go func(v float64) {
+			defer wg.Done()
+			g.SetMin(v)
+		}(float64(i))
+	}
+	wg.Wait()
+	if got, want := value(), 1.; got != want {
+		t.Errorf("after SetMin, got %v, want %v", got, want)
+	}
+	g.SetMin(math.NaN())
+	if got, want := value(), 1.; got != want {
+		t.Errorf("after SetMin with NaN, got %v, want %v", got, want)
+	}
+
+	vec := NewGaugeVec(GaugeOpts{Name: "test_vec", Help: "test help"}, []string{"l"})
+	if _, ok := vec.WithLabelValues("a").(MaxMinSetter); !ok {
+		t.Error("Gauge in GaugeVec does not implement MaxMinSetter")
+	}
+}
+
+func TestAutoDeleteGaugeVec(t *testing.T) {
+	vec := NewAutoDeleteGaugeVec(
+		GaugeOpts{
+			Name: "test",
+			Help: "helpless",
+		},
+		[]string{"pool"},
+	)
+	countChildren := func() int {
+		vec.mtx.RLock()
+		defer vec.mtx.RUnlock()
+		n := 0
+		for _, metrics := range vec.children {
+			n += len(metrics)
+		}
+		return n
+	}
+
+	a := vec.WithLabelValues("a")
+	a.Inc()
+	a.Inc()
+	vec.WithLabelValues("b").Inc()
+	if want, got := 2, countChildren(); want != got {
+		t.Fatalf("want %d children, got %d", want, got)
+	}
+	a.Dec()
+	if want, got := 2, countChildren(); want != got {
+		t.Fatalf("want %d children, got %d", want, got)
+	}
+	a.Dec()
+	if want, got := 1, countChildren(); want != got {
+		t.Fatalf("want %d children after reaching zero, got %d", want, got)
+	}
+
+	// Using the deleted Gauge again re-adds it.
+	a.Inc()
+	if want, got := 2, countChildren(); want != got {
+		t.Fatalf("want %d children after re-use, got %d", want, got)
+	}
+	if vec.WithLabelValues("a") != a {
+		t.Error("expected re-added gauge to be returned")
+	}
+	// A new Gauge with the same label values shares the state.
+	vec.WithLabelValues("b").Set(0)
+	b := vec.WithLabelValues("b")
+	b.Add(3)
+	vec.WithLabelValues("b").Sub(3)
+	if want, got := 1, countChildren(); want != got {
+		t.Fatalf("want %d children, got %d", want, got)
+	}
+}
+
+func TestAutoDeleteGaugeVecConcurrency(t *testing.T) {
+	vec := NewAutoDeleteGaugeVec(
+		GaugeOpts{
+			Name: "test",
+			Help: "helpless",
+		},
+		[]string{"pool"},
+	)
+
+	var start, end sync.WaitGroup
+	start.Add(1)
+	for i := 0; i < 8; i++ {
+		end.Add(1)
+		go func() {
+			defer end.Done()
+			start.Wait()
+			for j := 0; j < 1000; j++ {
+				g := vec.WithLabelValues("pool")
+				g.Inc()
+				vec.WithLabelValues("pool").Dec()
+			}
+		}()
+	}
+	vec.WithLabelValues("pool").Inc()
+	start.Done()
+	end.Wait()
+
+	m := &dto.Metric{}
+	vec.WithLabelValues("pool").Write(m)
+	if want, got := 1., m.GetGauge().GetValue(); want != got {
+		t.Errorf("want %f, got %f", want, got)
+	}
+}
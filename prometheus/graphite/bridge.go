@@ -76,6 +76,24 @@ type Config struct {
 	// logged regardless of the configured ErrorHandling provided Logger
 	// is not nil.
 	ErrorHandling HandlerErrorHandling
+
+	// LabelMapper defines how labels are flattened into the Graphite
+	// path. Defaults to DefaultLabelMapper.
+	LabelMapper LabelMapper
+}
+
+// LabelMapper maps a label pair to an element of the Graphite path. If ok is
+// false, the label is omitted from the path. The returned element is sanitized
+// like the rest of the path, with spaces turning into path separators. The
+// elements of all labels of a sample are appended to the metric name in the
+// lexicographical order of the label names.
+type LabelMapper func(name, value string) (element string, ok bool)
+
+// DefaultLabelMapper is the LabelMapper used if none is configured. It turns
+// every label into two path elements, the label name followed by the label
+// value.
+func DefaultLabelMapper(name, value string) (string, bool) {
+	return name + " " + value, true
 }
 
 // Bridge pushes metrics to the configured Graphite server.
@@ -87,6 +105,7 @@ type Bridge struct {
 
 	errorHandling HandlerErrorHandling
 	logger        Logger
+	labelMapper   LabelMapper
 
 	g prometheus.Gatherer
 }
@@ -136,6 +155,12 @@ func NewBridge(c *Config) (*Bridge, error) {
 
 	b.errorHandling = c.ErrorHandling
 
+	if c.LabelMapper == nil {
+		b.labelMapper = DefaultLabelMapper
+	} else {
+		b.labelMapper = c.LabelMapper
+	}
+
 	return b, nil
 }
 
@@ -178,10 +203,10 @@ func (b *Bridge) Push() error {
 	}
 	defer conn.Close()
 
-	return writeMetrics(conn, mfs, b.prefix, model.Now())
+	return writeMetrics(conn, mfs, b.prefix, b.labelMapper, model.Now())
 }
 
-func writeMetrics(w io.Writer, mfs []*dto.MetricFamily, prefix string, now model.Time) error {
+func writeMetrics(w io.Writer, mfs []*dto.MetricFamily, prefix string, mapper LabelMapper, now model.Time) error {
 	vec, err := expfmt.ExtractSamples(&expfmt.DecodeOptions{
 		Timestamp: now,
 	}, mfs...)
@@ -197,7 +222,7 @@ func writeMetrics(w io.Writer, mfs []*dto.MetricFamily, prefix string, now model
 		if err := buf.WriteByte('.'); err != nil {
 			return err
 		}
-		if err := writeMetric(buf, s.Metric); err != nil {
+		if err := writeMetric(buf, s.Metric, mapper); err != nil {
 			return err
 		}
 		if _, err := fmt.Fprintf(buf, " %g %d\n", s.Value, int64(s.Timestamp)/millisecondsPerSecond); err != nil {
@@ -211,19 +236,24 @@ func writeMetrics(w io.Writer, mfs []*dto.MetricFamily, prefix string, now model
 	return nil
 }
 
-func writeMetric(buf *bufio.Writer, m model.Metric) error {
+func writeMetric(buf *bufio.Writer, m model.Metric, mapper LabelMapper) error {
 	metricName, hasName := m[model.MetricNameLabel]
-	numLabels := len(m) - 1
-	if !hasName {
-		numLabels = len(m)
-	}
 
-	labelStrings := make([]string, 0, numLabels)
-	for label, value := range m {
+	labelNames := make([]string, 0, len(m))
+	for label := range m {
 		if label != model.MetricNameLabel {
-			labelStrings = append(labelStrings, fmt.Sprintf("%s %s", string(label), string(value)))
+			labelNames = append(labelNames, string(label))
+		}
+	}
+	sort.Strings(labelNames)
+
+	labelStrings := make([]string, 0, len(labelNames))
+	for _, label := range labelNames {
+		if s, ok := mapper(label, string(m[model.LabelName(label)])); ok {
+			labelStrings = append(labelStrings, s)
 		}
 	}
+	numLabels := len(labelStrings)
 
 	var err error
 	switch numLabels {
@@ -232,7 +262,6 @@ func writeMetric(buf *bufio.Writer, m model.Metric) error {
 			return writeSanitized(buf, string(metricName))
 		}
 	default:
-		sort.Strings(labelStrings)
 		if err = writeSanitized(buf, string(metricName)); err != nil {
 			return err
 		}
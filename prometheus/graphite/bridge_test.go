@@ -74,7 +74,7 @@ func TestWriteSummary(t *testing.T) {
 
 	now := model.Time(1477043083)
 	var buf bytes.Buffer
-	err = writeMetrics(&buf, mfs, "prefix", now)
+	err = writeMetrics(&buf, mfs, "prefix", DefaultLabelMapper, now)
 	if err != nil {
 		t.Fatalf("error: %v", err)
 	}
@@ -124,7 +124,7 @@ func TestWriteHistogram(t *testing.T) {
 
 	now := model.Time(1477043083)
 	var buf bytes.Buffer
-	err = writeMetrics(&buf, mfs, "prefix", now)
+	err = writeMetrics(&buf, mfs, "prefix", DefaultLabelMapper, now)
 	if err != nil {
 		t.Fatalf("error: %v", err)
 	}
@@ -174,7 +174,7 @@ prefix.name.constname.constvalue.labelname.val2 1 1477043
 
 	now := model.Time(1477043083)
 	var buf bytes.Buffer
-	err = writeMetrics(&buf, mfs, "prefix", now)
+	err = writeMetrics(&buf, mfs, "prefix", DefaultLabelMapper, now)
 	if err != nil {
 		t.Fatalf("error: %v", err)
 	}
@@ -184,6 +184,45 @@ prefix.name.constname.constvalue.labelname.val2 1 1477043
 	}
 }
 
+func TestLabelMapper(t *testing.T) {
+	cntVec := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "name",
+			Help:        "docstring",
+			ConstLabels: prometheus.Labels{"constname": "constvalue"},
+		},
+		[]string{"labelname"},
+	)
+	cntVec.WithLabelValues("val1").Inc()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(cntVec)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	// Drop the constant label and only keep the value of the other one.
+	mapper := func(name, value string) (string, bool) {
+		if name == "constname" {
+			return "", false
+		}
+		return value, true
+	}
+
+	now := model.Time(1477043083)
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, mfs, "prefix", mapper, now); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	want := "prefix.name.val1 1 1477043\n"
+	if got := buf.String(); want != got {
+		t.Fatalf("wanted \n%s\n, got \n%s\n", want, got)
+	}
+}
+
 func TestPush(t *testing.T) {
 	reg := prometheus.NewRegistry()
 	cntVec := prometheus.NewCounterVec(
@@ -18,6 +18,7 @@ import (
 	"math"
 	"sort"
 	"sync/atomic"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 
@@ -47,6 +48,25 @@ type Histogram interface {
 	Observe(float64)
 }
 
+// ManyObserver is implemented by the Histograms created by this package
+// (including those in a HistogramVec). Use a type assertion to access it.
+type ManyObserver interface {
+	// ObserveMany adds the same observation n times to the histogram. It
+	// is equivalent to, but much cheaper than, calling Observe n times,
+	// which is useful for callers that aggregate observations before
+	// recording them.
+	ObserveMany(v float64, n uint64)
+}
+
+// BucketsReporter is implemented by the Histograms created by this package
+// (including those in a HistogramVec). Use a type assertion to access it.
+type BucketsReporter interface {
+	// Buckets returns the upper bounds of the buckets of the histogram in
+	// increasing order. The implicit +Inf bucket is not included. The
+	// returned slice is a copy and may be modified freely.
+	Buckets() []float64
+}
+
 // bucketLabel is used for the label that defines the upper bound of a
 // bucket of a histogram ("le" -> "less or equal").
 const bucketLabel = "le"
@@ -107,6 +127,70 @@ func ExponentialBuckets(start, factor float64, count int) []float64 {
 	return buckets
 }
 
+// ExponentialBucketsRange creates 'count' buckets, where the lowest bucket has
+// an upper bound of 'min', the highest bucket has an upper bound of 'max' (up
+// to floating point precision), and each following bucket's upper bound is the
+// previous bucket's upper bound times a constant factor. The final +Inf bucket
+// is not counted and not included in the returned slice. The returned slice is
+// meant to be used for the Buckets field of HistogramOpts.
+//
+// The function panics if 'count' is less than 2, if 'min' is 0 or negative,
+// or if 'max' is less than or equal 'min'.
+func ExponentialBucketsRange(min, max float64, count int) []float64 {
+	if count < 2 {
+		panic("ExponentialBucketsRange needs a count of at least 2")
+	}
+	if min <= 0 {
+		panic("ExponentialBucketsRange needs a positive min value")
+	}
+	if max <= min {
+		panic("ExponentialBucketsRange needs a max value greater than the min value")
+	}
+	factor := math.Pow(max/min, 1/float64(count-1))
+	return ExponentialBuckets(min, factor, count)
+}
+
+// LatencyBuckets creates buckets suitable to observe durations in seconds. The
+// upper bounds are all the durations between 'min' and 'max' (inclusive) that
+// are 1, 2.5, or 5 times a power of ten, e.g. 1ms, 2.5ms, 5ms, 10ms, 25ms,
+// etc. Such aligned bucket boundaries are easy to read and to aggregate across
+// histograms. (DefBuckets are the same as LatencyBuckets(5*time.Millisecond,
+// 10*time.Second).) The final +Inf bucket is not included in the returned
+// slice. The returned slice is meant to be used for the Buckets field of
+// HistogramOpts.
+//
+// The function panics if 'min' is 0 or negative, or if the returned slice
+// would be empty.
+func LatencyBuckets(min, max time.Duration) []float64 {
+	if min <= 0 {
+		panic("LatencyBuckets needs a positive min duration")
+	}
+	var buckets []float64
+	// Calculate in tenths of nanoseconds to represent 2.5 exactly.
+	for pow := int64(1); pow <= math.MaxInt64/50; pow *= 10 {
+		for _, mantissa := range []int64{10, 25, 50} {
+			tenths := mantissa * pow
+			if tenths%10 != 0 {
+				continue
+			}
+			d := time.Duration(tenths / 10)
+			if d > max {
+				break
+			}
+			if d >= min {
+				buckets = append(buckets, d.Seconds())
+			}
+		}
+		if time.Duration(pow) > max {
+			break
+		}
+	}
+	if len(buckets) == 0 {
+		panic("LatencyBuckets needs a duration range containing at least one bucket boundary")
+	}
+	return buckets
+}
+
 // HistogramOpts bundles the options for creating a Histogram metric. It is
 // mandatory to set Name and Help to a non-empty string. All other fields are
 // optional and can safely be left at their zero value.
@@ -145,6 +229,48 @@ type HistogramOpts struct {
 	// metric name).
 	ConstLabels Labels
 
+	// LabelConstraints maps variable label names of a metric vector to
+	// functions that are applied to each value of the respective label
+	// before it is used, e.g. to map HTTP status codes to their class or
+	// to replace values outside of a bounded set with a fallback value.
+	// This keeps unbounded input from creating an unbounded number of
+	// series. Constraints for label names that are not variable labels of
+	// the vector are reported as an error upon registration. The field is
+	// ignored when creating a single metric (rather than a vector).
+	LabelConstraints map[string]LabelConstraint
+
+	// MaxLabelSets limits the number of label sets (i.e. the number of
+	// metrics) a metric vector keeps, to protect against label values
+	// that explode the number of series. Zero means no limit. What happens
+	// if a new label set is requested once the limit has been reached is
+	// determined by LabelSetOverflow. The field is ignored when creating a
+	// single metric (rather than a vector).
+	MaxLabelSets int
+	// LabelSetOverflow determines how a metric vector handles a new label
+	// set if MaxLabelSets has been reached. The default is
+	// LabelSetOverflowDrop.
+	LabelSetOverflow LabelSetOverflowPolicy
+	// LabelSetOverflowCounter, if not nil, is incremented each time a
+	// metric vector handles a new label set according to LabelSetOverflow
+	// because MaxLabelSets has been reached. It has to be registered
+	// separately.
+	LabelSetOverflowCounter Counter
+
+	// LabelSetTTL, if positive, makes a metric vector delete a label set
+	// (i.e. a metric) upon collection if the label set has not been
+	// retrieved (via WithLabelValues, With, GetMetricWithLabelValues, or
+	// GetMetricWith) within the duration. This is useful for label values
+	// that are only relevant for a short time. Note that keeping a
+	// retrieved metric to change it repeatedly does not count as a
+	// retrieval. The time is told by the DefaultClock at creation time of
+	// the vector. The field is ignored when creating a single metric
+	// (rather than a vector).
+	LabelSetTTL time.Duration
+	// LabelSetExpiredCounter, if not nil, is increased by the number of
+	// label sets deleted because of LabelSetTTL. It has to be registered
+	// separately.
+	LabelSetExpiredCounter Counter
+
 	// Buckets defines the buckets into which observations are counted. Each
 	// element in the slice is the upper inclusive bound of a bucket. The
 	// values must be sorted in strictly increasing order. There is no need
@@ -193,11 +319,17 @@ func newHistogram(desc *Desc, opts HistogramOpts, labelValues ...string) Histogr
 		labelPairs:  makeLabelPairs(desc, labelValues),
 	}
 	for i, upperBound := range h.upperBounds {
+		if math.IsNaN(upperBound) {
+			panic(fmt.Errorf(
+				"histogram %s: bucket %d has a NaN upper bound",
+				desc.fqName, i,
+			))
+		}
 		if i < len(h.upperBounds)-1 {
 			if upperBound >= h.upperBounds[i+1] {
 				panic(fmt.Errorf(
-					"histogram buckets must be in increasing order: %f >= %f",
-					upperBound, h.upperBounds[i+1],
+					"histogram %s: buckets must be in increasing order, but bucket %d (%g) >= bucket %d (%g)",
+					desc.fqName, i, upperBound, i+1, h.upperBounds[i+1],
 				))
 			}
 		} else {
@@ -237,21 +369,36 @@ func (h *histogram) Desc() *Desc {
 	return h.desc
 }
 
+// maxLinearSearchBuckets is the number of buckets up to which a linear search
+// is used to find the bucket for an observation. For small numbers of buckets,
+// a linear search is faster than a binary search.
+//
+// Microbenchmarks (BenchmarkHistogramNoLabels):
+// 11 buckets: 38.3 ns/op linear - binary 48.7 ns/op
+// 100 buckets: 78.1 ns/op linear - binary 54.9 ns/op
+// 300 buckets: 154 ns/op linear - binary 61.6 ns/op
+const maxLinearSearchBuckets = 35
+
 func (h *histogram) Observe(v float64) {
-	// TODO(beorn7): For small numbers of buckets (<30), a linear search is
-	// slightly faster than the binary search. If we really care, we could
-	// switch from one search strategy to the other depending on the number
-	// of buckets.
-	//
-	// Microbenchmarks (BenchmarkHistogramNoLabels):
-	// 11 buckets: 38.3 ns/op linear - binary 48.7 ns/op
-	// 100 buckets: 78.1 ns/op linear - binary 54.9 ns/op
-	// 300 buckets: 154 ns/op linear - binary 61.6 ns/op
-	i := sort.SearchFloat64s(h.upperBounds, v)
-	if i < len(h.counts) {
-		atomic.AddUint64(&h.counts[i], 1)
-	}
-	atomic.AddUint64(&h.count, 1)
+	h.observe(v, 1)
+}
+
+// ObserveMany implements ManyObserver.
+func (h *histogram) ObserveMany(v float64, n uint64) {
+	if n == 0 {
+		return
+	}
+	h.observe(v, n)
+}
+
+func (h *histogram) observe(v float64, n uint64) {
+	if i := h.findBucket(v); i < len(h.counts) {
+		atomic.AddUint64(&h.counts[i], n)
+	}
+	atomic.AddUint64(&h.count, n)
+	if n > 1 {
+		v *= float64(n)
+	}
 	for {
 		oldBits := atomic.LoadUint64(&h.sumBits)
 		newBits := math.Float64bits(math.Float64frombits(oldBits) + v)
@@ -261,6 +408,29 @@ func (h *histogram) Observe(v float64) {
 	}
 }
 
+// findBucket returns the index of the bucket v belongs to. It returns
+// len(h.upperBounds) if v belongs to the implicit +Inf bucket.
+func (h *histogram) findBucket(v float64) int {
+	if len(h.upperBounds) > maxLinearSearchBuckets {
+		return sort.SearchFloat64s(h.upperBounds, v)
+	}
+	for i, upperBound := range h.upperBounds {
+		if v <= upperBound {
+			return i
+		}
+	}
+	return len(h.upperBounds)
+}
+
+// Buckets implements BucketsReporter.
+func (h *histogram) Buckets() []float64 {
+	// h.upperBounds is never changed after construction, so no
+	// synchronization is needed.
+	buckets := make([]float64, len(h.upperBounds))
+	copy(buckets, h.upperBounds)
+	return buckets
+}
+
 func (h *histogram) Write(out *dto.Metric) error {
 	his := &dto.Histogram{}
 	buckets := make([]*dto.Bucket, len(h.upperBounds))
@@ -300,7 +470,7 @@ func NewHistogramVec(opts HistogramOpts, labelNames []string) *HistogramVec {
 		opts.ConstLabels,
 	)
 	return &HistogramVec{
-		metricVec: newMetricVec(desc, func(lvs ...string) Metric {
+		metricVec: newMetricVec(desc, opts.vecOpts(), func(lvs ...string) Metric {
 			return newHistogram(desc, opts, lvs...)
 		}),
 	}
@@ -373,6 +543,45 @@ func (m *HistogramVec) With(labels Labels) Observer {
 	return m.metricVec.with(labels).(Observer)
 }
 
+// WithPreparedLabelValues returns the Histogram for the provided PreparedLabelValues
+// (see PrepareLabelValues). If the Histogram does not exist (anymore), a new Histogram is
+// created. It panics if the PreparedLabelValues have been prepared by a
+// different HistogramVec (curried versions of the same HistogramVec are fine).
+func (m *HistogramVec) WithPreparedLabelValues(p PreparedLabelValues) Observer {
+	return m.metricVec.withPreparedLabelValues(p).(Observer)
+}
+
+// CurryWith returns a vector curried with the provided labels, i.e. the
+// returned vector has those labels pre-set for all labeled operations performed
+// on it. The cardinality of the curried vector is reduced accordingly. The
+// order of the remaining labels stays the same (just with the curried labels
+// taken out of the sequence – which is relevant for the
+// (GetMetric)WithLabelValues methods). It is possible to curry a curried
+// vector, but only with labels not yet used for currying before.
+//
+// The metrics contained in the HistogramVec are shared between the curried and
+// uncurried vectors. They are just accessed differently. Curried and uncurried
+// vectors behave identically in terms of collection. Only one must be
+// registered with a given registry (usually the uncurried version). The Reset
+// method deletes all metrics, even if called on a curried vector.
+func (m *HistogramVec) CurryWith(labels Labels) (ObserverVec, error) {
+	vec, err := m.curryWith(labels)
+	if vec != nil {
+		return &HistogramVec{vec}, err
+	}
+	return nil, err
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *HistogramVec) MustCurryWith(labels Labels) ObserverVec {
+	vec, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return vec
+}
+
 type constHistogram struct {
 	desc       *Desc
 	count      uint64
@@ -21,6 +21,7 @@ import (
 	"sync"
 	"testing"
 	"testing/quick"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
 )
@@ -124,6 +125,7 @@ func TestHistogramNonMonotonicBuckets(t *testing.T) {
 		"not strictly monotonic":  {1, 2, 2, 3},
 		"not monotonic at all":    {1, 2, 4, 3, 5},
 		"have +Inf in the middle": {1, 2, math.Inf(+1), 3},
+		"contain NaN":             {1, math.NaN(), 3},
 	}
 	for name, buckets := range testCases {
 		func() {
@@ -343,6 +345,97 @@ func TestBuckets(t *testing.T) {
 	got = ExponentialBuckets(100, 1.2, 3)
 	want = []float64{100, 120, 144}
 	if !reflect.DeepEqual(got, want) {
-		t.Errorf("linear buckets: got %v, want %v", got, want)
+		t.Errorf("exponential buckets: got %v, want %v", got, want)
+	}
+
+	got = ExponentialBucketsRange(1, 100, 3)
+	want = []float64{1, 10, 100}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("exponential buckets range: got %v, want %v", got, want)
+	}
+
+	got = LatencyBuckets(5*time.Millisecond, 10*time.Second)
+	if !reflect.DeepEqual(got, DefBuckets) {
+		t.Errorf("latency buckets: got %v, want %v", got, DefBuckets)
+	}
+	got = LatencyBuckets(time.Nanosecond, 30*time.Nanosecond)
+	want = []float64{1e-9, 5e-9, 10e-9, 25e-9}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("latency buckets: got %v, want %v", got, want)
+	}
+	got = LatencyBuckets(2*time.Millisecond, 3*time.Millisecond)
+	want = []float64{.0025}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("latency buckets: got %v, want %v", got, want)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	his := NewHistogram(HistogramOpts{
+		Name:    "test_histogram",
+		Help:    "helpless",
+		Buckets: []float64{1, 2, 5, math.Inf(+1)},
+	})
+
+	got := his.(BucketsReporter).Buckets()
+	if want := []float64{1, 2, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got buckets %v, want %v", got, want)
+	}
+	got[0] = 42
+	if want, got := 1., his.(BucketsReporter).Buckets()[0]; want != got {
+		t.Errorf("modifying the returned buckets changed the histogram, got %f, want %f", got, want)
+	}
+
+	if got, want := NewHistogram(HistogramOpts{Name: "default"}).(BucketsReporter).Buckets(), DefBuckets; !reflect.DeepEqual(got, want) {
+		t.Errorf("got buckets %v, want %v", got, want)
+	}
+
+	vec := NewHistogramVec(HistogramOpts{Name: "vec", Buckets: []float64{1, 2}}, []string{"l"})
+	if br, ok := vec.WithLabelValues("a").(BucketsReporter); !ok {
+		t.Error("Histogram in HistogramVec does not implement BucketsReporter")
+	} else if got, want := br.Buckets(), []float64{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got buckets %v, want %v", got, want)
+	}
+}
+
+func TestHistogramObserveMany(t *testing.T) {
+	his := NewHistogram(HistogramOpts{
+		Name:    "test_histogram",
+		Help:    "helpless",
+		Buckets: []float64{1, 2, 5},
+	})
+	his.(ManyObserver).ObserveMany(1.5, 3)
+	his.(ManyObserver).ObserveMany(4, 0)
+	his.Observe(10)
+
+	m := &dto.Metric{}
+	his.Write(m)
+	if want, got := uint64(4), m.GetHistogram().GetSampleCount(); want != got {
+		t.Errorf("got sample count %d, want %d", got, want)
+	}
+	if want, got := 14.5, m.GetHistogram().GetSampleSum(); want != got {
+		t.Errorf("got sample sum %f, want %f", got, want)
+	}
+	got := []uint64{}
+	for _, b := range m.GetHistogram().GetBucket() {
+		got = append(got, b.GetCumulativeCount())
+	}
+	if want := []uint64{0, 3, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got cumulative counts %v, want %v", got, want)
+	}
+}
+
+func TestHistogramFindBucket(t *testing.T) {
+	for _, n := range []int{1, maxLinearSearchBuckets, maxLinearSearchBuckets + 1} {
+		h := NewHistogram(HistogramOpts{
+			Name:    "test_histogram",
+			Help:    "helpless",
+			Buckets: LinearBuckets(0, 1, n),
+		}).(*histogram)
+		for _, v := range []float64{-1, 0, 0.5, 1, float64(n) - 0.5, float64(n), math.Inf(+1), math.NaN()} {
+			if want, got := sort.SearchFloat64s(h.upperBounds, v), h.findBucket(v); want != got {
+				t.Errorf("%d buckets, value %v: got bucket %d, want %d", n, v, got, want)
+			}
+		}
 	}
 }
@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"strings"
 	"unicode/utf8"
-
-	"github.com/prometheus/common/model"
 )
 
 // Labels represents a collection of label name -> value mappings. This type is
@@ -18,6 +16,27 @@ import (
 // create a Desc.
 type Labels map[string]string
 
+// LabelConstraint is a function applied to a label value of a metric vector
+// before the value is used. It returns the value to use instead. See the
+// LabelConstraints field of Opts.
+type LabelConstraint func(value string) string
+
+// LabelValueSet returns a LabelConstraint that passes through the provided
+// values and replaces every other value with fallback, e.g.:
+//     LabelValueSet("other", "GET", "POST", "PUT", "DELETE")
+func LabelValueSet(fallback string, values ...string) LabelConstraint {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return func(value string) string {
+		if _, ok := set[value]; ok {
+			return value
+		}
+		return fallback
+	}
+}
+
 // reservedLabelPrefix is a prefix which is not legal in user-supplied
 // label names.
 const reservedLabelPrefix = "__"
@@ -53,5 +72,5 @@ func validateLabelValues(vals []string, expectedNumberOfValues int) error {
 }
 
 func checkLabelName(l string) bool {
-	return model.LabelName(l).IsValid() && !strings.HasPrefix(l, reservedLabelPrefix)
+	return isValidLabelName(l) && !strings.HasPrefix(l, reservedLabelPrefix)
 }
@@ -15,6 +15,9 @@ package prometheus
 
 import (
 	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
 
 	dto "github.com/prometheus/client_model/go"
 )
@@ -94,6 +97,48 @@ type Opts struct {
 	// that label most likely should not be a label at all (but part of the
 	// metric name).
 	ConstLabels Labels
+
+	// LabelConstraints maps variable label names of a metric vector to
+	// functions that are applied to each value of the respective label
+	// before it is used, e.g. to map HTTP status codes to their class or
+	// to replace values outside of a bounded set with a fallback value.
+	// This keeps unbounded input from creating an unbounded number of
+	// series. Constraints for label names that are not variable labels of
+	// the vector are reported as an error upon registration. The field is
+	// ignored when creating a single metric (rather than a vector).
+	LabelConstraints map[string]LabelConstraint
+
+	// MaxLabelSets limits the number of label sets (i.e. the number of
+	// metrics) a metric vector keeps, to protect against label values
+	// that explode the number of series. Zero means no limit. What happens
+	// if a new label set is requested once the limit has been reached is
+	// determined by LabelSetOverflow. The field is ignored when creating a
+	// single metric (rather than a vector).
+	MaxLabelSets int
+	// LabelSetOverflow determines how a metric vector handles a new label
+	// set if MaxLabelSets has been reached. The default is
+	// LabelSetOverflowDrop.
+	LabelSetOverflow LabelSetOverflowPolicy
+	// LabelSetOverflowCounter, if not nil, is incremented each time a
+	// metric vector handles a new label set according to LabelSetOverflow
+	// because MaxLabelSets has been reached. It has to be registered
+	// separately.
+	LabelSetOverflowCounter Counter
+
+	// LabelSetTTL, if positive, makes a metric vector delete a label set
+	// (i.e. a metric) upon collection if the label set has not been
+	// retrieved (via WithLabelValues, With, GetMetricWithLabelValues, or
+	// GetMetricWith) within the duration. This is useful for label values
+	// that are only relevant for a short time. Note that keeping a
+	// retrieved metric to change it repeatedly does not count as a
+	// retrieval. The time is told by the DefaultClock at creation time of
+	// the vector. The field is ignored when creating a single metric
+	// (rather than a vector).
+	LabelSetTTL time.Duration
+	// LabelSetExpiredCounter, if not nil, is increased by the number of
+	// label sets deleted because of LabelSetTTL. It has to be registered
+	// separately.
+	LabelSetExpiredCounter Counter
 }
 
 // BuildFQName joins the given three name components by "_". Empty name
@@ -164,3 +209,30 @@ func NewInvalidMetric(desc *Desc, err error) Metric {
 func (m *invalidMetric) Desc() *Desc { return m.desc }
 
 func (m *invalidMetric) Write(*dto.Metric) error { return m.err }
+
+type timestampedMetric struct {
+	Metric
+	t time.Time
+}
+
+func (m timestampedMetric) Write(pb *dto.Metric) error {
+	e := m.Metric.Write(pb)
+	pb.TimestampMs = proto.Int64(m.t.Unix()*1000 + int64(m.t.Nanosecond()/1000000))
+	return e
+}
+
+// NewMetricWithTimestamp returns a new Metric wrapping the provided Metric in a
+// way that it has an explicit timestamp set to the provided Time. This is only
+// useful in rare cases as the timestamp of a Prometheus metric should usually
+// be set by the Prometheus server during scraping. Exceptions include mirroring
+// metrics with given timestamps from other metric sources.
+//
+// NewMetricWithTimestamp works best with MustNewConstMetric,
+// MustNewConstHistogram, and MustNewConstSummary, see example.
+//
+// Currently, the exposition formats used by Prometheus are limited to
+// millisecond resolution. Thus, the provided time will be rounded down to the
+// next full millisecond value.
+func NewMetricWithTimestamp(t time.Time, m Metric) Metric {
+	return timestampedMetric{Metric: m, t: t}
+}
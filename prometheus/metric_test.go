@@ -13,7 +13,12 @@
 
 package prometheus
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
 
 func TestBuildFQName(t *testing.T) {
 	scenarios := []struct{ namespace, subsystem, name, result string }{
@@ -33,3 +38,44 @@ func TestBuildFQName(t *testing.T) {
 		}
 	}
 }
+
+func TestNewMetricWithTimestamp(t *testing.T) {
+	desc := NewDesc("mirrored", "A mirrored metric.", nil, nil)
+	ts := time.Unix(1257894000, 12345678)
+	m := NewMetricWithTimestamp(ts, MustNewConstMetric(desc, GaugeValue, 42))
+
+	if m.Desc() != desc {
+		t.Errorf("unexpected desc %s", m.Desc())
+	}
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := int64(1257894000012), pb.GetTimestampMs(); want != got {
+		t.Errorf("want timestamp %d, got %d", want, got)
+	}
+	if want, got := 42.0, pb.GetGauge().GetValue(); want != got {
+		t.Errorf("want value %v, got %v", want, got)
+	}
+}
+
+func TestIsBuiltinCollector(t *testing.T) {
+	scenarios := []struct {
+		c    Collector
+		want bool
+	}{
+		{NewCounter(CounterOpts{Name: "c", Help: "help"}), true},
+		{NewGauge(GaugeOpts{Name: "g", Help: "help"}), true},
+		{NewHistogram(HistogramOpts{Name: "h", Help: "help"}), true},
+		{NewSummary(SummaryOpts{Name: "s", Help: "help"}), true},
+		{NewCounterVec(CounterOpts{Name: "cv", Help: "help"}, []string{"l"}), true},
+		{NewCounterFunc(CounterOpts{Name: "cf", Help: "help"}, func() float64 { return 1 }), false},
+		{NewGaugeFunc(GaugeOpts{Name: "gf", Help: "help"}, func() float64 { return 1 }), false},
+		{NewUntypedFunc(UntypedOpts{Name: "uf", Help: "help"}, func() float64 { return 1 }), false},
+	}
+	for i, s := range scenarios {
+		if got := isBuiltinCollector(s.c); got != s.want {
+			t.Errorf("%d. got %t, want %t", i, got, s.want)
+		}
+	}
+}
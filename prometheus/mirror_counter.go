@@ -0,0 +1,122 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// MirrorCounter is a Metric that mirrors a counter maintained by an external
+// system (e.g. a counter read from a device or from the statistics of another
+// process). In contrast to a Counter, it can be set to the absolute value
+// reported by the external system, and the time the value was observed at can
+// be exposed as the timestamp of the metric.
+//
+// If the mirrored counter is reset (i.e. its reported value decreases), the
+// MirrorCounter detects the reset and continues counting from the last value
+// it has exposed, so that the exposed value never decreases.
+//
+// To create MirrorCounter instances, use NewMirrorCounter.
+type MirrorCounter interface {
+	Metric
+	Collector
+
+	// SetTotal sets the MirrorCounter to the absolute value v reported by
+	// the mirrored counter at time ts. A value lower than the previously
+	// reported one is interpreted as a reset of the mirrored counter. If
+	// ts is the zero time, no timestamp is exposed, i.e. the time of the
+	// scrape is used by the Prometheus server.
+	SetTotal(v float64, ts time.Time)
+	// AddWithTimestamp adds v to the MirrorCounter and sets its timestamp
+	// to ts (or removes the timestamp if ts is the zero time). It panics if
+	// v is < 0. The added values are tracked separately from the values
+	// set with SetTotal, i.e. they are exposed on top of the mirrored
+	// counter and are not taken into account by the reset detection of
+	// SetTotal.
+	AddWithTimestamp(v float64, ts time.Time)
+}
+
+// NewMirrorCounter creates a new MirrorCounter based on the provided
+// CounterOpts.
+func NewMirrorCounter(opts CounterOpts) MirrorCounter {
+	desc := NewDesc(
+		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		opts.Help,
+		nil,
+		opts.ConstLabels,
+	)
+	result := &mirrorCounter{desc: desc, labelPairs: desc.constLabelPairs}
+	result.init(result) // Init self-collection.
+	return result
+}
+
+type mirrorCounter struct {
+	selfCollector
+
+	desc       *Desc
+	labelPairs []*dto.LabelPair
+
+	mtx      sync.Mutex
+	offset   float64 // Sum of the last reported values before each reset.
+	reported float64 // Last value reported by the mirrored counter.
+	added    float64 // Sum of the values added with AddWithTimestamp.
+	ts       time.Time
+}
+
+func (c *mirrorCounter) Desc() *Desc {
+	return c.desc
+}
+
+func (c *mirrorCounter) SetTotal(v float64, ts time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if v < c.reported {
+		c.offset += c.reported
+	}
+	c.reported = v
+	c.ts = ts
+}
+
+func (c *mirrorCounter) AddWithTimestamp(v float64, ts time.Time) {
+	if v < 0 {
+		panic(errors.New("counter cannot decrease in value"))
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.added += v
+	c.ts = ts
+}
+
+func (c *mirrorCounter) Write(out *dto.Metric) error {
+	c.mtx.Lock()
+	val, ts := c.offset+c.reported+c.added, c.ts
+	c.mtx.Unlock()
+
+	if err := populateMetric(CounterValue, val, c.labelPairs, out); err != nil {
+		return err
+	}
+	if !ts.IsZero() {
+		out.TimestampMs = proto.Int64(ts.Unix()*1000 + int64(ts.Nanosecond()/1000000))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMirrorCounter(t *testing.T) {
+	c := NewMirrorCounter(CounterOpts{
+		Name: "test_total",
+		Help: "test help",
+	})
+	ts := time.Unix(1500000000, 123456789)
+
+	check := func(wantValue float64, wantTimestampMs int64) {
+		m := &dto.Metric{}
+		if err := c.Write(m); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.GetCounter().GetValue(); got != wantValue {
+			t.Errorf("got value %v, want %v", got, wantValue)
+		}
+		if got := m.GetTimestampMs(); got != wantTimestampMs {
+			t.Errorf("got timestamp %d, want %d", got, wantTimestampMs)
+		}
+	}
+
+	check(0, 0)
+	c.SetTotal(10, ts)
+	check(10, 1500000000123)
+	c.SetTotal(15, ts.Add(time.Second))
+	check(15, 1500000001123)
+	// Reset of the mirrored counter.
+	c.SetTotal(3, ts.Add(2*time.Second))
+	check(18, 1500000002123)
+	c.AddWithTimestamp(2, time.Time{})
+	check(20, 0)
+	// Added values do not affect the reset detection of SetTotal.
+	c.SetTotal(4, ts)
+	check(21, 1500000000123)
+	c.SetTotal(1, ts)
+	check(22, 1500000000123)
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("negative AddWithTimestamp did not panic")
+		}
+	}()
+	c.AddWithTimestamp(-1, ts)
+}
@@ -0,0 +1,342 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multiprocess
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/common/expfmt"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pidLabel is the label added to gauges aggregated with GaugePerProcess.
+const pidLabel = "pid"
+
+// GaugeAggregation determines how the values of a gauge (or of an untyped
+// metric) from different processes are aggregated.
+type GaugeAggregation int
+
+// Supported GaugeAggregations. Counters are always summed up. So are the
+// counts, sums, and buckets of histograms and the counts and sums of
+// summaries. (The quantiles of summaries cannot be aggregated and are
+// dropped.)
+const (
+	// GaugePerProcess keeps the value of each process, distinguished by
+	// an additional label "pid".
+	GaugePerProcess GaugeAggregation = iota
+	// GaugeSum sums up the values of all processes.
+	GaugeSum
+	// GaugeMin takes the minimum of the values of all processes.
+	GaugeMin
+	// GaugeMax takes the maximum of the values of all processes.
+	GaugeMax
+)
+
+// GathererOpts configures the Gatherer returned by NewGatherer.
+type GathererOpts struct {
+	// GaugeAggregation is the aggregation used for gauges and untyped
+	// metrics not listed in GaugeAggregations. The default is
+	// GaugePerProcess.
+	GaugeAggregation GaugeAggregation
+	// GaugeAggregations maps metric names to the aggregation to use for
+	// them.
+	GaugeAggregations map[string]GaugeAggregation
+}
+
+type gatherer struct {
+	dir  string
+	opts GathererOpts
+}
+
+// NewGatherer returns a Gatherer that reads all shard files in the provided
+// directory (as written by ShardWriter) upon each call of Gather and returns
+// their aggregated content. Problems with individual shard files, metric
+// families with inconsistent types or help strings across shards, histograms
+// with inconsistent bucket layouts across shards, and gauges that cannot be
+// aggregated with GaugePerProcess because they have a "pid" label already are
+// reported in the returned error, while everything else is still returned.
+//
+// Combine the returned Gatherer with the Registry of the serving process via
+// prometheus.Gatherers, but make sure that the metrics of the serving process
+// are not also written into a shard file.
+func NewGatherer(dir string, opts GathererOpts) prometheus.Gatherer {
+	return &gatherer{dir: dir, opts: opts}
+}
+
+// familyAggregate is a MetricFamily being aggregated, with its Metrics mapped
+// by their label signature.
+type familyAggregate struct {
+	mf      *dto.MetricFamily
+	metrics map[string]*dto.Metric
+}
+
+// Gather implements prometheus.Gatherer.
+func (g *gatherer) Gather() ([]*dto.MetricFamily, error) {
+	paths, err := filepath.Glob(filepath.Join(g.dir, "*"+shardSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		families = map[string]*familyAggregate{}
+		errs     prometheus.MultiError
+	)
+	for _, path := range paths {
+		pid := strings.TrimSuffix(filepath.Base(path), shardSuffix)
+		if _, err := strconv.Atoi(pid); err != nil {
+			continue // Not a shard file.
+		}
+		mfs, err := readShard(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reading shard %s failed: %s", path, err))
+			continue
+		}
+		for _, mf := range mfs {
+			errs = append(errs, g.merge(families, mf, pid)...)
+		}
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		fa := families[name]
+		if len(fa.metrics) == 0 {
+			continue // All Metrics have been skipped because of errors.
+		}
+		keys := make([]string, 0, len(fa.metrics))
+		for key := range fa.metrics {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fa.mf.Metric = append(fa.mf.Metric, fa.metrics[key])
+		}
+		result = append(result, fa.mf)
+	}
+	return result, errs.MaybeUnwrap()
+}
+
+// readShard reads all MetricFamilies from the shard file with the provided
+// path.
+func readShard(path string) ([]*dto.MetricFamily, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		mfs []*dto.MetricFamily
+		dec = expfmt.NewDecoder(f, expfmt.FmtProtoDelim)
+	)
+	for {
+		mf := &dto.MetricFamily{}
+		if err := dec.Decode(mf); err != nil {
+			if err == io.EOF {
+				return mfs, nil
+			}
+			return nil, err
+		}
+		mfs = append(mfs, mf)
+	}
+}
+
+// merge merges the provided MetricFamily, read from the shard of the process
+// with the provided PID, into the provided aggregates. Metrics that cannot be
+// merged are skipped and reported in the returned MultiError.
+func (g *gatherer) merge(families map[string]*familyAggregate, mf *dto.MetricFamily, pid string) prometheus.MultiError {
+	fa, ok := families[mf.GetName()]
+	if !ok {
+		fa = &familyAggregate{
+			mf: &dto.MetricFamily{
+				Name: mf.Name,
+				Help: mf.Help,
+				Type: mf.Type,
+			},
+			metrics: map[string]*dto.Metric{},
+		}
+		families[mf.GetName()] = fa
+	}
+	if fa.mf.GetType() != mf.GetType() || fa.mf.GetHelp() != mf.GetHelp() {
+		return prometheus.MultiError{fmt.Errorf(
+			"metric family %q of process %s has type %s and help %q, inconsistent with other processes",
+			mf.GetName(), pid, mf.GetType(), mf.GetHelp(),
+		)}
+	}
+
+	aggr := g.opts.GaugeAggregation
+	if a, ok := g.opts.GaugeAggregations[mf.GetName()]; ok {
+		aggr = a
+	}
+	isGauge := mf.GetType() == dto.MetricType_GAUGE || mf.GetType() == dto.MetricType_UNTYPED
+
+	var errs prometheus.MultiError
+	for _, m := range mf.GetMetric() {
+		labels := m.GetLabel()
+		if isGauge && aggr == GaugePerProcess {
+			if hasLabel(labels, pidLabel) {
+				errs = append(errs, fmt.Errorf(
+					"metric %q of process %s already has a label %q and cannot be aggregated per process",
+					mf.GetName(), pid, pidLabel,
+				))
+				continue
+			}
+			labels = append(labels[:len(labels):len(labels)], &dto.LabelPair{
+				Name:  proto.String(pidLabel),
+				Value: proto.String(pid),
+			})
+			sort.Sort(prometheus.LabelPairSorter(labels))
+		}
+		key := labelSignature(labels)
+		existing, ok := fa.metrics[key]
+		if !ok {
+			fa.metrics[key] = newAggregate(labels, m)
+			continue
+		}
+		if err := mergeMetric(existing, m, aggr); err != nil {
+			errs = append(errs, fmt.Errorf("metric %q of process %s: %s", mf.GetName(), pid, err))
+		}
+	}
+	return errs
+}
+
+// hasLabel returns whether the provided labels contain one with the provided
+// name.
+func hasLabel(labels []*dto.LabelPair, name string) bool {
+	for _, lp := range labels {
+		if lp.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// labelSignature returns a string uniquely identifying the provided (sorted)
+// labels.
+func labelSignature(labels []*dto.LabelPair) string {
+	parts := make([]string, 0, 2*len(labels))
+	for _, lp := range labels {
+		parts = append(parts, lp.GetName(), lp.GetValue())
+	}
+	return strings.Join(parts, "\xff")
+}
+
+// newAggregate returns a copy of the provided Metric with the provided labels
+// to aggregate the same Metric of other processes into. Timestamps and the
+// quantiles of summaries are dropped.
+func newAggregate(labels []*dto.LabelPair, m *dto.Metric) *dto.Metric {
+	aggr := &dto.Metric{Label: labels}
+	switch {
+	case m.Counter != nil:
+		aggr.Counter = &dto.Counter{Value: proto.Float64(m.Counter.GetValue())}
+	case m.Gauge != nil:
+		aggr.Gauge = &dto.Gauge{Value: proto.Float64(m.Gauge.GetValue())}
+	case m.Untyped != nil:
+		aggr.Untyped = &dto.Untyped{Value: proto.Float64(m.Untyped.GetValue())}
+	case m.Summary != nil:
+		aggr.Summary = &dto.Summary{
+			SampleCount: proto.Uint64(m.Summary.GetSampleCount()),
+			SampleSum:   proto.Float64(m.Summary.GetSampleSum()),
+		}
+	case m.Histogram != nil:
+		h := &dto.Histogram{
+			SampleCount: proto.Uint64(m.Histogram.GetSampleCount()),
+			SampleSum:   proto.Float64(m.Histogram.GetSampleSum()),
+		}
+		for _, b := range m.Histogram.GetBucket() {
+			h.Bucket = append(h.Bucket, &dto.Bucket{
+				UpperBound:      proto.Float64(b.GetUpperBound()),
+				CumulativeCount: proto.Uint64(b.GetCumulativeCount()),
+			})
+		}
+		aggr.Histogram = h
+	}
+	return aggr
+}
+
+// mergeMetric merges the provided Metric into the provided aggregate, using
+// the provided GaugeAggregation for gauges and untyped metrics. It returns an
+// error, leaving the aggregate unchanged, if the buckets of a histogram differ
+// from those of the aggregate.
+func mergeMetric(aggr, m *dto.Metric, ga GaugeAggregation) error {
+	switch {
+	case aggr.Counter != nil && m.Counter != nil:
+		aggr.Counter.Value = proto.Float64(aggr.Counter.GetValue() + m.Counter.GetValue())
+	case aggr.Gauge != nil && m.Gauge != nil:
+		aggr.Gauge.Value = proto.Float64(aggregateGauge(aggr.Gauge.GetValue(), m.Gauge.GetValue(), ga))
+	case aggr.Untyped != nil && m.Untyped != nil:
+		aggr.Untyped.Value = proto.Float64(aggregateGauge(aggr.Untyped.GetValue(), m.Untyped.GetValue(), ga))
+	case aggr.Summary != nil && m.Summary != nil:
+		aggr.Summary.SampleCount = proto.Uint64(aggr.Summary.GetSampleCount() + m.Summary.GetSampleCount())
+		aggr.Summary.SampleSum = proto.Float64(aggr.Summary.GetSampleSum() + m.Summary.GetSampleSum())
+	case aggr.Histogram != nil && m.Histogram != nil:
+		buckets := m.Histogram.GetBucket()
+		if len(buckets) != len(aggr.Histogram.Bucket) {
+			return fmt.Errorf(
+				"histogram has %d buckets, inconsistent with %d buckets of other processes",
+				len(buckets), len(aggr.Histogram.Bucket),
+			)
+		}
+		for i, b := range buckets {
+			if got, want := b.GetUpperBound(), aggr.Histogram.Bucket[i].GetUpperBound(); got != want {
+				return fmt.Errorf(
+					"histogram has a bucket with upper bound %v, inconsistent with upper bound %v of other processes",
+					got, want,
+				)
+			}
+		}
+		aggr.Histogram.SampleCount = proto.Uint64(aggr.Histogram.GetSampleCount() + m.Histogram.GetSampleCount())
+		aggr.Histogram.SampleSum = proto.Float64(aggr.Histogram.GetSampleSum() + m.Histogram.GetSampleSum())
+		for i, b := range buckets {
+			ab := aggr.Histogram.Bucket[i]
+			ab.CumulativeCount = proto.Uint64(ab.GetCumulativeCount() + b.GetCumulativeCount())
+		}
+	}
+	return nil
+}
+
+// aggregateGauge aggregates the two provided gauge values. With
+// GaugePerProcess, the values are never from the same series, so this only
+// happens if a shard contains the same series twice, in which case the later
+// value wins.
+func aggregateGauge(a, b float64, ga GaugeAggregation) float64 {
+	switch ga {
+	case GaugeSum:
+		return a + b
+	case GaugeMin:
+		if b < a {
+			return b
+		}
+		return a
+	case GaugeMax:
+		if b > a {
+			return b
+		}
+		return a
+	}
+	return b
+}
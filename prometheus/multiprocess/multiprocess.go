@@ -0,0 +1,125 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package multiprocess supports exposing the metrics of a group of processes
+// (e.g. the workers of a pre-fork server) via a single endpoint, similar to
+// the multiprocess mode of the Python client library.
+//
+// Each process writes the metrics of its own Registry as a shard file into a
+// shared directory with a ShardWriter. The process serving the metrics
+// endpoint uses a Gatherer created with NewGatherer, which reads all shard
+// files upon each scrape and aggregates their content. The shards are written
+// on demand or periodically (see ShardWriter.Run) rather than upon each change
+// of a metric, so the aggregated metrics lag behind by up to one write
+// interval.
+//
+// The shard files are not removed automatically when a process terminates,
+// because counters would otherwise go backwards. Remove the shard files of
+// terminated processes with RemoveShard once their counts are no longer needed
+// (e.g. upon restart of the whole group), and clear the directory before the
+// group starts.
+package multiprocess
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// shardSuffix is the file name suffix of shard files.
+const shardSuffix = ".shard"
+
+// shardPath returns the path of the shard file of the process with the
+// provided PID in the provided directory.
+func shardPath(dir string, pid int) string {
+	return filepath.Join(dir, strconv.Itoa(pid)+shardSuffix)
+}
+
+// ShardWriter writes the metrics gathered from a Gatherer into the shard file
+// of the current process. Create instances with NewShardWriter.
+type ShardWriter struct {
+	dir    string
+	g      prometheus.Gatherer
+	getpid func() int // Only replaced in tests.
+}
+
+// NewShardWriter returns a ShardWriter that writes the metrics gathered from
+// the provided Gatherer (usually the Registry of the current process) into the
+// provided directory. The directory must exist.
+func NewShardWriter(dir string, g prometheus.Gatherer) *ShardWriter {
+	return &ShardWriter{dir: dir, g: g, getpid: os.Getpid}
+}
+
+// Write gathers the metrics and writes them into the shard file of the current
+// process, replacing the previous content atomically. The shard file is named
+// after the PID of the process at the time Write is called, so that a forked
+// process writes into a shard file of its own.
+func (w *ShardWriter) Write() error {
+	mfs, err := w.g.Gather()
+	if err != nil {
+		return fmt.Errorf("gathering metrics failed: %s", err)
+	}
+	tmp, err := ioutil.TempFile(w.dir, "tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename.
+
+	enc := expfmt.NewEncoder(tmp, expfmt.FmtProtoDelim)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			tmp.Close()
+			return fmt.Errorf("encoding metrics failed: %s", err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), shardPath(w.dir, w.getpid()))
+}
+
+// Run calls Write at the provided interval until the provided Context is done.
+// Then it calls Write a final time and returns its error. Errors of earlier
+// calls of Write are passed to onError if it is not nil.
+func (w *ShardWriter) Run(ctx context.Context, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return w.Write()
+		case <-ticker.C:
+			if err := w.Write(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// RemoveShard removes the shard file of the process with the provided PID from
+// the provided directory. It is not an error if the file does not exist.
+func RemoveShard(dir string, pid int) error {
+	err := os.Remove(shardPath(dir, pid))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
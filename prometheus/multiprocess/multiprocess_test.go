@@ -0,0 +1,251 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multiprocess
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// workerMetrics are the metrics of one simulated worker process.
+type workerMetrics struct {
+	reg      *prometheus.Registry
+	requests *prometheus.CounterVec
+	inFlight prometheus.Gauge
+	memory   prometheus.Gauge
+	latency  prometheus.Histogram
+	sizes    prometheus.Summary
+}
+
+func newWorkerMetrics() workerMetrics {
+	w := workerMetrics{
+		reg: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{Name: "requests_total", Help: "Requests."},
+			[]string{"code"},
+		),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{Name: "in_flight", Help: "In flight."}),
+		memory:   prometheus.NewGauge(prometheus.GaugeOpts{Name: "memory_bytes", Help: "Memory."}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "latency_seconds", Help: "Latency.", Buckets: []float64{0.1, 1},
+		}),
+		sizes: prometheus.NewSummary(prometheus.SummaryOpts{Name: "sizes_bytes", Help: "Sizes."}),
+	}
+	w.reg.MustRegister(w.requests, w.inFlight, w.memory, w.latency, w.sizes)
+	return w
+}
+
+func TestGatherer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multiprocess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, pid := range []int{100, 200} {
+		w := newWorkerMetrics()
+		w.requests.WithLabelValues("200").Add(float64(10 * (i + 1)))
+		w.inFlight.Set(float64(i + 1))
+		w.memory.Set(float64(1000 * (i + 1)))
+		w.latency.Observe(0.05)
+		w.latency.Observe(0.5 * float64(i+1))
+		w.sizes.Observe(100)
+
+		sw := NewShardWriter(dir, w.reg)
+		sw.getpid = func() int { return pid }
+		if err := sw.Write(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files other than shards are ignored.
+	if err := ioutil.WriteFile(filepath.Join(dir, "other"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewGatherer(dir, GathererOpts{
+		GaugeAggregations: map[string]GaugeAggregation{"memory_bytes": GaugeMax},
+	})
+	mfs, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := `# HELP in_flight In flight.
+# TYPE in_flight gauge
+in_flight{pid="100"} 1
+in_flight{pid="200"} 2
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 4
+latency_seconds_bucket{le="+Inf"} 4
+latency_seconds_sum 1.6
+latency_seconds_count 4
+# HELP memory_bytes Memory.
+# TYPE memory_bytes gauge
+memory_bytes 2000
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{code="200"} 30
+# HELP sizes_bytes Sizes.
+# TYPE sizes_bytes summary
+sizes_bytes_sum 200
+sizes_bytes_count 2
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if err := RemoveShard(dir, 200); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveShard(dir, 200); err != nil {
+		t.Errorf("removing a missing shard failed: %s", err)
+	}
+	mfs, err = g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "requests_total" {
+			if got, want := mf.GetMetric()[0].GetCounter().GetValue(), 10.0; got != want {
+				t.Errorf("got %v requests after removing a shard, want %v", got, want)
+			}
+		}
+	}
+}
+
+func TestGathererInconsistentShards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multiprocess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for pid, help := range map[int]string{1: "Some help.", 2: "Other help."} {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "c_total", Help: help}))
+		sw := NewShardWriter(dir, reg)
+		pid := pid
+		sw.getpid = func() int { return pid }
+		if err := sw.Write(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(shardPath(dir, 3), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mfs, err := NewGatherer(dir, GathererOpts{}).Gather()
+	multiErr, ok := err.(prometheus.MultiError)
+	if !ok || len(multiErr) != 2 {
+		t.Errorf("got error %v, want two errors", err)
+	}
+	if got, want := len(mfs), 1; got != want {
+		t.Errorf("got %d metric families, want %d", got, want)
+	}
+}
+
+// writeShard writes the metrics of the provided Registry as the shard of the
+// process with the provided PID.
+func writeShard(t *testing.T, dir string, pid int, reg *prometheus.Registry) {
+	sw := NewShardWriter(dir, reg)
+	sw.getpid = func() int { return pid }
+	if err := sw.Write(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGathererInconsistentBuckets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multiprocess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Processes are read in lexicographical order of their PIDs.
+	for pid, buckets := range map[int][]float64{
+		1: {0.1, 1},
+		2: {0.5, 1},     // Different upper bound.
+		3: {0.1, 1, 10}, // Different number of buckets.
+		4: {0.1, 1},
+	} {
+		reg := prometheus.NewRegistry()
+		h := prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "latency_seconds", Help: "Latency.", Buckets: buckets,
+		})
+		h.Observe(0.05)
+		reg.MustRegister(h)
+		writeShard(t, dir, pid, reg)
+	}
+
+	mfs, err := NewGatherer(dir, GathererOpts{}).Gather()
+	multiErr, ok := err.(prometheus.MultiError)
+	if !ok || len(multiErr) != 2 {
+		t.Errorf("got error %v, want two errors", err)
+	}
+	if got, want := len(mfs), 1; got != want {
+		t.Fatalf("got %d metric families, want %d", got, want)
+	}
+	h := mfs[0].GetMetric()[0].GetHistogram()
+	if got, want := h.GetSampleCount(), uint64(2); got != want {
+		t.Errorf("got sample count %d, want %d", got, want)
+	}
+	if got, want := h.GetBucket()[0].GetCumulativeCount(), uint64(2); got != want {
+		t.Errorf("got cumulative count %d in first bucket, want %d", got, want)
+	}
+}
+
+func TestGathererPIDLabel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multiprocess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "g", Help: "help"}, []string{pidLabel})
+	g.WithLabelValues("42").Set(1)
+	reg.MustRegister(g)
+	writeShard(t, dir, 1, reg)
+
+	mfs, err := NewGatherer(dir, GathererOpts{}).Gather()
+	if err == nil {
+		t.Error("gauge with a pid label aggregated per process without error")
+	}
+	if got := len(mfs); got != 0 {
+		t.Errorf("got %d metric families, want none", got)
+	}
+
+	// Other aggregations do not add a pid label.
+	mfs, err = NewGatherer(dir, GathererOpts{GaugeAggregation: GaugeSum}).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(mfs[0].GetMetric()), 1; got != want {
+		t.Errorf("got %d metrics, want %d", got, want)
+	}
+}
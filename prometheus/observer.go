@@ -39,12 +39,37 @@ func (f ObserverFunc) Observe(value float64) {
 	f(value)
 }
 
+// MultiObserver returns an Observer that passes each observation on to all the
+// provided Observers, in the order provided. This is useful to feed the same
+// value into multiple Histograms or Summaries (e.g. a coarse global Histogram
+// and a fine-grained one partitioned by endpoint) from a single Observe
+// call. nil Observers in the list are skipped.
+func MultiObserver(observers ...Observer) Observer {
+	mo := make(multiObserver, 0, len(observers))
+	for _, o := range observers {
+		if o != nil {
+			mo = append(mo, o)
+		}
+	}
+	return mo
+}
+
+type multiObserver []Observer
+
+func (mo multiObserver) Observe(value float64) {
+	for _, o := range mo {
+		o.Observe(value)
+	}
+}
+
 // ObserverVec is an interface implemented by `HistogramVec` and `SummaryVec`.
 type ObserverVec interface {
 	GetMetricWith(Labels) (Observer, error)
 	GetMetricWithLabelValues(lvs ...string) (Observer, error)
 	With(Labels) Observer
 	WithLabelValues(...string) Observer
+	CurryWith(Labels) (ObserverVec, error)
+	MustCurryWith(Labels) ObserverVec
 
 	Collector
 }
@@ -0,0 +1,50 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMultiObserver(t *testing.T) {
+	var (
+		coarse = NewHistogram(HistogramOpts{Name: "coarse", Buckets: []float64{1}})
+		fine   = NewHistogramVec(HistogramOpts{Name: "fine", Buckets: []float64{.1, .2, .5, 1}}, []string{"endpoint"})
+		sum    float64
+		m      = &dto.Metric{}
+	)
+
+	o := MultiObserver(coarse, nil, fine.WithLabelValues("/"), ObserverFunc(func(v float64) { sum += v }))
+	o.Observe(0.3)
+	o.Observe(0.7)
+
+	if want, got := 1., sum; want != got {
+		t.Errorf("want sum %f, got %f", want, got)
+	}
+	coarse.Write(m)
+	if want, got := uint64(2), m.GetHistogram().GetSampleCount(); want != got {
+		t.Errorf("want %d observations for coarse histogram, got %d", want, got)
+	}
+	m.Reset()
+	fine.WithLabelValues("/").(Histogram).Write(m)
+	if want, got := uint64(2), m.GetHistogram().GetSampleCount(); want != got {
+		t.Errorf("want %d observations for fine histogram, got %d", want, got)
+	}
+
+	// Observing with no Observers at all must not panic.
+	MultiObserver().Observe(1)
+	MultiObserver(nil, nil).Observe(1)
+}
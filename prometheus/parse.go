@@ -0,0 +1,145 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ParseText parses metrics in the Prometheus text exposition format read from
+// the provided Reader and returns them as MetricFamilies, sorted by name with
+// sorted Metrics, as Gather would return them. It is meant for exporters
+// proxying the exposition of another program (e.g. to filter or relabel it).
+// The MetricFamilies can be exposed as they are by injecting them into the
+// gathering via Gatherers, or they can be converted into Metrics with
+// MetricsFromFamily to be sent from the Collect method of a Collector.
+func ParseText(r io.Reader) ([]*dto.MetricFamily, error) {
+	var parser expfmt.TextParser
+	metricFamiliesByName, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeMetricFamilies(metricFamiliesByName), nil
+}
+
+// MetricsFromFamily converts all Metrics in the provided MetricFamily into
+// constant Metrics as created by NewConstMetric, NewConstSummary, and
+// NewConstHistogram, with explicit timestamps preserved (see
+// NewMetricWithTimestamp). All labels become variable labels of the Descs of
+// the returned Metrics. Metrics with the same label names share the same Desc.
+// As a Desc requires a help string, MetricFamilies without one get the help
+// string "No help provided.".
+// Note that the Collector sending the returned Metrics has to describe those
+// Descs, and that a Registry only accepts Metrics with the same name if they
+// have the same label names.
+//
+// An error is returned if the MetricFamily is not valid, e.g. if it contains
+// invalid label names or if the type of a Metric does not match the type of
+// the MetricFamily.
+func MetricsFromFamily(mf *dto.MetricFamily) ([]Metric, error) {
+	var (
+		descs   = map[string]*Desc{}
+		metrics = make([]Metric, 0, len(mf.GetMetric()))
+		help    = mf.GetHelp()
+	)
+	if help == "" {
+		help = "No help provided."
+	}
+	for _, m := range mf.GetMetric() {
+		names := make([]string, 0, len(m.GetLabel()))
+		values := make([]string, 0, len(m.GetLabel()))
+		for _, lp := range m.GetLabel() {
+			names = append(names, lp.GetName())
+			values = append(values, lp.GetValue())
+		}
+		key := strings.Join(names, "\xff")
+		desc, ok := descs[key]
+		if !ok {
+			desc = NewDesc(mf.GetName(), help, names, nil)
+			if desc.err != nil {
+				return nil, desc.err
+			}
+			descs[key] = desc
+		}
+
+		metric, err := metricFromDTO(desc, mf.GetType(), m, values)
+		if err != nil {
+			return nil, fmt.Errorf("converting metric of family %q failed: %s", mf.GetName(), err)
+		}
+		if m.TimestampMs != nil {
+			ms := m.GetTimestampMs()
+			metric = NewMetricWithTimestamp(time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)), metric)
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
+// metricFromDTO converts the provided dto.Metric of the provided type into a
+// constant Metric with the provided Desc and label values.
+func metricFromDTO(desc *Desc, t dto.MetricType, m *dto.Metric, labelValues []string) (Metric, error) {
+	switch t {
+	case dto.MetricType_COUNTER:
+		if m.Counter == nil {
+			return nil, fmt.Errorf("counter value missing")
+		}
+		return NewConstMetric(desc, CounterValue, m.Counter.GetValue(), labelValues...)
+	case dto.MetricType_GAUGE:
+		if m.Gauge == nil {
+			return nil, fmt.Errorf("gauge value missing")
+		}
+		return NewConstMetric(desc, GaugeValue, m.Gauge.GetValue(), labelValues...)
+	case dto.MetricType_UNTYPED:
+		if m.Untyped == nil {
+			return nil, fmt.Errorf("untyped value missing")
+		}
+		return NewConstMetric(desc, UntypedValue, m.Untyped.GetValue(), labelValues...)
+	case dto.MetricType_SUMMARY:
+		if m.Summary == nil {
+			return nil, fmt.Errorf("summary missing")
+		}
+		quantiles := make(map[float64]float64, len(m.Summary.GetQuantile()))
+		for _, q := range m.Summary.GetQuantile() {
+			quantiles[q.GetQuantile()] = q.GetValue()
+		}
+		return NewConstSummary(
+			desc, m.Summary.GetSampleCount(), m.Summary.GetSampleSum(),
+			quantiles, labelValues...,
+		)
+	case dto.MetricType_HISTOGRAM:
+		if m.Histogram == nil {
+			return nil, fmt.Errorf("histogram missing")
+		}
+		buckets := make(map[float64]uint64, len(m.Histogram.GetBucket()))
+		for _, b := range m.Histogram.GetBucket() {
+			if math.IsInf(b.GetUpperBound(), +1) {
+				continue // Implicit in NewConstHistogram.
+			}
+			buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+		}
+		return NewConstHistogram(
+			desc, m.Histogram.GetSampleCount(), m.Histogram.GetSampleSum(),
+			buckets, labelValues...,
+		)
+	}
+	return nil, fmt.Errorf("unknown metric type %v", t)
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/common/expfmt"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+const parseTestInput = `# HELP a_total A counter.
+# TYPE a_total counter
+a_total{code="200",method="get"} 3
+a_total{code="500",method="get"} 1 1500000000000
+# HELP b A gauge.
+# TYPE b gauge
+b -2.5
+# HELP c A histogram.
+# TYPE c histogram
+c_bucket{le="0.1"} 1
+c_bucket{le="1"} 3
+c_bucket{le="+Inf"} 4
+c_sum 5.5
+c_count 4
+# HELP d A summary.
+# TYPE d summary
+d{quantile="0.5"} 0.2
+d{quantile="0.9"} 0.7
+d_sum 3
+d_count 10
+# HELP e An untyped metric.
+# TYPE e untyped
+e{x="y"} 1
+`
+
+// metricsCollector collects the Metrics it contains.
+type metricsCollector []Metric
+
+func (c metricsCollector) Describe(ch chan<- *Desc) {
+	seen := map[*Desc]bool{}
+	for _, m := range c {
+		if d := m.Desc(); !seen[d] {
+			seen[d] = true
+			ch <- d
+		}
+	}
+}
+
+func (c metricsCollector) Collect(ch chan<- Metric) {
+	for _, m := range c {
+		ch <- m
+	}
+}
+
+func encodeText(t *testing.T, mfs []*dto.MetricFamily) string {
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+func TestParseTextRoundTrip(t *testing.T) {
+	parsed, err := ParseText(strings.NewReader(parseTestInput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, mf := range parsed {
+		names = append(names, mf.GetName())
+	}
+	if got, want := strings.Join(names, ","), "a_total,b,c,d,e"; got != want {
+		t.Errorf("got metric families %s, want %s", got, want)
+	}
+
+	var c metricsCollector
+	for _, mf := range parsed {
+		metrics, err := MetricsFromFamily(mf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c = append(c, metrics...)
+	}
+	reg := NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	gathered, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := encodeText(t, gathered), encodeText(t, parsed); got != want {
+		t.Errorf("round trip changed the exposition; got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseTextEdgeCases(t *testing.T) {
+	if _, err := ParseText(strings.NewReader("invalid {")); err == nil {
+		t.Error("expected error for invalid input")
+	}
+
+	mf := &dto.MetricFamily{
+		Name:   proto.String("a"),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(1)}}},
+	}
+	metrics, err := MetricsFromFamily(mf)
+	if err != nil {
+		t.Fatalf("unexpected error for family without help: %s", err)
+	}
+	if got, want := metrics[0].Desc().help, "No help provided."; got != want {
+		t.Errorf("got help %q, want %q", got, want)
+	}
+
+	mf = &dto.MetricFamily{
+		Name:   proto.String("a"),
+		Help:   proto.String("help"),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Counter: &dto.Counter{Value: proto.Float64(1)}}},
+	}
+	if _, err := MetricsFromFamily(mf); err == nil {
+		t.Error("expected error for mismatching metric type")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promauto
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestFactory(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	f := With(reg)
+
+	f.NewCounter(prometheus.CounterOpts{Name: "c", Help: "help"})
+	f.NewCounterVec(prometheus.CounterOpts{Name: "cv", Help: "help"}, []string{"l"}).WithLabelValues("a").Inc()
+	f.NewCounterFunc(prometheus.CounterOpts{Name: "cf", Help: "help"}, func() float64 { return 1 })
+	f.NewGauge(prometheus.GaugeOpts{Name: "g", Help: "help"})
+	f.NewGaugeVec(prometheus.GaugeOpts{Name: "gv", Help: "help"}, []string{"l"}).WithLabelValues("a").Inc()
+	f.NewGaugeFunc(prometheus.GaugeOpts{Name: "gf", Help: "help"}, func() float64 { return 1 })
+	f.NewSummary(prometheus.SummaryOpts{Name: "s", Help: "help"})
+	f.NewSummaryVec(prometheus.SummaryOpts{Name: "sv", Help: "help"}, []string{"l"}).WithLabelValues("a").Observe(1)
+	f.NewHistogram(prometheus.HistogramOpts{Name: "h", Help: "help"})
+	f.NewHistogramVec(prometheus.HistogramOpts{Name: "hv", Help: "help"}, []string{"l"}).WithLabelValues("a").Observe(1)
+	f.NewUntypedFunc(prometheus.UntypedOpts{Name: "u", Help: "help"}, func() float64 { return 1 })
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(mfs), 11; got != want {
+		t.Errorf("got %d metric families, want %d", got, want)
+	}
+}
+
+func TestFactoryWithoutRegisterer(t *testing.T) {
+	// Must not panic although the same metric is created twice.
+	With(nil).NewCounter(prometheus.CounterOpts{Name: "c", Help: "help"})
+	With(nil).NewCounter(prometheus.CounterOpts{Name: "c", Help: "help"})
+}
+
+func TestFactoryPanicsOnDuplicate(t *testing.T) {
+	f := With(prometheus.NewRegistry())
+	f.NewGauge(prometheus.GaugeOpts{Name: "g", Help: "help"})
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic on duplicate registration")
+		}
+	}()
+	f.NewGauge(prometheus.GaugeOpts{Name: "g", Help: "help"})
+}
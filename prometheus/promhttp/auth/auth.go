@@ -0,0 +1,88 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auth provides middlewares restricting access to an http.Handler
+// (usually one serving metrics, as created with promhttp.HandlerFor) by HTTP
+// basic auth or TLS client certificates. It lives in a package of its own to
+// not burden all users of package promhttp with a dependency on
+// golang.org/x/crypto. The middlewares checking bcrypt hashes require Go1.18 or
+// later as current versions of golang.org/x/crypto do not support older Go
+// versions.
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"net/http"
+)
+
+// basicAuthRealm is the realm announced in the WWW-Authenticate header.
+const basicAuthRealm = `Basic realm="metrics"`
+
+// BasicAuthHandler is a middleware that wraps the provided http.Handler (usually
+// a handler serving metrics) so that it is only called for requests carrying
+// HTTP basic auth credentials matching the provided username and password. All
+// other requests are answered with an HTTP status code 401 and a
+// WWW-Authenticate header.
+//
+// The credentials are compared in constant time to not leak information about
+// them via timing. Note that basic auth transmits the credentials in the clear,
+// so it should only be used with TLS.
+func BasicAuthHandler(username, password string, next http.Handler) http.Handler {
+	wantUser := sha256.Sum256([]byte(username))
+	wantPass := sha256.Sum256([]byte(password))
+	return basicAuthHandler(func(user, pass string) bool {
+		gotUser := sha256.Sum256([]byte(user))
+		gotPass := sha256.Sum256([]byte(pass))
+		// Evaluate both comparisons to not leak which one failed.
+		userOK := subtle.ConstantTimeCompare(gotUser[:], wantUser[:])
+		passOK := subtle.ConstantTimeCompare(gotPass[:], wantPass[:])
+		return userOK&passOK == 1
+	}, next)
+}
+
+// ClientCertHandler is a middleware that wraps the provided http.Handler
+// (usually a handler serving metrics) so that it is only called for requests
+// received via TLS with a client certificate verified by the server. All other
+// requests are answered with an HTTP status code 403. The verification itself
+// happens during the TLS handshake, i.e. the http.Server must be configured
+// with a tls.Config with ClientCAs set and ClientAuth set to
+// tls.VerifyClientCertIfGiven or tls.RequireAndVerifyClientCert. If allow is
+// not nil, it is called with the verified client certificate and has to return
+// true for the request to be accepted, e.g. to only accept certain subjects.
+func ClientCertHandler(allow func(*x509.Certificate) bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 ||
+			(allow != nil && !allow(r.TLS.VerifiedChains[0][0])) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// basicAuthHandler calls next if the basic auth credentials of the request are
+// accepted by the provided check function. Otherwise, it responds with an HTTP
+// status code 401.
+func basicAuthHandler(check func(user, pass string) bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || !check(user, pass) {
+			w.Header().Set("WWW-Authenticate", basicAuthRealm)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
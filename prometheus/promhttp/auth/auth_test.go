@@ -0,0 +1,110 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuthHandler(t *testing.T) {
+	testBasicAuthHandler(t, BasicAuthHandler("user", "pass", secretHandler))
+}
+
+// secretHandler is the handler wrapped by the middlewares under test.
+var secretHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("secret metrics"))
+})
+
+// testBasicAuthHandler tests a handler that must only accept the basic auth
+// credentials "user" and "pass".
+func testBasicAuthHandler(t *testing.T, handler http.Handler) {
+	scenarios := []struct {
+		setAuth    bool
+		user, pass string
+		wantCode   int
+	}{
+		{setAuth: false, wantCode: http.StatusUnauthorized},
+		{setAuth: true, user: "user", pass: "wrong", wantCode: http.StatusUnauthorized},
+		{setAuth: true, user: "wrong", pass: "pass", wantCode: http.StatusUnauthorized},
+		{setAuth: true, user: "user", pass: "", wantCode: http.StatusUnauthorized},
+		{setAuth: true, user: "user", pass: "pass", wantCode: http.StatusOK},
+	}
+	for i, s := range scenarios {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/", nil)
+		if s.setAuth {
+			request.SetBasicAuth(s.user, s.pass)
+		}
+		handler.ServeHTTP(writer, request)
+		if got := writer.Code; got != s.wantCode {
+			t.Errorf("%d. got HTTP status code %d, want %d", i, got, s.wantCode)
+		}
+		if s.wantCode == http.StatusUnauthorized {
+			if got := writer.Header().Get("WWW-Authenticate"); got != basicAuthRealm {
+				t.Errorf("%d. got WWW-Authenticate header %q, want %q", i, got, basicAuthRealm)
+			}
+			continue
+		}
+		if got, want := writer.Body.String(), "secret metrics"; got != want {
+			t.Errorf("%d. got body %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestClientCertHandler(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "prometheus"}}
+	allow := func(c *x509.Certificate) bool {
+		return c.Subject.CommonName == "prometheus"
+	}
+
+	scenarios := []struct {
+		allow    func(*x509.Certificate) bool
+		state    *tls.ConnectionState
+		wantCode int
+	}{
+		{allow: nil, state: nil, wantCode: http.StatusForbidden},
+		{allow: nil, state: &tls.ConnectionState{}, wantCode: http.StatusForbidden},
+		{
+			allow:    nil,
+			state:    &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+			wantCode: http.StatusOK,
+		},
+		{
+			allow:    allow,
+			state:    &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+			wantCode: http.StatusOK,
+		},
+		{
+			allow: allow,
+			state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+				{Subject: pkix.Name{CommonName: "someone-else"}},
+			}}},
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for i, s := range scenarios {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.TLS = s.state
+		ClientCertHandler(s.allow, secretHandler).ServeHTTP(writer, request)
+		if got := writer.Code; got != s.wantCode {
+			t.Errorf("%d. got HTTP status code %d, want %d", i, got, s.wantCode)
+		}
+	}
+}
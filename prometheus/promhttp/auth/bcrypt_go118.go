@@ -0,0 +1,69 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.18
+
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicAuthHandlerBcrypt works like BasicAuthHandler, but instead of the
+// password itself, it expects a bcrypt hash of the password (as created by
+// bcrypt.GenerateFromPassword from the golang.org/x/crypto/bcrypt package). This
+// avoids keeping the plain password in configuration files. Note that
+// checking a bcrypt hash is expensive by design.
+func BasicAuthHandlerBcrypt(username string, passwordHash []byte, next http.Handler) http.Handler {
+	wantUser := sha256.Sum256([]byte(username))
+	return basicAuthHandler(func(user, pass string) bool {
+		gotUser := sha256.Sum256([]byte(user))
+		// Always check the password to not leak the validity of the
+		// username via timing.
+		passOK := bcrypt.CompareHashAndPassword(passwordHash, []byte(pass)) == nil
+		return subtle.ConstantTimeCompare(gotUser[:], wantUser[:]) == 1 && passOK
+	}, next)
+}
+
+// BasicAuthHandlerUsers works like BasicAuthHandlerBcrypt, but it accepts the
+// credentials of any of the provided users, given as a map from usernames to
+// bcrypt hashes of their passwords. The map is copied, i.e. later changes of it
+// have no effect on the returned handler.
+func BasicAuthHandlerUsers(users map[string][]byte, next http.Handler) http.Handler {
+	hashes := make(map[string][]byte, len(users))
+	cost := bcrypt.DefaultCost
+	for user, hash := range users {
+		hashes[user] = hash
+		if c, err := bcrypt.Cost(hash); err == nil {
+			cost = c
+		}
+	}
+	// Unknown users are checked against a dummy hash of the same cost to
+	// not leak the validity of usernames via timing.
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("dummy"), cost)
+	if err != nil {
+		panic(err) // Cost has been checked before.
+	}
+	return basicAuthHandler(func(user, pass string) bool {
+		hash, known := hashes[user]
+		if !known {
+			hash = dummyHash
+		}
+		passOK := bcrypt.CompareHashAndPassword(hash, []byte(pass)) == nil
+		return known && passOK
+	}, next)
+}
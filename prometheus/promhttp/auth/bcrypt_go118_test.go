@@ -0,0 +1,65 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.18
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuthHandlerBcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBasicAuthHandler(t, BasicAuthHandlerBcrypt("user", hash, secretHandler))
+}
+
+func TestBasicAuthHandlerUsers(t *testing.T) {
+	users := map[string][]byte{}
+	for _, user := range []string{"alice", "bob"} {
+		hash, err := bcrypt.GenerateFromPassword([]byte(user+"-pass"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[user] = hash
+	}
+	handler := BasicAuthHandlerUsers(users, secretHandler)
+	delete(users, "bob") // Must not affect the handler.
+
+	scenarios := []struct {
+		user, pass string
+		wantCode   int
+	}{
+		{user: "alice", pass: "alice-pass", wantCode: http.StatusOK},
+		{user: "bob", pass: "bob-pass", wantCode: http.StatusOK},
+		{user: "alice", pass: "bob-pass", wantCode: http.StatusUnauthorized},
+		{user: "carol", pass: "carol-pass", wantCode: http.StatusUnauthorized},
+		{user: "carol", pass: "dummy", wantCode: http.StatusUnauthorized},
+	}
+	for i, s := range scenarios {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.SetBasicAuth(s.user, s.pass)
+		handler.ServeHTTP(writer, request)
+		if got := writer.Code; got != s.wantCode {
+			t.Errorf("%d. got HTTP status code %d, want %d", i, got, s.wantCode)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/prometheus/common/expfmt"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// truncatedHeader is the response header set if metric families have been
+// dropped because of HandlerOpts.MaxBodySize.
+const truncatedHeader = "X-Prometheus-Exposition-Truncated"
+
+// limitedEncoder is an expfmt.Encoder that only passes on complete metric
+// families to the underlying Writer as long as the total number of bytes
+// written stays within a limit. Once a metric family does not fit anymore, it
+// and all following metric families are dropped (without encoding them).
+type limitedEncoder struct {
+	w              io.Writer
+	scratch        *bytes.Buffer
+	enc            expfmt.Encoder // Encodes into scratch.
+	limit, written int
+	dropped        []string // Names of the dropped metric families.
+}
+
+// newLimitedEncoder returns a limitedEncoder writing at most limit bytes to w,
+// using newEncoder to create the actual encoder.
+func newLimitedEncoder(w io.Writer, limit int, newEncoder func(io.Writer) expfmt.Encoder) *limitedEncoder {
+	scratch := &bytes.Buffer{}
+	return &limitedEncoder{
+		w:       w,
+		scratch: scratch,
+		enc:     newEncoder(scratch),
+		limit:   limit,
+	}
+}
+
+// Encode implements expfmt.Encoder.
+func (e *limitedEncoder) Encode(mf *dto.MetricFamily) error {
+	if len(e.dropped) > 0 {
+		e.dropped = append(e.dropped, mf.GetName())
+		return nil
+	}
+	e.scratch.Reset()
+	if err := e.enc.Encode(mf); err != nil {
+		return err
+	}
+	if e.written+e.scratch.Len() > e.limit {
+		e.dropped = append(e.dropped, mf.GetName())
+		return nil
+	}
+	n, err := e.w.Write(e.scratch.Bytes())
+	e.written += n
+	return err
+}
+
+// truncatedFamily returns the metric family promhttp_exposition_truncated
+// served if HandlerOpts.MaxBodySize is set.
+func truncatedFamily(truncated bool) *dto.MetricFamily {
+	value := 0.
+	if truncated {
+		value = 1
+	}
+	return gaugeFamily(
+		"promhttp_exposition_truncated",
+		"Whether metric families have been dropped from this scrape because the response exceeded the maximum body size (1) or not (0).",
+		value,
+	)
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandlerMaxBodySize(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		g := prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: "Help."})
+		g.Set(1)
+		reg.MustRegister(g)
+	}
+	family := "# HELP a Help.\n# TYPE a gauge\na 1\n"
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	logBuf := &bytes.Buffer{}
+
+	for _, scenario := range []struct {
+		maxBodySize   int
+		wantFamilies  []string
+		wantTruncated bool
+	}{
+		{
+			maxBodySize:  0,
+			wantFamilies: []string{"a", "b", "c"},
+		},
+		{
+			maxBodySize:  3 * len(family),
+			wantFamilies: []string{"a", "b", "c"},
+		},
+		{
+			maxBodySize:   3*len(family) - 1,
+			wantFamilies:  []string{"a", "b"},
+			wantTruncated: true,
+		},
+		{
+			maxBodySize:   1,
+			wantTruncated: true,
+		},
+	} {
+		logBuf.Reset()
+		writer := httptest.NewRecorder()
+		HandlerFor(reg, HandlerOpts{
+			MaxBodySize: scenario.maxBodySize,
+			ErrorLog:    log.New(logBuf, "", 0),
+		}).ServeHTTP(writer, request)
+
+		if got, want := writer.Code, http.StatusOK; got != want {
+			t.Errorf("max body size %d: got HTTP status code %d, want %d", scenario.maxBodySize, got, want)
+		}
+		body := writer.Body.String()
+		for _, name := range []string{"a", "b", "c"} {
+			want := false
+			for _, n := range scenario.wantFamilies {
+				want = want || n == name
+			}
+			if got := strings.Contains(body, "\n"+name+" 1\n"); got != want {
+				t.Errorf("max body size %d: got family %s served %t, want %t", scenario.maxBodySize, name, got, want)
+			}
+		}
+		truncated := writer.Header().Get(truncatedHeader) == "true"
+		if truncated != scenario.wantTruncated {
+			t.Errorf("max body size %d: got truncated header %t, want %t", scenario.maxBodySize, truncated, scenario.wantTruncated)
+		}
+		if got, want := logBuf.Len() > 0, scenario.wantTruncated; got != want {
+			t.Errorf("max body size %d: got log output %q", scenario.maxBodySize, logBuf.String())
+		}
+		switch {
+		case scenario.maxBodySize == 0:
+			if strings.Contains(body, "promhttp_exposition_truncated") {
+				t.Error("unexpected promhttp_exposition_truncated without max body size")
+			}
+		case scenario.wantTruncated:
+			if !strings.Contains(body, "\npromhttp_exposition_truncated 1\n") {
+				t.Errorf("max body size %d: want promhttp_exposition_truncated 1, got body %q", scenario.maxBodySize, body)
+			}
+		default:
+			if !strings.Contains(body, "\npromhttp_exposition_truncated 0\n") {
+				t.Errorf("max body size %d: want promhttp_exposition_truncated 0, got body %q", scenario.maxBodySize, body)
+			}
+		}
+	}
+}
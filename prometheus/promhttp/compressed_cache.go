@@ -0,0 +1,72 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// compressedCache holds gzip-compressed response bodies per negotiated
+// exposition format. Entries expire after a fixed TTL and are then replaced by
+// the next successful gzip-compressed response for the same format.
+type compressedCache struct {
+	ttl   time.Duration
+	clock prometheus.Clock
+
+	mtx     sync.Mutex
+	entries map[expfmt.Format]compressedCacheEntry
+}
+
+type compressedCacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+func newCompressedCache(ttl time.Duration, clock prometheus.Clock) *compressedCache {
+	return &compressedCache{
+		ttl:     ttl,
+		clock:   clock,
+		entries: map[expfmt.Format]compressedCacheEntry{},
+	}
+}
+
+// get returns the cached body for the given format if it exists and has not
+// expired yet. The returned slice must not be modified.
+func (c *compressedCache) get(format expfmt.Format) ([]byte, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.entries[format]
+	if !ok || !c.clock.Now().Before(e.expires) {
+		return nil, false
+	}
+	return e.body, true
+}
+
+// put stores a copy of the provided body for the given format.
+func (c *compressedCache) put(format expfmt.Format, body []byte) {
+	e := compressedCacheEntry{
+		body:    append([]byte(nil), body...),
+		expires: c.clock.Now().Add(c.ttl),
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.entries[format] = e
+}
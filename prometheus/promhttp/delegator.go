@@ -28,13 +28,37 @@ const (
 	pusher
 )
 
-type delegator interface {
+// DelegatingResponseWriter is an http.ResponseWriter that delegates to another
+// http.ResponseWriter while recording the status code and the number of bytes
+// written. It is what the InstrumentHandler… middlewares use internally, and it
+// is exported for authors of custom instrumentation middlewares. Create
+// instances with NewDelegatingResponseWriter.
+type DelegatingResponseWriter interface {
 	http.ResponseWriter
 
+	// Status returns the status code written so far, or 0 if neither
+	// WriteHeader nor Write has been called yet.
 	Status() int
+	// Written returns the number of bytes written to the response body so
+	// far.
 	Written() int64
 }
 
+// NewDelegatingResponseWriter returns a DelegatingResponseWriter wrapping the
+// provided http.ResponseWriter. The returned DelegatingResponseWriter implements
+// exactly those of the optional interfaces http.CloseNotifier, http.Flusher,
+// http.Hijacker, io.ReaderFrom, and (with Go1.8+) http.Pusher that are
+// implemented by the wrapped http.ResponseWriter, so that upgrading via type
+// assertion works as expected. If observeWriteHeader is not nil, it is called
+// with the status code whenever the header is written.
+func NewDelegatingResponseWriter(w http.ResponseWriter, observeWriteHeader func(status int)) DelegatingResponseWriter {
+	return newDelegator(w, observeWriteHeader)
+}
+
+type delegator interface {
+	DelegatingResponseWriter
+}
+
 type responseWriterDelegator struct {
 	http.ResponseWriter
 
@@ -76,16 +100,16 @@ type flusherDelegator struct{ *responseWriterDelegator }
 type hijackerDelegator struct{ *responseWriterDelegator }
 type readerFromDelegator struct{ *responseWriterDelegator }
 
-func (d *closeNotifierDelegator) CloseNotify() <-chan bool {
+func (d closeNotifierDelegator) CloseNotify() <-chan bool {
 	return d.ResponseWriter.(http.CloseNotifier).CloseNotify()
 }
-func (d *flusherDelegator) Flush() {
+func (d flusherDelegator) Flush() {
 	d.ResponseWriter.(http.Flusher).Flush()
 }
-func (d *hijackerDelegator) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+func (d hijackerDelegator) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return d.ResponseWriter.(http.Hijacker).Hijack()
 }
-func (d *readerFromDelegator) ReadFrom(re io.Reader) (int64, error) {
+func (d readerFromDelegator) ReadFrom(re io.Reader) (int64, error) {
 	if !d.wroteHeader {
 		d.WriteHeader(http.StatusOK)
 	}
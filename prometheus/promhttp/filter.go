@@ -0,0 +1,99 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"regexp"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// filterActive returns whether any of the filtering options in opts is set.
+func (opts HandlerOpts) filterActive() bool {
+	return len(opts.IncludeMetricNames) > 0 ||
+		len(opts.ExcludeMetricNames) > 0 ||
+		len(opts.ExcludeLabelValues) > 0
+}
+
+// filterMetricFamilies returns the provided MetricFamilies as filtered by the
+// filtering options in opts. The provided MetricFamilies are not modified
+// (they might be shared, e.g. if returned by a prometheus.CachingGatherer).
+// MetricFamilies with some of their metrics filtered out are copied.
+func filterMetricFamilies(mfs []*dto.MetricFamily, opts HandlerOpts) []*dto.MetricFamily {
+	result := make([]*dto.MetricFamily, 0, len(mfs))
+	for _, mf := range mfs {
+		name := mf.GetName()
+		if len(opts.IncludeMetricNames) > 0 && !matchAny(opts.IncludeMetricNames, name) {
+			continue
+		}
+		if matchAny(opts.ExcludeMetricNames, name) {
+			continue
+		}
+		if len(opts.ExcludeLabelValues) > 0 {
+			mf = filterMetrics(mf, opts.ExcludeLabelValues)
+			if len(mf.Metric) == 0 {
+				continue
+			}
+		}
+		result = append(result, mf)
+	}
+	return result
+}
+
+// filterMetrics returns the provided MetricFamily without the metrics having a
+// label value matched by the regular expression for the label name in
+// exclude. If no metric is filtered out, the provided MetricFamily is returned
+// as is. Otherwise, a copy is returned.
+func filterMetrics(mf *dto.MetricFamily, exclude map[string]*regexp.Regexp) *dto.MetricFamily {
+	var kept []*dto.Metric
+	for i, m := range mf.Metric {
+		if !excludeMetric(m, exclude) {
+			if kept != nil {
+				kept = append(kept, m)
+			}
+			continue
+		}
+		if kept == nil {
+			kept = make([]*dto.Metric, i, len(mf.Metric))
+			copy(kept, mf.Metric)
+		}
+	}
+	if kept == nil {
+		return mf
+	}
+	return &dto.MetricFamily{
+		Name:   mf.Name,
+		Help:   mf.Help,
+		Type:   mf.Type,
+		Metric: kept,
+	}
+}
+
+func excludeMetric(m *dto.Metric, exclude map[string]*regexp.Regexp) bool {
+	for _, lp := range m.Label {
+		if re, ok := exclude[lp.GetName()]; ok && re.MatchString(lp.GetValue()) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
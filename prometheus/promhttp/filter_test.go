@@ -0,0 +1,108 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandlerFiltering(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "requests_total",
+		Help: "helpless",
+	}, []string{"path"})
+	requests.WithLabelValues("/api").Inc()
+	requests.WithLabelValues("/debug/pprof").Inc()
+	debug := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "debug_heap_objects",
+		Help: "helpless",
+	})
+	debugInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "debug_info",
+		Help: "helpless",
+	})
+	reg.MustRegister(requests, debug, debugInfo)
+	cg := prometheus.NewCachingGatherer(reg, prometheus.CachingGathererOpts{})
+
+	scenarios := []struct {
+		opts HandlerOpts
+		want string
+	}{
+		{
+			opts: HandlerOpts{},
+			want: `# HELP debug_heap_objects helpless
+# TYPE debug_heap_objects gauge
+debug_heap_objects 0
+# HELP debug_info helpless
+# TYPE debug_info gauge
+debug_info 0
+# HELP requests_total helpless
+# TYPE requests_total counter
+requests_total{path="/api"} 1
+requests_total{path="/debug/pprof"} 1
+`,
+		},
+		{
+			opts: HandlerOpts{
+				IncludeMetricNames: []*regexp.Regexp{regexp.MustCompile("^debug_")},
+				ExcludeMetricNames: []*regexp.Regexp{regexp.MustCompile("_info$")},
+			},
+			want: `# HELP debug_heap_objects helpless
+# TYPE debug_heap_objects gauge
+debug_heap_objects 0
+`,
+		},
+		{
+			opts: HandlerOpts{
+				ExcludeMetricNames: []*regexp.Regexp{regexp.MustCompile("^debug_")},
+				ExcludeLabelValues: map[string]*regexp.Regexp{"path": regexp.MustCompile("^/debug/")},
+			},
+			want: `# HELP requests_total helpless
+# TYPE requests_total counter
+requests_total{path="/api"} 1
+`,
+		},
+		{
+			opts: HandlerOpts{
+				ExcludeLabelValues: map[string]*regexp.Regexp{"path": regexp.MustCompile("")},
+			},
+			want: `# HELP debug_heap_objects helpless
+# TYPE debug_heap_objects gauge
+debug_heap_objects 0
+# HELP debug_info helpless
+# TYPE debug_info gauge
+debug_info 0
+`,
+		},
+	}
+	// Run the unfiltered scenario again at the end to check that the
+	// filtering has not modified the cached MetricFamilies.
+	scenarios = append(scenarios, scenarios[0])
+
+	for i, s := range scenarios {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/metrics", nil)
+		request.Header.Add("Accept", "test/plain")
+		HandlerFor(cg, s.opts).ServeHTTP(writer, request)
+		if got := writer.Body.String(); got != s.want {
+			t.Errorf("%d. got body\n%s\nwant\n%s", i, got, s.want)
+		}
+	}
+}
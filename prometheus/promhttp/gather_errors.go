@@ -0,0 +1,108 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// otherCause is the value of the "cause" label for gather errors that cannot be
+// attributed to a specific metric.
+const otherCause = "other"
+
+// gatherErrorMetrics tracks the errors returned by Gather in a handler.
+type gatherErrorMetrics struct {
+	errors    *prometheus.CounterVec
+	lastError prometheus.Gauge
+}
+
+// newGatherErrorMetrics creates the gather error metrics and registers them
+// with the provided Registerer. If equal metrics have been registered before
+// (e.g. by another handler), those are used instead, so that several handlers
+// can share them. It returns nil if reg is nil and panics if registration
+// fails for any other reason.
+func newGatherErrorMetrics(reg prometheus.Registerer) *gatherErrorMetrics {
+	if reg == nil {
+		return nil
+	}
+	m := &gatherErrorMetrics{
+		errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "promhttp_metric_handler_gather_errors_total",
+				Help: "Total number of errors encountered while gathering metrics, partitioned by the failing metric where determinable.",
+			},
+			[]string{"cause"},
+		),
+		lastError: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "promhttp_metric_handler_last_gather_error_timestamp_seconds",
+			Help: "Time of the last gathering of metrics that encountered an error, in seconds since the epoch.",
+		}),
+	}
+	if err := reg.Register(m.errors); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		m.errors = are.ExistingCollector.(*prometheus.CounterVec)
+	}
+	if err := reg.Register(m.lastError); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		m.lastError = are.ExistingCollector.(prometheus.Gauge)
+	}
+	return m
+}
+
+// observe records the provided error returned by Gather. A MultiError is
+// broken down into its parts. Errors of type prometheus.CollectError are
+// attributed to the failing metric. Errors of type prometheus.CollectorError
+// and prometheus.GatherError are attributed to the failing Collector (as
+// identified by its lexicographically first metric name) if known. All other
+// errors are attributed to otherCause. It is a no-op if m or err is nil.
+func (m *gatherErrorMetrics) observe(err error) {
+	if m == nil || err == nil {
+		return
+	}
+	errs, ok := err.(prometheus.MultiError)
+	if !ok {
+		errs = prometheus.MultiError{err}
+	}
+	if len(errs) == 0 {
+		return
+	}
+	for _, err := range errs {
+		m.errors.WithLabelValues(errorCause(err)).Inc()
+	}
+	m.lastError.SetToCurrentTime()
+}
+
+// errorCause returns the value of the "cause" label for the provided error, see
+// observe.
+func errorCause(err error) string {
+	switch e := err.(type) {
+	case prometheus.CollectError:
+		return e.Name
+	case prometheus.CollectorError:
+		if e.Collector != "" {
+			return e.Collector
+		}
+	case prometheus.GatherError:
+		if e.Collector != "" {
+			return e.Collector
+		}
+	}
+	return otherCause
+}
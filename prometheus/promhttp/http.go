@@ -29,17 +29,33 @@
 // middleware. Middleware wrappers follow the naming scheme
 // InstrumentRoundTripperX, where X describes the intended use of the
 // middleware. See each function's doc comment for specific details.
+//
+// All handlers of this package are plain http.Handler instances and can be
+// used with web frameworks without any adapter code of this package, which
+// keeps it free of dependencies on those frameworks. Gin and Echo wrap an
+// http.Handler with gin.WrapH and echo.WrapHandler, respectively, e.g.:
+//     router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(reg, opts)))
+// Frameworks based on fasthttp, like Fiber, come with an adaptor for
+// net/http handlers (e.g. adaptor.HTTPHandler in Fiber). The same works for
+// the instrumentation middleware: Wrap the http.Handler of the application
+// before handing it to the framework.
 package promhttp
 
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -49,7 +65,14 @@ const (
 	contentTypeHeader     = "Content-Type"
 	contentLengthHeader   = "Content-Length"
 	contentEncodingHeader = "Content-Encoding"
+	acceptHeader          = "Accept"
 	acceptEncodingHeader  = "Accept-Encoding"
+	etagHeader            = "ETag"
+	ifNoneMatchHeader     = "If-None-Match"
+	scrapeTimeoutHeader   = "X-Prometheus-Scrape-Timeout-Seconds"
+	trailerHeader         = "Trailer"
+
+	gzipEncoding = "gzip"
 )
 
 var bufPool sync.Pool
@@ -67,27 +90,175 @@ func giveBuf(buf *bytes.Buffer) {
 	bufPool.Put(buf)
 }
 
-// Handler returns an HTTP handler for the prometheus.DefaultGatherer. The
-// Handler uses the default HandlerOpts, i.e. report the first error as an HTTP
-// error, no error logging, and compression if requested by the client.
+// gzipPools holds one pool of gzip.Writers per compression level, indexed by
+// level-gzip.HuffmanOnly.
+var gzipPools [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+// getGzipWriter returns a gzip.Writer with the given compression level (which
+// must be valid) writing to w.
+func getGzipWriter(w io.Writer, level int) *gzip.Writer {
+	if gz, ok := gzipPools[level-gzip.HuffmanOnly].Get().(*gzip.Writer); ok {
+		gz.Reset(w)
+		return gz
+	}
+	gz, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		panic(err) // Level has been checked before.
+	}
+	return gz
+}
+
+// giveGzipWriter returns a gzip.Writer obtained with getGzipWriter with the
+// given level to its pool.
+func giveGzipWriter(gz *gzip.Writer, level int) {
+	gzipPools[level-gzip.HuffmanOnly].Put(gz)
+}
+
+// Handler returns an HTTP handler for the prometheus.DefaultGatherer, using
+// default HandlerOpts, i.e. it reports the first error as an HTTP error, it has
+// no error logging, and it applies compression if requested by the client.
+//
+// The returned http.Handler is already instrumented using the
+// InstrumentMetricHandler function and the prometheus.DefaultRegisterer. If you
+// create multiple http.Handlers by separate calls of the Handler function, the
+// metrics used for instrumentation will be shared.
 //
 // If you want to create a Handler for the DefaultGatherer with different
 // HandlerOpts, create it with HandlerFor with prometheus.DefaultGatherer and
-// your desired HandlerOpts.
+// your desired HandlerOpts (and instrument it with InstrumentMetricHandler if
+// desired).
 func Handler() http.Handler {
-	return HandlerFor(prometheus.DefaultGatherer, HandlerOpts{})
+	return InstrumentMetricHandler(
+		prometheus.DefaultRegisterer, HandlerFor(prometheus.DefaultGatherer, HandlerOpts{}),
+	)
+}
+
+// InstrumentMetricHandler is usually used with an http.Handler returned by the
+// HandlerFor function. It instruments the provided http.Handler with two
+// metrics: A counter vector "promhttp_metric_handler_requests_total" to count
+// scrapes partitioned by HTTP status code, and a gauge
+// "promhttp_metric_handler_requests_in_flight" to track the number of
+// simultaneous scrapes (which helps to detect overlapping scrapes, e.g. from
+// slow collections). The function registers the metrics with the provided
+// Registerer. If equal metrics have been registered before (e.g. by a previous
+// call of InstrumentMetricHandler), those are used instead, so that several
+// handlers can share them. It panics if registration fails for any other
+// reason.
+//
+// See the example for InstrumentHandlerDuration for an example of how to
+// instrument an http.Handler in general.
+func InstrumentMetricHandler(reg prometheus.Registerer, handler http.Handler) http.Handler {
+	cnt := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "promhttp_metric_handler_requests_total",
+			Help: "Total number of scrapes by HTTP status code.",
+		},
+		[]string{"code"},
+	)
+	// Initialize the most likely HTTP status codes.
+	cnt.WithLabelValues("200")
+	cnt.WithLabelValues("500")
+	cnt.WithLabelValues("503")
+	if err := reg.Register(cnt); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		cnt = are.ExistingCollector.(*prometheus.CounterVec)
+	}
+
+	gge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "promhttp_metric_handler_requests_in_flight",
+		Help: "Current number of scrapes being served.",
+	})
+	if err := reg.Register(gge); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		gge = are.ExistingCollector.(prometheus.Gauge)
+	}
+
+	return InstrumentHandlerCounter(cnt, InstrumentHandlerInFlight(gge, handler))
 }
 
 // HandlerFor returns an http.Handler for the provided Gatherer. The behavior
-// of the Handler is defined by the provided HandlerOpts.
+// of the Handler is defined by the provided HandlerOpts. If the Gatherer is a
+// prometheus.ContextGatherer (like prometheus.Registry and
+// prometheus.Gatherers), the Context of each request is passed on, so that
+// gathering stops early (and the Context reaches the CollectWithContext method
+// of prometheus.ContextCollectors) if the client closes the connection or the
+// scrape timeout is reached (see HandlerOpts.ScrapeTimeoutOffset).
 func HandlerFor(reg prometheus.Gatherer, opts HandlerOpts) http.Handler {
+	return handlerFor(reg, opts, newGatherErrorMetrics(opts.GatherErrorRegisterer))
+}
+
+// handlerFor implements HandlerFor. Gather errors are recorded in gatherErrs
+// (which may be nil), so that handlers can share them.
+func handlerFor(reg prometheus.Gatherer, opts HandlerOpts, gatherErrs *gatherErrorMetrics) http.Handler {
+	level := opts.CompressionLevel
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		panic(fmt.Errorf("invalid gzip compression level %d", opts.CompressionLevel))
+	}
+
+	offered := opts.OfferedCompressions
+	if offered == nil {
+		offered = []string{gzipEncoding}
+	}
+	for _, enc := range offered {
+		if _, ok := opts.CompressionEncoders[enc]; !ok && enc != gzipEncoding {
+			panic(fmt.Errorf("no encoder for offered compression %q", enc))
+		}
+	}
+
+	switch opts.Format {
+	case "", expfmt.FmtText, expfmt.FmtProtoDelim, expfmt.FmtProtoText, expfmt.FmtProtoCompact:
+	default:
+		panic(fmt.Errorf("unsupported exposition format %q", opts.Format))
+	}
+
+	filter := opts.filterActive()
+
+	var cache *compressedCache
+	if opts.CompressedCacheTTL > 0 && !opts.DisableCompression && opts.GathererForRequest == nil && opts.ScrapeMetadata == NoScrapeMetadata {
+		cache = newCompressedCache(opts.CompressedCacheTTL, prometheus.DefaultClock())
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		mfs, err := reg.Gather()
+		contentType := negotiateFormat(req, opts)
+		var encoding string
+		if !opts.DisableCompression {
+			encoding = negotiateEncoding(req, offered)
+		}
+		if cache != nil && encoding == gzipEncoding {
+			if body, ok := cache.get(contentType); ok {
+				header := w.Header()
+				header.Set(contentTypeHeader, string(contentType))
+				header.Set(contentLengthHeader, fmt.Sprint(len(body)))
+				header.Set(contentEncodingHeader, gzipEncoding)
+				writeBody(w, req, body, opts.EnableETag)
+				return
+			}
+		}
+
+		g, err := selectGatherer(reg, req, opts)
 		if err != nil {
+			http.Error(w, "Invalid request:\n\n"+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		gatherStart := time.Now()
+		mfs, err := gather(g, req, opts.ScrapeTimeoutOffset)
+		gatherDuration := time.Since(gatherStart)
+		if err != nil {
+			gatherErrs.observe(err)
 			if opts.ErrorLog != nil {
 				opts.ErrorLog.Println("error gathering metrics:", err)
 			}
-			switch opts.ErrorHandling {
+			switch gatherErrorHandling(err, opts) {
 			case PanicOnError:
 				panic(err)
 			case ContinueOnError:
@@ -100,32 +271,87 @@ func HandlerFor(reg prometheus.Gatherer, opts HandlerOpts) http.Handler {
 				return
 			}
 		}
+		if filter {
+			mfs = filterMetricFamilies(mfs, opts)
+		}
+		if opts.NameEscaping != prometheus.NoEscaping {
+			mfs = escapeMetricFamilies(mfs, opts.NameEscaping)
+		}
 
-		contentType := expfmt.Negotiate(req.Header)
 		buf := getBuf()
 		defer giveBuf(buf)
-		writer, encoding := decorateWriter(req, buf, opts.DisableCompression)
-		enc := expfmt.NewEncoder(writer, contentType)
+		writer := encodingWriter(buf, encoding, level, opts.CompressionEncoders)
+		newEncoder := func(w io.Writer) expfmt.Encoder {
+			if opts.FastTextEncoding && contentType == expfmt.FmtText {
+				return textEncoder{w: w}
+			}
+			return expfmt.NewEncoder(w, contentType)
+		}
+		enc := newEncoder(writer)
+		bodyEnc := enc
+		var limited *limitedEncoder
+		if opts.MaxBodySize > 0 {
+			limited = newLimitedEncoder(writer, opts.MaxBodySize, newEncoder)
+			bodyEnc = limited
+		}
 		var lastErr error
-		for _, mf := range mfs {
-			if err := enc.Encode(mf); err != nil {
-				lastErr = err
-				if opts.ErrorLog != nil {
-					opts.ErrorLog.Println("error encoding metric family:", err)
-				}
-				switch opts.ErrorHandling {
-				case PanicOnError:
-					panic(err)
-				case ContinueOnError:
-					// Handled later.
-				case HTTPErrorOnError:
-					http.Error(w, "An error has occurred during metrics encoding:\n\n"+err.Error(), http.StatusInternalServerError)
-					return
+		// encodeAll returns false if an error response has been sent.
+		encodeAll := func(enc expfmt.Encoder, mfs []*dto.MetricFamily) bool {
+			for _, mf := range mfs {
+				if err := enc.Encode(mf); err != nil {
+					lastErr = err
+					if opts.ErrorLog != nil {
+						opts.ErrorLog.Println("error encoding metric family:", err)
+					}
+					switch opts.ErrorHandling {
+					case PanicOnError:
+						panic(err)
+					case ContinueOnError:
+						// Handled later.
+					case HTTPErrorOnError:
+						http.Error(w, "An error has occurred during metrics encoding:\n\n"+err.Error(), http.StatusInternalServerError)
+						return false
+					}
 				}
 			}
+			return true
 		}
-		if closer, ok := writer.(io.Closer); ok {
-			closer.Close()
+		if !encodeAll(bodyEnc, mfs) {
+			return
+		}
+		var dropped []string
+		if limited != nil && len(limited.dropped) > 0 {
+			dropped = limited.dropped
+			if opts.ErrorLog != nil {
+				opts.ErrorLog.Println(
+					"response exceeded the maximum body size of", opts.MaxBodySize,
+					"bytes, dropped metric families:", strings.Join(dropped, ", "),
+				)
+			}
+		}
+		// If we got here with an error, some metrics are missing.
+		meta := scrapeMetadata{
+			gatherDuration: gatherDuration,
+			metricFamilies: len(mfs) - len(dropped),
+			truncated:      err != nil || len(dropped) > 0,
+		}
+		// The synthetic metric families are not subject to MaxBodySize.
+		var synthetic []*dto.MetricFamily
+		if opts.ScrapeMetadata == ScrapeMetadataMetrics {
+			synthetic = meta.metricFamiliesOf()
+		}
+		if limited != nil {
+			synthetic = append(synthetic, truncatedFamily(len(dropped) > 0))
+		}
+		if !encodeAll(enc, synthetic) {
+			return
+		}
+		switch wc := writer.(type) {
+		case *gzip.Writer:
+			wc.Close()
+			giveGzipWriter(wc, level)
+		case io.WriteCloser:
+			wc.Close()
 		}
 		if lastErr != nil && buf.Len() == 0 {
 			http.Error(w, "No metrics encoded, last error:\n\n"+lastErr.Error(), http.StatusInternalServerError)
@@ -133,15 +359,66 @@ func HandlerFor(reg prometheus.Gatherer, opts HandlerOpts) http.Handler {
 		}
 		header := w.Header()
 		header.Set(contentTypeHeader, string(contentType))
-		header.Set(contentLengthHeader, fmt.Sprint(buf.Len()))
+		if opts.ScrapeMetadata == ScrapeMetadataTrailers {
+			// Trailers require chunked encoding with HTTP/1.1, so
+			// no Content-Length.
+			header.Set(trailerHeader, strings.Join(scrapeMetadataTrailers, ", "))
+		} else {
+			header.Set(contentLengthHeader, fmt.Sprint(buf.Len()))
+		}
 		if encoding != "" {
 			header.Set(contentEncodingHeader, encoding)
 		}
-		w.Write(buf.Bytes())
+		if len(dropped) > 0 {
+			header.Set(truncatedHeader, "true")
+		}
+		if cache != nil && encoding == gzipEncoding && err == nil && lastErr == nil && len(dropped) == 0 {
+			cache.put(contentType, buf.Bytes())
+		}
+		writeBody(w, req, buf.Bytes(), opts.EnableETag)
+		if opts.ScrapeMetadata == ScrapeMetadataTrailers {
+			meta.setTrailers(header)
+		}
 		// TODO(beorn7): Consider streaming serving of metrics.
 	})
 }
 
+// writeBody writes the provided body to w, whose header has already been
+// set. For HEAD requests, only the header is written. If etag is true, an ETag
+// header is set, and if the request has a matching If-None-Match header, the
+// response is HTTP status code 304 without a body.
+func writeBody(w http.ResponseWriter, req *http.Request, body []byte, etag bool) {
+	header := w.Header()
+	if etag {
+		h := fnv.New64a()
+		h.Write(body)
+		tag := fmt.Sprintf(`"%x"`, h.Sum64())
+		header.Set(etagHeader, tag)
+		if etagMatches(req.Header.Get(ifNoneMatchHeader), tag) {
+			header.Del(contentLengthHeader)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if req.Method == "HEAD" {
+		return
+	}
+	w.Write(body)
+}
+
+// etagMatches returns whether the provided value of an If-None-Match header
+// matches the provided ETag. Weak comparison is used as required for
+// If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
 // HandlerErrorHandling defines how a Handler serving metrics will handle
 // errors.
 type HandlerErrorHandling int
@@ -163,13 +440,52 @@ const (
 	PanicOnError
 )
 
+// gatherErrorHandling returns the HandlerErrorHandling to apply to the
+// provided error returned by gathering, see
+// HandlerOpts.ErrorHandlingByCategory.
+func gatherErrorHandling(err error, opts HandlerOpts) HandlerErrorHandling {
+	if len(opts.ErrorHandlingByCategory) == 0 {
+		return opts.ErrorHandling
+	}
+	errs, ok := err.(prometheus.MultiError)
+	if !ok {
+		errs = prometheus.MultiError{err}
+	}
+	result := ContinueOnError
+	for _, err := range errs {
+		handling, ok := opts.ErrorHandlingByCategory[prometheus.GatherErrorCategoryOf(err)]
+		if !ok {
+			handling = opts.ErrorHandling
+		}
+		switch handling {
+		case PanicOnError:
+			return PanicOnError
+		case HTTPErrorOnError:
+			result = HTTPErrorOnError
+		}
+	}
+	return result
+}
+
 // Logger is the minimal interface HandlerOpts needs for logging. Note that
 // log.Logger from the standard library implements this interface, and it is
-// easy to implement by custom loggers, if they don't do so already anyway.
+// easy to implement by custom loggers, if they don't do so already anyway. See
+// LoggerFunc for loggers with a differently named method of the same
+// signature. With Go1.21 or later, NewSlogLogger adapts a *slog.Logger.
 type Logger interface {
 	Println(v ...interface{})
 }
 
+// LoggerFunc is an adapter to allow the use of a function as a Logger. This
+// is useful for loggers that have a suitable method under a different name,
+// e.g. LoggerFunc(sugaredLogger.Error) for a zap SugaredLogger.
+type LoggerFunc func(v ...interface{})
+
+// Println implements Logger by calling f(v...).
+func (f LoggerFunc) Println(v ...interface{}) {
+	f(v...)
+}
+
 // HandlerOpts specifies options how to serve metrics via an http.Handler. The
 // zero value of HandlerOpts is a reasonable default.
 type HandlerOpts struct {
@@ -180,25 +496,334 @@ type HandlerOpts struct {
 	// logged regardless of the configured ErrorHandling provided ErrorLog
 	// is not nil.
 	ErrorHandling HandlerErrorHandling
+	// ErrorHandlingByCategory overrides ErrorHandling for errors returned
+	// by gathering, depending on their category as determined by
+	// prometheus.GatherErrorCategoryOf. Errors of a category not in the
+	// map are handled as per ErrorHandling. If gathering returns several
+	// errors, the most severe handling applies (PanicOnError over
+	// HTTPErrorOnError over ContinueOnError). For example, mapping
+	// prometheus.GatherErrorDuplicate to ContinueOnError while leaving
+	// ErrorHandling at HTTPErrorOnError serves duplicate-free metrics
+	// despite duplicates but still fails the scrape if a Collector fails.
+	// Encoding errors are always handled as per ErrorHandling.
+	ErrorHandlingByCategory map[prometheus.GatherErrorCategory]HandlerErrorHandling
 	// If DisableCompression is true, the handler will never compress the
 	// response, even if requested by the client.
 	DisableCompression bool
+	// CompressionLevel is the gzip compression level used if the response
+	// is compressed, see the constants in the compress/gzip package. The
+	// zero value is interpreted as gzip.DefaultCompression. (Use
+	// DisableCompression to not compress at all.) HandlerFor panics if the
+	// level is invalid.
+	CompressionLevel int
+	// If CompressedCacheTTL is positive, gzip-compressed responses are
+	// cached per negotiated exposition format for the given duration.
+	// Within that time, requests accepting gzip in a cached format are
+	// served the cached bytes directly, without gathering or compressing
+	// again. Responses are only cached if gathering and encoding
+	// succeeded without any error. Requests not accepting gzip, or asking
+	// for a format not cached yet, take the regular path. The cache has
+	// no effect if DisableCompression is true or GathererForRequest is
+	// set.
+	CompressedCacheTTL time.Duration
+	// If GatherErrorRegisterer is not nil, the handler registers the
+	// metrics promhttp_metric_handler_gather_errors_total and
+	// promhttp_metric_handler_last_gather_error_timestamp_seconds with it
+	// and updates them whenever gathering returns errors. The former is
+	// partitioned by the label "cause", which is the name of the failing
+	// metric for errors of type prometheus.CollectError and "other" for
+	// all other errors. If the metrics have been registered before
+	// (e.g. by another handler), the existing ones are updated. Any other
+	// registration error causes a panic.
+	GatherErrorRegisterer prometheus.Registerer
+	// OfferedCompressions are the content encodings the handler may use
+	// to compress the response, in order of preference. The first one
+	// accepted by the client (as per its Accept-Encoding header) is
+	// used. If the client accepts none of them, the response is not
+	// compressed. "gzip" is built in. Any other encoding (like "zstd")
+	// needs an encoder in CompressionEncoders, or HandlerFor panics. The
+	// default value (used if OfferedCompressions is nil) is
+	// []string{"gzip"}. OfferedCompressions has no effect if
+	// DisableCompression is true.
+	OfferedCompressions []string
+	// CompressionEncoders provides the encoders for the content encodings
+	// in OfferedCompressions that are not built in, mapped by the name of
+	// the content encoding.
+	CompressionEncoders map[string]CompressionEncoder
+	// If GathererForRequest is not nil, it is called for each request to
+	// select the Gatherer to gather from, typically based on URL query
+	// parameters. This enables the multi-target exporter pattern
+	// (e.g. "/metrics?target=x", where the returned Gatherer collects
+	// from x) and filtered scrapes skipping expensive Collectors (see
+	// GatherersByQueryParam). If GathererForRequest returns nil, the
+	// Gatherer provided to HandlerFor is used. If it returns an error, the
+	// handler responds with HTTP status code 400 and the error message in
+	// the body.
+	GathererForRequest func(*http.Request) (prometheus.Gatherer, error)
+	// If EnableETag is true, responses carry an ETag header derived from a
+	// hash of the (possibly compressed) response body. A request with an
+	// If-None-Match header matching the ETag of the response is answered
+	// with HTTP status code 304 and no body. This saves bandwidth for
+	// clients polling frequently while the metrics rarely change (e.g.
+	// external probes). Note that the metrics are still gathered and
+	// encoded to calculate the ETag.
+	EnableETag bool
+	// If IncludeMetricNames is not empty, only metric families with a name
+	// matched by at least one of the regular expressions are served.
+	// Note that a regular expression matches any part of the name unless
+	// anchored (e.g. "^go_" matches all names starting with "go_").
+	IncludeMetricNames []*regexp.Regexp
+	// Metric families with a name matched by any of the regular
+	// expressions in ExcludeMetricNames are not served, even if included
+	// by IncludeMetricNames.
+	ExcludeMetricNames []*regexp.Regexp
+	// Metrics with a label value matched by the regular expression mapped
+	// to the name of the label in ExcludeLabelValues are not served. A
+	// metric family without any metrics left is not served at all.
+	//
+	// The filtering by IncludeMetricNames, ExcludeMetricNames, and
+	// ExcludeLabelValues happens upon each scrape after gathering, i.e.
+	// the filtered metrics are still collected. To avoid expensive
+	// collections, register the affected Collectors with a separate
+	// Registry instead (and serve it via a separate handler or via
+	// GathererForRequest).
+	ExcludeLabelValues map[string]*regexp.Regexp
+	// If ScrapeTimeoutOffset is positive and a request carries the
+	// X-Prometheus-Scrape-Timeout-Seconds header (as set by the Prometheus
+	// server), gathering is stopped early at ScrapeTimeoutOffset before the
+	// scrape timeout is reached, i.e. Collectors that have not finished by
+	// then are abandoned. This only works with Gatherers implementing
+	// prometheus.ContextGatherer (like prometheus.Registry). The metrics
+	// gathered so far are only served if ErrorHandling is ContinueOnError.
+	// Either way, the scraper gets a timely response including an error
+	// rather than running into the scrape timeout. ScrapeTimeoutOffset
+	// should leave enough time for encoding and sending the response.
+	ScrapeTimeoutOffset time.Duration
+	// If Format is not empty, the handler always serves the metrics in
+	// that exposition format, regardless of the Accept header of the
+	// request. This helps in environments where middle boxes mangle the
+	// Accept header or the protobuf format. Format must be one of
+	// expfmt.FmtText, expfmt.FmtProtoDelim, expfmt.FmtProtoText, or
+	// expfmt.FmtProtoCompact. Otherwise, HandlerFor panics.
+	Format expfmt.Format
+	// If DisableProtobuf is true, the handler serves the text format even
+	// if the request accepts one of the protobuf formats. It has no effect
+	// if Format is set.
+	DisableProtobuf bool
+	// NameEscaping is the prometheus.EscapingScheme applied to metric and
+	// label names before encoding. Names that are valid under
+	// prometheus.LegacyValidation are never changed. The default is
+	// prometheus.NoEscaping, which is fine as long as no names outside of
+	// the legacy character set are gathered. Set it if
+	// prometheus.NameValidationScheme is prometheus.UTF8Validation (or if
+	// the Gatherer injects metrics from other sources), as the exposition
+	// formats served by this package cannot represent such names in a way
+	// understood by scrapers.
+	NameEscaping prometheus.EscapingScheme
+	// If FastTextEncoding is true, the text format is rendered by an
+	// encoder optimized for large expositions, which appends to pooled byte
+	// slices instead of using the fmt package and thereby avoids nearly all
+	// allocations. Its output is identical to the one of the regular
+	// encoder, except that nothing at all is written for an invalid
+	// MetricFamily (rather than the part preceding the problem). Protobuf
+	// formats are not affected.
+	FastTextEncoding bool
+	// ScrapeMetadata determines if and how the handler reports metadata
+	// about each scrape, i.e. the gather duration, the number of served
+	// metric families, and whether metrics are missing because of an
+	// error during gathering (which can only happen with
+	// ContinueOnError) or because of MaxBodySize. See the documentation
+	// of the ScrapeMetadata values for details. The default is
+	// NoScrapeMetadata. Note that a CompressedCacheTTL has no effect if
+	// scrape metadata is reported.
+	ScrapeMetadata ScrapeMetadata
+	// If MaxBodySize is positive, the handler stops encoding metric
+	// families once the (uncompressed) response body would exceed that
+	// many bytes, protecting both the scraper and the exporter from
+	// runaway cardinality. The metric family that does not fit anymore
+	// and all following ones (in lexicographical order) are dropped, and
+	// their names are logged to ErrorLog. The response then carries the
+	// header X-Prometheus-Exposition-Truncated with the value "true". In
+	// addition, the gauge promhttp_exposition_truncated is served with
+	// the value 1 if metric families have been dropped and 0 otherwise,
+	// so that truncation can be alerted on. That gauge, as well as the
+	// metrics reported with ScrapeMetadataMetrics, are not subject to the
+	// limit, so that the body might slightly exceed MaxBodySize.
+	MaxBodySize int
 }
 
-// decorateWriter wraps a writer to handle gzip compression if requested.  It
-// returns the decorated writer and the appropriate "Content-Encoding" header
-// (which is empty if no compression is enabled).
-func decorateWriter(request *http.Request, writer io.Writer, compressionDisabled bool) (io.Writer, string) {
-	if compressionDisabled {
-		return writer, ""
+// escapeMetricFamilies returns a new slice with all the provided
+// MetricFamilies escaped with the provided scheme.
+func escapeMetricFamilies(mfs []*dto.MetricFamily, scheme prometheus.EscapingScheme) []*dto.MetricFamily {
+	escaped := make([]*dto.MetricFamily, 0, len(mfs))
+	for _, mf := range mfs {
+		escaped = append(escaped, prometheus.EscapeMetricFamily(mf, scheme))
+	}
+	return escaped
+}
+
+// gather gathers from g. If g is a prometheus.ContextGatherer, the Context of
+// req is passed on, so that gathering stops once the client has gone away. If
+// offset is positive and req carries a scrape timeout, gathering additionally
+// stops at offset before the scrape timeout.
+func gather(g prometheus.Gatherer, req *http.Request, offset time.Duration) ([]*dto.MetricFamily, error) {
+	cg, ok := g.(prometheus.ContextGatherer)
+	if !ok {
+		return g.Gather()
+	}
+	ctx := req.Context()
+	if timeout, ok := scrapeTimeout(req, offset); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return cg.GatherWithContext(ctx)
+}
+
+// selectGatherer returns the Gatherer selected for req by the
+// GathererForRequest function in opts, or reg if no Gatherer is selected.
+func selectGatherer(reg prometheus.Gatherer, req *http.Request, opts HandlerOpts) (prometheus.Gatherer, error) {
+	if opts.GathererForRequest == nil {
+		return reg, nil
+	}
+	selected, err := opts.GathererForRequest(req)
+	if err != nil || selected == nil {
+		return reg, err
+	}
+	return selected, nil
+}
+
+// scrapeTimeout returns the scrape timeout of req minus offset and true, or
+// false if offset is not positive, req carries no valid scrape timeout, or no
+// time would be left.
+func scrapeTimeout(req *http.Request, offset time.Duration) (time.Duration, bool) {
+	if offset <= 0 {
+		return 0, false
+	}
+	v := req.Header.Get(scrapeTimeoutHeader)
+	if v == "" {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil || seconds <= 0 {
+		return 0, false
+	}
+	timeout := time.Duration(seconds*float64(time.Second)) - offset
+	if timeout <= 0 {
+		// No time left to gather anything. Try the full gathering
+		// anyway rather than failing right away.
+		return 0, false
+	}
+	return timeout, true
+}
+
+// GatherersByQueryParam returns a function suitable as GathererForRequest in
+// HandlerOpts. It selects Gatherers from the provided map by the values of the
+// URL query parameter with the provided name. All selected Gatherers are
+// gathered from as prometheus.Gatherers. For example, with the name
+// "collect[]" and a map with the keys "go" and "process", a request to
+// "/metrics?collect[]=go" only gathers from the Gatherer mapped to "go". A
+// value may also be a comma-separated list (e.g. "?collect[]=go,process").
+// Requests without the query parameter select no Gatherer (so that the
+// Gatherer provided to HandlerFor is used), and requests with a value not
+// contained in the map result in an error.
+func GatherersByQueryParam(name string, gatherers map[string]prometheus.Gatherer) func(*http.Request) (prometheus.Gatherer, error) {
+	return func(req *http.Request) (prometheus.Gatherer, error) {
+		values, ok := req.URL.Query()[name]
+		if !ok {
+			return nil, nil
+		}
+		var (
+			selected prometheus.Gatherers
+			seen     = map[string]struct{}{}
+		)
+		for _, value := range values {
+			for _, key := range strings.Split(value, ",") {
+				key = strings.TrimSpace(key)
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				g, ok := gatherers[key]
+				if !ok {
+					return nil, fmt.Errorf("unknown value %q for query parameter %q", key, name)
+				}
+				seen[key] = struct{}{}
+				selected = append(selected, g)
+			}
+		}
+		return selected, nil
+	}
+}
+
+// CompressionEncoder returns an io.WriteCloser that compresses everything
+// written to it and writes the result to the provided io.Writer. The returned
+// io.WriteCloser is closed once the whole response has been written to it.
+type CompressionEncoder func(io.Writer) io.WriteCloser
+
+// encodingWriter wraps a writer to handle the compression for the provided
+// content encoding (as returned by negotiateEncoding). Gzip compression uses the
+// given level. The writer is returned unchanged if encoding is empty. A
+// returned *gzip.Writer should be given back with giveGzipWriter once closed.
+func encodingWriter(writer io.Writer, encoding string, level int, encoders map[string]CompressionEncoder) io.Writer {
+	switch encoding {
+	case "":
+		return writer
+	case gzipEncoding:
+		return getGzipWriter(writer, level)
+	default:
+		return encoders[encoding](writer)
+	}
+}
+
+// negotiateFormat returns the exposition format to serve in response to the
+// provided request, taking into account the Format and DisableProtobuf fields
+// of the provided HandlerOpts.
+func negotiateFormat(request *http.Request, opts HandlerOpts) expfmt.Format {
+	if opts.Format != "" {
+		return opts.Format
+	}
+	header := request.Header
+	if values := header[acceptHeader]; len(values) > 1 {
+		// expfmt.Negotiate only looks at the first Accept header. Join
+		// repeated headers, which is equivalent as per RFC 7230.
+		header = http.Header{acceptHeader: {strings.Join(values, ",")}}
+	}
+	format := expfmt.Negotiate(header)
+	if opts.DisableProtobuf && format != expfmt.FmtText {
+		return expfmt.FmtText
+	}
+	return format
+}
+
+// negotiateEncoding returns the first of the offered content encodings accepted
+// by the request, or the empty string if none is accepted. Encodings listed
+// with a quality value of zero are not accepted. Encoding names are compared
+// case-insensitively, and repeated Accept-Encoding headers are treated like a
+// single header with all their values.
+func negotiateEncoding(request *http.Request, offered []string) string {
+	header := strings.Join(request.Header[acceptEncodingHeader], ",")
+	if header == "" {
+		return ""
+	}
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		ok := true
+		for _, param := range params[1:] {
+			param = strings.ToLower(strings.Replace(param, " ", "", -1))
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					ok = false
+				}
+			}
+		}
+		accepted[name] = ok
 	}
-	header := request.Header.Get(acceptEncodingHeader)
-	parts := strings.Split(header, ",")
-	for _, part := range parts {
-		part := strings.TrimSpace(part)
-		if part == "gzip" || strings.HasPrefix(part, "gzip;") {
-			return gzip.NewWriter(writer), "gzip"
+	for _, enc := range offered {
+		if accepted[strings.ToLower(enc)] {
+			return enc
 		}
 	}
-	return writer, ""
+	return ""
 }
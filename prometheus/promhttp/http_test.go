@@ -15,11 +15,25 @@ package promhttp
 
 import (
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/common/expfmt"
+
+	dto "github.com/prometheus/client_model/go"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -129,3 +143,707 @@ the_count 0
 	}()
 	panicHandler.ServeHTTP(writer, request)
 }
+
+type duplicateCollector struct {
+	desc *prometheus.Desc
+}
+
+func (c duplicateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c duplicateCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 2)
+}
+
+func TestHandlerErrorHandlingByCategory(t *testing.T) {
+	dupReg := prometheus.NewRegistry()
+	dupReg.MustRegister(duplicateCollector{
+		desc: prometheus.NewDesc("dup", "A duplicated metric.", nil, nil),
+	})
+	failReg := prometheus.NewRegistry()
+	failReg.MustRegister(duplicateCollector{
+		desc: prometheus.NewDesc("dup", "A duplicated metric.", nil, nil),
+	})
+	failReg.MustRegister(errorCollector{})
+
+	opts := HandlerOpts{
+		ErrorHandling: HTTPErrorOnError,
+		ErrorHandlingByCategory: map[prometheus.GatherErrorCategory]HandlerErrorHandling{
+			prometheus.GatherErrorDuplicate: ContinueOnError,
+		},
+	}
+	request, _ := http.NewRequest("GET", "/", nil)
+
+	writer := httptest.NewRecorder()
+	HandlerFor(dupReg, opts).ServeHTTP(writer, request)
+	if got, want := writer.Code, http.StatusOK; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+	if got, want := writer.Body.String(), "# HELP dup A duplicated metric.\n# TYPE dup gauge\ndup 1\n"; got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+
+	writer = httptest.NewRecorder()
+	HandlerFor(failReg, opts).ServeHTTP(writer, request)
+	if got, want := writer.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+
+	opts.ErrorHandlingByCategory[prometheus.GatherErrorCollectFailure] = PanicOnError
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for collect failure")
+		}
+	}()
+	HandlerFor(failReg, opts).ServeHTTP(httptest.NewRecorder(), request)
+}
+
+func TestHandlerCompressedCache(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	defer prometheus.SetDefaultClock(prometheus.DefaultClock())
+	prometheus.SetDefaultClock(prometheus.ClockFunc(func() time.Time { return now }))
+
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "the_count",
+		Help: "Ah-ah-ah! Thunder and lightning!",
+	})
+	reg.MustRegister(cnt)
+	handler := HandlerFor(reg, HandlerOpts{CompressedCacheTTL: time.Minute})
+
+	scrape := func(gzipped bool) string {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Add("Accept", "test/plain")
+		if gzipped {
+			request.Header.Add(acceptEncodingHeader, "gzip")
+		}
+		handler.ServeHTTP(writer, request)
+		if !gzipped {
+			return writer.Body.String()
+		}
+		if got, want := writer.Header().Get(contentEncodingHeader), "gzip"; got != want {
+			t.Fatalf("got Content-Encoding %q, want %q", got, want)
+		}
+		r, err := gzip.NewReader(writer.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	wantBody := func(v string) string {
+		return `# HELP the_count Ah-ah-ah! Thunder and lightning!
+# TYPE the_count counter
+the_count ` + v + `
+`
+	}
+
+	if got, want := scrape(true), wantBody("0"); got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+	cnt.Inc()
+	if got, want := scrape(true), wantBody("0"); got != want {
+		t.Errorf("got cached body %q, want %q", got, want)
+	}
+	if got, want := scrape(false), wantBody("1"); got != want {
+		t.Errorf("got uncompressed body %q, want %q", got, want)
+	}
+
+	now = now.Add(time.Minute)
+	if got, want := scrape(true), wantBody("1"); got != want {
+		t.Errorf("got body after expiry %q, want %q", got, want)
+	}
+}
+
+func TestHandlerGatherErrorMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(errorCollector{})
+	selfReg := prometheus.NewRegistry()
+
+	opts := HandlerOpts{
+		ErrorHandling:         ContinueOnError,
+		GatherErrorRegisterer: selfReg,
+	}
+	handler := HandlerFor(reg, opts)
+	// A second handler shares the already registered metrics.
+	snapshotHandler := SnapshotHandlerFor(reg, opts, SnapshotOpts{})
+
+	scrape := func(h http.Handler, query string) *httptest.ResponseRecorder {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/"+query, nil)
+		request.Header.Add("Accept", "test/plain")
+		h.ServeHTTP(writer, request)
+		return writer
+	}
+
+	scrape(handler, "")
+	token := scrape(snapshotHandler, "?snapshot=new").Header().Get(SnapshotTokenHeader)
+	// Serving the stored snapshot does not count its errors again.
+	scrape(snapshotHandler, "?snapshot="+token)
+
+	mfs, err := selfReg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(mfs), 2; got != want {
+		t.Fatalf("got %d metric families, want %d", got, want)
+	}
+	errs := mfs[0]
+	if got, want := errs.GetName(), "promhttp_metric_handler_gather_errors_total"; got != want {
+		t.Fatalf("got metric family %q, want %q", got, want)
+	}
+	if got, want := len(errs.GetMetric()), 1; got != want {
+		t.Fatalf("got %d metrics, want %d", got, want)
+	}
+	m := errs.GetMetric()[0]
+	if got, want := m.GetLabel()[0].GetValue(), "invalid_metric"; got != want {
+		t.Errorf("got cause %q, want %q", got, want)
+	}
+	if got, want := m.GetCounter().GetValue(), 2.; got != want {
+		t.Errorf("got %v errors, want %v", got, want)
+	}
+	if got := mfs[1].GetMetric()[0].GetGauge().GetValue(); got <= 0 {
+		t.Errorf("got last error timestamp %v, want positive value", got)
+	}
+}
+
+func TestHandlerGatherErrorCauses(t *testing.T) {
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return nil, prometheus.MultiError{
+			prometheus.CollectorError{Collector: "slow_metric", Err: errors.New("timeout")},
+			prometheus.CollectorError{Collector: "slow_metric", Err: errors.New("timeout")},
+			prometheus.GatherError{Collector: "dup_metric", Err: errors.New("duplicate")},
+			prometheus.GatherError{Category: prometheus.GatherErrorAborted, Err: errors.New("aborted")},
+			errors.New("unknown"),
+		}
+	})
+	selfReg := prometheus.NewRegistry()
+	handler := HandlerFor(gatherer, HandlerOpts{
+		ErrorHandling:         ContinueOnError,
+		GatherErrorRegisterer: selfReg,
+	})
+	request, _ := http.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	mfs, err := selfReg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, m := range mfs[0].GetMetric() {
+		got[m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+	}
+	want := map[string]float64{"slow_metric": 2, "dup_metric": 1, "other": 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors by cause %v, want %v", got, want)
+	}
+}
+
+func TestHandlerCompressionLevel(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "the_count",
+		Help: "Ah-ah-ah! Thunder and lightning!",
+	})
+	reg.MustRegister(cnt)
+	want := `# HELP the_count Ah-ah-ah! Thunder and lightning!
+# TYPE the_count counter
+the_count 0
+`
+
+	for _, level := range []int{0, gzip.NoCompression, gzip.BestSpeed, gzip.BestCompression, gzip.HuffmanOnly} {
+		handler := HandlerFor(reg, HandlerOpts{CompressionLevel: level})
+		// Scrape repeatedly to exercise pooled writers.
+		for i := 0; i < 3; i++ {
+			writer := httptest.NewRecorder()
+			request, _ := http.NewRequest("GET", "/", nil)
+			request.Header.Add("Accept", "test/plain")
+			request.Header.Add(acceptEncodingHeader, "gzip")
+			handler.ServeHTTP(writer, request)
+
+			r, err := gzip.NewReader(writer.Body)
+			if err != nil {
+				t.Fatalf("level %d: %s", level, err)
+			}
+			body, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("level %d: %s", level, err)
+			}
+			if got := string(body); got != want {
+				t.Errorf("level %d: got body %q, want %q", level, got, want)
+			}
+		}
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic for invalid compression level")
+		}
+	}()
+	HandlerFor(reg, HandlerOpts{CompressionLevel: 42})
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	offered := []string{"zstd", "gzip"}
+	scenarios := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip;q=0.5", "gzip"},
+		{"gzip, zstd", "zstd"},
+		{"gzip, zstd;q=0", "gzip"},
+		{"gzip; q=0, zstd;q=0.0", ""},
+		{"br, deflate", ""},
+		{"GZIP", "gzip"},
+		{"gzip, ZSTD;Q=0", "gzip"},
+	}
+	for _, s := range scenarios {
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Set(acceptEncodingHeader, s.acceptEncoding)
+		if got := negotiateEncoding(request, offered); got != s.want {
+			t.Errorf("Accept-Encoding %q: got %q, want %q", s.acceptEncoding, got, s.want)
+		}
+	}
+}
+
+func TestNegotiateRepeatedHeaders(t *testing.T) {
+	offered := []string{"zstd", "gzip"}
+	scenarios := []struct {
+		acceptEncoding []string
+		want           string
+	}{
+		{[]string{"br", "gzip"}, "gzip"},
+		{[]string{"gzip", "zstd"}, "zstd"},
+		{[]string{"gzip, zstd", "zstd;q=0"}, "gzip"},
+	}
+	for _, s := range scenarios {
+		request, _ := http.NewRequest("GET", "/", nil)
+		for _, v := range s.acceptEncoding {
+			request.Header.Add(acceptEncodingHeader, v)
+		}
+		if got := negotiateEncoding(request, offered); got != s.want {
+			t.Errorf("Accept-Encoding %q: got %q, want %q", s.acceptEncoding, got, s.want)
+		}
+	}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Add(acceptHeader, "text/html")
+	request.Header.Add(acceptHeader, "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7")
+	if got, want := negotiateFormat(request, HandlerOpts{}), expfmt.FmtProtoDelim; got != want {
+		t.Errorf("got format %q, want %q", got, want)
+	}
+}
+
+func BenchmarkNegotiate(b *testing.B) {
+	offered := []string{"zstd", "gzip"}
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Add(acceptHeader, "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7")
+	request.Header.Add(acceptHeader, "text/plain;version=0.0.4;q=0.3,*/*;q=0.1")
+	request.Header.Add(acceptEncodingHeader, "gzip;q=0.9, deflate")
+	request.Header.Add(acceptEncodingHeader, "zstd;q=0")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		negotiateFormat(request, HandlerOpts{})
+		negotiateEncoding(request, offered)
+	}
+}
+
+func TestHandlerCustomCompression(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "the_count",
+		Help: "Ah-ah-ah! Thunder and lightning!",
+	})
+	reg.MustRegister(cnt)
+	want := `# HELP the_count Ah-ah-ah! Thunder and lightning!
+# TYPE the_count counter
+the_count 0
+`
+
+	handler := HandlerFor(reg, HandlerOpts{
+		OfferedCompressions: []string{"deflate", "gzip"},
+		CompressionEncoders: map[string]CompressionEncoder{
+			"deflate": func(w io.Writer) io.WriteCloser {
+				fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+				return fw
+			},
+		},
+	})
+	scrape := func(acceptEncoding string) (string, string) {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Add("Accept", "test/plain")
+		request.Header.Add(acceptEncodingHeader, acceptEncoding)
+		handler.ServeHTTP(writer, request)
+
+		encoding := writer.Header().Get(contentEncodingHeader)
+		var r io.Reader = writer.Body
+		switch encoding {
+		case "gzip":
+			gr, err := gzip.NewReader(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = gr
+		case "deflate":
+			r = flate.NewReader(r)
+		}
+		body, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoding, string(body)
+	}
+
+	for acceptEncoding, wantEncoding := range map[string]string{
+		"gzip, deflate":     "deflate",
+		"gzip":              "gzip",
+		"deflate;q=0, gzip": "gzip",
+		"br":                "",
+	} {
+		encoding, body := scrape(acceptEncoding)
+		if encoding != wantEncoding {
+			t.Errorf("Accept-Encoding %q: got encoding %q, want %q", acceptEncoding, encoding, wantEncoding)
+		}
+		if body != want {
+			t.Errorf("Accept-Encoding %q: got body %q, want %q", acceptEncoding, body, want)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic for offered compression without encoder")
+		}
+	}()
+	HandlerFor(reg, HandlerOpts{OfferedCompressions: []string{"zstd"}})
+}
+
+func TestHandlerGathererForRequest(t *testing.T) {
+	newReg := func(name string) *prometheus.Registry {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: name,
+			Help: "helpless",
+		}))
+		return reg
+	}
+	var (
+		def     = newReg("default_gauge")
+		a       = newReg("a_gauge")
+		b       = newReg("b_gauge")
+		handler = HandlerFor(def, HandlerOpts{
+			GathererForRequest: GatherersByQueryParam("collect[]", map[string]prometheus.Gatherer{
+				"a": a,
+				"b": b,
+			}),
+		})
+	)
+
+	scenarios := []struct {
+		query    string
+		wantCode int
+		want     []string
+	}{
+		{"", http.StatusOK, []string{"default_gauge"}},
+		{"?collect[]=a", http.StatusOK, []string{"a_gauge"}},
+		{"?collect[]=a&collect[]=b", http.StatusOK, []string{"a_gauge", "b_gauge"}},
+		{"?collect[]=b,a,b", http.StatusOK, []string{"a_gauge", "b_gauge"}},
+		{"?collect[]=c", http.StatusBadRequest, nil},
+	}
+	for _, s := range scenarios {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/metrics"+s.query, nil)
+		request.Header.Add("Accept", "test/plain")
+		handler.ServeHTTP(writer, request)
+		if got := writer.Code; got != s.wantCode {
+			t.Errorf("%q: got HTTP status code %d, want %d", s.query, got, s.wantCode)
+			continue
+		}
+		var got []string
+		for _, line := range strings.Split(writer.Body.String(), "\n") {
+			if strings.HasPrefix(line, "# TYPE ") {
+				got = append(got, strings.Fields(line)[2])
+			}
+		}
+		if !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%q: got metrics %v, want %v", s.query, got, s.want)
+		}
+	}
+}
+
+func TestInstrumentMetricHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	handler := InstrumentMetricHandler(reg, HandlerFor(reg, HandlerOpts{}))
+	// Do it again to test idempotency.
+	InstrumentMetricHandler(reg, HandlerFor(reg, HandlerOpts{}))
+
+	scrape := func() string {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Add("Accept", "test/plain")
+		handler.ServeHTTP(writer, request)
+		if got, want := writer.Code, http.StatusOK; got != want {
+			t.Errorf("got HTTP status code %d, want %d", got, want)
+		}
+		return writer.Body.String()
+	}
+
+	body := scrape()
+	for _, want := range []string{
+		"promhttp_metric_handler_requests_in_flight 1\n",
+		`promhttp_metric_handler_requests_total{code="200"} 0` + "\n",
+		`promhttp_metric_handler_requests_total{code="503"} 0` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("got body %q, want it to contain %q", body, want)
+		}
+	}
+
+	body = scrape()
+	for _, want := range []string{
+		"promhttp_metric_handler_requests_in_flight 1\n",
+		`promhttp_metric_handler_requests_total{code="200"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("got body %q, want it to contain %q", body, want)
+		}
+	}
+}
+
+func TestLoggerFunc(t *testing.T) {
+	var logged []interface{}
+	var l Logger = LoggerFunc(func(v ...interface{}) { logged = v })
+	l.Println("error gathering metrics:", 42)
+	if want := []interface{}{"error gathering metrics:", 42}; !reflect.DeepEqual(logged, want) {
+		t.Errorf("got %v, want %v", logged, want)
+	}
+}
+
+func TestHandlerHeadAndETag(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "the_count",
+		Help: "Ah-ah-ah! Thunder and lightning!",
+	})
+	reg.MustRegister(cnt)
+	handler := HandlerFor(reg, HandlerOpts{EnableETag: true})
+
+	request := func(method, ifNoneMatch string) *httptest.ResponseRecorder {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest(method, "/", nil)
+		request.Header.Add("Accept", "test/plain")
+		if ifNoneMatch != "" {
+			request.Header.Add(ifNoneMatchHeader, ifNoneMatch)
+		}
+		handler.ServeHTTP(writer, request)
+		return writer
+	}
+
+	get := request("GET", "")
+	etag := get.Header().Get(etagHeader)
+	if etag == "" {
+		t.Fatal("no ETag header")
+	}
+
+	head := request("HEAD", "")
+	if got := head.Body.Len(); got != 0 {
+		t.Errorf("got body of length %d for HEAD request, want none", got)
+	}
+	if got, want := head.Header().Get(contentLengthHeader), fmt.Sprint(get.Body.Len()); got != want {
+		t.Errorf("got Content-Length %s for HEAD request, want %s", got, want)
+	}
+	if got := head.Header().Get(etagHeader); got != etag {
+		t.Errorf("got ETag %s for HEAD request, want %s", got, etag)
+	}
+
+	for _, ifNoneMatch := range []string{etag, `"foo", W/` + etag, "*"} {
+		if got := request("GET", ifNoneMatch); got.Code != http.StatusNotModified || got.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: got HTTP status code %d and body length %d, want %d and 0", ifNoneMatch, got.Code, got.Body.Len(), http.StatusNotModified)
+		}
+	}
+
+	cnt.Inc()
+	got := request("GET", etag)
+	if got.Code != http.StatusOK {
+		t.Errorf("got HTTP status code %d after change, want %d", got.Code, http.StatusOK)
+	}
+	if got.Header().Get(etagHeader) == etag {
+		t.Error("ETag unchanged after change of metrics")
+	}
+}
+
+func TestHandlerScrapeTimeout(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	release := make(chan struct{})
+	defer close(release)
+	reg.MustRegister(
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "fast", Help: "help"}),
+		slowCollector{prometheus.NewDesc("slow", "help", nil, nil), release},
+	)
+	handler := HandlerFor(reg, HandlerOpts{
+		ErrorHandling:       ContinueOnError,
+		ScrapeTimeoutOffset: 450 * time.Millisecond,
+	})
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Add("Accept", "text/plain")
+	request.Header.Add(scrapeTimeoutHeader, "0.5")
+	writer := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(writer, request)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not honor the scrape timeout")
+	}
+
+	if got, want := writer.Code, http.StatusOK; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+	body := writer.Body.String()
+	if !strings.Contains(body, "fast 0") {
+		t.Errorf("fast metric missing in body %q", body)
+	}
+	if strings.Contains(body, "slow") {
+		t.Errorf("slow metric unexpectedly in body %q", body)
+	}
+}
+
+// blockingCollector closes started upon collection, blocks in
+// CollectWithContext until the Context is done, and then closes canceled.
+type blockingCollector struct {
+	desc              *prometheus.Desc
+	started, canceled chan struct{}
+}
+
+func (c blockingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c blockingCollector) Collect(ch chan<- prometheus.Metric) {
+	c.CollectWithContext(context.Background(), ch)
+}
+
+func (c blockingCollector) CollectWithContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	close(c.started)
+	<-ctx.Done()
+	close(c.canceled)
+}
+
+func TestHandlerRequestContext(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	collector := blockingCollector{
+		desc:     prometheus.NewDesc("blocking", "help", nil, nil),
+		started:  make(chan struct{}),
+		canceled: make(chan struct{}),
+	}
+	reg.MustRegister(collector)
+	handler := HandlerFor(prometheus.Gatherers{reg}, HandlerOpts{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	request, _ := http.NewRequest("GET", "/", nil)
+	request = request.WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+		close(done)
+	}()
+	// Simulate the client going away during collection.
+	<-collector.started
+	cancel()
+	for _, ch := range []chan struct{}{done, collector.canceled} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal("cancellation of the request did not reach the handler and the Collector")
+		}
+	}
+}
+
+// slowCollector collects a gauge only after release has been closed.
+type slowCollector struct {
+	desc    *prometheus.Desc
+	release chan struct{}
+}
+
+func (c slowCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c slowCollector) Collect(ch chan<- prometheus.Metric) {
+	<-c.release
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 1)
+}
+
+func TestHandlerFormat(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "g", Help: "help"}))
+	const acceptProto = "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited"
+
+	scenarios := []struct {
+		opts   HandlerOpts
+		accept string
+		want   expfmt.Format
+	}{
+		{HandlerOpts{}, acceptProto, expfmt.FmtProtoDelim},
+		{HandlerOpts{DisableProtobuf: true}, acceptProto, expfmt.FmtText},
+		{HandlerOpts{DisableProtobuf: true}, "text/plain", expfmt.FmtText},
+		{HandlerOpts{Format: expfmt.FmtText}, acceptProto, expfmt.FmtText},
+		{HandlerOpts{Format: expfmt.FmtProtoDelim}, "text/plain", expfmt.FmtProtoDelim},
+		{HandlerOpts{Format: expfmt.FmtProtoText, DisableProtobuf: true}, "", expfmt.FmtProtoText},
+	}
+	for i, s := range scenarios {
+		request, _ := http.NewRequest("GET", "/", nil)
+		if s.accept != "" {
+			request.Header.Add("Accept", s.accept)
+		}
+		writer := httptest.NewRecorder()
+		HandlerFor(reg, s.opts).ServeHTTP(writer, request)
+		if got := writer.Header().Get(contentTypeHeader); got != string(s.want) {
+			t.Errorf("%d. got content type %q, want %q", i, got, s.want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("HandlerFor did not panic with an unsupported format")
+		}
+	}()
+	HandlerFor(reg, HandlerOpts{Format: "application/json"})
+}
+
+func TestHandlerNameEscaping(t *testing.T) {
+	g := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return []*dto.MetricFamily{{
+			Name: proto.String("http.server.duration"),
+			Help: proto.String("help"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{
+				Label: []*dto.LabelPair{{Name: proto.String("http.method"), Value: proto.String("GET")}},
+				Gauge: &dto.Gauge{Value: proto.Float64(1)},
+			}},
+		}}, nil
+	})
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	writer := httptest.NewRecorder()
+	HandlerFor(g, HandlerOpts{NameEscaping: prometheus.UnderscoreEscaping}).ServeHTTP(writer, request)
+	if want := `http_server_duration{http_method="GET"} 1`; !strings.Contains(writer.Body.String(), want) {
+		t.Errorf("got body %q, want it to contain %q", writer.Body.String(), want)
+	}
+}
@@ -27,6 +27,10 @@ import (
 // magicString is used for the hacky label test in checkLabels. Remove once fixed.
 const magicString = "zZgWfBxLqvG8kc8IMv3POi2Bb0tZI3vAnBx+gBaFi9FyPzB/CzKUer1yufDa"
 
+// maxCurriedLabels is the maximum number of curried labels checkLabels can
+// cope with.
+const maxCurriedLabels = 16
+
 // InstrumentHandlerInFlight is a middleware that wraps the provided
 // http.Handler. It sets the provided prometheus.Gauge to the number of
 // requests currently handled by the wrapped http.Handler.
@@ -53,12 +57,15 @@ func InstrumentHandlerInFlight(g prometheus.Gauge, next http.Handler) http.Handl
 //
 // If the wrapped Handler does not set a status code, a status code of 200 is assumed.
 //
+// See WithLabelFromCtx for adding labels computed from the request context.
+//
 // If the wrapped Handler panics, no values are reported.
 //
 // Note that this method is only guaranteed to never observe negative durations
 // if used with Go1.9+.
-func InstrumentHandlerDuration(obs prometheus.ObserverVec, next http.Handler) http.HandlerFunc {
-	code, method := checkLabels(obs)
+func InstrumentHandlerDuration(obs prometheus.ObserverVec, next http.Handler, opts ...Option) http.HandlerFunc {
+	mwOpts := applyOptions(opts)
+	code, method := checkLabels(obs, mwOpts.extraLabelNames()...)
 
 	if code {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -66,14 +73,14 @@ func InstrumentHandlerDuration(obs prometheus.ObserverVec, next http.Handler) ht
 			d := newDelegator(w, nil)
 			next.ServeHTTP(d, r)
 
-			obs.With(labels(code, method, r.Method, d.Status())).Observe(time.Since(now).Seconds())
+			obs.With(mwOpts.labels(code, method, r, d.Status())).Observe(time.Since(now).Seconds())
 		})
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		now := time.Now()
 		next.ServeHTTP(w, r)
-		obs.With(labels(code, method, r.Method, 0)).Observe(time.Since(now).Seconds())
+		obs.With(mwOpts.labels(code, method, r, 0)).Observe(time.Since(now).Seconds())
 	})
 }
 
@@ -88,23 +95,26 @@ func InstrumentHandlerDuration(obs prometheus.ObserverVec, next http.Handler) ht
 //
 // If the wrapped Handler does not set a status code, a status code of 200 is assumed.
 //
+// See WithLabelFromCtx for adding labels computed from the request context.
+//
 // If the wrapped Handler panics, the Counter is not incremented.
 //
 // See the example for InstrumentHandlerDuration for example usage.
-func InstrumentHandlerCounter(counter *prometheus.CounterVec, next http.Handler) http.HandlerFunc {
-	code, method := checkLabels(counter)
+func InstrumentHandlerCounter(counter *prometheus.CounterVec, next http.Handler, opts ...Option) http.HandlerFunc {
+	mwOpts := applyOptions(opts)
+	code, method := checkLabels(counter, mwOpts.extraLabelNames()...)
 
 	if code {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			d := newDelegator(w, nil)
 			next.ServeHTTP(d, r)
-			counter.With(labels(code, method, r.Method, d.Status())).Inc()
+			counter.With(mwOpts.labels(code, method, r, d.Status())).Inc()
 		})
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		next.ServeHTTP(w, r)
-		counter.With(labels(code, method, r.Method, 0)).Inc()
+		counter.With(mwOpts.labels(code, method, r, 0)).Inc()
 	})
 }
 
@@ -120,6 +130,8 @@ func InstrumentHandlerCounter(counter *prometheus.CounterVec, next http.Handler)
 // labels. Note that partitioning of Histograms is expensive and should be used
 // judiciously.
 //
+// See WithLabelFromCtx for adding labels computed from the request context.
+//
 // If the wrapped Handler panics before calling WriteHeader, no value is
 // reported.
 //
@@ -127,13 +139,14 @@ func InstrumentHandlerCounter(counter *prometheus.CounterVec, next http.Handler)
 // if used with Go1.9+.
 //
 // See the example for InstrumentHandlerDuration for example usage.
-func InstrumentHandlerTimeToWriteHeader(obs prometheus.ObserverVec, next http.Handler) http.HandlerFunc {
-	code, method := checkLabels(obs)
+func InstrumentHandlerTimeToWriteHeader(obs prometheus.ObserverVec, next http.Handler, opts ...Option) http.HandlerFunc {
+	mwOpts := applyOptions(opts)
+	code, method := checkLabels(obs, mwOpts.extraLabelNames()...)
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		now := time.Now()
 		d := newDelegator(w, func(status int) {
-			obs.With(labels(code, method, r.Method, status)).Observe(time.Since(now).Seconds())
+			obs.With(mwOpts.labels(code, method, r, status)).Observe(time.Since(now).Seconds())
 		})
 		next.ServeHTTP(d, r)
 	})
@@ -152,25 +165,28 @@ func InstrumentHandlerTimeToWriteHeader(obs prometheus.ObserverVec, next http.Ha
 //
 // If the wrapped Handler does not set a status code, a status code of 200 is assumed.
 //
+// See WithLabelFromCtx for adding labels computed from the request context.
+//
 // If the wrapped Handler panics, no values are reported.
 //
 // See the example for InstrumentHandlerDuration for example usage.
-func InstrumentHandlerRequestSize(obs prometheus.ObserverVec, next http.Handler) http.HandlerFunc {
-	code, method := checkLabels(obs)
+func InstrumentHandlerRequestSize(obs prometheus.ObserverVec, next http.Handler, opts ...Option) http.HandlerFunc {
+	mwOpts := applyOptions(opts)
+	code, method := checkLabels(obs, mwOpts.extraLabelNames()...)
 
 	if code {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			d := newDelegator(w, nil)
 			next.ServeHTTP(d, r)
 			size := computeApproximateRequestSize(r)
-			obs.With(labels(code, method, r.Method, d.Status())).Observe(float64(size))
+			obs.With(mwOpts.labels(code, method, r, d.Status())).Observe(float64(size))
 		})
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		next.ServeHTTP(w, r)
 		size := computeApproximateRequestSize(r)
-		obs.With(labels(code, method, r.Method, 0)).Observe(float64(size))
+		obs.With(mwOpts.labels(code, method, r, 0)).Observe(float64(size))
 	})
 }
 
@@ -187,19 +203,22 @@ func InstrumentHandlerRequestSize(obs prometheus.ObserverVec, next http.Handler)
 //
 // If the wrapped Handler does not set a status code, a status code of 200 is assumed.
 //
+// See WithLabelFromCtx for adding labels computed from the request context.
+//
 // If the wrapped Handler panics, no values are reported.
 //
 // See the example for InstrumentHandlerDuration for example usage.
-func InstrumentHandlerResponseSize(obs prometheus.ObserverVec, next http.Handler) http.Handler {
-	code, method := checkLabels(obs)
+func InstrumentHandlerResponseSize(obs prometheus.ObserverVec, next http.Handler, opts ...Option) http.Handler {
+	mwOpts := applyOptions(opts)
+	code, method := checkLabels(obs, mwOpts.extraLabelNames()...)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		d := newDelegator(w, nil)
 		next.ServeHTTP(d, r)
-		obs.With(labels(code, method, r.Method, d.Status())).Observe(float64(d.Written()))
+		obs.With(mwOpts.labels(code, method, r, d.Status())).Observe(float64(d.Written()))
 	})
 }
 
-func checkLabels(c prometheus.Collector) (code bool, method bool) {
+func checkLabels(c prometheus.Collector, extraLabels ...string) (code bool, method bool) {
 	// TODO(beorn7): Remove this hacky way to check for instance labels
 	// once Descriptors can have their dimensionality queried.
 	var (
@@ -223,51 +242,73 @@ func checkLabels(c prometheus.Collector) (code bool, method bool) {
 
 	close(descc)
 
-	if _, err := prometheus.NewConstMetric(desc, prometheus.UntypedValue, 0); err == nil {
-		return
+	allowed := map[string]bool{"code": true, "method": true}
+	for _, name := range extraLabels {
+		if allowed[name] {
+			panic("label from context must not be named \"code\" or \"method\"")
+		}
+		allowed[name] = true
 	}
-	if m, err := prometheus.NewConstMetric(desc, prometheus.UntypedValue, 0, magicString); err == nil {
-		if err := m.Write(&pm); err != nil {
-			panic("error checking metric for labels")
+
+	// Find out the number of instance labels by trying to create a metric
+	// with an increasing number of label values. Curried labels count as
+	// instance labels here, so allow for some of them.
+	for n := 0; n <= len(allowed)+maxCurriedLabels; n++ {
+		lvs := make([]string, n)
+		for i := range lvs {
+			lvs[i] = magicString
 		}
-		for _, label := range pm.Label {
-			name, value := label.GetName(), label.GetValue()
-			if value != magicString {
-				continue
-			}
-			switch name {
-			case "code":
-				code = true
-			case "method":
-				method = true
-			default:
-				panic("metric partitioned with non-supported labels")
-			}
-			return
+		m, err := prometheus.NewConstMetric(desc, prometheus.UntypedValue, 0, lvs...)
+		if err != nil {
+			continue
 		}
-		panic("previously set label not found – this must never happen")
-	}
-	if m, err := prometheus.NewConstMetric(desc, prometheus.UntypedValue, 0, magicString, magicString); err == nil {
 		if err := m.Write(&pm); err != nil {
 			panic("error checking metric for labels")
 		}
+		found := map[string]bool{}
 		for _, label := range pm.Label {
 			name, value := label.GetName(), label.GetValue()
 			if value != magicString {
 				continue
 			}
-			if name == "code" || name == "method" {
+			if isLabelCurried(c, name) {
 				continue
 			}
-			panic("metric partitioned with non-supported labels")
+			if !allowed[name] {
+				panic("metric partitioned with non-supported labels")
+			}
+			found[name] = true
+		}
+		for _, name := range extraLabels {
+			if !found[name] {
+				panic("label from context not present in metric: " + name)
+			}
 		}
-		code = true
-		method = true
-		return
+		return found["code"], found["method"]
 	}
 	panic("metric partitioned with non-supported labels")
 }
 
+func isLabelCurried(c prometheus.Collector, label string) bool {
+	// This is even hackier than the label test above. We essentially try to
+	// curry again and see if it works. But for that, we need to
+	// type-convert to the two types we use here, ObserverVec or
+	// *CounterVec.
+	switch v := c.(type) {
+	case *prometheus.CounterVec:
+		if _, err := v.CurryWith(prometheus.Labels{label: "dummy"}); err == nil {
+			return false
+		}
+	case prometheus.ObserverVec:
+		if _, err := v.CurryWith(prometheus.Labels{label: "dummy"}); err == nil {
+			return false
+		}
+	default:
+		panic("unsupported metric vec type")
+	}
+	return true
+}
+
 // emptyLabels is a one-time allocation for non-partitioned metrics to avoid
 // unnecessary allocations on each request.
 var emptyLabels = prometheus.Labels{}
@@ -14,6 +14,7 @@
 package promhttp
 
 import (
+	"context"
 	"io"
 	"log"
 	"net/http"
@@ -21,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestMiddlewareAPI(t *testing.T) {
@@ -89,6 +91,83 @@ func TestMiddlewareAPI(t *testing.T) {
 	chain.ServeHTTP(w, r)
 }
 
+func TestMiddlewareCurriedVec(t *testing.T) {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_requests_total",
+			Help: "A counter for requests to the wrapped handler.",
+		},
+		[]string{"handler", "code"},
+	)
+	handler := InstrumentHandlerCounter(
+		counter.MustCurryWith(prometheus.Labels{"handler": "push"}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		}),
+	)
+
+	r, _ := http.NewRequest("GET", "www.example.com", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got := testutil.ToFloat64(counter.WithLabelValues("push", "202")); got != 1 {
+		t.Errorf("want counter value 1, got %v", got)
+	}
+}
+
+type tenantKey struct{}
+
+func TestMiddlewareWithLabelFromCtx(t *testing.T) {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_requests_total",
+			Help: "A counter for requests to the wrapped handler.",
+		},
+		[]string{"code", "tenant"},
+	)
+	tenantFromCtx := WithLabelFromCtx("tenant", func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return tenant
+	})
+
+	handler := InstrumentHandlerCounter(counter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}), tenantFromCtx)
+
+	r, _ := http.NewRequest("GET", "www.example.com", nil)
+	r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, "acme"))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got := testutil.ToFloat64(counter.WithLabelValues("418", "acme")); got != 1 {
+		t.Errorf("want counter value 1, got %v", got)
+	}
+
+	// A metric without the label from the context must be rejected.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic for metric without tenant label")
+			}
+		}()
+		InstrumentHandlerCounter(prometheus.NewCounterVec(
+			prometheus.CounterOpts{Name: "c_total", Help: "help"},
+			[]string{"code"},
+		), handler, tenantFromCtx)
+	}()
+
+	// Labels from the context must not shadow code or method.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic for label from context named method")
+			}
+		}()
+		InstrumentHandlerCounter(prometheus.NewCounterVec(
+			prometheus.CounterOpts{Name: "c_total", Help: "help"},
+			[]string{"method"},
+		), handler, WithLabelFromCtx("method", func(context.Context) string { return "" }))
+	}()
+}
+
 func TestInstrumentTimeToFirstWrite(t *testing.T) {
 	var i int
 	dobs := &responseWriterDelegator{
@@ -145,6 +224,33 @@ func TestInterfaceUpgrade(t *testing.T) {
 	}
 }
 
+func TestNewDelegatingResponseWriter(t *testing.T) {
+	var observed int
+	recorder := httptest.NewRecorder()
+	d := NewDelegatingResponseWriter(recorder, func(status int) {
+		observed = status
+	})
+	if got := d.Status(); got != 0 {
+		t.Errorf("got status %d before writing, want 0", got)
+	}
+	d.Write([]byte("hello"))
+	if got, want := d.Status(), http.StatusOK; got != want {
+		t.Errorf("got status %d, want %d", got, want)
+	}
+	if got, want := observed, http.StatusOK; got != want {
+		t.Errorf("got observed status %d, want %d", got, want)
+	}
+	if got, want := d.Written(), int64(5); got != want {
+		t.Errorf("got %d bytes written, want %d", got, want)
+	}
+	if _, ok := d.(http.Flusher); !ok {
+		t.Error("DelegatingResponseWriter does not implement http.Flusher")
+	}
+	if _, ok := d.(http.Hijacker); ok {
+		t.Error("DelegatingResponseWriter unexpectedly implements http.Hijacker")
+	}
+}
+
 func ExampleInstrumentHandlerDuration() {
 	inFlightGauge := prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "in_flight_requests",
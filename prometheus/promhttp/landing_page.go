@@ -0,0 +1,92 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// LandingPageLink is a link shown on a landing page, see LandingPageConfig.
+type LandingPageLink struct {
+	Address     string // The target of the link, e.g. "/metrics".
+	Text        string // The text of the link, e.g. "Metrics".
+	Description string // An optional description shown next to the link.
+}
+
+// LandingPageConfig configures the landing page served by the handler returned
+// by LandingPageHandler.
+type LandingPageConfig struct {
+	// Name is the name of the exporter, used as the title and the heading
+	// of the page.
+	Name string
+	// Description is an optional paragraph shown below the heading.
+	Description string
+	// Version is an optional version string shown below the heading.
+	Version string
+	// Links are shown as a list. If empty, a single link to "/metrics" is
+	// shown.
+	Links []LandingPageLink
+}
+
+var landingPageTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<title>{{.Name}}</title>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{if .Description}}<p>{{.Description}}</p>
+{{end}}{{if .Version}}<p>Version: {{.Version}}</p>
+{{end}}<ul>
+{{range .Links}}<li><a href="{{.Address}}">{{.Text}}</a>{{if .Description}}: {{.Description}}{{end}}</li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+// LandingPageHandler returns an http.Handler serving a simple HTML page with
+// the name and description of an exporter and links to its endpoints, meant to
+// be registered for the root path ("/") of an exporter. This saves exporter
+// authors from writing such a page by hand, and it makes health checks
+// requesting "/" succeed. Requests for any path other than "/" are answered
+// with an HTTP status code 404, so that typos in URLs are not masked when the
+// handler is registered for "/" with an http.ServeMux (which routes all
+// otherwise unmatched paths to it).
+//
+// The page is rendered once upon creation of the handler. All content is HTML
+// escaped.
+func LandingPageHandler(c LandingPageConfig) http.Handler {
+	if len(c.Links) == 0 {
+		c.Links = []LandingPageLink{{Address: "/metrics", Text: "Metrics"}}
+	}
+	var buf bytes.Buffer
+	if err := landingPageTemplate.Execute(&buf, c); err != nil {
+		panic(fmt.Errorf("error rendering landing page: %s", err))
+	}
+	page := buf.Bytes()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set(contentTypeHeader, "text/html; charset=utf-8")
+		w.Header().Set(contentLengthHeader, fmt.Sprint(len(page)))
+		w.Write(page)
+	})
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLandingPageHandler(t *testing.T) {
+	handler := LandingPageHandler(LandingPageConfig{
+		Name:        "Example Exporter",
+		Description: "Exports <examples>.",
+		Version:     "1.2.3",
+	})
+
+	writer := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(writer, request)
+	if got, want := writer.Code, http.StatusOK; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+	if got, want := writer.Header().Get(contentTypeHeader), "text/html; charset=utf-8"; got != want {
+		t.Errorf("got content type %q, want %q", got, want)
+	}
+	body := writer.Body.String()
+	for _, want := range []string{
+		"<title>Example Exporter</title>",
+		"<p>Exports &lt;examples&gt;.</p>",
+		"Version: 1.2.3",
+		`<a href="/metrics">Metrics</a>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body %q does not contain %q", body, want)
+		}
+	}
+
+	writer = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/typo", nil)
+	handler.ServeHTTP(writer, request)
+	if got, want := writer.Code, http.StatusNotFound; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+}
+
+func TestLandingPageHandlerLinks(t *testing.T) {
+	handler := LandingPageHandler(LandingPageConfig{
+		Name: "Example Exporter",
+		Links: []LandingPageLink{
+			{Address: "/metrics", Text: "Metrics"},
+			{Address: "/probe?target=example.org", Text: "Probe", Description: "Probe a target"},
+		},
+	})
+
+	writer := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(writer, request)
+	body := writer.Body.String()
+	for _, want := range []string{
+		`<a href="/metrics">Metrics</a>`,
+		`<a href="/probe?target=example.org">Probe</a>: Probe a target`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body %q does not contain %q", body, want)
+		}
+	}
+}
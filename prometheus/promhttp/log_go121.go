@@ -0,0 +1,49 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.21
+
+package promhttp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// NewSlogLogger returns a Logger that logs to the provided *slog.Logger at the
+// provided level. Arguments of type error are logged as the attribute "err",
+// all other arguments are formatted into the message as fmt.Sprintln would
+// do. For example, the handler's log line for a gathering error results in the
+// message "error gathering metrics:" with the error as attribute.
+func NewSlogLogger(l *slog.Logger, level slog.Level) Logger {
+	return LoggerFunc(func(v ...interface{}) {
+		var (
+			msg   []interface{}
+			attrs []slog.Attr
+		)
+		for _, arg := range v {
+			if err, ok := arg.(error); ok {
+				attrs = append(attrs, slog.Any("err", err))
+				continue
+			}
+			msg = append(msg, arg)
+		}
+		l.LogAttrs(
+			context.Background(), level,
+			strings.TrimSuffix(fmt.Sprintln(msg...), "\n"),
+			attrs...,
+		)
+	})
+}
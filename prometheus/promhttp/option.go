@@ -0,0 +1,87 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Option is a function that configures one of the InstrumentHandler…
+// middlewares.
+type Option func(*options)
+
+// LabelValueFromCtx is used to compute the value of an additional label from
+// the context of a request.
+type LabelValueFromCtx func(ctx context.Context) string
+
+type options struct {
+	extraLabelsFromCtx map[string]LabelValueFromCtx
+}
+
+func defaultOptions() *options {
+	return &options{extraLabelsFromCtx: map[string]LabelValueFromCtx{}}
+}
+
+// WithLabelFromCtx returns an Option that adds a label with the provided name
+// to the observations of a middleware. The label value is computed by calling
+// valueFn with the context of the request being handled, e.g. to partition by
+// a tenant ID stored in the context by an authentication middleware. The
+// vector passed to the middleware (an ObserverVec, or a CounterVec in the case
+// of InstrumentHandlerCounter) must have a label with the provided name, in
+// addition to the optional "code" and "method" labels. The name must be
+// neither "code" nor "method". The Option can be passed to any of the
+// InstrumentHandler… middlewares except InstrumentHandlerInFlight.
+func WithLabelFromCtx(name string, valueFn LabelValueFromCtx) Option {
+	return func(o *options) {
+		o.extraLabelsFromCtx[name] = valueFn
+	}
+}
+
+// applyOptions returns the options resulting from applying the provided
+// Options to the default options.
+func applyOptions(opts []Option) *options {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// extraLabelNames returns the names of the labels added with WithLabelFromCtx.
+func (o *options) extraLabelNames() []string {
+	names := make([]string, 0, len(o.extraLabelsFromCtx))
+	for name := range o.extraLabelsFromCtx {
+		names = append(names, name)
+	}
+	return names
+}
+
+// labels works like the labels function but also adds the labels configured
+// with WithLabelFromCtx, using the context of the provided request.
+func (o *options) labels(code, method bool, r *http.Request, status int) prometheus.Labels {
+	if len(o.extraLabelsFromCtx) == 0 {
+		return labels(code, method, r.Method, status)
+	}
+	l := prometheus.Labels{}
+	for name, value := range labels(code, method, r.Method, status) {
+		l[name] = value
+	}
+	for name, valueFn := range o.extraLabelsFromCtx {
+		l[name] = valueFn(r.Context())
+	}
+	return l
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ScrapeMetadata determines how a handler created with HandlerFor reports
+// metadata about each scrape.
+type ScrapeMetadata int
+
+// Supported ScrapeMetadata values.
+const (
+	// NoScrapeMetadata does not report any scrape metadata.
+	NoScrapeMetadata ScrapeMetadata = iota
+	// ScrapeMetadataTrailers reports the scrape metadata as the HTTP
+	// trailers X-Prometheus-Gather-Duration-Seconds,
+	// X-Prometheus-Metric-Families, and X-Prometheus-Truncated ("true" or
+	// "false"). Trailers are supported by HTTP/2 and by HTTP/1.1 with
+	// chunked transfer encoding, which is why the response does not carry
+	// a Content-Length header in this mode. (To serve HTTP/2 without TLS,
+	// wrap the handler with h2c.NewHandler from golang.org/x/net.) Many clients ignore trailers, so this mode is mostly useful for
+	// debugging and for custom scrapers.
+	ScrapeMetadataTrailers
+	// ScrapeMetadataMetrics reports the scrape metadata as the gauges
+	// promhttp_scrape_gather_duration_seconds,
+	// promhttp_scrape_metric_families, and promhttp_scrape_truncated (1 if
+	// metrics are missing, 0 otherwise), appended to the served metrics.
+	// This makes the metadata available to the Prometheus server, e.g. to
+	// alert on exporters that get slower or lose metrics. The number of
+	// metric families does not include these gauges.
+	ScrapeMetadataMetrics
+)
+
+// Names of the trailers used with ScrapeMetadataTrailers.
+const (
+	gatherDurationTrailer = "X-Prometheus-Gather-Duration-Seconds"
+	metricFamiliesTrailer = "X-Prometheus-Metric-Families"
+	truncatedTrailer      = "X-Prometheus-Truncated"
+)
+
+var scrapeMetadataTrailers = []string{gatherDurationTrailer, metricFamiliesTrailer, truncatedTrailer}
+
+// scrapeMetadata is the metadata of a single scrape.
+type scrapeMetadata struct {
+	gatherDuration time.Duration
+	metricFamilies int
+	truncated      bool
+}
+
+// setTrailers sets the trailers announced for ScrapeMetadataTrailers in the
+// provided header, which must be the header of a ResponseWriter the body has
+// already been written to.
+func (m scrapeMetadata) setTrailers(header http.Header) {
+	header.Set(gatherDurationTrailer, strconv.FormatFloat(m.gatherDuration.Seconds(), 'g', -1, 64))
+	header.Set(metricFamiliesTrailer, strconv.Itoa(m.metricFamilies))
+	header.Set(truncatedTrailer, strconv.FormatBool(m.truncated))
+}
+
+// metricFamiliesOf returns the metric families reported for
+// ScrapeMetadataMetrics.
+func (m scrapeMetadata) metricFamiliesOf() []*dto.MetricFamily {
+	truncated := 0.
+	if m.truncated {
+		truncated = 1
+	}
+	return []*dto.MetricFamily{
+		gaugeFamily(
+			"promhttp_scrape_gather_duration_seconds",
+			"Duration of gathering the metrics of this scrape.",
+			m.gatherDuration.Seconds(),
+		),
+		gaugeFamily(
+			"promhttp_scrape_metric_families",
+			"Number of metric families served in this scrape.",
+			float64(m.metricFamilies),
+		),
+		gaugeFamily(
+			"promhttp_scrape_truncated",
+			"Whether metrics are missing from this scrape because of errors during gathering (1) or not (0).",
+			truncated,
+		),
+	}
+}
+
+func gaugeFamily(name, help string, value float64) *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name:   proto.String(name),
+		Help:   proto.String(help),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(value)}}},
+	}
+}
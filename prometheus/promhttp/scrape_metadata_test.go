@@ -0,0 +1,77 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestScrapeMetadataMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "g", Help: "help"}),
+		errorCollector{},
+	)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	writer := httptest.NewRecorder()
+	HandlerFor(reg, HandlerOpts{
+		ErrorHandling:  ContinueOnError,
+		ScrapeMetadata: ScrapeMetadataMetrics,
+	}).ServeHTTP(writer, request)
+
+	body := writer.Body.String()
+	for _, want := range []string{
+		"\ng 0\n",
+		"\npromhttp_scrape_metric_families 1\n",
+		"\npromhttp_scrape_truncated 1\n",
+		"\n# TYPE promhttp_scrape_gather_duration_seconds gauge\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("got body\n%s\nwant it to contain %q", body, want)
+		}
+	}
+}
+
+func TestScrapeMetadataTrailers(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "g", Help: "help"}))
+
+	server := httptest.NewServer(HandlerFor(reg, HandlerOpts{ScrapeMetadata: ScrapeMetadataTrailers}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := ioutil.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resp.Trailer.Get(metricFamiliesTrailer), "1"; got != want {
+		t.Errorf("got trailer %s %q, want %q", metricFamiliesTrailer, got, want)
+	}
+	if got, want := resp.Trailer.Get(truncatedTrailer), "false"; got != want {
+		t.Errorf("got trailer %s %q, want %q", truncatedTrailer, got, want)
+	}
+	if resp.Trailer.Get(gatherDurationTrailer) == "" {
+		t.Errorf("trailer %s missing", gatherDurationTrailer)
+	}
+}
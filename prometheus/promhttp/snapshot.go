@@ -0,0 +1,200 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// SnapshotParam is the name of the URL query parameter used to request
+	// a snapshot from a handler created with SnapshotHandlerFor.
+	SnapshotParam = "snapshot"
+	// SnapshotTokenHeader is the name of the HTTP response header carrying
+	// the token of a newly created snapshot.
+	SnapshotTokenHeader = "X-Prometheus-Snapshot-Token"
+	// newSnapshot is the value of SnapshotParam to request a new snapshot.
+	newSnapshot = "new"
+)
+
+// Default values for SnapshotOpts.
+const (
+	// DefSnapshotTTL is the default duration for which a snapshot is kept.
+	DefSnapshotTTL = time.Minute
+	// DefMaxSnapshots is the default number of snapshots kept at the same
+	// time.
+	DefMaxSnapshots = 10
+)
+
+// SnapshotOpts specifies how a handler created with SnapshotHandlerFor keeps
+// its snapshots. The zero value of SnapshotOpts is a reasonable default.
+type SnapshotOpts struct {
+	// TTL is the duration after which a snapshot expires. The default value
+	// is DefSnapshotTTL.
+	TTL time.Duration
+	// MaxSnapshots is the maximum number of snapshots kept at the same
+	// time. If a new snapshot is requested while the maximum number is
+	// reached, the oldest snapshot is evicted. The default value is
+	// DefMaxSnapshots.
+	MaxSnapshots int
+	// Clock is used to tell the time for snapshot expiry. The default
+	// value is prometheus.DefaultClock at creation time of the handler.
+	Clock prometheus.Clock
+}
+
+// snapshot is the result of one Gather call, frozen for later use.
+type snapshot struct {
+	mfs     []*dto.MetricFamily
+	err     error
+	expires time.Time
+}
+
+// Gather implements prometheus.Gatherer.
+func (s *snapshot) Gather() ([]*dto.MetricFamily, error) {
+	return s.mfs, s.err
+}
+
+// SnapshotHandlerFor returns an http.Handler for the provided Gatherer that
+// allows clients to read the same gathered metrics repeatedly, e.g. to run
+// several queries against one consistent state of the metrics.
+//
+// Without the SnapshotParam URL query parameter, the handler behaves exactly
+// like the handler returned by HandlerFor. With the query parameter set to
+// "new" (e.g. "/metrics?snapshot=new"), the handler gathers from the Gatherer as
+// usual, but it keeps the result as a snapshot and returns the token
+// identifying the snapshot in the SnapshotTokenHeader response header. With the
+// query parameter set to such a token, the handler serves the snapshot
+// identified by the token without gathering again. Unknown or expired tokens
+// result in an HTTP status code 404.
+//
+// Snapshots are kept in memory. Their number is bounded by the MaxSnapshots
+// field of SnapshotOpts, and they expire after the TTL set in SnapshotOpts.
+// Both snapshot creation and snapshot serving honor the provided HandlerOpts.
+// If GathererForRequest is set in HandlerOpts, it selects the Gatherer upon
+// snapshot creation, while a stored snapshot is always served as is.
+func SnapshotHandlerFor(reg prometheus.Gatherer, opts HandlerOpts, snapOpts SnapshotOpts) http.Handler {
+	if snapOpts.TTL <= 0 {
+		snapOpts.TTL = DefSnapshotTTL
+	}
+	if snapOpts.MaxSnapshots <= 0 {
+		snapOpts.MaxSnapshots = DefMaxSnapshots
+	}
+	if snapOpts.Clock == nil {
+		snapOpts.Clock = prometheus.DefaultClock()
+	}
+	s := &snapshotStore{
+		opts:      snapOpts,
+		snapshots: map[string]*snapshot{},
+	}
+	gatherErrs := newGatherErrorMetrics(opts.GatherErrorRegisterer)
+	h := handlerFor(reg, opts, gatherErrs)
+	// A snapshot must not be replaced by a Gatherer selected by
+	// GathererForRequest when serving it.
+	snapServeOpts := opts
+	snapServeOpts.GathererForRequest = nil
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token := req.URL.Query().Get(SnapshotParam)
+		switch token {
+		case "":
+			h.ServeHTTP(w, req)
+			return
+		case newSnapshot:
+			g, err := selectGatherer(reg, req, opts)
+			if err != nil {
+				http.Error(w, "Invalid request:\n\n"+err.Error(), http.StatusBadRequest)
+				return
+			}
+			mfs, err := gather(g, req, opts.ScrapeTimeoutOffset)
+			snap := &snapshot{mfs: mfs, err: err}
+			token, err = s.add(snap)
+			if err != nil {
+				http.Error(w, "Could not create snapshot:\n\n"+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set(SnapshotTokenHeader, token)
+			handlerFor(snap, snapServeOpts, gatherErrs).ServeHTTP(w, req)
+		default:
+			snap, ok := s.get(token)
+			if !ok {
+				http.Error(w, "Unknown or expired snapshot token.", http.StatusNotFound)
+				return
+			}
+			// Errors of a stored snapshot have been recorded upon its
+			// creation already.
+			handlerFor(snap, snapServeOpts, nil).ServeHTTP(w, req)
+		}
+	})
+}
+
+// snapshotStore keeps snapshots by token.
+type snapshotStore struct {
+	mtx       sync.Mutex
+	opts      SnapshotOpts
+	snapshots map[string]*snapshot
+	tokens    []string // In order of creation, oldest first.
+}
+
+// add stores the provided snapshot under a new random token, which is
+// returned. It evicts expired snapshots and, if still required, the oldest
+// snapshot to stay within the configured maximum number of snapshots.
+func (s *snapshotStore) add(snap *snapshot) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	now := s.opts.Clock.Now()
+	snap.expires = now.Add(s.opts.TTL)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.evictExpired(now)
+	for len(s.tokens) >= s.opts.MaxSnapshots {
+		delete(s.snapshots, s.tokens[0])
+		s.tokens = s.tokens[1:]
+	}
+	s.snapshots[token] = snap
+	s.tokens = append(s.tokens, token)
+	return token, nil
+}
+
+// get returns the unexpired snapshot stored under the provided token.
+func (s *snapshotStore) get(token string) (*snapshot, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.evictExpired(s.opts.Clock.Now())
+	snap, ok := s.snapshots[token]
+	return snap, ok
+}
+
+// evictExpired removes all snapshots that have expired at the provided
+// time. As all snapshots have the same TTL, the snapshots expire in order of
+// creation. Must be called with the mutex held.
+func (s *snapshotStore) evictExpired(now time.Time) {
+	for len(s.tokens) > 0 && !now.Before(s.snapshots[s.tokens[0]].expires) {
+		delete(s.snapshots, s.tokens[0])
+		s.tokens = s.tokens[1:]
+	}
+}
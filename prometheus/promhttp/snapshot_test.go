@@ -0,0 +1,154 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSnapshotHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "the_count",
+		Help: "Ah-ah-ah! Thunder and lightning!",
+	})
+	reg.MustRegister(cnt)
+
+	handler := SnapshotHandlerFor(reg, HandlerOpts{}, SnapshotOpts{MaxSnapshots: 1})
+	scrape := func(query string) *httptest.ResponseRecorder {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/"+query, nil)
+		request.Header.Add("Accept", "test/plain")
+		handler.ServeHTTP(writer, request)
+		return writer
+	}
+
+	wantSnapshotBody := `# HELP the_count Ah-ah-ah! Thunder and lightning!
+# TYPE the_count counter
+the_count 0
+`
+	wantLiveBody := `# HELP the_count Ah-ah-ah! Thunder and lightning!
+# TYPE the_count counter
+the_count 1
+`
+
+	writer := scrape("?snapshot=new")
+	if got, want := writer.Code, http.StatusOK; got != want {
+		t.Fatalf("got HTTP status code %d, want %d", got, want)
+	}
+	token := writer.Header().Get(SnapshotTokenHeader)
+	if token == "" {
+		t.Fatal("no snapshot token returned")
+	}
+	if got := writer.Body.String(); got != wantSnapshotBody {
+		t.Errorf("got body %q, want %q", got, wantSnapshotBody)
+	}
+
+	cnt.Inc()
+
+	if got := scrape("?snapshot=" + token).Body.String(); got != wantSnapshotBody {
+		t.Errorf("got snapshot body %q, want %q", got, wantSnapshotBody)
+	}
+	if got := scrape("").Body.String(); got != wantLiveBody {
+		t.Errorf("got live body %q, want %q", got, wantLiveBody)
+	}
+	if got, want := scrape("?snapshot=unknown").Code, http.StatusNotFound; got != want {
+		t.Errorf("got HTTP status code %d for unknown token, want %d", got, want)
+	}
+
+	// Creating another snapshot evicts the first one.
+	scrape("?snapshot=new")
+	if got, want := scrape("?snapshot="+token).Code, http.StatusNotFound; got != want {
+		t.Errorf("got HTTP status code %d for evicted token, want %d", got, want)
+	}
+}
+
+func TestSnapshotHandlerRequestContext(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	collector := blockingCollector{
+		desc:     prometheus.NewDesc("blocking", "help", nil, nil),
+		started:  make(chan struct{}),
+		canceled: make(chan struct{}),
+	}
+	reg.MustRegister(collector)
+	handler := SnapshotHandlerFor(reg, HandlerOpts{}, SnapshotOpts{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	request, _ := http.NewRequest("GET", "/?snapshot=new", nil)
+	request = request.WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+		close(done)
+	}()
+	// Simulate the client going away during snapshot creation.
+	<-collector.started
+	cancel()
+	for _, ch := range []chan struct{}{done, collector.canceled} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal("cancellation of the request did not reach the snapshot creation")
+		}
+	}
+}
+
+func TestSnapshotHandlerGathererForRequest(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	moduleReg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounter(prometheus.CounterOpts{Name: "module_count", Help: "help"})
+	moduleReg.MustRegister(cnt)
+
+	handler := SnapshotHandlerFor(reg, HandlerOpts{
+		GathererForRequest: GatherersByQueryParam("module", map[string]prometheus.Gatherer{
+			"m": moduleReg,
+		}),
+	}, SnapshotOpts{})
+	scrape := func(query string) *httptest.ResponseRecorder {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/"+query, nil)
+		request.Header.Add("Accept", "test/plain")
+		handler.ServeHTTP(writer, request)
+		return writer
+	}
+
+	wantSnapshotBody := `# HELP module_count help
+# TYPE module_count counter
+module_count 0
+`
+	writer := scrape("?snapshot=new&module=m")
+	if got := writer.Body.String(); got != wantSnapshotBody {
+		t.Errorf("got body %q, want %q", got, wantSnapshotBody)
+	}
+	token := writer.Header().Get(SnapshotTokenHeader)
+
+	cnt.Inc()
+
+	// The snapshot is served as is, whether or not the request selects a
+	// Gatherer.
+	for _, query := range []string{"?snapshot=" + token + "&module=m", "?snapshot=" + token} {
+		if got := scrape(query).Body.String(); got != wantSnapshotBody {
+			t.Errorf("%s: got snapshot body %q, want %q", query, got, wantSnapshotBody)
+		}
+	}
+	if got, want := scrape("?snapshot=new&module=unknown").Code, http.StatusBadRequest; got != want {
+		t.Errorf("got HTTP status code %d for unknown module, want %d", got, want)
+	}
+}
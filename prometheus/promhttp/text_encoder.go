@@ -0,0 +1,208 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+var textBufPool sync.Pool
+
+func getTextBuf() *[]byte {
+	if b := textBufPool.Get(); b != nil {
+		return b.(*[]byte)
+	}
+	b := make([]byte, 0, 4096)
+	return &b
+}
+
+func giveTextBuf(b *[]byte) {
+	textBufPool.Put(b)
+}
+
+// textEncoder is an expfmt.Encoder for the text format that avoids the
+// allocations of expfmt.MetricFamilyToText. It renders each MetricFamily into
+// a pooled byte slice and writes it to the underlying Writer in one go. The
+// output is identical to the one of the expfmt encoder. Unlike the latter, it
+// writes nothing at all for an invalid MetricFamily.
+type textEncoder struct {
+	w io.Writer
+}
+
+// Encode implements expfmt.Encoder.
+func (e textEncoder) Encode(mf *dto.MetricFamily) error {
+	bp := getTextBuf()
+	defer giveTextBuf(bp)
+
+	b, err := appendMetricFamilyText((*bp)[:0], mf)
+	*bp = b[:0] // Keep the possibly grown slice for the next use.
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(b)
+	return err
+}
+
+// appendMetricFamilyText appends the provided MetricFamily in the text format
+// to b and returns the extended slice.
+func appendMetricFamilyText(b []byte, mf *dto.MetricFamily) ([]byte, error) {
+	if len(mf.Metric) == 0 {
+		return b, fmt.Errorf("MetricFamily has no metrics: %s", mf)
+	}
+	name := mf.GetName()
+	if name == "" {
+		return b, fmt.Errorf("MetricFamily has no name: %s", mf)
+	}
+
+	if mf.Help != nil {
+		b = append(b, "# HELP "...)
+		b = append(b, name...)
+		b = append(b, ' ')
+		b = appendEscaped(b, mf.GetHelp(), false)
+		b = append(b, '\n')
+	}
+	b = append(b, "# TYPE "...)
+	b = append(b, name...)
+	b = append(b, ' ')
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		b = append(b, "counter\n"...)
+	case dto.MetricType_GAUGE:
+		b = append(b, "gauge\n"...)
+	case dto.MetricType_SUMMARY:
+		b = append(b, "summary\n"...)
+	case dto.MetricType_UNTYPED:
+		b = append(b, "untyped\n"...)
+	case dto.MetricType_HISTOGRAM:
+		b = append(b, "histogram\n"...)
+	default:
+		return b, fmt.Errorf("unexpected type in metric family %s", mf)
+	}
+
+	for _, m := range mf.Metric {
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			if m.Counter == nil {
+				return b, fmt.Errorf("expected counter in metric %s %s", name, m)
+			}
+			b = appendSample(b, name, "", m, "", 0, m.Counter.GetValue())
+		case dto.MetricType_GAUGE:
+			if m.Gauge == nil {
+				return b, fmt.Errorf("expected gauge in metric %s %s", name, m)
+			}
+			b = appendSample(b, name, "", m, "", 0, m.Gauge.GetValue())
+		case dto.MetricType_UNTYPED:
+			if m.Untyped == nil {
+				return b, fmt.Errorf("expected untyped in metric %s %s", name, m)
+			}
+			b = appendSample(b, name, "", m, "", 0, m.Untyped.GetValue())
+		case dto.MetricType_SUMMARY:
+			if m.Summary == nil {
+				return b, fmt.Errorf("expected summary in metric %s %s", name, m)
+			}
+			for _, q := range m.Summary.Quantile {
+				b = appendSample(b, name, "", m, "quantile", q.GetQuantile(), q.GetValue())
+			}
+			b = appendSample(b, name, "_sum", m, "", 0, m.Summary.GetSampleSum())
+			b = appendSample(b, name, "_count", m, "", 0, float64(m.Summary.GetSampleCount()))
+		case dto.MetricType_HISTOGRAM:
+			if m.Histogram == nil {
+				return b, fmt.Errorf("expected histogram in metric %s %s", name, m)
+			}
+			infSeen := false
+			for _, bucket := range m.Histogram.Bucket {
+				b = appendSample(b, name, "_bucket", m, "le", bucket.GetUpperBound(), float64(bucket.GetCumulativeCount()))
+				if math.IsInf(bucket.GetUpperBound(), +1) {
+					infSeen = true
+				}
+			}
+			if !infSeen {
+				b = appendSample(b, name, "_bucket", m, "le", math.Inf(+1), float64(m.Histogram.GetSampleCount()))
+			}
+			b = appendSample(b, name, "_sum", m, "", 0, m.Histogram.GetSampleSum())
+			b = appendSample(b, name, "_count", m, "", 0, float64(m.Histogram.GetSampleCount()))
+		}
+	}
+	return b, nil
+}
+
+// appendSample appends a single sample line. If extraLabel is not empty, a
+// label with that name and the provided extraValue formatted as a float is
+// added after the labels of the Metric (as needed for quantiles and buckets).
+func appendSample(
+	b []byte,
+	name, suffix string,
+	m *dto.Metric,
+	extraLabel string, extraValue float64,
+	value float64,
+) []byte {
+	b = append(b, name...)
+	b = append(b, suffix...)
+	if len(m.Label) > 0 || extraLabel != "" {
+		sep := byte('{')
+		for _, lp := range m.Label {
+			b = append(b, sep)
+			b = append(b, lp.GetName()...)
+			b = append(b, '=', '"')
+			b = appendEscaped(b, lp.GetValue(), true)
+			b = append(b, '"')
+			sep = ','
+		}
+		if extraLabel != "" {
+			b = append(b, sep)
+			b = append(b, extraLabel...)
+			b = append(b, '=', '"')
+			b = appendFloat(b, extraValue)
+			b = append(b, '"')
+		}
+		b = append(b, '}')
+	}
+	b = append(b, ' ')
+	b = appendFloat(b, value)
+	if m.TimestampMs != nil {
+		b = append(b, ' ')
+		b = strconv.AppendInt(b, m.GetTimestampMs(), 10)
+	}
+	return append(b, '\n')
+}
+
+// appendFloat appends f formatted as by the %v verb of the fmt package, which
+// is what the expfmt encoder uses.
+func appendFloat(b []byte, f float64) []byte {
+	return strconv.AppendFloat(b, f, 'g', -1, 64)
+}
+
+// appendEscaped appends s with '\' replaced by '\\', new line characters
+// replaced by '\n', and - if quote is true - '"' replaced by '\"'.
+func appendEscaped(b []byte, s string, quote bool) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			b = append(b, '\\', '\\')
+		case c == '\n':
+			b = append(b, '\\', 'n')
+		case c == '"' && quote:
+			b = append(b, '\\', '"')
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
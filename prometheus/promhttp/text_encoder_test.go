@@ -0,0 +1,234 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/common/expfmt"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func labelPair(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)}
+}
+
+var textEncoderTestFamilies = []*dto.MetricFamily{
+	{
+		Name: proto.String("requests_total"),
+		Help: proto.String("Total requests with \\ and \"quotes\"\nand a new line."),
+		Type: dto.MetricType_COUNTER.Enum(),
+		Metric: []*dto.Metric{
+			{
+				Label:   []*dto.LabelPair{labelPair("code", "200"), labelPair("path", "/a\\b\n\"c\"")},
+				Counter: &dto.Counter{Value: proto.Float64(1234567)},
+			},
+			{
+				Label:       []*dto.LabelPair{labelPair("code", "500"), labelPair("path", "")},
+				Counter:     &dto.Counter{Value: proto.Float64(0.000012)},
+				TimestampMs: proto.Int64(1500000000123),
+			},
+		},
+	},
+	{
+		Name: proto.String("temperature"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{
+			{Gauge: &dto.Gauge{Value: proto.Float64(math.Inf(-1))}},
+		},
+	},
+	{
+		Name: proto.String("odd"),
+		Help: proto.String(""),
+		Type: dto.MetricType_UNTYPED.Enum(),
+		Metric: []*dto.Metric{
+			{Label: []*dto.LabelPair{labelPair("x", "y")}, Untyped: &dto.Untyped{Value: proto.Float64(math.NaN())}},
+			{Untyped: &dto.Untyped{Value: proto.Float64(-3e-10)}},
+		},
+	},
+	{
+		Name: proto.String("rpc_duration_seconds"),
+		Help: proto.String("RPC latency."),
+		Type: dto.MetricType_SUMMARY.Enum(),
+		Metric: []*dto.Metric{
+			{
+				Label: []*dto.LabelPair{labelPair("service", "a")},
+				Summary: &dto.Summary{
+					SampleCount: proto.Uint64(100),
+					SampleSum:   proto.Float64(12.5),
+					Quantile: []*dto.Quantile{
+						{Quantile: proto.Float64(0.5), Value: proto.Float64(0.1)},
+						{Quantile: proto.Float64(0.99), Value: proto.Float64(1e21)},
+					},
+				},
+			},
+			{
+				Summary: &dto.Summary{SampleCount: proto.Uint64(0), SampleSum: proto.Float64(0)},
+			},
+		},
+	},
+	{
+		Name: proto.String("request_size_bytes"),
+		Help: proto.String("Request sizes."),
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{
+			{
+				Histogram: &dto.Histogram{
+					SampleCount: proto.Uint64(7),
+					SampleSum:   proto.Float64(4096),
+					Bucket: []*dto.Bucket{
+						{UpperBound: proto.Float64(100), CumulativeCount: proto.Uint64(2)},
+						{UpperBound: proto.Float64(1e6), CumulativeCount: proto.Uint64(6)},
+					},
+				},
+			},
+			{
+				Label: []*dto.LabelPair{labelPair("method", "post")},
+				Histogram: &dto.Histogram{
+					SampleCount: proto.Uint64(3),
+					SampleSum:   proto.Float64(0.25),
+					Bucket: []*dto.Bucket{
+						{UpperBound: proto.Float64(0.001), CumulativeCount: proto.Uint64(1)},
+						{UpperBound: proto.Float64(math.Inf(+1)), CumulativeCount: proto.Uint64(3)},
+					},
+				},
+				TimestampMs: proto.Int64(-1),
+			},
+		},
+	},
+}
+
+func TestTextEncoderMatchesExpfmt(t *testing.T) {
+	for _, mf := range textEncoderTestFamilies {
+		var want, got bytes.Buffer
+		if _, err := expfmt.MetricFamilyToText(&want, mf); err != nil {
+			t.Fatal(err)
+		}
+		if err := (textEncoder{w: &got}).Encode(mf); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("metric family %s: got\n%s\nwant\n%s", mf.GetName(), got.String(), want.String())
+		}
+	}
+}
+
+func TestTextEncoderInvalid(t *testing.T) {
+	scenarios := []*dto.MetricFamily{
+		{Name: proto.String("empty"), Type: dto.MetricType_GAUGE.Enum()},
+		{Type: dto.MetricType_GAUGE.Enum(), Metric: []*dto.Metric{{Gauge: &dto.Gauge{}}}},
+		{
+			Name:   proto.String("mismatch"),
+			Type:   dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{}}, {Counter: &dto.Counter{}}},
+		},
+		{
+			Name:   proto.String("unknown_type"),
+			Type:   dto.MetricType(42).Enum(),
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{}}},
+		},
+	}
+	for i, mf := range scenarios {
+		var buf bytes.Buffer
+		if err := (textEncoder{w: &buf}).Encode(mf); err == nil {
+			t.Errorf("%d. expected error", i)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("%d. expected no output, got %q", i, buf.String())
+		}
+	}
+}
+
+func TestHandlerFastTextEncoding(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cv := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "c", Help: "help"}, []string{"l"})
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "h", Help: "help"})
+	reg.MustRegister(cv, h)
+	cv.WithLabelValues("a").Inc()
+	h.Observe(0.3)
+
+	scrape := func(opts HandlerOpts) string {
+		request, _ := http.NewRequest("GET", "/", nil)
+		writer := httptest.NewRecorder()
+		HandlerFor(reg, opts).ServeHTTP(writer, request)
+		body, err := ioutil.ReadAll(writer.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+	if got, want := scrape(HandlerOpts{FastTextEncoding: true}), scrape(HandlerOpts{}); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// benchmarkFamilies returns 50 metric families with 1000 series each.
+func benchmarkFamilies() []*dto.MetricFamily {
+	mfs := make([]*dto.MetricFamily, 0, 50)
+	for i := 0; i < 50; i++ {
+		mf := &dto.MetricFamily{
+			Name: proto.String(fmt.Sprintf("benchmark_metric_%d_total", i)),
+			Help: proto.String("A metric for benchmarking."),
+			Type: dto.MetricType_COUNTER.Enum(),
+		}
+		for j := 0; j < 1000; j++ {
+			mf.Metric = append(mf.Metric, &dto.Metric{
+				Label: []*dto.LabelPair{
+					labelPair("instance", fmt.Sprintf("host-%d", j%100)),
+					labelPair("path", fmt.Sprintf("/api/v1/resource/%d", j)),
+				},
+				Counter: &dto.Counter{Value: proto.Float64(float64(j) * 1.5)},
+			})
+		}
+		mfs = append(mfs, mf)
+	}
+	return mfs
+}
+
+func BenchmarkTextEncoding(b *testing.B) {
+	mfs := benchmarkFamilies()
+	encoders := []struct {
+		name string
+		new  func(*bytes.Buffer) expfmt.Encoder
+	}{
+		{"expfmt", func(buf *bytes.Buffer) expfmt.Encoder { return expfmt.NewEncoder(buf, expfmt.FmtText) }},
+		{"fast", func(buf *bytes.Buffer) expfmt.Encoder { return textEncoder{w: buf} }},
+	}
+	for _, e := range encoders {
+		b.Run(e.name, func(b *testing.B) {
+			var buf bytes.Buffer
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				enc := e.new(&buf)
+				for _, mf := range mfs {
+					if err := enc.Encode(mf); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package websocket provides an http.Handler pushing metrics to WebSocket
+// clients, e.g. live dashboards. It lives in a package of its own to not burden
+// all users of package promhttp with a dependency on golang.org/x/net.
+//
+// The package requires Go1.18 or later as current versions of golang.org/x/net
+// do not support older Go versions.
+package websocket
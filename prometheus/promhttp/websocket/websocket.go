@@ -0,0 +1,199 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.18
+
+package websocket
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	"golang.org/x/net/websocket"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Default values for Opts.
+const (
+	// DefInterval is the default interval between two pushes of metrics to
+	// a WebSocket client.
+	DefInterval = 5 * time.Second
+	// DefMaxConnections is the default maximum number of concurrent
+	// WebSocket connections.
+	DefMaxConnections = 10
+)
+
+// Opts specifies how a handler created with HandlerFor pushes metrics. The zero
+// value of Opts is a reasonable default.
+type Opts struct {
+	// Interval is the interval between two pushes to a client. It is also
+	// the minimum interval between two Gather calls, which are shared by
+	// all connections. The default value is DefInterval.
+	Interval time.Duration
+	// MaxConnections is the maximum number of concurrent connections. Any
+	// further connection attempt is answered with HTTP status code 503. The
+	// default value is DefMaxConnections.
+	MaxConnections int
+	// AllowedOrigins are the origins (like "https://dashboard.example.org")
+	// of web pages allowed to connect in addition to pages served from the
+	// same host as the handler. Browsers send the origin of the page
+	// opening a WebSocket in the Origin header. Connections with any other
+	// Origin header are rejected with HTTP status code 403, so that
+	// arbitrary web pages visited by a user cannot read the metrics
+	// (cross-site WebSocket hijacking). Connections without an Origin
+	// header (i.e. from clients other than browsers) are always accepted.
+	AllowedOrigins []string
+	// ErrorLog specifies an optional logger for errors gathering and
+	// pushing metrics. If nil, errors are not logged at all.
+	ErrorLog promhttp.Logger
+}
+
+// HandlerFor returns an http.Handler for the provided Gatherer that accepts
+// WebSocket connections and pushes the gathered metrics in the text exposition
+// format to each connected client, once right after connecting and then every
+// Opts.Interval, until the client disconnects. Each push is a single text
+// message. Gather errors are logged (if an ErrorLog is configured), and
+// whatever could be gathered is pushed anyway.
+//
+// The handler is meant for internal tooling like live dashboards. Prometheus
+// servers should scrape a handler created with promhttp.HandlerFor instead.
+func HandlerFor(reg prometheus.Gatherer, opts Opts) http.Handler {
+	if opts.Interval <= 0 {
+		opts.Interval = DefInterval
+	}
+	if opts.MaxConnections <= 0 {
+		opts.MaxConnections = DefMaxConnections
+	}
+	var (
+		g     = &throttledGatherer{g: reg, interval: opts.Interval, clock: prometheus.DefaultClock()}
+		slots = make(chan struct{}, opts.MaxConnections)
+	)
+
+	ws := websocket.Server{
+		Handshake: func(config *websocket.Config, req *http.Request) error {
+			return checkOrigin(config, req, opts.AllowedOrigins)
+		},
+		Handler: func(conn *websocket.Conn) {
+			defer conn.Close()
+
+			// We don't expect anything from the client, but
+			// reading is the way to find out about a disconnect.
+			done := make(chan struct{})
+			go func() {
+				io.Copy(ioutil.Discard, conn)
+				close(done)
+			}()
+
+			ticker := time.NewTicker(opts.Interval)
+			defer ticker.Stop()
+			for {
+				if err := pushMetrics(conn, g, opts.ErrorLog); err != nil {
+					if opts.ErrorLog != nil {
+						opts.ErrorLog.Println("error pushing metrics via WebSocket:", err)
+					}
+					return
+				}
+				select {
+				case <-ticker.C:
+				case <-done:
+					return
+				}
+			}
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		default:
+			http.Error(w, "Too many WebSocket connections.", http.StatusServiceUnavailable)
+			return
+		}
+		ws.ServeHTTP(w, req)
+	})
+}
+
+// checkOrigin accepts requests without an Origin header, requests with an
+// Origin header matching the host of the request, and requests with an Origin
+// header contained in allowed. It returns an error for all other requests.
+func checkOrigin(config *websocket.Config, req *http.Request, allowed []string) error {
+	origin, err := websocket.Origin(config, req)
+	if err != nil {
+		return err
+	}
+	if origin == nil {
+		return nil
+	}
+	config.Origin = origin
+	if strings.EqualFold(origin.Host, req.Host) {
+		return nil
+	}
+	for _, o := range allowed {
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin.Scheme+"://"+origin.Host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q not allowed", origin)
+}
+
+// pushMetrics gathers from g and sends the result as one message to conn.
+func pushMetrics(conn *websocket.Conn, g prometheus.Gatherer, errorLog promhttp.Logger) error {
+	mfs, err := g.Gather()
+	if err != nil && errorLog != nil {
+		errorLog.Println("error gathering metrics:", err)
+	}
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.FmtText)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil && errorLog != nil {
+			errorLog.Println("error encoding metric family:", err)
+		}
+	}
+	return websocket.Message.Send(conn, buf.String())
+}
+
+// throttledGatherer calls Gather on the wrapped Gatherer at most once per
+// interval and returns the previous result in between.
+type throttledGatherer struct {
+	g        prometheus.Gatherer
+	interval time.Duration
+	clock    prometheus.Clock
+
+	mtx  sync.Mutex
+	last time.Time
+	mfs  []*dto.MetricFamily
+	err  error
+}
+
+func (t *throttledGatherer) Gather() ([]*dto.MetricFamily, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if now := t.clock.Now(); t.last.IsZero() || now.Sub(t.last) >= t.interval {
+		t.mfs, t.err = t.g.Gather()
+		t.last = now
+	}
+	return t.mfs, t.err
+}
@@ -0,0 +1,166 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.18
+
+package websocket
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "the_count",
+		Help: "Ah-ah-ah! Thunder and lightning!",
+	})
+	reg.MustRegister(cnt)
+
+	server := httptest.NewServer(HandlerFor(reg, Opts{
+		Interval:       10 * time.Millisecond,
+		MaxConnections: 1,
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	conn, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var msg string
+	if err := websocket.Message.Receive(conn, &msg); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP the_count Ah-ah-ah! Thunder and lightning!
+# TYPE the_count counter
+the_count 0
+`
+	if msg != want {
+		t.Errorf("got message %q, want %q", msg, want)
+	}
+
+	cnt.Inc()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(msg, "the_count 1") {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for updated metrics")
+		}
+		if err := websocket.Message.Receive(conn, &msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A second connection exceeds the limit.
+	if _, err := websocket.Dial(url, "", server.URL); err == nil {
+		t.Error("expected second connection to be rejected")
+	}
+}
+
+// handshakeStatus sends a WebSocket handshake request with the provided Origin
+// header (none if empty) to the server with the provided URL and returns the
+// HTTP status code of the response.
+func handshakeStatus(t *testing.T, serverURL, origin string) int {
+	req, err := http.NewRequest("GET", serverURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	conn, err := net.Dial("tcp", req.URL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestHandlerOrigin(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	server := httptest.NewServer(HandlerFor(reg, Opts{
+		AllowedOrigins: []string{"https://dashboard.example.org"},
+	}))
+	defer server.Close()
+
+	for _, s := range []struct {
+		origin string
+		want   int
+	}{
+		{origin: "", want: http.StatusSwitchingProtocols},
+		{origin: server.URL, want: http.StatusSwitchingProtocols},
+		{origin: "https://dashboard.example.org", want: http.StatusSwitchingProtocols},
+		{origin: "https://DASHBOARD.example.org", want: http.StatusSwitchingProtocols},
+		{origin: "http://dashboard.example.org", want: http.StatusForbidden},
+		{origin: "https://evil.example.com", want: http.StatusForbidden},
+	} {
+		if got := handshakeStatus(t, server.URL, s.origin); got != s.want {
+			t.Errorf("origin %q: got HTTP status code %d, want %d", s.origin, got, s.want)
+		}
+	}
+}
+
+func TestThrottledGatherer(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounter(prometheus.CounterOpts{Name: "c", Help: "help"})
+	reg.MustRegister(cnt)
+
+	g := &throttledGatherer{
+		g:        reg,
+		interval: time.Second,
+		clock:    prometheus.ClockFunc(func() time.Time { return now }),
+	}
+	value := func() float64 {
+		mfs, err := g.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mfs[0].GetMetric()[0].GetCounter().GetValue()
+	}
+
+	if got := value(); got != 0 {
+		t.Errorf("got %v, want 0", got)
+	}
+	cnt.Inc()
+	if got := value(); got != 0 {
+		t.Errorf("got %v within interval, want 0", got)
+	}
+	now = now.Add(time.Second)
+	if got := value(); got != 1 {
+		t.Errorf("got %v after interval, want 1", got)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package promsafe provides type-safe variants of the metric vectors of the
+// prometheus package. The label names of a vector are declared as a struct
+// type, and children are retrieved by passing a value of that struct type, so
+// that a missing or misspelled label name is caught at compile time rather
+// than by a panic at runtime. For example:
+//
+//    type requestLabels struct {
+//    	Method     string
+//    	StatusCode string `promsafe:"code"`
+//    }
+//
+//    var requests = promsafe.NewCounterVec[requestLabels](prometheus.CounterOpts{
+//    	Name: "http_requests_total",
+//    	Help: "Total number of HTTP requests.",
+//    })
+//
+//    func init() {
+//    	prometheus.MustRegister(requests)
+//    }
+//
+//    func handle() {
+//    	requests.With(requestLabels{Method: "GET", StatusCode: "200"}).Inc()
+//    }
+//
+// The package requires Go1.18 or later, which is the first version supporting
+// type parameters.
+package promsafe
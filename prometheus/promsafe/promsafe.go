@@ -0,0 +1,214 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.18
+
+package promsafe
+
+import (
+	"fmt"
+	"reflect"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labelsOf maps the fields of a label struct type T to label names.
+type labelsOf[T any] struct {
+	names []string
+}
+
+// newLabelsOf returns the labelsOf for T. The label name for a field is taken
+// from its "promsafe" struct tag or, if there is none, derived from the field
+// name by converting it to snake case (e.g. "StatusCode" becomes
+// "status_code"). A field tagged with "-" is ignored. It panics if T is not a
+// struct type or has an exported field that is not of kind string, as those
+// are programming errors that can be detected upon creation of the vector.
+func newLabelsOf[T any]() labelsOf[T] {
+	var zero T
+	typ := reflect.TypeOf(zero)
+	if typ == nil || typ.Kind() != reflect.Struct {
+		panic(fmt.Errorf("promsafe: label type %v is not a struct", typ))
+	}
+	l := labelsOf[T]{names: make([]string, typ.NumField())}
+	for i := range l.names {
+		f := typ.Field(i)
+		name := f.Tag.Get("promsafe")
+		if name == "-" || f.PkgPath != "" {
+			continue // Ignored or unexported.
+		}
+		if f.Type.Kind() != reflect.String {
+			panic(fmt.Errorf("promsafe: field %s of label type %v is not a string", f.Name, typ))
+		}
+		if name == "" {
+			name = snakeCase(f.Name)
+		}
+		l.names[i] = name
+	}
+	return l
+}
+
+// labelNames returns the label names in the order of the fields.
+func (l labelsOf[T]) labelNames() []string {
+	names := make([]string, 0, len(l.names))
+	for _, name := range l.names {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// labelValues returns the label values stored in labels, in the same order as
+// returned by labelNames.
+func (l labelsOf[T]) labelValues(labels T) []string {
+	v := reflect.ValueOf(labels)
+	lvs := make([]string, 0, len(l.names))
+	for i, name := range l.names {
+		if name != "" {
+			lvs = append(lvs, v.Field(i).String())
+		}
+	}
+	return lvs
+}
+
+// snakeCase converts a Go identifier in camel case to snake case. Runs of
+// upper-case letters are treated as one word, e.g. "HTTPMethod" becomes
+// "http_method".
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var out []rune
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				out = append(out, '_')
+			}
+		}
+		out = append(out, unicode.ToLower(r))
+	}
+	return string(out)
+}
+
+// CounterVec is a type-safe variant of prometheus.CounterVec with the label
+// names declared by the struct type T. Create instances with NewCounterVec.
+type CounterVec[T any] struct {
+	*vec[T]
+	inner *prometheus.CounterVec
+}
+
+// NewCounterVec creates a new CounterVec based on the provided CounterOpts and
+// partitioned by the labels declared by T.
+func NewCounterVec[T any](opts prometheus.CounterOpts) *CounterVec[T] {
+	labels := newLabelsOf[T]()
+	inner := prometheus.NewCounterVec(opts, labels.labelNames())
+	return &CounterVec[T]{vec: &vec[T]{labels: labels, collector: inner, deleter: inner}, inner: inner}
+}
+
+// With returns the Counter for the provided labels, creating it if needed.
+func (v *CounterVec[T]) With(labels T) prometheus.Counter {
+	return v.inner.WithLabelValues(v.labels.labelValues(labels)...)
+}
+
+// GaugeVec is a type-safe variant of prometheus.GaugeVec with the label names
+// declared by the struct type T. Create instances with NewGaugeVec.
+type GaugeVec[T any] struct {
+	*vec[T]
+	inner *prometheus.GaugeVec
+}
+
+// NewGaugeVec creates a new GaugeVec based on the provided GaugeOpts and
+// partitioned by the labels declared by T.
+func NewGaugeVec[T any](opts prometheus.GaugeOpts) *GaugeVec[T] {
+	labels := newLabelsOf[T]()
+	inner := prometheus.NewGaugeVec(opts, labels.labelNames())
+	return &GaugeVec[T]{vec: &vec[T]{labels: labels, collector: inner, deleter: inner}, inner: inner}
+}
+
+// With returns the Gauge for the provided labels, creating it if needed.
+func (v *GaugeVec[T]) With(labels T) prometheus.Gauge {
+	return v.inner.WithLabelValues(v.labels.labelValues(labels)...)
+}
+
+// HistogramVec is a type-safe variant of prometheus.HistogramVec with the
+// label names declared by the struct type T. Create instances with
+// NewHistogramVec.
+type HistogramVec[T any] struct {
+	*vec[T]
+	inner *prometheus.HistogramVec
+}
+
+// NewHistogramVec creates a new HistogramVec based on the provided
+// HistogramOpts and partitioned by the labels declared by T.
+func NewHistogramVec[T any](opts prometheus.HistogramOpts) *HistogramVec[T] {
+	labels := newLabelsOf[T]()
+	inner := prometheus.NewHistogramVec(opts, labels.labelNames())
+	return &HistogramVec[T]{vec: &vec[T]{labels: labels, collector: inner, deleter: inner}, inner: inner}
+}
+
+// With returns the Histogram for the provided labels, creating it if needed.
+func (v *HistogramVec[T]) With(labels T) prometheus.Observer {
+	return v.inner.WithLabelValues(v.labels.labelValues(labels)...)
+}
+
+// SummaryVec is a type-safe variant of prometheus.SummaryVec with the label
+// names declared by the struct type T. Create instances with NewSummaryVec.
+type SummaryVec[T any] struct {
+	*vec[T]
+	inner *prometheus.SummaryVec
+}
+
+// NewSummaryVec creates a new SummaryVec based on the provided SummaryOpts and
+// partitioned by the labels declared by T.
+func NewSummaryVec[T any](opts prometheus.SummaryOpts) *SummaryVec[T] {
+	labels := newLabelsOf[T]()
+	inner := prometheus.NewSummaryVec(opts, labels.labelNames())
+	return &SummaryVec[T]{vec: &vec[T]{labels: labels, collector: inner, deleter: inner}, inner: inner}
+}
+
+// With returns the Summary for the provided labels, creating it if needed.
+func (v *SummaryVec[T]) With(labels T) prometheus.Observer {
+	return v.inner.WithLabelValues(v.labels.labelValues(labels)...)
+}
+
+// vec implements the methods shared by all vector types.
+type vec[T any] struct {
+	labels    labelsOf[T]
+	collector prometheus.Collector
+	deleter   interface {
+		DeleteLabelValues(...string) bool
+		Reset()
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (v *vec[T]) Describe(ch chan<- *prometheus.Desc) {
+	v.collector.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (v *vec[T]) Collect(ch chan<- prometheus.Metric) {
+	v.collector.Collect(ch)
+}
+
+// Delete deletes the metric for the provided labels. It returns whether a
+// metric was deleted.
+func (v *vec[T]) Delete(labels T) bool {
+	return v.deleter.DeleteLabelValues(v.labels.labelValues(labels)...)
+}
+
+// Reset deletes all metrics in the vector.
+func (v *vec[T]) Reset() {
+	v.deleter.Reset()
+}
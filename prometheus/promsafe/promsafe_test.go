@@ -0,0 +1,116 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.18
+
+package promsafe
+
+import (
+	"reflect"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type testLabels struct {
+	HTTPMethod string
+	StatusCode string `promsafe:"code"`
+	Ignored    string `promsafe:"-"`
+	unexported string
+}
+
+func TestNewLabelsOf(t *testing.T) {
+	l := newLabelsOf[testLabels]()
+	if got, want := l.labelNames(), []string{"http_method", "code"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got label names %v, want %v", got, want)
+	}
+	got := l.labelValues(testLabels{HTTPMethod: "GET", StatusCode: "200", Ignored: "x", unexported: "y"})
+	if want := []string{"GET", "200"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got label values %v, want %v", got, want)
+	}
+
+	for name, f := range map[string]func(){
+		"not a struct":       func() { newLabelsOf[string]() },
+		"non-string field":   func() { newLabelsOf[struct{ Code int }]() },
+		"interface type nil": func() { newLabelsOf[interface{}]() },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: newLabelsOf did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"Method":     "method",
+		"StatusCode": "status_code",
+		"HTTPMethod": "http_method",
+		"UserID":     "user_id",
+		"Route2Name": "route2_name",
+	} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q): got %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCounterVec(t *testing.T) {
+	vec := NewCounterVec[testLabels](prometheus.CounterOpts{
+		Name: "test_total",
+		Help: "helpless",
+	})
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(vec)
+
+	vec.With(testLabels{HTTPMethod: "GET", StatusCode: "200"}).Inc()
+	vec.With(testLabels{HTTPMethod: "GET", StatusCode: "200"}).Inc()
+	vec.With(testLabels{HTTPMethod: "POST", StatusCode: "500"}).Inc()
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || len(mfs[0].GetMetric()) != 2 {
+		t.Fatalf("unexpected metric families: %v", mfs)
+	}
+	m := mfs[0].GetMetric()[0]
+	if got, want := labelMap(m), map[string]string{"http_method": "GET", "code": "200"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got labels %v, want %v", got, want)
+	}
+	if got := m.GetCounter().GetValue(); got != 2 {
+		t.Errorf("got value %v, want 2", got)
+	}
+
+	if !vec.Delete(testLabels{HTTPMethod: "POST", StatusCode: "500"}) {
+		t.Error("Delete did not delete")
+	}
+	vec.Reset()
+	if mfs, _ = reg.Gather(); len(mfs) != 0 {
+		t.Errorf("got %d metric families after Reset, want 0", len(mfs))
+	}
+}
+
+func labelMap(m *dto.Metric) map[string]string {
+	labels := map[string]string{}
+	for _, lp := range m.GetLabel() {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	return labels
+}
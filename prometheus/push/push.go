@@ -29,12 +29,16 @@ package push
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/model"
@@ -60,6 +64,8 @@ const contentTypeHeader = "Content-Type"
 // Note that all previously pushed metrics with the same job and other grouping
 // labels will be replaced with the metrics pushed by this call. (It uses HTTP
 // method 'PUT' to push to the Pushgateway.)
+//
+// For more control (e.g. basic auth or a custom http.Client), use a Pusher.
 func FromGatherer(job string, grouping map[string]string, url string, g prometheus.Gatherer) error {
 	return push(job, grouping, url, g, "PUT")
 }
@@ -72,34 +78,239 @@ func AddFromGatherer(job string, grouping map[string]string, url string, g prome
 }
 
 func push(job string, grouping map[string]string, pushURL string, g prometheus.Gatherer, method string) error {
-	if !strings.Contains(pushURL, "://") {
-		pushURL = "http://" + pushURL
-	}
-	if strings.HasSuffix(pushURL, "/") {
-		pushURL = pushURL[:len(pushURL)-1]
+	p := New(pushURL, job).Gatherer(g)
+	for ln, lv := range grouping {
+		p.Grouping(ln, lv)
 	}
+	return p.push(context.Background(), method)
+}
+
+// HTTPDoer is the interface of the HTTP client used by a Pusher. It is
+// implemented by *http.Client, but it allows to plug in other clients, e.g. to
+// add authentication schemes, tracing, or request signing.
+type HTTPDoer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Pusher manages a push to the Pushgateway. Use New to create one, configure it
+// with its methods, and finally use the Add or Push method to push. The methods
+// configuring the Pusher return the Pusher itself so that calls can be chained,
+// e.g.:
+//
+//    err := push.New("http://pushgateway:9091", "db_backup").
+//    	Collector(completionTime).
+//    	Grouping("db", "customers").
+//    	Push()
+//
+// Configuration errors (like an invalid grouping label) are recorded in the
+// Pusher and returned by the next call of Push, Add, or Delete.
+type Pusher struct {
+	error error
+
+	url, job string
+	grouping map[string]string
 
+	gatherers  prometheus.Gatherers
+	registerer prometheus.Registerer
+
+	client             HTTPDoer
+	useBasicAuth       bool
+	username, password string
+
+	maxRetries             int
+	minBackoff, maxBackoff time.Duration
+
+	format expfmt.Format
+}
+
+// New creates a new Pusher to push to the provided URL with the provided job
+// name. You can use just host:port or ip:port as url, in which case 'http://' is
+// added automatically. Alternatively, include the schema in the URL. However, do
+// not include the '/metrics/jobs/...' part. The job name must not contain a
+// "/".
+//
+// Note that until https://github.com/prometheus/pushgateway/issues/97 is
+// resolved, a '/' character in the job name is prohibited.
+func New(url, job string) *Pusher {
+	var (
+		reg = prometheus.NewRegistry()
+		err error
+	)
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+	if strings.HasSuffix(url, "/") {
+		url = url[:len(url)-1]
+	}
 	if strings.Contains(job, "/") {
-		return fmt.Errorf("job contains '/': %s", job)
+		err = fmt.Errorf("job contains '/': %s", job)
 	}
-	urlComponents := []string{url.QueryEscape(job)}
-	for ln, lv := range grouping {
-		if !model.LabelName(ln).IsValid() {
-			return fmt.Errorf("grouping label has invalid name: %s", ln)
+
+	return &Pusher{
+		error:      err,
+		url:        url,
+		job:        job,
+		grouping:   map[string]string{},
+		gatherers:  prometheus.Gatherers{reg},
+		registerer: reg,
+		client:     http.DefaultClient,
+		format:     expfmt.FmtProtoDelim,
+	}
+}
+
+// Push collects/gathers all metrics from all Collectors and Gatherers added to
+// this Pusher. Then, it pushes them to the Pushgateway configured while
+// creating this Pusher, using the configured job name and any added grouping
+// labels as grouping key. All previously pushed metrics with the same job and
+// other grouping labels will be replaced with the metrics pushed by this
+// call. (It uses HTTP method 'PUT' to push to the Pushgateway.)
+//
+// Push returns the first error encountered by any method call (including this
+// one) in the lifetime of the Pusher.
+func (p *Pusher) Push() error {
+	return p.push(context.Background(), "PUT")
+}
+
+// PushContext works like Push, but the provided Context is used for the HTTP
+// requests (including retries, see Retry). Once the Context is done, pushing
+// is aborted.
+func (p *Pusher) PushContext(ctx context.Context) error {
+	return p.push(ctx, "PUT")
+}
+
+// Add works like push, but only previously pushed metrics with the same name
+// (and the same job and other grouping labels) will be replaced. (It uses HTTP
+// method 'POST' to push to the Pushgateway.)
+func (p *Pusher) Add() error {
+	return p.push(context.Background(), "POST")
+}
+
+// AddContext works like Add, but the provided Context is used for the HTTP
+// requests as described for PushContext.
+func (p *Pusher) AddContext(ctx context.Context) error {
+	return p.push(ctx, "POST")
+}
+
+// Delete deletes all metrics pushed with the job name and grouping labels of
+// this Pusher from the Pushgateway. (It uses HTTP method 'DELETE'.) The
+// Collectors and Gatherers of the Pusher are not used.
+//
+// Delete returns the first error encountered by any method call (including
+// this one) in the lifetime of the Pusher.
+func (p *Pusher) Delete() error {
+	return p.DeleteContext(context.Background())
+}
+
+// DeleteContext works like Delete, but the provided Context is used for the
+// HTTP requests as described for PushContext.
+func (p *Pusher) DeleteContext(ctx context.Context) error {
+	if p.error != nil {
+		return p.error
+	}
+	return p.do(ctx, "DELETE", nil)
+}
+
+// Gatherer adds a Gatherer to the Pusher, from which metrics will be gathered
+// to push them to the Pushgateway. The gathered metrics must not contain a job
+// label of their own.
+//
+// For convenience, this method returns a pointer to the Pusher itself.
+func (p *Pusher) Gatherer(g prometheus.Gatherer) *Pusher {
+	p.gatherers = append(p.gatherers, g)
+	return p
+}
+
+// Collector adds a Collector to the Pusher, from which metrics will be
+// collected to push them to the Pushgateway. The collected metrics must not
+// contain a job label of their own.
+//
+// For convenience, this method returns a pointer to the Pusher itself.
+func (p *Pusher) Collector(c prometheus.Collector) *Pusher {
+	if p.error == nil {
+		p.error = p.registerer.Register(c)
+	}
+	return p
+}
+
+// Grouping adds a label pair to the grouping key of the Pusher, replacing any
+// previously added label pair with the same label name. Note that setting any
+// labels in the grouping key that are already contained in the metrics to push
+// will lead to an error.
+//
+// For convenience, this method returns a pointer to the Pusher itself.
+//
+// Note that until https://github.com/prometheus/pushgateway/issues/97 is
+// resolved, this method does not allow a '/' character in the label value.
+func (p *Pusher) Grouping(name, value string) *Pusher {
+	if p.error == nil {
+		if !model.LabelName(name).IsValid() {
+			p.error = fmt.Errorf("grouping label has invalid name: %s", name)
+			return p
 		}
-		if strings.Contains(lv, "/") {
-			return fmt.Errorf("value of grouping label %s contains '/': %s", ln, lv)
+		if strings.Contains(value, "/") {
+			p.error = fmt.Errorf("value of grouping label %s contains '/': %s", name, value)
+			return p
 		}
-		urlComponents = append(urlComponents, ln, lv)
+		p.grouping[name] = value
 	}
-	pushURL = fmt.Sprintf("%s/metrics/job/%s", pushURL, strings.Join(urlComponents, "/"))
+	return p
+}
 
-	mfs, err := g.Gather()
+// Client sets a custom HTTP client for the Pusher, e.g. an *http.Client with a
+// custom Transport to configure TLS or timeouts, or any other HTTPDoer. For
+// convenience, this method returns a pointer to the Pusher itself.
+func (p *Pusher) Client(c HTTPDoer) *Pusher {
+	p.client = c
+	return p
+}
+
+// Retry configures the Pusher to retry a failed push (or deletion) up to
+// maxRetries times. Only failures caused by network errors or by the HTTP
+// status codes 429 and 5xx are retried, as other failures (like a 400 caused by
+// inconsistent metrics) will fail again. The first retry happens after
+// minBackoff. The backoff is doubled for each further retry, up to
+// maxBackoff. The actual waiting time is randomized between half and the full
+// backoff (jitter) so that many batch jobs failing at the same time do not
+// retry in lockstep. Retries stop early once the Context passed to PushContext,
+// AddContext, or DeleteContext is done. By default, a Pusher does not retry.
+// For convenience, this method returns a pointer to the Pusher itself.
+func (p *Pusher) Retry(maxRetries int, minBackoff, maxBackoff time.Duration) *Pusher {
+	p.maxRetries = maxRetries
+	p.minBackoff = minBackoff
+	p.maxBackoff = maxBackoff
+	return p
+}
+
+// BasicAuth configures the Pusher to use HTTP Basic Authentication with the
+// provided username and password. For convenience, this method returns a
+// pointer to the Pusher itself.
+func (p *Pusher) BasicAuth(username, password string) *Pusher {
+	p.useBasicAuth = true
+	p.username = username
+	p.password = password
+	return p
+}
+
+// Format configures the Pusher to use an encoding format given by the
+// provided expfmt.Format. The default format is expfmt.FmtProtoDelim and
+// should be used with the standard Prometheus Pushgateway. Custom
+// implementations may require different formats. For convenience, this
+// method returns a pointer to the Pusher itself.
+func (p *Pusher) Format(format expfmt.Format) *Pusher {
+	p.format = format
+	return p
+}
+
+func (p *Pusher) push(ctx context.Context, method string) error {
+	if p.error != nil {
+		return p.error
+	}
+	mfs, err := p.gatherers.Gather()
 	if err != nil {
 		return err
 	}
 	buf := &bytes.Buffer{}
-	enc := expfmt.NewEncoder(buf, expfmt.FmtProtoDelim)
+	enc := expfmt.NewEncoder(buf, p.format)
 	// Check for pre-existing grouping labels:
 	for _, mf := range mfs {
 		for _, m := range mf.GetMetric() {
@@ -107,7 +318,7 @@ func push(job string, grouping map[string]string, pushURL string, g prometheus.G
 				if l.GetName() == "job" {
 					return fmt.Errorf("pushed metric %s (%s) already contains a job label", mf.GetName(), m)
 				}
-				if _, ok := grouping[l.GetName()]; ok {
+				if _, ok := p.grouping[l.GetName()]; ok {
 					return fmt.Errorf(
 						"pushed metric %s (%s) already contains grouping label %s",
 						mf.GetName(), m, l.GetName(),
@@ -117,21 +328,74 @@ func push(job string, grouping map[string]string, pushURL string, g prometheus.G
 		}
 		enc.Encode(mf)
 	}
-	req, err := http.NewRequest(method, pushURL, buf)
+	return p.do(ctx, method, buf.Bytes())
+}
+
+// do sends a request with the provided method and body (which may be nil),
+// retrying as configured.
+func (p *Pusher) do(ctx context.Context, method string, body []byte) error {
+	backoff := p.minBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := p.send(ctx, method, body)
+		if err == nil || !retry || attempt >= p.maxRetries {
+			return err
+		}
+		wait := backoff
+		if wait > 1 {
+			wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+		if backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+	}
+}
+
+// send sends a single request, applying basic auth if configured, and checks
+// the response for the status code the Pushgateway uses for success. It
+// returns whether it makes sense to retry in case of an error.
+func (p *Pusher) send(ctx context.Context, method string, body []byte) (bool, error) {
+	var r io.Reader // Must stay a nil interface for requests without body.
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, p.fullURL(), r)
 	if err != nil {
-		return err
+		return false, err
+	}
+	if body != nil {
+		req.Header.Set(contentTypeHeader, string(p.format))
 	}
-	req.Header.Set(contentTypeHeader, string(expfmt.FmtProtoDelim))
-	resp, err := http.DefaultClient.Do(req)
+	if p.useBasicAuth {
+		req.SetBasicAuth(p.username, p.password)
+	}
+	resp, err := p.client.Do(req.WithContext(ctx))
 	if err != nil {
-		return err
+		return ctx.Err() == nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 202 {
 		body, _ := ioutil.ReadAll(resp.Body) // Ignore any further error as this is for an error message only.
-		return fmt.Errorf("unexpected status code %d while pushing to %s: %s", resp.StatusCode, pushURL, body)
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+		return retry, fmt.Errorf("unexpected status code %d while pushing to %s: %s", resp.StatusCode, p.fullURL(), body)
+	}
+	return false, nil
+}
+
+// fullURL assembles the URL used to push/delete metrics and returns it as a
+// string. The job name and any grouping label values containing a '/' will
+// trigger an error in New or Grouping, respectively.
+func (p *Pusher) fullURL() string {
+	urlComponents := []string{url.QueryEscape(p.job)}
+	for ln, lv := range p.grouping {
+		urlComponents = append(urlComponents, ln, lv)
 	}
-	return nil
+	return fmt.Sprintf("%s/metrics/job/%s", p.url, strings.Join(urlComponents, "/"))
 }
 
 // Collectors works like FromGatherer, but it does not use a Gatherer. Instead,
@@ -21,11 +21,14 @@ package push
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/prometheus/common/expfmt"
 
@@ -174,3 +177,186 @@ func TestPush(t *testing.T) {
 		t.Error("unexpected path:", lastPath)
 	}
 }
+
+func TestPusher(t *testing.T) {
+	var (
+		lastMethod, lastPath, lastContentType string
+		lastUser, lastPass                    string
+		lastBasicAuth                         bool
+		lastBody                              []byte
+	)
+
+	pgw := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lastMethod = r.Method
+			lastPath = r.URL.EscapedPath()
+			lastContentType = r.Header.Get("Content-Type")
+			lastUser, lastPass, lastBasicAuth = r.BasicAuth()
+			lastBody, _ = ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", `text/plain; charset=utf-8`)
+			w.WriteHeader(http.StatusAccepted)
+		}),
+	)
+	defer pgw.Close()
+
+	metric := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "testname",
+		Help: "testhelp",
+	})
+
+	// Push with basic auth, grouping, and text format.
+	if err := New(pgw.URL, "testjob").
+		Collector(metric).
+		Grouping("instance", "a").
+		BasicAuth("user", "pass").
+		Format(expfmt.FmtText).
+		Push(); err != nil {
+		t.Fatal(err)
+	}
+	if lastMethod != "PUT" {
+		t.Error("want method PUT for Push, got", lastMethod)
+	}
+	if lastPath != "/metrics/job/testjob/instance/a" {
+		t.Error("unexpected path:", lastPath)
+	}
+	if !lastBasicAuth || lastUser != "user" || lastPass != "pass" {
+		t.Errorf("unexpected basic auth: %t, %q, %q", lastBasicAuth, lastUser, lastPass)
+	}
+	if lastContentType != string(expfmt.FmtText) {
+		t.Errorf("got content type %q, want %q", lastContentType, expfmt.FmtText)
+	}
+	if want := "# HELP testname testhelp\n# TYPE testname counter\ntestname 0\n"; string(lastBody) != want {
+		t.Errorf("got body %q, want %q", lastBody, want)
+	}
+
+	// Add with a custom client and a Gatherer.
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(metric)
+	if err := New(pgw.URL, "testjob").
+		Gatherer(reg).
+		Client(&http.Client{}).
+		Add(); err != nil {
+		t.Fatal(err)
+	}
+	if lastMethod != "POST" {
+		t.Error("want method POST for Add, got", lastMethod)
+	}
+	if lastBasicAuth {
+		t.Error("unexpected basic auth")
+	}
+	if lastContentType != string(expfmt.FmtProtoDelim) {
+		t.Errorf("got content type %q, want %q", lastContentType, expfmt.FmtProtoDelim)
+	}
+
+	// Delete.
+	if err := New(pgw.URL, "testjob").Grouping("instance", "a").Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if lastMethod != "DELETE" {
+		t.Error("want method DELETE for Delete, got", lastMethod)
+	}
+	if lastPath != "/metrics/job/testjob/instance/a" {
+		t.Error("unexpected path:", lastPath)
+	}
+
+	// Configuration errors are returned on push.
+	if err := New(pgw.URL, "test/job").Collector(metric).Push(); err == nil {
+		t.Error("push with invalid job value succeeded")
+	}
+	if err := New(pgw.URL, "testjob").Grouping("foo-bar", "bums").Add(); err == nil {
+		t.Error("push with invalid grouping succeeded")
+	}
+	if err := New(pgw.URL, "testjob").Grouping("foo", "bu/ms").Delete(); err == nil {
+		t.Error("delete with invalid grouping value succeeded")
+	}
+}
+
+// countingDoer is an HTTPDoer counting the requests it passes on.
+type countingDoer struct {
+	mtx sync.Mutex
+	n   int
+}
+
+func (d *countingDoer) Do(req *http.Request) (*http.Response, error) {
+	d.mtx.Lock()
+	d.n++
+	d.mtx.Unlock()
+	return http.DefaultClient.Do(req)
+}
+
+func TestPusherRetry(t *testing.T) {
+	var (
+		mtx    sync.Mutex
+		codes  []int
+		bodies []string
+	)
+	pgw := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			code := codes[0]
+			if len(codes) > 1 {
+				codes = codes[1:]
+			}
+			w.WriteHeader(code)
+		}),
+	)
+	defer pgw.Close()
+
+	metric := prometheus.NewGauge(prometheus.GaugeOpts{Name: "g", Help: "help"})
+
+	scenarios := []struct {
+		codes        []int
+		maxRetries   int
+		wantErr      bool
+		wantRequests int
+	}{
+		{codes: []int{503, 429, 202}, maxRetries: 2, wantErr: false, wantRequests: 3},
+		{codes: []int{500, 500, 202}, maxRetries: 1, wantErr: true, wantRequests: 2},
+		{codes: []int{400, 202}, maxRetries: 3, wantErr: true, wantRequests: 1},
+		{codes: []int{500}, maxRetries: 0, wantErr: true, wantRequests: 1},
+	}
+	for i, s := range scenarios {
+		mtx.Lock()
+		codes, bodies = s.codes, nil
+		mtx.Unlock()
+		doer := &countingDoer{}
+		err := New(pgw.URL, "testjob").
+			Collector(metric).
+			Format(expfmt.FmtText).
+			Client(doer).
+			Retry(s.maxRetries, time.Millisecond, 2*time.Millisecond).
+			PushContext(context.Background())
+		if gotErr := err != nil; gotErr != s.wantErr {
+			t.Errorf("%d. got error %v, want error %t", i, err, s.wantErr)
+		}
+		if doer.n != s.wantRequests {
+			t.Errorf("%d. got %d requests, want %d", i, doer.n, s.wantRequests)
+		}
+		for _, b := range bodies {
+			if b != bodies[0] || b == "" {
+				t.Errorf("%d. retries did not send the same body: %q", i, bodies)
+				break
+			}
+		}
+	}
+
+	// A done Context stops retrying.
+	mtx.Lock()
+	codes = []int{503}
+	mtx.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	doer := &countingDoer{}
+	if err := New(pgw.URL, "testjob").
+		Client(doer).
+		Retry(10, time.Hour, time.Hour).
+		DeleteContext(ctx); err == nil {
+		t.Error("expected error with done Context")
+	}
+	if doer.n > 1 {
+		t.Errorf("got %d requests with done Context, want at most 1", doer.n)
+	}
+}
@@ -15,11 +15,13 @@ package prometheus
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"sort"
 	"sync"
+	"time"
 	"unicode/utf8"
 
 	"github.com/golang/protobuf/proto"
@@ -55,13 +57,20 @@ func init() {
 }
 
 // NewRegistry creates a new vanilla Registry without any Collectors
-// pre-registered.
-func NewRegistry() *Registry {
-	return &Registry{
+// pre-registered. The behavior of the Registry can be tweaked with the provided
+// RegistryOptions.
+func NewRegistry(opts ...RegistryOption) *Registry {
+	r := &Registry{
 		collectorsByID:  map[uint64]Collector{},
-		descIDs:         map[uint64]struct{}{},
+		descIDs:         map[uint64]string{},
 		dimHashesByName: map[string]uint64{},
+		tagsByID:        map[uint64][]string{},
+		namesByID:       map[uint64]string{},
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // NewPedanticRegistry returns a registry that checks during collection if each
@@ -73,12 +82,156 @@ func NewRegistry() *Registry {
 // their own Desc or a Desc provided by their registered Collector. Well-behaved
 // Collectors and Metrics will only provide consistent Descs. This Registry is
 // useful to test the implementation of Collectors and Metrics.
-func NewPedanticRegistry() *Registry {
-	r := NewRegistry()
+func NewPedanticRegistry(opts ...RegistryOption) *Registry {
+	r := NewRegistry(opts...)
 	r.pedanticChecksEnabled = true
 	return r
 }
 
+// RegistryOption is a function that configures a Registry upon creation with
+// NewRegistry or NewPedanticRegistry.
+type RegistryOption func(*Registry)
+
+// WithGatherHook returns a RegistryOption that makes the Registry call the
+// provided function for each MetricFamily it has gathered, right before Gather
+// returns. The MetricFamilies are passed in the same (sorted) order as they are
+// returned by Gather. The hook is meant for auditing purposes, e.g. to record
+// which metrics and labels are exposed or to check naming policies.
+//
+// The hook is called synchronously from within Gather, so it should be
+// fast. The MetricFamily passed to the hook is the very same instance that is
+// returned by Gather. The hook must therefore treat it as read-only. Any
+// modification would leak into the gathered result (and possibly corrupt it).
+func WithGatherHook(hook func(*dto.MetricFamily)) RegistryOption {
+	return func(r *Registry) {
+		r.gatherHook = hook
+	}
+}
+
+// WithCollectorIsolation returns a RegistryOption that isolates Collectors
+// from each other during gathering. By default, a Metric that fails to be
+// written or that is inconsistent is skipped, and the problem is reported in
+// the error returned by Gather (which, by default, makes a handler created with
+// promhttp.HandlerFor fail the whole scrape). With collector isolation, the
+// output of each Collector is buffered and validated on its own first. If any
+// of the Metrics of a Collector fails the validation, all the output of that
+// Collector is dropped while the output of all other Collectors is gathered as
+// usual. The error is not returned by Gather. Instead, the counter
+// prometheus_registry_collector_errors_total, partitioned by the label
+// "collector", is incremented, and the error can be retrieved with
+// LastCollectorErrors. The counter is registered with the Registry itself. The
+// value of the "collector" label is the lexicographically first
+// fully-qualified metric name described by the Collector.
+//
+// Problems that only show up when combining the output of several Collectors
+// (e.g. the same metric collected by two different Collectors) are still
+// reported in the error returned by Gather.
+func WithCollectorIsolation() RegistryOption {
+	return func(r *Registry) {
+		r.collectorErrors = NewCounterVec(
+			CounterOpts{
+				Name: "prometheus_registry_collector_errors_total",
+				Help: "Total number of gatherings in which the output of a collector was dropped because of an error.",
+			},
+			[]string{"collector"},
+		)
+		r.MustRegister(r.collectorErrors)
+	}
+}
+
+// WithCollectorTimeout returns a RegistryOption that limits the time a single
+// Collector may take to collect. Once the timeout has elapsed, the Registry
+// stops waiting for the Collector, and any Metrics it collects later are
+// discarded. The Collector keeps running in the background until its Collect
+// method returns. Without collector isolation (see WithCollectorIsolation),
+// the Metrics collected before the timeout are still gathered, and Gather
+// reports a CollectorError. With collector isolation, all the output of the
+// timed-out Collector is dropped, and the timeout is treated like any other
+// error of the Collector. A timeout of zero or less means no timeout, which
+// is the default.
+func WithCollectorTimeout(timeout time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.collectorTimeout = timeout
+	}
+}
+
+// WithMaxConcurrentCollectors returns a RegistryOption that limits the number of
+// Collectors collecting concurrently during a Gather call to the provided
+// number. By default, all Collectors are called concurrently, which can cause
+// CPU spikes if many expensive Collectors are registered. With a limit, cheap
+// Collectors (the Go and process Collectors and the metric types of this
+// package) are called first, so that their metrics are not delayed by
+// expensive Collectors. A limit of zero or less means no limit, which is the
+// default. Note that a collector timeout (see WithCollectorTimeout) only
+// applies once a Collector has started.
+func WithMaxConcurrentCollectors(n int) RegistryOption {
+	return func(r *Registry) {
+		r.maxConcurrentCollectors = n
+	}
+}
+
+// WithCollectorMetrics returns a RegistryOption that makes the Registry expose
+// metrics about its Collectors, partitioned by the label "collector" (with the
+// same value as described for WithCollectorIsolation): The gauge
+// prometheus_collector_scrape_duration_seconds is set to the duration of the
+// most recent collection of each Collector, and the counter
+// prometheus_collector_scrape_errors_total counts the collections that have
+// failed, i.e. timed out or panicked (see WithCollectorTimeout and
+// WithCollectorPanicRecovery) or, with collector isolation, have been dropped.
+// (Without collector isolation, invalid Metrics cannot be attributed to the
+// Collector that has collected them and are therefore not counted.) This helps
+// to find out which Collector is slowing down or breaking scrapes. The metrics
+// are registered with the Registry itself. The series of a Collector are
+// deleted once the Collector is unregistered.
+func WithCollectorMetrics() RegistryOption {
+	return func(r *Registry) {
+		r.collectorDurations = NewGaugeVec(
+			GaugeOpts{
+				Name: "prometheus_collector_scrape_duration_seconds",
+				Help: "Duration of the most recent collection of a collector in seconds.",
+			},
+			[]string{"collector"},
+		)
+		r.collectorFailures = NewCounterVec(
+			CounterOpts{
+				Name: "prometheus_collector_scrape_errors_total",
+				Help: "Total number of failed collections of a collector.",
+			},
+			[]string{"collector"},
+		)
+		r.MustRegister(r.collectorDurations, r.collectorFailures)
+	}
+}
+
+// WithCollectorPanicRecovery returns a RegistryOption that makes the Registry
+// recover from panics in the Collect method of a Collector. By default, such a
+// panic crashes the program. With panic recovery, the panic is reported as a
+// CollectorError by Gather (or, with collector isolation, treated like any
+// other error of the Collector, see WithCollectorIsolation), and the output of
+// all other Collectors is gathered as usual.
+func WithCollectorPanicRecovery() RegistryOption {
+	return func(r *Registry) {
+		r.recoverCollectorPanics = true
+	}
+}
+
+// LastCollectorErrors returns the errors that caused the output of Collectors to
+// be dropped during the most recent Gather call, mapped by the value of the
+// "collector" label (see WithCollectorIsolation). It returns nil if collector
+// isolation is not enabled.
+func (r *Registry) LastCollectorErrors() map[string]error {
+	if r.collectorErrors == nil {
+		return nil
+	}
+	r.lastCollectorErrsMtx.Lock()
+	defer r.lastCollectorErrsMtx.Unlock()
+	result := make(map[string]error, len(r.lastCollectorErrs))
+	for name, err := range r.lastCollectorErrs {
+		result[name] = err
+	}
+	return result
+}
+
 // Registerer is the interface for the part of a registry in charge of
 // registering and unregistering. Users of custom registries should use
 // Registerer as type for registration purposes (rather than the Registry type
@@ -136,6 +289,19 @@ type Gatherer interface {
 	Gather() ([]*dto.MetricFamily, error)
 }
 
+// ContextGatherer is a Gatherer that can stop gathering early. It is
+// implemented by Registry.
+type ContextGatherer interface {
+	Gatherer
+	// GatherWithContext works like Gather but stops waiting for the
+	// Collectors once the provided Context is done. In that case, the
+	// metrics collected so far are returned, and the returned error
+	// includes the error of the Context. Collectors that have not finished
+	// yet keep running in the background until they are done, but their
+	// remaining output is discarded.
+	GatherWithContext(ctx context.Context) ([]*dto.MetricFamily, error)
+}
+
 // Register registers the provided Collector with the DefaultRegisterer.
 //
 // Register is a shortcut for DefaultRegisterer.Register(c). See there for more
@@ -162,6 +328,41 @@ func Unregister(c Collector) bool {
 	return DefaultRegisterer.Unregister(c)
 }
 
+// registerWithContext registers the provided Collector with the provided
+// Registerer and unregisters it again once the provided Context is done. The
+// returned error is the one returned by Register. In case of an error, the
+// Collector is not tracked. If the Context is never done (i.e. its Done method
+// returns nil, as for context.Background()), the Collector is not tracked
+// either. Otherwise, a goroutine waits for the Context until it is done.
+//
+// If reg is a *Registry, the Collector is only unregistered if it is still
+// registered itself, i.e. an equal Collector registered in the meantime is
+// left alone. Other Registerers only provide Unregister, which cannot tell
+// apart equal Collectors.
+func registerWithContext(ctx context.Context, reg Registerer, c Collector) error {
+	if err := reg.Register(c); err != nil {
+		return err
+	}
+	done := ctx.Done()
+	if done == nil {
+		return nil
+	}
+	r, isRegistry := reg.(*Registry)
+	if !isRegistry {
+		go func() {
+			<-done
+			reg.Unregister(c)
+		}()
+		return nil
+	}
+	collectorID, descIDs := describeCollector(c)
+	go func() {
+		<-done
+		r.unregisterIfSame(collectorID, descIDs, c)
+	}()
+	return nil
+}
+
 // GathererFunc turns a function into a Gatherer.
 type GathererFunc func() ([]*dto.MetricFamily, error)
 
@@ -186,6 +387,121 @@ func (err AlreadyRegisteredError) Error() string {
 	return "duplicate metrics collector registration attempted"
 }
 
+// GatherErrorCategory is a machine-readable classification of the errors
+// reported by Registry.Gather, see GatherErrorCategoryOf.
+type GatherErrorCategory int
+
+// The categories of errors reported by Registry.Gather.
+const (
+	// GatherErrorUnknown is the category of errors not created by a
+	// Registry, e.g. those returned by a custom Gatherer.
+	GatherErrorUnknown GatherErrorCategory = iota
+	// GatherErrorCollectFailure is the category of a CollectError or a
+	// CollectorError, i.e. a Collector failed to collect.
+	GatherErrorCollectFailure
+	// GatherErrorDuplicate is the category of a GatherError caused by a
+	// Metric collected before with the same name and label values.
+	GatherErrorDuplicate
+	// GatherErrorInconsistent is the category of a GatherError caused by
+	// a Metric that is invalid or inconsistent with other Metrics of the
+	// same name or with its Desc (e.g. in its label names, help string, or
+	// type).
+	GatherErrorInconsistent
+	// GatherErrorAborted is the category of a GatherError caused by the
+	// gathering being stopped early, see Registry.GatherWithContext.
+	GatherErrorAborted
+)
+
+func (c GatherErrorCategory) String() string {
+	switch c {
+	case GatherErrorCollectFailure:
+		return "collect_failure"
+	case GatherErrorDuplicate:
+		return "duplicate"
+	case GatherErrorInconsistent:
+		return "inconsistent"
+	case GatherErrorAborted:
+		return "aborted"
+	default:
+		return "unknown"
+	}
+}
+
+// GatherErrorCategoryOf returns the category of the provided error as reported
+// by Registry.Gather (as part of a MultiError). It returns GatherErrorUnknown
+// for errors of other types.
+func GatherErrorCategoryOf(err error) GatherErrorCategory {
+	switch e := err.(type) {
+	case GatherError:
+		return e.Category
+	case CollectError, CollectorError:
+		return GatherErrorCollectFailure
+	default:
+		return GatherErrorUnknown
+	}
+}
+
+// GatherError is reported by Registry.Gather (as part of a MultiError) for
+// collected Metrics that are rejected because they are duplicates or
+// inconsistent, and if the gathering is stopped early. Together with
+// CollectError and CollectorError, it allows to handle errors selectively by
+// their category, e.g. to tolerate duplicates while failing on anything else.
+type GatherError struct {
+	// Category is the category of the error.
+	Category GatherErrorCategory
+	// Collector is the lexicographically first fully-qualified metric
+	// name described by the Collector that has collected the rejected
+	// Metric. It is empty if the Collector is not known (e.g. because it
+	// has been unregistered meanwhile or for GatherErrorAborted).
+	Collector string
+	// Desc is the descriptor of the rejected Metric. It is nil if not
+	// applicable.
+	Desc *Desc
+	// Err describes the problem.
+	Err error
+}
+
+func (err GatherError) Error() string {
+	return err.Err.Error()
+}
+
+// CollectError is reported by Registry.Gather (as part of a MultiError) if the
+// Write method of a collected Metric returns an error. This is typically the
+// case for Metrics created with NewInvalidMetric by a Collector failing to
+// collect. The error allows to find out which metric failed, e.g. to break down
+// failures by metric.
+type CollectError struct {
+	// Name is the fully-qualified name of the Metric that failed.
+	Name string
+	// Desc is the descriptor of the Metric that failed.
+	Desc *Desc
+	// Collector is the lexicographically first fully-qualified metric
+	// name described by the Collector that has collected the Metric. It is
+	// empty if the Collector is not known.
+	Collector string
+	// Err is the error returned by the Write method of the Metric.
+	Err error
+}
+
+func (err CollectError) Error() string {
+	return fmt.Sprintf("error collecting metric %v: %s", err.Desc, err.Err)
+}
+
+// CollectorError is reported by Registry.Gather (as part of a MultiError) if a
+// Collector has timed out or panicked, see WithCollectorTimeout and
+// WithCollectorPanicRecovery.
+type CollectorError struct {
+	// Collector is the lexicographically first fully-qualified metric name
+	// described by the failed Collector.
+	Collector string
+	// Err describes the failure.
+	Err error
+}
+
+func (err CollectorError) Error() string {
+	return fmt.Sprintf("collector %q failed: %s", err.Collector, err.Err)
+}
+
 // MultiError is a slice of errors implementing the error interface. It is used
 // by a Gatherer to report multiple errors during MetricFamily gathering.
 type MultiError []error
@@ -224,18 +540,52 @@ func (errs MultiError) MaybeUnwrap() error {
 type Registry struct {
 	mtx                   sync.RWMutex
 	collectorsByID        map[uint64]Collector // ID is a hash of the descIDs.
-	descIDs               map[uint64]struct{}
+	tagsByID              map[uint64][]string  // Same ID as above.
+	namesByID             map[uint64]string    // Same ID as above.
+	descIDs               map[uint64]string    // Mapped to the Collector name.
 	dimHashesByName       map[string]uint64
 	pedanticChecksEnabled bool
+	gatherHook            func(*dto.MetricFamily)
+
+	collectorTimeout        time.Duration
+	recoverCollectorPanics  bool
+	maxConcurrentCollectors int
+
+	// Only used if collector metrics are enabled.
+	collectorDurations *GaugeVec
+	collectorFailures  *CounterVec
+
+	// Only used if collector isolation is enabled.
+	collectorErrors      *CounterVec
+	lastCollectorErrsMtx sync.Mutex
+	lastCollectorErrs    map[string]error
 }
 
 // Register implements Registerer.
 func (r *Registry) Register(c Collector) error {
+	return r.register(c, nil)
+}
+
+// RegisterWithTags works like Register, but it additionally associates the
+// provided tags with the Collector. The tags have no effect on regular
+// gathering with the Gather method. However, a Gatherer created with
+// TaggedGatherer only gathers from Collectors that have been registered with at
+// least one of the tags provided to TaggedGatherer. Thus, tags allow to expose
+// different subsets of the registered Collectors (e.g. those belonging to a
+// certain subsystem) on different endpoints without splitting the Registry.
+func (r *Registry) RegisterWithTags(c Collector, tags ...string) error {
+	return r.register(c, tags)
+}
+
+// register registers the provided Collector and associates it with the
+// provided tags (which may be nil).
+func (r *Registry) register(c Collector, tags []string) error {
 	var (
 		descChan           = make(chan *Desc, capDescChan)
 		newDescIDs         = map[uint64]struct{}{}
 		newDimHashesByName = map[string]uint64{}
 		collectorID        uint64 // Just a sum of all desc IDs.
+		collectorName      string // Lexicographically first fqName.
 		duplicateDescErr   error
 	)
 	go func() {
@@ -264,6 +614,9 @@ func (r *Registry) Register(c Collector) error {
 			newDescIDs[desc.id] = struct{}{}
 			collectorID += desc.id
 		}
+		if collectorName == "" || desc.fqName < collectorName {
+			collectorName = desc.fqName
+		}
 
 		// Are all the label names and the help string consistent with
 		// previous descriptors of the same name?
@@ -301,8 +654,13 @@ func (r *Registry) Register(c Collector) error {
 
 	// Only after all tests have passed, actually register.
 	r.collectorsByID[collectorID] = c
+	r.namesByID[collectorID] = collectorName
+	if len(tags) > 0 {
+		// Copy tags as the caller might modify the slice later.
+		r.tagsByID[collectorID] = append([]string(nil), tags...)
+	}
 	for hash := range newDescIDs {
-		r.descIDs[hash] = struct{}{}
+		r.descIDs[hash] = collectorName
 	}
 	for name, dimHash := range newDimHashesByName {
 		r.dimHashesByName[name] = dimHash
@@ -312,6 +670,107 @@ func (r *Registry) Register(c Collector) error {
 
 // Unregister implements Registerer.
 func (r *Registry) Unregister(c Collector) bool {
+	collectorID, descIDs := describeCollector(c)
+
+	r.mtx.RLock()
+	if _, exists := r.collectorsByID[collectorID]; !exists {
+		r.mtx.RUnlock()
+		return false
+	}
+	r.mtx.RUnlock()
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.unregister(collectorID, descIDs)
+	return true
+}
+
+// UnregisterAll unregisters all the provided Collectors in one go, i.e. a
+// concurrent Gather sees either all or none of them. The Collectors are only
+// unregistered if all of them are currently registered. UnregisterAll returns
+// whether that was the case (and the Collectors have been unregistered).
+func (r *Registry) UnregisterAll(cs ...Collector) bool {
+	var (
+		collectorIDs = make([]uint64, len(cs))
+		descIDs      = make([]map[uint64]struct{}, len(cs))
+	)
+	for i, c := range cs {
+		collectorIDs[i], descIDs[i] = describeCollector(c)
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for _, id := range collectorIDs {
+		if _, exists := r.collectorsByID[id]; !exists {
+			return false
+		}
+	}
+	for i, id := range collectorIDs {
+		r.unregister(id, descIDs[i])
+	}
+	return true
+}
+
+// Reset unregisters all Collectors and forgets the label names and help
+// strings of all metric names ever registered, so that the Registry is in the
+// same state as right after its creation. (The metrics registered by
+// WithCollectorIsolation and WithCollectorMetrics stay registered but are reset
+// to their initial state.)
+// Reset is meant for tests that have to clean up a Registry shared between
+// test cases, e.g. the DefaultRegisterer (which is a *Registry unless it has
+// been changed). Note that this includes the Collectors registered by default.
+func (r *Registry) Reset() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	keep := r.internalVecs()
+	for id := range r.collectorsByID {
+		if _, ok := keep[id]; ok {
+			continue
+		}
+		delete(r.collectorsByID, id)
+		delete(r.tagsByID, id)
+		delete(r.namesByID, id)
+	}
+	r.descIDs = map[uint64]string{}
+	r.dimHashesByName = map[string]uint64{}
+	for _, vec := range keep {
+		r.descIDs[vec.desc.id] = vec.desc.fqName
+		r.dimHashesByName[vec.desc.fqName] = vec.desc.dimHash
+		vec.Reset()
+	}
+	if r.collectorErrors != nil {
+		r.lastCollectorErrsMtx.Lock()
+		r.lastCollectorErrs = nil
+		r.lastCollectorErrsMtx.Unlock()
+	}
+}
+
+// internalVecs returns the metric vectors registered by the Registry itself
+// (see WithCollectorIsolation and WithCollectorMetrics), mapped by their
+// collector ID. As a metric vector describes a single Desc, its collector ID is
+// the ID of that Desc. (Looking up the registered Collectors themselves would
+// panic for Collectors of a non-comparable type.)
+func (r *Registry) internalVecs() map[uint64]*metricVec {
+	vecs := map[uint64]*metricVec{}
+	add := func(v *metricVec) {
+		vecs[v.desc.id] = v
+	}
+	if r.collectorErrors != nil {
+		add(r.collectorErrors.metricVec)
+	}
+	if r.collectorDurations != nil {
+		add(r.collectorDurations.metricVec)
+		add(r.collectorFailures.metricVec)
+	}
+	return vecs
+}
+
+// describeCollector returns the ID of the provided Collector as used in
+// collectorsByID and the IDs of the descriptors it describes.
+func describeCollector(c Collector) (uint64, map[uint64]struct{}) {
 	var (
 		descChan    = make(chan *Desc, capDescChan)
 		descIDs     = map[uint64]struct{}{}
@@ -327,24 +786,39 @@ func (r *Registry) Unregister(c Collector) bool {
 			descIDs[desc.id] = struct{}{}
 		}
 	}
+	return collectorID, descIDs
+}
 
-	r.mtx.RLock()
-	if _, exists := r.collectorsByID[collectorID]; !exists {
-		r.mtx.RUnlock()
-		return false
-	}
-	r.mtx.RUnlock()
-
+// unregisterIfSame unregisters the Collector with the provided ID and
+// descriptor IDs if it is the provided Collector itself (rather than an equal
+// one). c must be of a comparable type. It returns whether c was unregistered.
+func (r *Registry) unregisterIfSame(collectorID uint64, descIDs map[uint64]struct{}, c Collector) bool {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
+	if existing, exists := r.collectorsByID[collectorID]; !exists || existing != c {
+		return false
+	}
+	r.unregister(collectorID, descIDs)
+	return true
+}
+
+// unregister removes the Collector with the provided ID and descriptor IDs.
+// Must be called with the write lock held.
+func (r *Registry) unregister(collectorID uint64, descIDs map[uint64]struct{}) {
+	if r.collectorDurations != nil {
+		name := r.namesByID[collectorID]
+		r.collectorDurations.DeleteLabelValues(name)
+		r.collectorFailures.DeleteLabelValues(name)
+	}
 	delete(r.collectorsByID, collectorID)
+	delete(r.tagsByID, collectorID)
+	delete(r.namesByID, collectorID)
 	for id := range descIDs {
 		delete(r.descIDs, id)
 	}
 	// dimHashesByName is left untouched as those must be consistent
 	// throughout the lifetime of a program.
-	return true
 }
 
 // MustRegister implements Registerer.
@@ -356,32 +830,214 @@ func (r *Registry) MustRegister(cs ...Collector) {
 	}
 }
 
+// MemoryEstimate is the result of a rough estimation of the memory held by the
+// children of a metric vector (like a CounterVec or a GaugeVec).
+type MemoryEstimate struct {
+	// Series is the number of children, i.e. the number of distinct
+	// label value combinations currently present.
+	Series int
+	// Bytes is the total length of all label values stored for the
+	// children. It does not include the overhead of the metrics themselves
+	// and is therefore only useful to compare metric vectors with each
+	// other.
+	Bytes int
+}
+
+// memoryEstimator is implemented by Collectors that can estimate the memory
+// held by their children. It is implemented by all metric vectors of this
+// package.
+type memoryEstimator interface {
+	estimateMemory() (string, MemoryEstimate)
+}
+
+// EstimateMemory walks all registered metric vectors and returns, mapped by
+// metric name, the number of series and the approximate number of bytes of
+// stored label values. Collectors that are not metric vectors of this package
+// are ignored. If more than one metric vector with the same name is
+// registered (differing only in their constant labels), their estimates are
+// summed up.
+//
+// EstimateMemory is meant as a debugging aid to find the cause of a high
+// cardinality. It locks each metric vector while counting its children, so it
+// should not be called frequently on large registries.
+func (r *Registry) EstimateMemory() map[string]MemoryEstimate {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	result := map[string]MemoryEstimate{}
+	for _, c := range r.collectorsByID {
+		me, ok := c.(memoryEstimator)
+		if !ok {
+			continue
+		}
+		name, est := me.estimateMemory()
+		sum := result[name]
+		sum.Series += est.Series
+		sum.Bytes += est.Bytes
+		result[name] = sum
+	}
+	return result
+}
+
+// Descs returns the descriptors of all registered Collectors, sorted by their
+// fully-qualified name and then by their constant labels. It is meant for
+// tooling like metric catalogs or documentation generators, which can inspect
+// the returned Descs with their accessor methods (FQName, Help,
+// VariableLabels, and ConstLabels). Unchecked Collectors (see Register) do
+// not describe any Descs and are therefore not represented in the result.
+func (r *Registry) Descs() []*Desc {
+	r.mtx.RLock()
+	collectors := make([]Collector, 0, len(r.collectorsByID))
+	for _, c := range r.collectorsByID {
+		collectors = append(collectors, c)
+	}
+	r.mtx.RUnlock()
+
+	var (
+		descs []*Desc
+		seen  = map[uint64]struct{}{}
+	)
+	for _, c := range collectors {
+		descChan := make(chan *Desc, capDescChan)
+		go func(c Collector) {
+			c.Describe(descChan)
+			close(descChan)
+		}(c)
+		for desc := range descChan {
+			if _, exists := seen[desc.id]; exists {
+				continue
+			}
+			seen[desc.id] = struct{}{}
+			descs = append(descs, desc)
+		}
+	}
+	sort.Sort(descSorter(descs))
+	return descs
+}
+
+// descSorter implements sort.Interface to sort Descs by fully-qualified name
+// and then by their string representation (which includes the const labels).
+type descSorter []*Desc
+
+func (s descSorter) Len() int {
+	return len(s)
+}
+
+func (s descSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s descSorter) Less(i, j int) bool {
+	if s[i].fqName != s[j].fqName {
+		return s[i].fqName < s[j].fqName
+	}
+	return s[i].String() < s[j].String()
+}
+
 // Gather implements Gatherer.
 func (r *Registry) Gather() ([]*dto.MetricFamily, error) {
+	return r.gather(context.Background(), nil)
+}
+
+// GatherWithContext implements ContextGatherer.
+func (r *Registry) GatherWithContext(ctx context.Context) ([]*dto.MetricFamily, error) {
+	return r.gather(ctx, nil)
+}
+
+// TaggedGatherer returns a Gatherer that only gathers from those Collectors
+// registered with the provided Registry that have been registered (via
+// RegisterWithTags) with at least one of the provided tags. If no tags are
+// provided, the returned Gatherer gathers nothing. Otherwise, the returned
+// Gatherer behaves like the Gather method of the Registry. It also implements
+// ContextGatherer.
+func TaggedGatherer(r *Registry, tags ...string) Gatherer {
+	tagSet := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		tagSet[tag] = struct{}{}
+	}
+	return taggedGatherer{r: r, tagSet: tagSet}
+}
+
+// taggedGatherer is the ContextGatherer returned by TaggedGatherer.
+type taggedGatherer struct {
+	r      *Registry
+	tagSet map[string]struct{}
+}
+
+// Gather implements Gatherer.
+func (g taggedGatherer) Gather() ([]*dto.MetricFamily, error) {
+	return g.r.gather(context.Background(), g.tagSet)
+}
+
+// GatherWithContext implements ContextGatherer.
+func (g taggedGatherer) GatherWithContext(ctx context.Context) ([]*dto.MetricFamily, error) {
+	return g.r.gather(ctx, g.tagSet)
+}
+
+// gather implements Gather. If tagSet is nil, all registered Collectors are
+// collected. Otherwise, only those Collectors are collected that have been
+// registered with at least one of the tags in tagSet.
+func (r *Registry) gather(ctx context.Context, tagSet map[string]struct{}) ([]*dto.MetricFamily, error) {
 	var (
 		metricChan        = make(chan Metric, capMetricChan)
+		batchChan         chan collectorBatch // Only used with collector isolation.
 		metricHashes      = map[uint64]struct{}{}
 		dimHashes         = map[string]uint64{}
 		wg                sync.WaitGroup
 		errs              MultiError          // The collected errors to return in the end.
 		registeredDescIDs map[uint64]struct{} // Only used for pedantic checks
+
+		// Collectors that timed out or panicked (without collector
+		// isolation).
+		failedMtx sync.Mutex
+		failed    MultiError
 	)
 
 	r.mtx.RLock()
 	metricFamiliesByName := make(map[string]*dto.MetricFamily, len(r.dimHashesByName))
 
+	collectors := r.collectorsByID
+	if tagSet != nil {
+		collectors = make(map[uint64]Collector, len(r.tagsByID))
+		for id, tags := range r.tagsByID {
+			for _, tag := range tags {
+				if _, ok := tagSet[tag]; ok {
+					collectors[id] = r.collectorsByID[id]
+					break
+				}
+			}
+		}
+	}
+
 	// Scatter.
-	// (Collectors could be complex and slow, so we call them all at once.)
-	wg.Add(len(r.collectorsByID))
-	go func() {
-		wg.Wait()
-		close(metricChan)
-	}()
-	for _, collector := range r.collectorsByID {
-		go func(collector Collector) {
-			defer wg.Done()
-			collector.Collect(metricChan)
-		}(collector)
+	// (Collectors could be complex and slow, so we call them all at once,
+	// unless the number of concurrently running Collectors is limited.)
+	wg.Add(len(collectors))
+	if r.collectorErrors != nil {
+		// With collector isolation, each Collector's output is
+		// buffered so that it can be checked on its own.
+		batchChan = make(chan collectorBatch, len(collectors))
+		close(metricChan) // Not used with collector isolation.
+		go func() {
+			wg.Wait()
+			close(batchChan)
+		}()
+		r.scatter(ctx.Done(), collectors, &wg, func(name string, collector Collector) {
+			batchChan <- r.collectBatch(ctx, name, collector)
+		})
+	} else {
+		go func() {
+			wg.Wait()
+			close(metricChan)
+		}()
+		r.scatter(ctx.Done(), collectors, &wg, func(name string, collector Collector) {
+			if err := r.collect(ctx, collector, metricChan); err != nil {
+				r.countCollectorFailure(name)
+				failedMtx.Lock()
+				failed = append(failed, CollectorError{Collector: name, Err: err})
+				failedMtx.Unlock()
+			}
+		})
 	}
 
 	// In case pedantic checks are enabled, we have to copy the map before
@@ -395,124 +1051,427 @@ func (r *Registry) Gather() ([]*dto.MetricFamily, error) {
 
 	r.mtx.RUnlock()
 
-	// Drain metricChan in case of premature return.
-	defer func() {
-		for range metricChan {
-		}
-	}()
+	// Drain metricChan in case of premature return. Do it in the background
+	// so that Collectors still running after ctx is done do not delay the
+	// return.
+	defer func(metricChan <-chan Metric) {
+		go func() {
+			for range metricChan {
+			}
+		}()
+	}(metricChan)
 
 	// Gather.
-	for metric := range metricChan {
-		// This could be done concurrently, too, but it required locking
-		// of metricFamiliesByName (and of metricHashes if checks are
-		// enabled). Most likely not worth it.
-		desc := metric.Desc()
-		dtoMetric := &dto.Metric{}
-		if err := metric.Write(dtoMetric); err != nil {
-			errs = append(errs, fmt.Errorf(
-				"error collecting metric %v: %s", desc, err,
-			))
-			continue
-		}
-		metricFamily, ok := metricFamiliesByName[desc.fqName]
-		if ok {
-			if metricFamily.GetHelp() != desc.help {
-				errs = append(errs, fmt.Errorf(
-					"collected metric %s %s has help %q but should have %q",
-					desc.fqName, dtoMetric, desc.help, metricFamily.GetHelp(),
-				))
+	var (
+		done          = ctx.Done()
+		metrics       = metricChan // Set to nil once closed.
+		batches       = batchChan  // Set to nil once closed.
+		collectorErrs map[string]error
+	)
+	if batchChan != nil {
+		collectorErrs = map[string]error{}
+	}
+gatherLoop:
+	for metrics != nil || batches != nil {
+		select {
+		case <-done:
+			errs = append(errs, GatherError{
+				Category: GatherErrorAborted,
+				Err:      fmt.Errorf("gathering stopped early: %s", ctx.Err()),
+			})
+			break gatherLoop
+		case metric, ok := <-metrics:
+			if !ok {
+				metrics = nil
 				continue
 			}
-			// TODO(beorn7): Simplify switch once Desc has type.
-			switch metricFamily.GetType() {
-			case dto.MetricType_COUNTER:
-				if dtoMetric.Counter == nil {
-					errs = append(errs, fmt.Errorf(
-						"collected metric %s %s should be a Counter",
-						desc.fqName, dtoMetric,
-					))
-					continue
-				}
-			case dto.MetricType_GAUGE:
-				if dtoMetric.Gauge == nil {
-					errs = append(errs, fmt.Errorf(
-						"collected metric %s %s should be a Gauge",
-						desc.fqName, dtoMetric,
-					))
-					continue
-				}
-			case dto.MetricType_SUMMARY:
-				if dtoMetric.Summary == nil {
-					errs = append(errs, fmt.Errorf(
-						"collected metric %s %s should be a Summary",
-						desc.fqName, dtoMetric,
-					))
-					continue
-				}
-			case dto.MetricType_UNTYPED:
-				if dtoMetric.Untyped == nil {
-					errs = append(errs, fmt.Errorf(
-						"collected metric %s %s should be Untyped",
-						desc.fqName, dtoMetric,
-					))
-					continue
-				}
-			case dto.MetricType_HISTOGRAM:
-				if dtoMetric.Histogram == nil {
-					errs = append(errs, fmt.Errorf(
-						"collected metric %s %s should be a Histogram",
-						desc.fqName, dtoMetric,
-					))
-					continue
-				}
-			default:
-				panic("encountered MetricFamily with invalid type")
+			// This could be done concurrently, too, but it required
+			// locking of metricFamiliesByName (and of metricHashes if
+			// checks are enabled). Most likely not worth it.
+			desc := metric.Desc()
+			dtoMetric := &dto.Metric{}
+			if err := metric.Write(dtoMetric); err != nil {
+				errs = append(errs, CollectError{
+					Name: desc.fqName, Desc: desc,
+					Collector: r.collectorNameOf(desc), Err: err,
+				})
+				continue
 			}
-		} else {
-			metricFamily = &dto.MetricFamily{}
-			metricFamily.Name = proto.String(desc.fqName)
-			metricFamily.Help = proto.String(desc.help)
-			// TODO(beorn7): Simplify switch once Desc has type.
-			switch {
-			case dtoMetric.Gauge != nil:
-				metricFamily.Type = dto.MetricType_GAUGE.Enum()
-			case dtoMetric.Counter != nil:
-				metricFamily.Type = dto.MetricType_COUNTER.Enum()
-			case dtoMetric.Summary != nil:
-				metricFamily.Type = dto.MetricType_SUMMARY.Enum()
-			case dtoMetric.Untyped != nil:
-				metricFamily.Type = dto.MetricType_UNTYPED.Enum()
-			case dtoMetric.Histogram != nil:
-				metricFamily.Type = dto.MetricType_HISTOGRAM.Enum()
-			default:
-				errs = append(errs, fmt.Errorf(
-					"empty metric collected: %s", dtoMetric,
-				))
+			if err := r.processMetric(
+				desc, dtoMetric,
+				metricFamiliesByName, metricHashes, dimHashes, registeredDescIDs,
+			); err != nil {
+				errs = append(errs, attributeGatherError(err, r.collectorNameOf(desc)))
+			}
+		case batch, ok := <-batches:
+			if !ok {
+				batches = nil
+				continue
+			}
+			err := batch.err
+			var dtoMetrics []*dto.Metric
+			if err == nil {
+				dtoMetrics, err = r.checkBatch(batch.metrics, registeredDescIDs)
+			}
+			if err != nil {
+				r.collectorErrors.WithLabelValues(batch.name).Inc()
+				r.countCollectorFailure(batch.name)
+				collectorErrs[batch.name] = err
 				continue
 			}
-			metricFamiliesByName[desc.fqName] = metricFamily
+			for i, metric := range batch.metrics {
+				if err := r.processMetric(
+					metric.Desc(), dtoMetrics[i],
+					metricFamiliesByName, metricHashes, dimHashes, registeredDescIDs,
+				); err != nil {
+					errs = append(errs, attributeGatherError(err, batch.name))
+				}
+			}
 		}
-		if err := checkMetricConsistency(metricFamily, dtoMetric, metricHashes, dimHashes); err != nil {
-			errs = append(errs, err)
-			continue
+	}
+	failedMtx.Lock()
+	errs = append(errs, failed...)
+	failedMtx.Unlock()
+	if collectorErrs != nil {
+		r.lastCollectorErrsMtx.Lock()
+		r.lastCollectorErrs = collectorErrs
+		r.lastCollectorErrsMtx.Unlock()
+	}
+	mfs := normalizeMetricFamilies(metricFamiliesByName)
+	if r.gatherHook != nil {
+		for _, mf := range mfs {
+			r.gatherHook(mf)
 		}
-		if r.pedanticChecksEnabled {
-			// Is the desc registered at all?
-			if _, exist := registeredDescIDs[desc.id]; !exist {
-				errs = append(errs, fmt.Errorf(
-					"collected metric %s %s with unregistered descriptor %s",
-					metricFamily.GetName(), dtoMetric, desc,
-				))
-				continue
+	}
+	return mfs, errs.MaybeUnwrap()
+}
+
+// collectorNameOf returns the name of the registered Collector describing the
+// provided Desc, or "" if there is none.
+func (r *Registry) collectorNameOf(desc *Desc) string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.descIDs[desc.id]
+}
+
+// attributeGatherError sets the Collector of the provided error to the
+// provided name if it is a GatherError or a CollectError (as returned by
+// processMetric and checkBatch). Other errors are returned unchanged.
+func attributeGatherError(err error, collector string) error {
+	switch e := err.(type) {
+	case GatherError:
+		e.Collector = collector
+		return e
+	case CollectError:
+		e.Collector = collector
+		return e
+	default:
+		return err
+	}
+}
+
+// processMetric checks the provided written Metric for consistency with the
+// metrics already in metricFamiliesByName and adds it to the matching
+// MetricFamily (which is created if needed).
+func (r *Registry) processMetric(
+	desc *Desc,
+	dtoMetric *dto.Metric,
+	metricFamiliesByName map[string]*dto.MetricFamily,
+	metricHashes map[uint64]struct{},
+	dimHashes map[string]uint64,
+	registeredDescIDs map[uint64]struct{},
+) error {
+	metricFamily, ok := metricFamiliesByName[desc.fqName]
+	if ok {
+		if metricFamily.GetHelp() != desc.help {
+			return inconsistentMetricError(
+				desc, "collected metric %s %s has help %q but should have %q",
+				desc.fqName, dtoMetric, desc.help, metricFamily.GetHelp(),
+			)
+		}
+		// TODO(beorn7): Simplify switch once Desc has type.
+		switch metricFamily.GetType() {
+		case dto.MetricType_COUNTER:
+			if dtoMetric.Counter == nil {
+				return inconsistentMetricError(
+					desc, "collected metric %s %s should be a Counter",
+					desc.fqName, dtoMetric,
+				)
 			}
-			if err := checkDescConsistency(metricFamily, dtoMetric, desc); err != nil {
-				errs = append(errs, err)
-				continue
+		case dto.MetricType_GAUGE:
+			if dtoMetric.Gauge == nil {
+				return inconsistentMetricError(
+					desc, "collected metric %s %s should be a Gauge",
+					desc.fqName, dtoMetric,
+				)
+			}
+		case dto.MetricType_SUMMARY:
+			if dtoMetric.Summary == nil {
+				return inconsistentMetricError(
+					desc, "collected metric %s %s should be a Summary",
+					desc.fqName, dtoMetric,
+				)
+			}
+		case dto.MetricType_UNTYPED:
+			if dtoMetric.Untyped == nil {
+				return inconsistentMetricError(
+					desc, "collected metric %s %s should be Untyped",
+					desc.fqName, dtoMetric,
+				)
+			}
+		case dto.MetricType_HISTOGRAM:
+			if dtoMetric.Histogram == nil {
+				return inconsistentMetricError(
+					desc, "collected metric %s %s should be a Histogram",
+					desc.fqName, dtoMetric,
+				)
 			}
+		default:
+			panic("encountered MetricFamily with invalid type")
 		}
-		metricFamily.Metric = append(metricFamily.Metric, dtoMetric)
+	} else {
+		metricFamily = &dto.MetricFamily{}
+		metricFamily.Name = proto.String(desc.fqName)
+		metricFamily.Help = proto.String(desc.help)
+		// TODO(beorn7): Simplify switch once Desc has type.
+		switch {
+		case dtoMetric.Gauge != nil:
+			metricFamily.Type = dto.MetricType_GAUGE.Enum()
+		case dtoMetric.Counter != nil:
+			metricFamily.Type = dto.MetricType_COUNTER.Enum()
+		case dtoMetric.Summary != nil:
+			metricFamily.Type = dto.MetricType_SUMMARY.Enum()
+		case dtoMetric.Untyped != nil:
+			metricFamily.Type = dto.MetricType_UNTYPED.Enum()
+		case dtoMetric.Histogram != nil:
+			metricFamily.Type = dto.MetricType_HISTOGRAM.Enum()
+		default:
+			return inconsistentMetricError(desc, "empty metric collected: %s", dtoMetric)
+		}
+		metricFamiliesByName[desc.fqName] = metricFamily
 	}
-	return normalizeMetricFamilies(metricFamiliesByName), errs.MaybeUnwrap()
+	if err := checkMetricConsistency(metricFamily, dtoMetric, desc, metricHashes, dimHashes); err != nil {
+		return err
+	}
+	if r.pedanticChecksEnabled {
+		// Is the desc registered at all?
+		if _, exist := registeredDescIDs[desc.id]; !exist {
+			return inconsistentMetricError(
+				desc, "collected metric %s %s with unregistered descriptor %s",
+				metricFamily.GetName(), dtoMetric, desc,
+			)
+		}
+		if err := checkDescConsistency(metricFamily, dtoMetric, desc); err != nil {
+			return err
+		}
+	}
+	metricFamily.Metric = append(metricFamily.Metric, dtoMetric)
+	return nil
+}
+
+// scatter calls collect for each of the provided Collectors (together with its
+// name) in a goroutine of its own and calls wg.Done after each call. If the
+// number of concurrently running Collectors is limited, the goroutines are
+// started one by one as running ones finish, cheap built-in Collectors first.
+// Collectors not started yet once done is closed are skipped. scatter must be
+// called with r.mtx read-locked, but it does not wait for the calls of collect.
+func (r *Registry) scatter(
+	done <-chan struct{},
+	collectors map[uint64]Collector,
+	wg *sync.WaitGroup,
+	collect func(name string, collector Collector),
+) {
+	if r.collectorDurations != nil {
+		untimed := collect
+		collect = func(name string, collector Collector) {
+			start := time.Now()
+			untimed(name, collector)
+			r.collectorDurations.WithLabelValues(name).Set(time.Since(start).Seconds())
+		}
+	}
+
+	if r.maxConcurrentCollectors <= 0 {
+		for id, collector := range collectors {
+			go func(name string, collector Collector) {
+				defer wg.Done()
+				collect(name, collector)
+			}(r.namesByID[id], collector)
+		}
+		return
+	}
+
+	var builtins, others []uint64
+	for id, collector := range collectors {
+		if isBuiltinCollector(collector) {
+			builtins = append(builtins, id)
+		} else {
+			others = append(others, id)
+		}
+	}
+	var (
+		ids   = append(builtins, others...)
+		names = make([]string, len(ids))
+		cs    = make([]Collector, len(ids))
+		sem   = make(chan struct{}, r.maxConcurrentCollectors)
+	)
+	for i, id := range ids {
+		names[i], cs[i] = r.namesByID[id], collectors[id]
+	}
+	go func() {
+		for i := range cs {
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				// Skip the remaining Collectors.
+				for range cs[i:] {
+					wg.Done()
+				}
+				return
+			}
+			go func(name string, collector Collector) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				collect(name, collector)
+			}(names[i], cs[i])
+		}
+	}()
+}
+
+// countCollectorFailure increments the failure counter of the Collector with the
+// provided name if collector metrics are enabled.
+func (r *Registry) countCollectorFailure(name string) {
+	if r.collectorFailures != nil {
+		r.collectorFailures.WithLabelValues(name).Inc()
+	}
+}
+
+// isBuiltinCollector returns true if the provided Collector is known to be
+// cheap to collect, i.e. it is one of the Go or process Collectors or one of
+// the metric types (and metric vectors) of this package. Metrics created by
+// the ...Func constructors are not considered cheap as they call arbitrary
+// functions upon collection.
+func isBuiltinCollector(c Collector) bool {
+	switch c.(type) {
+	case *goCollector, *processCollector,
+		*CounterVec, *GaugeVec, *HistogramVec, *SummaryVec,
+		*counter, *value, *histogram, *summary, *mirrorCounter:
+		return true
+	}
+	return false
+}
+
+// collectorBatch is the buffered output of one Collector, used with collector
+// isolation.
+type collectorBatch struct {
+	name    string
+	metrics []Metric
+	err     error // Set if the Collector timed out or panicked.
+}
+
+// collectBatch collects all Metrics from the provided Collector.
+func (r *Registry) collectBatch(ctx context.Context, name string, c Collector) collectorBatch {
+	var (
+		metricChan = make(chan Metric, capMetricChan)
+		err        error
+	)
+	go func() {
+		err = r.collect(ctx, c, metricChan)
+		close(metricChan)
+	}()
+	batch := collectorBatch{name: name}
+	for metric := range metricChan {
+		batch.metrics = append(batch.metrics, metric)
+	}
+	batch.err = err
+	return batch
+}
+
+// collect calls the Collect method of the provided Collector (or its
+// CollectWithContext method if it is a ContextCollector), sending the collected
+// Metrics to ch, while enforcing the collector timeout (if any). It returns an
+// error if the Collector has timed out or if it has panicked (and panic
+// recovery is enabled).
+func (r *Registry) collect(ctx context.Context, c Collector, ch chan<- Metric) error {
+	if r.collectorTimeout <= 0 {
+		return r.collectRecovering(ctx, c, ch)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.collectorTimeout)
+	defer cancel()
+	var (
+		innerChan = make(chan Metric, capMetricChan)
+		errChan   = make(chan error, 1)
+		timer     = time.NewTimer(r.collectorTimeout)
+	)
+	defer timer.Stop()
+	go func() {
+		errChan <- r.collectRecovering(ctx, c, innerChan)
+		close(innerChan)
+	}()
+	for {
+		select {
+		case metric, ok := <-innerChan:
+			if !ok {
+				return <-errChan
+			}
+			ch <- metric
+		case <-timer.C:
+			// Drain innerChan so that the Collector can finish.
+			go func() {
+				for range innerChan {
+				}
+			}()
+			return fmt.Errorf("collection timed out after %v", r.collectorTimeout)
+		}
+	}
+}
+
+// collectRecovering calls the Collect method of the provided Collector (or its
+// CollectWithContext method if it is a ContextCollector). If panic recovery is
+// enabled, a panic is returned as an error.
+func (r *Registry) collectRecovering(ctx context.Context, c Collector, ch chan<- Metric) (err error) {
+	if r.recoverCollectorPanics {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("panic during collection: %v", p)
+			}
+		}()
+	}
+	if cc, ok := c.(ContextCollector); ok {
+		cc.CollectWithContext(ctx, ch)
+		return nil
+	}
+	c.Collect(ch)
+	return nil
+}
+
+// checkBatch writes all the provided Metrics (collected by one Collector) and
+// checks them for consistency among themselves. It returns the written Metrics
+// in the same order, or the first error encountered.
+func (r *Registry) checkBatch(metrics []Metric, registeredDescIDs map[uint64]struct{}) ([]*dto.Metric, error) {
+	var (
+		metricFamiliesByName = map[string]*dto.MetricFamily{}
+		metricHashes         = map[uint64]struct{}{}
+		dimHashes            = map[string]uint64{}
+		dtoMetrics           = make([]*dto.Metric, 0, len(metrics))
+	)
+	for _, metric := range metrics {
+		desc := metric.Desc()
+		dtoMetric := &dto.Metric{}
+		if err := metric.Write(dtoMetric); err != nil {
+			return nil, CollectError{Name: desc.fqName, Desc: desc, Err: err}
+		}
+		if err := r.processMetric(
+			desc, dtoMetric,
+			metricFamiliesByName, metricHashes, dimHashes, registeredDescIDs,
+		); err != nil {
+			return nil, err
+		}
+		dtoMetrics = append(dtoMetrics, dtoMetric)
+	}
+	return dtoMetrics, nil
 }
 
 // Gatherers is a slice of Gatherer instances that implements the Gatherer
@@ -531,10 +1490,19 @@ func (r *Registry) Gather() ([]*dto.MetricFamily, error) {
 // the gathered MetricFamilies are reported as errors by the Gather method, and
 // inconsistent Metrics are dropped. Invalid parts of the MetricFamilies
 // (e.g. syntactically invalid metric or label names) will go undetected.
+//
+// Gatherers also implements ContextGatherer. Its GatherWithContext method passes
+// the Context on to those Gatherers in the slice that are ContextGatherers
+// themselves and skips the remaining Gatherers once the Context is done.
 type Gatherers []Gatherer
 
 // Gather implements Gatherer.
 func (gs Gatherers) Gather() ([]*dto.MetricFamily, error) {
+	return gs.GatherWithContext(context.Background())
+}
+
+// GatherWithContext implements ContextGatherer.
+func (gs Gatherers) GatherWithContext(ctx context.Context) ([]*dto.MetricFamily, error) {
 	var (
 		metricFamiliesByName = map[string]*dto.MetricFamily{}
 		metricHashes         = map[uint64]struct{}{}
@@ -543,7 +1511,22 @@ func (gs Gatherers) Gather() ([]*dto.MetricFamily, error) {
 	)
 
 	for i, g := range gs {
-		mfs, err := g.Gather()
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, GatherError{
+				Category: GatherErrorAborted,
+				Err:      fmt.Errorf("gathering stopped early: %s", err),
+			})
+			break
+		}
+		var (
+			mfs []*dto.MetricFamily
+			err error
+		)
+		if cg, ok := g.(ContextGatherer); ok {
+			mfs, err = cg.GatherWithContext(ctx)
+		} else {
+			mfs, err = g.Gather()
+		}
 		if err != nil {
 			if multiErr, ok := err.(MultiError); ok {
 				for _, err := range multiErr {
@@ -557,15 +1540,15 @@ func (gs Gatherers) Gather() ([]*dto.MetricFamily, error) {
 			existingMF, exists := metricFamiliesByName[mf.GetName()]
 			if exists {
 				if existingMF.GetHelp() != mf.GetHelp() {
-					errs = append(errs, fmt.Errorf(
-						"gathered metric family %s has help %q but should have %q",
+					errs = append(errs, inconsistentMetricError(
+						nil, "gathered metric family %s has help %q but should have %q",
 						mf.GetName(), mf.GetHelp(), existingMF.GetHelp(),
 					))
 					continue
 				}
 				if existingMF.GetType() != mf.GetType() {
-					errs = append(errs, fmt.Errorf(
-						"gathered metric family %s has type %s but should have %s",
+					errs = append(errs, inconsistentMetricError(
+						nil, "gathered metric family %s has type %s but should have %s",
 						mf.GetName(), mf.GetType(), existingMF.GetType(),
 					))
 					continue
@@ -578,7 +1561,7 @@ func (gs Gatherers) Gather() ([]*dto.MetricFamily, error) {
 				metricFamiliesByName[mf.GetName()] = existingMF
 			}
 			for _, m := range mf.Metric {
-				if err := checkMetricConsistency(existingMF, m, metricHashes, dimHashes); err != nil {
+				if err := checkMetricConsistency(existingMF, m, nil, metricHashes, dimHashes); err != nil {
 					errs = append(errs, err)
 					continue
 				}
@@ -654,6 +1637,13 @@ func normalizeMetricFamilies(metricFamiliesByName map[string]*dto.MetricFamily)
 	return result
 }
 
+// inconsistentMetricError returns a GatherError of category
+// GatherErrorInconsistent for the provided Desc (which may be nil) with an
+// error formatted as with fmt.Errorf.
+func inconsistentMetricError(desc *Desc, format string, args ...interface{}) error {
+	return GatherError{Category: GatherErrorInconsistent, Desc: desc, Err: fmt.Errorf(format, args...)}
+}
+
 // checkMetricConsistency checks if the provided Metric is consistent with the
 // provided MetricFamily. It also hashed the Metric labels and the MetricFamily
 // name. If the resulting hash is already in the provided metricHashes, an error
@@ -662,9 +1652,12 @@ func normalizeMetricFamilies(metricFamiliesByName map[string]*dto.MetricFamily)
 // doesn't yet contain a hash for the provided MetricFamily, it is
 // added. Otherwise, an error is returned if the existing dimHashes in not equal
 // the calculated dimHash.
+// Errors returned are of type GatherError with the provided Desc (which may be
+// nil) attached.
 func checkMetricConsistency(
 	metricFamily *dto.MetricFamily,
 	dtoMetric *dto.Metric,
+	desc *Desc,
 	metricHashes map[uint64]struct{},
 	dimHashes map[string]uint64,
 ) error {
@@ -674,15 +1667,15 @@ func checkMetricConsistency(
 		metricFamily.GetType() == dto.MetricType_SUMMARY && dtoMetric.Summary == nil ||
 		metricFamily.GetType() == dto.MetricType_HISTOGRAM && dtoMetric.Histogram == nil ||
 		metricFamily.GetType() == dto.MetricType_UNTYPED && dtoMetric.Untyped == nil {
-		return fmt.Errorf(
-			"collected metric %s %s is not a %s",
+		return inconsistentMetricError(
+			desc, "collected metric %s %s is not a %s",
 			metricFamily.GetName(), dtoMetric, metricFamily.GetType(),
 		)
 	}
 
 	for _, labelPair := range dtoMetric.GetLabel() {
 		if !utf8.ValidString(*labelPair.Value) {
-			return fmt.Errorf("collected metric's label %s is not utf8: %#v", *labelPair.Name, *labelPair.Value)
+			return inconsistentMetricError(desc, "collected metric's label %s is not utf8: %#v", *labelPair.Name, *labelPair.Value)
 		}
 	}
 
@@ -692,8 +1685,13 @@ func checkMetricConsistency(
 	h = hashAddByte(h, separatorByte)
 	dh := hashNew()
 	// Make sure label pairs are sorted. We depend on it for the consistency
-	// check.
-	sort.Sort(LabelPairSorter(dtoMetric.Label))
+	// check. Only sort if required, as the label pairs are usually shared
+	// between concurrent Gather calls (e.g. if a Collector is registered
+	// with multiple registries), and sorting even an already sorted slice
+	// might swap elements.
+	if !sort.IsSorted(LabelPairSorter(dtoMetric.Label)) {
+		sort.Sort(LabelPairSorter(dtoMetric.Label))
+	}
 	for _, lp := range dtoMetric.Label {
 		h = hashAdd(h, lp.GetValue())
 		h = hashAddByte(h, separatorByte)
@@ -701,15 +1699,15 @@ func checkMetricConsistency(
 		dh = hashAddByte(dh, separatorByte)
 	}
 	if _, exists := metricHashes[h]; exists {
-		return fmt.Errorf(
+		return GatherError{Category: GatherErrorDuplicate, Desc: desc, Err: fmt.Errorf(
 			"collected metric %s %s was collected before with the same name and label values",
 			metricFamily.GetName(), dtoMetric,
-		)
+		)}
 	}
 	if dimHash, ok := dimHashes[metricFamily.GetName()]; ok {
 		if dimHash != dh {
-			return fmt.Errorf(
-				"collected metric %s %s has label dimensions inconsistent with previously collected metrics in the same metric family",
+			return inconsistentMetricError(
+				desc, "collected metric %s %s has label dimensions inconsistent with previously collected metrics in the same metric family",
 				metricFamily.GetName(), dtoMetric,
 			)
 		}
@@ -727,8 +1725,8 @@ func checkDescConsistency(
 ) error {
 	// Desc help consistency with metric family help.
 	if metricFamily.GetHelp() != desc.help {
-		return fmt.Errorf(
-			"collected metric %s %s has help %q but should have %q",
+		return inconsistentMetricError(
+			desc, "collected metric %s %s has help %q but should have %q",
 			metricFamily.GetName(), dtoMetric, metricFamily.GetHelp(), desc.help,
 		)
 	}
@@ -742,8 +1740,8 @@ func checkDescConsistency(
 		})
 	}
 	if len(lpsFromDesc) != len(dtoMetric.Label) {
-		return fmt.Errorf(
-			"labels in collected metric %s %s are inconsistent with descriptor %s",
+		return inconsistentMetricError(
+			desc, "labels in collected metric %s %s are inconsistent with descriptor %s",
 			metricFamily.GetName(), dtoMetric, desc,
 		)
 	}
@@ -752,8 +1750,8 @@ func checkDescConsistency(
 		lpFromMetric := dtoMetric.Label[i]
 		if lpFromDesc.GetName() != lpFromMetric.GetName() ||
 			lpFromDesc.Value != nil && lpFromDesc.GetValue() != lpFromMetric.GetValue() {
-			return fmt.Errorf(
-				"labels in collected metric %s %s are inconsistent with descriptor %s",
+			return inconsistentMetricError(
+				desc, "labels in collected metric %s %s are inconsistent with descriptor %s",
 				metricFamily.GetName(), dtoMetric, desc,
 			)
 		}
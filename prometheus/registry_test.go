@@ -21,9 +21,16 @@ package prometheus_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
 
@@ -588,3 +595,737 @@ func TestRegisterWithOrGet(t *testing.T) {
 		t.Error("unexpected error:", err)
 	}
 }
+
+func TestGatherHook(t *testing.T) {
+	var seen []string
+	reg := prometheus.NewRegistry(prometheus.WithGatherHook(func(mf *dto.MetricFamily) {
+		seen = append(seen, mf.GetName())
+	}))
+	reg.MustRegister(
+		prometheus.NewCounter(prometheus.CounterOpts{Name: "b_total", Help: "help"}),
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "a", Help: "help"}),
+	)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(mfs) {
+		t.Fatalf("hook called %d times, want %d", len(seen), len(mfs))
+	}
+	for i, mf := range mfs {
+		if seen[i] != mf.GetName() {
+			t.Errorf("%d. hook saw %q, want %q", i, seen[i], mf.GetName())
+		}
+	}
+}
+
+// TestMultipleRegistries registers the same instances of the standard metric
+// types with two registries and gathers from both concurrently while the
+// metrics are being changed. It is most useful when run with -race.
+func TestMultipleRegistries(t *testing.T) {
+	var (
+		counter   = prometheus.NewCounter(prometheus.CounterOpts{Name: "test_counter", Help: "help"})
+		gauge     = prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "help"})
+		histogram = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_histogram", Help: "help"})
+		summary   = prometheus.NewSummary(prometheus.SummaryOpts{Name: "test_summary", Help: "help"})
+		untyped   = prometheus.NewUntypedFunc(prometheus.UntypedOpts{Name: "test_untyped", Help: "help"}, func() float64 { return 1 })
+		gaugeFunc = prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "test_gauge_func", Help: "help"}, func() float64 { return 42 })
+		gaugeVec  = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_gauge_vec", Help: "help"}, []string{"l"})
+		// More than 12 labels to make sure sorting is not done by
+		// insertion sort.
+		vec = prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{Name: "test_summary_vec", Help: "help", ConstLabels: prometheus.Labels{"c": "v"}},
+			[]string{"n", "m", "l", "k", "j", "i", "h", "g", "f", "e", "d", "b", "a"},
+		)
+		regs = []*prometheus.Registry{prometheus.NewRegistry(), prometheus.NewPedanticRegistry()}
+	)
+	for _, reg := range regs {
+		reg.MustRegister(counter, gauge, histogram, summary, untyped, gaugeFunc, gaugeVec, vec)
+	}
+
+	const iterations = 200
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < iterations; i++ {
+			counter.Inc()
+			gauge.Set(float64(i))
+			histogram.Observe(float64(i))
+			summary.Observe(float64(i))
+			gaugeVec.WithLabelValues(string(rune('a'+i%26))).Inc()
+			vec.WithLabelValues("n", "m", "l", "k", "j", "i", "h", "g", "f", "e", "d", "x", string(rune('a'+i%26))).Observe(float64(i))
+		}
+	}()
+
+	errs := make(chan error, 2*len(regs))
+	for _, reg := range regs {
+		for j := 0; j < 2; j++ {
+			go func(reg *prometheus.Registry) {
+				var err error
+				for i := 0; i < iterations/10 && err == nil; i++ {
+					_, err = reg.Gather()
+				}
+				errs <- err
+			}(reg)
+		}
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	<-done
+
+	// After all changes are done, both registries must see the same.
+	mfs0, err := regs[0].Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfs1, err := regs[1].Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs0) != len(mfs1) {
+		t.Fatalf("registries gathered %d and %d metric families", len(mfs0), len(mfs1))
+	}
+	for i := range mfs0 {
+		if mfs0[i].GetName() == "test_summary" || mfs0[i].GetName() == "test_summary_vec" {
+			// Quantiles might be NaN, which never compares equal.
+			continue
+		}
+		if !proto.Equal(mfs0[i], mfs1[i]) {
+			t.Errorf("registries gathered different metric families:\n%s\n%s", mfs0[i], mfs1[i])
+		}
+	}
+}
+
+func TestTaggedGatherer(t *testing.T) {
+	var (
+		reg   = prometheus.NewRegistry()
+		db    = prometheus.NewCounter(prometheus.CounterOpts{Name: "db_queries_total", Help: "help"})
+		http  = prometheus.NewCounter(prometheus.CounterOpts{Name: "http_requests_total", Help: "help"})
+		both  = prometheus.NewGauge(prometheus.GaugeOpts{Name: "connections", Help: "help"})
+		other = prometheus.NewGauge(prometheus.GaugeOpts{Name: "other", Help: "help"})
+	)
+	if err := reg.RegisterWithTags(db, "db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterWithTags(http, "http"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterWithTags(both, "db", "http"); err != nil {
+		t.Fatal(err)
+	}
+	reg.MustRegister(other)
+
+	names := func(g prometheus.Gatherer) []string {
+		mfs, err := g.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := []string{}
+		for _, mf := range mfs {
+			result = append(result, mf.GetName())
+		}
+		return result
+	}
+
+	scenarios := []struct {
+		gatherer prometheus.Gatherer
+		want     []string
+	}{
+		{reg, []string{"connections", "db_queries_total", "http_requests_total", "other"}},
+		{prometheus.TaggedGatherer(reg, "db"), []string{"connections", "db_queries_total"}},
+		{prometheus.TaggedGatherer(reg, "http", "db"), []string{"connections", "db_queries_total", "http_requests_total"}},
+		{prometheus.TaggedGatherer(reg, "unknown"), []string{}},
+		{prometheus.TaggedGatherer(reg), []string{}},
+	}
+	for i, s := range scenarios {
+		if got := names(s.gatherer); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%d. got %v, want %v", i, got, s.want)
+		}
+	}
+
+	reg.Unregister(both)
+	if got, want := names(prometheus.TaggedGatherer(reg, "db")), []string{"db_queries_total"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after unregistering, got %v, want %v", got, want)
+	}
+
+	// Modifying the tags slice after registration must not affect the
+	// registered tags.
+	tags := []string{"db"}
+	if err := reg.RegisterWithTags(both, tags...); err != nil {
+		t.Fatal(err)
+	}
+	tags[0] = "http"
+	if got, want := names(prometheus.TaggedGatherer(reg, "db")), []string{"connections", "db_queries_total"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after modifying tags, got %v, want %v", got, want)
+	}
+}
+
+func TestEstimateMemory(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cv := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "requests_total", Help: "help"},
+		[]string{"method", "path"},
+	)
+	hv := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Name: "latency_seconds", Help: "help"},
+		[]string{"endpoint"},
+	)
+	reg.MustRegister(cv, hv, prometheus.NewCounter(prometheus.CounterOpts{Name: "plain_total", Help: "help"}))
+
+	cv.WithLabelValues("GET", "/").Inc()
+	cv.WithLabelValues("POST", "/login").Inc()
+	hv.WithLabelValues("api").Observe(1)
+
+	want := map[string]prometheus.MemoryEstimate{
+		"requests_total":  {Series: 2, Bytes: 3 + 1 + 4 + 6},
+		"latency_seconds": {Series: 1, Bytes: 3},
+	}
+	if got := reg.EstimateMemory(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	cv.Reset()
+	want["requests_total"] = prometheus.MemoryEstimate{}
+	if got := reg.EstimateMemory(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after reset, got %v, want %v", got, want)
+	}
+}
+
+// duplicateCollector collects the same metric twice, which is inconsistent.
+type duplicateCollector struct {
+	desc *prometheus.Desc
+}
+
+func (c duplicateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c duplicateCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 1, "a")
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 2, "b")
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 3, "a")
+}
+
+func TestCollectorIsolation(t *testing.T) {
+	var (
+		healthy = prometheus.NewCounter(prometheus.CounterOpts{Name: "healthy_total", Help: "help"})
+		broken  = duplicateCollector{prometheus.NewDesc("broken", "help", []string{"l"}, nil)}
+	)
+
+	strict := prometheus.NewRegistry()
+	strict.MustRegister(healthy, broken)
+	mfs, err := strict.Gather()
+	if err == nil {
+		t.Error("expected error from strict registry")
+	}
+	if got, want := len(mfs), 2; got != want {
+		t.Errorf("got %d metric families from strict registry, want %d", got, want)
+	}
+	if got := strict.LastCollectorErrors(); got != nil {
+		t.Errorf("got collector errors %v from strict registry, want nil", got)
+	}
+
+	isolated := prometheus.NewPedanticRegistry(prometheus.WithCollectorIsolation())
+	isolated.MustRegister(healthy, broken)
+	for i := 0; i < 2; i++ {
+		mfs, err = isolated.Gather()
+		if err != nil {
+			t.Fatalf("unexpected error from isolated registry: %s", err)
+		}
+	}
+	names := map[string]*dto.MetricFamily{}
+	for _, mf := range mfs {
+		names[mf.GetName()] = mf
+	}
+	if _, ok := names["broken"]; ok {
+		t.Error("output of broken collector not dropped")
+	}
+	if _, ok := names["healthy_total"]; !ok {
+		t.Error("output of healthy collector missing")
+	}
+	// Depending on the order in which the collected output is processed,
+	// the counter does or does not include the error of the second
+	// gathering yet.
+	errs, ok := names["prometheus_registry_collector_errors_total"]
+	if !ok {
+		t.Fatal("collector error counter missing")
+	}
+	m := errs.GetMetric()[0]
+	if got, want := m.GetLabel()[0].GetValue(), "broken"; got != want {
+		t.Errorf("got collector label %q, want %q", got, want)
+	}
+	if got := m.GetCounter().GetValue(); got != 1 && got != 2 {
+		t.Errorf("got counter value %v, want 1 or 2", got)
+	}
+	collectorErrs := isolated.LastCollectorErrors()
+	if len(collectorErrs) != 1 || collectorErrs["broken"] == nil {
+		t.Errorf("got collector errors %v, want one for %q", collectorErrs, "broken")
+	}
+}
+
+func TestUnregisterAllAndReset(t *testing.T) {
+	var (
+		a   = prometheus.NewCounter(prometheus.CounterOpts{Name: "a_total", Help: "help"})
+		b   = prometheus.NewGauge(prometheus.GaugeOpts{Name: "b", Help: "help"})
+		c   = prometheus.NewGauge(prometheus.GaugeOpts{Name: "c", Help: "help"})
+		reg = prometheus.NewRegistry(prometheus.WithCollectorIsolation())
+	)
+	reg.MustRegister(a, b)
+
+	gatheredNames := func() []string {
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, mf := range mfs {
+			names = append(names, mf.GetName())
+		}
+		return names
+	}
+
+	if reg.UnregisterAll(a, c) {
+		t.Error("UnregisterAll succeeded with a collector not registered")
+	}
+	if got, want := gatheredNames(), []string{"a_total", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !reg.UnregisterAll(a, b) {
+		t.Error("UnregisterAll failed")
+	}
+	if got, want := len(gatheredNames()), 0; got != want {
+		t.Errorf("got %d metric families, want %d", got, want)
+	}
+
+	// After unregistering, a metric with the same name but a different
+	// help string is still rejected. After a reset, it is accepted.
+	reg.MustRegister(a)
+	other := prometheus.NewCounter(prometheus.CounterOpts{Name: "a_total", Help: "other help"})
+	reg.Unregister(a)
+	if err := reg.Register(other); err == nil {
+		t.Error("registering inconsistent help string succeeded")
+	}
+	reg.Reset()
+	if err := reg.Register(other); err != nil {
+		t.Errorf("registering after reset failed: %s", err)
+	}
+	if got, want := gatheredNames(), []string{"a_total"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := reg.Register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prometheus_registry_collector_errors_total",
+		Help: "help",
+	}, []string{"collector"})); err == nil {
+		t.Error("collector error counter not registered anymore after reset")
+	}
+}
+
+// sliceCollector is a Collector of a non-comparable type.
+type sliceCollector []prometheus.Collector
+
+func (cs sliceCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range cs {
+		c.Describe(ch)
+	}
+}
+
+func (cs sliceCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range cs {
+		c.Collect(ch)
+	}
+}
+
+func TestResetNonComparableCollector(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(sliceCollector{
+		prometheus.NewCounter(prometheus.CounterOpts{Name: "a_total", Help: "help"}),
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "b", Help: "help"}),
+	})
+	reg.Reset()
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(mfs), 0; got != want {
+		t.Errorf("got %d metric families, want %d", got, want)
+	}
+}
+
+// slowCollector collects a gauge only after release has been closed.
+type slowCollector struct {
+	desc    *prometheus.Desc
+	release chan struct{}
+}
+
+func (c slowCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c slowCollector) Collect(ch chan<- prometheus.Metric) {
+	<-c.release
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 1)
+}
+
+func TestGatherWithContext(t *testing.T) {
+	for _, isolated := range []bool{false, true} {
+		var reg *prometheus.Registry
+		if isolated {
+			reg = prometheus.NewRegistry(prometheus.WithCollectorIsolation())
+		} else {
+			reg = prometheus.NewRegistry()
+		}
+		fast := prometheus.NewGauge(prometheus.GaugeOpts{Name: "fast", Help: "help"})
+		slow := slowCollector{
+			desc:    prometheus.NewDesc("slow", "help", nil, nil),
+			release: make(chan struct{}),
+		}
+		reg.MustRegister(fast, slow)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		mfs, err := reg.GatherWithContext(ctx)
+		cancel()
+		close(slow.release)
+
+		if err == nil || !strings.Contains(err.Error(), "gathering stopped early") {
+			t.Errorf("isolated=%t: got error %v, want gathering stopped early", isolated, err)
+		}
+		names := map[string]bool{}
+		for _, mf := range mfs {
+			names[mf.GetName()] = true
+		}
+		if !names["fast"] {
+			t.Errorf("isolated=%t: fast metric missing", isolated)
+		}
+		if names["slow"] {
+			t.Errorf("isolated=%t: slow metric unexpectedly gathered", isolated)
+		}
+
+		// Without a deadline, everything is gathered.
+		mfs, err = reg.GatherWithContext(context.Background())
+		if err != nil {
+			t.Fatalf("isolated=%t: unexpected error: %s", isolated, err)
+		}
+		if got, want := len(mfs), 2; got != want {
+			t.Errorf("isolated=%t: got %d metric families, want %d", isolated, got, want)
+		}
+	}
+}
+
+// panickingCollector panics upon collection.
+type panickingCollector struct {
+	desc *prometheus.Desc
+}
+
+func (c panickingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c panickingCollector) Collect(ch chan<- prometheus.Metric) {
+	panic("oops")
+}
+
+func TestCollectorTimeoutAndPanicRecovery(t *testing.T) {
+	for _, isolated := range []bool{false, true} {
+		opts := []prometheus.RegistryOption{
+			prometheus.WithCollectorTimeout(50 * time.Millisecond),
+			prometheus.WithCollectorPanicRecovery(),
+		}
+		if isolated {
+			opts = append(opts, prometheus.WithCollectorIsolation())
+		}
+		reg := prometheus.NewRegistry(opts...)
+		slow := slowCollector{
+			desc:    prometheus.NewDesc("slow", "help", nil, nil),
+			release: make(chan struct{}),
+		}
+		reg.MustRegister(
+			prometheus.NewGauge(prometheus.GaugeOpts{Name: "fast", Help: "help"}),
+			slow,
+			panickingCollector{prometheus.NewDesc("panicking", "help", nil, nil)},
+		)
+
+		mfs, err := reg.Gather()
+		close(slow.release)
+
+		names := map[string]bool{}
+		for _, mf := range mfs {
+			names[mf.GetName()] = true
+		}
+		if !names["fast"] {
+			t.Errorf("isolated=%t: fast metric missing", isolated)
+		}
+		if names["slow"] || names["panicking"] {
+			t.Errorf("isolated=%t: unexpectedly gathered %v", isolated, names)
+		}
+
+		failed := map[string]error{}
+		if isolated {
+			if err != nil {
+				t.Errorf("isolated=%t: unexpected error: %s", isolated, err)
+			}
+			failed = reg.LastCollectorErrors()
+		} else {
+			multiErr, ok := err.(prometheus.MultiError)
+			if !ok {
+				t.Fatalf("isolated=%t: got error %v, want MultiError", isolated, err)
+			}
+			for _, err := range multiErr {
+				if collectorErr, ok := err.(prometheus.CollectorError); ok {
+					failed[collectorErr.Collector] = collectorErr.Err
+				}
+			}
+		}
+		if got, want := len(failed), 2; got != want {
+			t.Fatalf("isolated=%t: got %d failed collectors (%v), want %d", isolated, got, failed, want)
+		}
+		if err := failed["slow"]; err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("isolated=%t: got error %v for slow collector, want timeout", isolated, err)
+		}
+		if err := failed["panicking"]; err == nil || !strings.Contains(err.Error(), "oops") {
+			t.Errorf("isolated=%t: got error %v for panicking collector, want panic", isolated, err)
+		}
+	}
+}
+
+// concurrencyTrackingCollector records the maximum number of its instances
+// collecting at the same time.
+type concurrencyTrackingCollector struct {
+	desc             *prometheus.Desc
+	mtx              *sync.Mutex
+	running, maxSeen *int
+}
+
+func (c concurrencyTrackingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c concurrencyTrackingCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mtx.Lock()
+	*c.running++
+	if *c.running > *c.maxSeen {
+		*c.maxSeen = *c.running
+	}
+	c.mtx.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 1)
+
+	c.mtx.Lock()
+	*c.running--
+	c.mtx.Unlock()
+}
+
+func TestMaxConcurrentCollectors(t *testing.T) {
+	var (
+		mtx              sync.Mutex
+		running, maxSeen int
+		reg              = prometheus.NewRegistry(prometheus.WithMaxConcurrentCollectors(2))
+	)
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "cheap", Help: "help"}))
+	for i := 0; i < 6; i++ {
+		reg.MustRegister(concurrencyTrackingCollector{
+			desc:    prometheus.NewDesc(fmt.Sprintf("expensive_%d", i), "help", nil, nil),
+			mtx:     &mtx,
+			running: &running,
+			maxSeen: &maxSeen,
+		})
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(mfs), 7; got != want {
+		t.Errorf("got %d metric families, want %d", got, want)
+	}
+	if maxSeen > 2 {
+		t.Errorf("got %d concurrently running collectors, want at most 2", maxSeen)
+	}
+}
+
+func TestCollectorMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry(
+		prometheus.WithCollectorMetrics(),
+		prometheus.WithCollectorPanicRecovery(),
+	)
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "fast", Help: "help"})
+	p := panickingCollector{prometheus.NewDesc("panicking", "help", nil, nil)}
+	reg.MustRegister(g, p)
+
+	if _, err := reg.Gather(); err == nil {
+		t.Error("expected error from panicking collector")
+	}
+	mfs, _ := reg.Gather()
+
+	durations := map[string]bool{}
+	failures := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			switch mf.GetName() {
+			case "prometheus_collector_scrape_duration_seconds":
+				durations[m.GetLabel()[0].GetValue()] = true
+			case "prometheus_collector_scrape_errors_total":
+				failures[m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	for _, name := range []string{"fast", "panicking"} {
+		if !durations[name] {
+			t.Errorf("duration of collector %q missing", name)
+		}
+	}
+	// Depending on the order of collection, the counter does or does not
+	// include the failure of the second gathering yet.
+	if got := failures["panicking"]; got != 1 && got != 2 {
+		t.Errorf("got %v failures of panicking collector, want 1 or 2", got)
+	}
+	if _, ok := failures["fast"]; ok {
+		t.Error("got failures of fast collector")
+	}
+
+	// The series of unregistered collectors are deleted, while the
+	// collector metrics themselves survive a reset.
+	reg.Unregister(p)
+	reg.Reset()
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			if got := m.GetLabel()[0].GetValue(); got == "panicking" {
+				t.Errorf("series of unregistered collector still present in %s", mf.GetName())
+			}
+		}
+	}
+	if err := reg.Register(prometheus.NewGauge(prometheus.GaugeOpts{Name: "other", Help: "help"})); err != nil {
+		t.Errorf("registering after reset failed: %s", err)
+	}
+}
+
+func TestRegistryDescs(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		prometheus.NewCounterVec(prometheus.CounterOpts{Name: "b_total", Help: "help b"}, []string{"code"}),
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "a", Help: "help a", ConstLabels: prometheus.Labels{"x": "2"}}),
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "a", Help: "help a", ConstLabels: prometheus.Labels{"x": "1"}}),
+	)
+
+	descs := reg.Descs()
+	var got []string
+	for _, d := range descs {
+		got = append(got, d.FQName()+d.ConstLabels()["x"])
+	}
+	if want := []string{"a1", "a2", "b_total"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got descs %v, want %v", got, want)
+	}
+	if got, want := descs[2].VariableLabels(), []string{"code"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got variable labels %v, want %v", got, want)
+	}
+}
+
+func TestGatherersWithContext(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	slow := slowCollector{
+		desc:    prometheus.NewDesc("slow", "help", nil, nil),
+		release: make(chan struct{}),
+	}
+	defer close(slow.release)
+	reg.MustRegister(slow, prometheus.NewGauge(prometheus.GaugeOpts{Name: "fast", Help: "help"}))
+	called := false
+	gs := prometheus.Gatherers{
+		prometheus.TaggedGatherer(reg), // Gathers nothing.
+		reg,
+		prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			called = true
+			return nil, nil
+		}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	mfs, err := gs.GatherWithContext(ctx)
+	if err == nil || !strings.Contains(err.Error(), "gathering stopped early") {
+		t.Errorf("got error %v, want gathering stopped early", err)
+	}
+	if len(mfs) != 1 || mfs[0].GetName() != "fast" {
+		t.Errorf("got %v, want only the fast metric", mfs)
+	}
+	if called {
+		t.Error("Gatherer called after the Context was done")
+	}
+	var aborted bool
+	for _, err := range err.(prometheus.MultiError) {
+		aborted = aborted || prometheus.GatherErrorCategoryOf(err) == prometheus.GatherErrorAborted
+	}
+	if !aborted {
+		t.Errorf("got %v, want an error of category %s", err, prometheus.GatherErrorAborted)
+	}
+}
+
+// categoryCollector collects a duplicate, an inconsistent, and an invalid
+// Metric.
+type categoryCollector struct {
+	desc *prometheus.Desc
+}
+
+func (c categoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c categoryCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 1, "a")
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 2, "a")
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("category_test", "Other help.", []string{"l"}, nil),
+		prometheus.GaugeValue, 3, "b",
+	)
+	ch <- prometheus.NewInvalidMetric(c.desc, errors.New("collect error"))
+}
+
+func TestGatherErrorCategories(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(categoryCollector{
+		desc: prometheus.NewDesc("category_test", "Help.", []string{"l"}, nil),
+	})
+
+	_, err := reg.Gather()
+	errs, ok := err.(prometheus.MultiError)
+	if !ok {
+		t.Fatalf("got %v, want MultiError", err)
+	}
+	got := map[prometheus.GatherErrorCategory]int{}
+	for _, err := range errs {
+		got[prometheus.GatherErrorCategoryOf(err)]++
+		switch e := err.(type) {
+		case prometheus.GatherError:
+			if e.Collector != "category_test" || e.Desc.FQName() != "category_test" {
+				t.Errorf("got collector %q and desc %v, want both attributed to category_test", e.Collector, e.Desc)
+			}
+		case prometheus.CollectError:
+			if e.Collector != "category_test" {
+				t.Errorf("got collector %q, want category_test", e.Collector)
+			}
+		default:
+			t.Errorf("unexpected error type %T", err)
+		}
+	}
+	want := map[prometheus.GatherErrorCategory]int{
+		prometheus.GatherErrorDuplicate:      1,
+		prometheus.GatherErrorInconsistent:   1,
+		prometheus.GatherErrorCollectFailure: 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got categories %v, want %v", got, want)
+	}
+
+	if got := prometheus.GatherErrorCategoryOf(errors.New("other")); got != prometheus.GatherErrorUnknown {
+		t.Errorf("got category %v for unknown error", got)
+	}
+	if got, want := prometheus.GatherErrorDuplicate.String(), "duplicate"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
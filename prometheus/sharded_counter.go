@@ -0,0 +1,165 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"math"
+	"sync/atomic"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ShardedCounter is a counter for extremely hot code paths where many
+// goroutines increment the same Counter concurrently, which makes the CPU
+// cores fight over the cache line holding the value of a regular Counter. A
+// ShardedCounter distributes its value over a fixed number of shards, each on
+// its own cache line. Goroutines increment the shard assigned to them (e.g. by
+// worker index), and the shards are summed up upon collection. This trades
+// memory for scalability. Most programs do not need it. Measure first.
+//
+// To create ShardedCounter instances, use NewShardedCounter.
+type ShardedCounter struct {
+	selfCollector
+
+	desc       *Desc
+	labelPairs []*dto.LabelPair
+	shards     []CounterShard
+}
+
+// CounterShard is a shard of a ShardedCounter. It is safe for concurrent use,
+// but it is only fast if each shard is mostly incremented by one goroutine at
+// a time.
+type CounterShard struct {
+	// valBits and valInt have to go first in the struct to guarantee
+	// alignment for atomic operations.
+	// http://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	valBits uint64 // Bits of a float64 for non-integer increments.
+	valInt  uint64 // Integer increments, which are cheaper.
+	_       [48]byte
+}
+
+// NewShardedCounter creates a new ShardedCounter with the provided number of
+// shards (usually the number of worker goroutines or runtime.GOMAXPROCS(0)),
+// based on the provided CounterOpts. It panics if shards is < 1.
+func NewShardedCounter(opts CounterOpts, shards int) *ShardedCounter {
+	if shards < 1 {
+		panic(errors.New("a ShardedCounter needs at least one shard"))
+	}
+	desc := NewDesc(
+		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		opts.Help,
+		nil,
+		opts.ConstLabels,
+	)
+	result := &ShardedCounter{
+		desc:       desc,
+		labelPairs: desc.constLabelPairs,
+		shards:     make([]CounterShard, shards),
+	}
+	result.init(result) // Init self-collection.
+	return result
+}
+
+// Shard returns the shard with index i modulo the number of shards.
+func (c *ShardedCounter) Shard(i int) *CounterShard {
+	n := uint(i)
+	if i < 0 {
+		// Negating the unsigned value works for the most negative int,
+		// too, unlike negating i.
+		n = -n
+	}
+	return &c.shards[n%uint(len(c.shards))]
+}
+
+// Desc implements Metric.
+func (c *ShardedCounter) Desc() *Desc {
+	return c.desc
+}
+
+// Write implements Metric. It sums up all shards.
+func (c *ShardedCounter) Write(out *dto.Metric) error {
+	var val float64
+	for i := range c.shards {
+		s := &c.shards[i]
+		val += math.Float64frombits(atomic.LoadUint64(&s.valBits)) + float64(atomic.LoadUint64(&s.valInt))
+	}
+	return populateMetric(CounterValue, val, c.labelPairs, out)
+}
+
+// Inc increments the shard by 1.
+func (s *CounterShard) Inc() {
+	atomic.AddUint64(&s.valInt, 1)
+}
+
+// Add adds the provided value to the shard. It panics if the value is < 0.
+func (s *CounterShard) Add(v float64) {
+	if v < 0 {
+		panic(errors.New("counter cannot decrease in value"))
+	}
+	if ival := uint64(v); float64(ival) == v {
+		atomic.AddUint64(&s.valInt, ival)
+		return
+	}
+	for {
+		oldBits := atomic.LoadUint64(&s.valBits)
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + v)
+		if atomic.CompareAndSwapUint64(&s.valBits, oldBits, newBits) {
+			return
+		}
+	}
+}
+
+// LocalCounter buffers increments of a Counter without any synchronization. It
+// must only be used by a single goroutine, which increments it on a hot path
+// and periodically calls Flush to add the buffered increments to the Counter,
+// e.g. every n iterations of a loop, upon each tick of a time.Ticker selected
+// on in the same goroutine, and before the goroutine exits. Until then, the
+// increments are not visible to collection, i.e. the exposed value lags
+// behind.
+//
+// Create LocalCounter instances with NewLocalCounter, one per goroutine.
+type LocalCounter struct {
+	c       Counter
+	pending float64
+}
+
+// NewLocalCounter returns a new LocalCounter buffering increments for the
+// provided Counter.
+func NewLocalCounter(c Counter) *LocalCounter {
+	return &LocalCounter{c: c}
+}
+
+// Inc increments the buffered value by 1.
+func (l *LocalCounter) Inc() {
+	l.pending++
+}
+
+// Add adds the provided value to the buffered value. It panics if the value is
+// < 0.
+func (l *LocalCounter) Add(v float64) {
+	if v < 0 {
+		panic(errors.New("counter cannot decrease in value"))
+	}
+	l.pending += v
+}
+
+// Flush adds the buffered value to the Counter and resets the buffered value.
+func (l *LocalCounter) Flush() {
+	if l.pending == 0 {
+		return
+	}
+	l.c.Add(l.pending)
+	l.pending = 0
+}
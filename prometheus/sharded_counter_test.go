@@ -0,0 +1,136 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"sync"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func counterValue(t *testing.T, m Metric) float64 {
+	out := &dto.Metric{}
+	if err := m.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	return out.GetCounter().GetValue()
+}
+
+func TestShardedCounter(t *testing.T) {
+	c := NewShardedCounter(CounterOpts{Name: "test", Help: "test help"}, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := c.Shard(i)
+			for j := 0; j < 1000; j++ {
+				s.Inc()
+			}
+			s.Add(0.5)
+			s.Add(2)
+		}(i)
+	}
+	wg.Wait()
+	if got, want := counterValue(t, c), 8*1002.5; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if c.Shard(-1) != c.Shard(1) || c.Shard(5) != c.Shard(1) {
+		t.Error("unexpected shard selection")
+	}
+	// The most negative int must not result in a negative index.
+	minInt := -int(^uint(0)>>1) - 1
+	if c.Shard(minInt) != c.Shard(0) {
+		t.Error("unexpected shard selection for the most negative int")
+	}
+
+	reg := NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for negative increment")
+		}
+	}()
+	c.Shard(0).Add(-1)
+}
+
+func TestLocalCounter(t *testing.T) {
+	c := NewCounter(CounterOpts{Name: "test", Help: "test help"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l := NewLocalCounter(c)
+			for j := 0; j < 1000; j++ {
+				l.Inc()
+				if j%100 == 0 {
+					l.Flush()
+				}
+			}
+			l.Add(0.5)
+			l.Flush()
+		}()
+	}
+	wg.Wait()
+	if got, want := counterValue(t, c), 4*1000.5; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func BenchmarkCounterIncParallel(b *testing.B) {
+	b.Run("Counter", func(b *testing.B) {
+		c := NewCounter(CounterOpts{Name: "test", Help: "test help"})
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				c.Inc()
+			}
+		})
+	})
+	b.Run("ShardedCounter", func(b *testing.B) {
+		var (
+			c    = NewShardedCounter(CounterOpts{Name: "test", Help: "test help"}, 64)
+			mtx  sync.Mutex
+			next int
+		)
+		b.RunParallel(func(pb *testing.PB) {
+			mtx.Lock()
+			s := c.Shard(next)
+			next++
+			mtx.Unlock()
+			for pb.Next() {
+				s.Inc()
+			}
+		})
+	})
+	b.Run("LocalCounter", func(b *testing.B) {
+		c := NewCounter(CounterOpts{Name: "test", Help: "test help"})
+		b.RunParallel(func(pb *testing.PB) {
+			l := NewLocalCounter(c)
+			for pb.Next() {
+				l.Inc()
+			}
+			l.Flush()
+		})
+	})
+}
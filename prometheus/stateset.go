@@ -0,0 +1,110 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"sync"
+)
+
+// StateSet is a Collector representing the current state of a state machine
+// (or any other enumeration) as one gauge per possible state. The gauge of the
+// active state has the value 1, all others have the value 0. All gauges share
+// the same metric name and are distinguished by a single label whose values
+// are the names of the states.
+//
+// To create StateSet instances, use NewStateSet.
+type StateSet interface {
+	Collector
+
+	// SetState makes the provided state the active one, i.e. its gauge is
+	// set to 1 and all other gauges are set to 0. The change is atomic,
+	// i.e. a concurrent collection sees either the old or the new active
+	// state, but never both or none of them. An error is returned (and the
+	// active state is left unchanged) if the provided state is not one of
+	// the states the StateSet was created with.
+	SetState(active string) error
+	// State returns the currently active state, or the empty string if no
+	// state has been set yet.
+	State() string
+}
+
+// NewStateSet creates a new StateSet based on the provided GaugeOpts. The
+// provided stateLabel is the name of the label to distinguish the states, and
+// states are the possible values of that label. Initially, no state is active,
+// i.e. all gauges have the value 0.
+//
+// The function panics if states contains duplicates.
+func NewStateSet(opts GaugeOpts, stateLabel string, states []string) StateSet {
+	s := &stateSet{
+		desc: NewDesc(
+			BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			opts.Help,
+			[]string{stateLabel},
+			opts.ConstLabels,
+		),
+		states: make([]string, 0, len(states)),
+		known:  make(map[string]struct{}, len(states)),
+	}
+	for _, state := range states {
+		if _, ok := s.known[state]; ok {
+			panic(fmt.Errorf("duplicate state %q in state set", state))
+		}
+		s.known[state] = struct{}{}
+		s.states = append(s.states, state)
+	}
+	return s
+}
+
+type stateSet struct {
+	desc   *Desc
+	states []string
+	known  map[string]struct{}
+
+	mtx    sync.RWMutex // Protects active.
+	active string
+}
+
+func (s *stateSet) SetState(active string) error {
+	if _, ok := s.known[active]; !ok {
+		return fmt.Errorf("unknown state %q", active)
+	}
+	s.mtx.Lock()
+	s.active = active
+	s.mtx.Unlock()
+	return nil
+}
+
+func (s *stateSet) State() string {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.active
+}
+
+// Describe implements Collector.
+func (s *stateSet) Describe(ch chan<- *Desc) {
+	ch <- s.desc
+}
+
+// Collect implements Collector.
+func (s *stateSet) Collect(ch chan<- Metric) {
+	active := s.State()
+	for _, state := range s.states {
+		v := 0.
+		if state == active {
+			v = 1
+		}
+		ch <- MustNewConstMetric(s.desc, GaugeValue, v, state)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStateSet(t *testing.T) {
+	s := NewStateSet(
+		GaugeOpts{Name: "door_state", Help: "State of the door."},
+		"state", []string{"open", "closed", "locked"},
+	)
+	reg := NewPedanticRegistry()
+	reg.MustRegister(s)
+
+	values := func() map[string]float64 {
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := map[string]float64{}
+		for _, m := range mfs[0].GetMetric() {
+			result[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+		}
+		return result
+	}
+
+	if got, want := values(), map[string]float64{"open": 0, "closed": 0, "locked": 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := s.State(); got != "" {
+		t.Errorf("got initial state %q, want none", got)
+	}
+
+	if err := s.SetState("closed"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := values(), map[string]float64{"open": 0, "closed": 1, "locked": 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if err := s.SetState("ajar"); err == nil {
+		t.Error("expected error for unknown state")
+	}
+	if got, want := s.State(), "closed"; got != want {
+		t.Errorf("got state %q after failed SetState, want %q", got, want)
+	}
+
+	if err := s.SetState("locked"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := values(), map[string]float64{"open": 0, "closed": 0, "locked": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestStateSetDuplicateStates(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic for duplicate states")
+		}
+	}()
+	NewStateSet(GaugeOpts{Name: "x", Help: "help"}, "state", []string{"a", "b", "a"})
+}
@@ -16,9 +16,12 @@ package prometheus
 import (
 	"fmt"
 	"math"
+	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
 
 	"github.com/beorn7/perks/quantile"
 	"github.com/golang/protobuf/proto"
@@ -56,6 +59,24 @@ type Summary interface {
 	Observe(float64)
 }
 
+// SlidingWindowReporter is implemented by the Summaries created by this package
+// (including those in a SummaryVec). Use a type assertion to access it.
+type SlidingWindowReporter interface {
+	// SlidingWindow returns the configuration of the sliding time window
+	// the quantiles of the summary are calculated over, with all defaults
+	// applied.
+	SlidingWindow() SlidingWindow
+}
+
+// SlidingWindow describes the sliding time window of a Summary. Observations
+// are kept for MaxAge. They are discarded in AgeBuckets steps, each of which
+// happens after BucketDuration (which is MaxAge divided by AgeBuckets).
+type SlidingWindow struct {
+	MaxAge         time.Duration
+	AgeBuckets     uint32
+	BucketDuration time.Duration
+}
+
 // DefObjectives are the default Summary quantile values.
 //
 // Deprecated: DefObjectives will not be used as the default objectives in
@@ -120,6 +141,48 @@ type SummaryOpts struct {
 	// metric name).
 	ConstLabels Labels
 
+	// LabelConstraints maps variable label names of a metric vector to
+	// functions that are applied to each value of the respective label
+	// before it is used, e.g. to map HTTP status codes to their class or
+	// to replace values outside of a bounded set with a fallback value.
+	// This keeps unbounded input from creating an unbounded number of
+	// series. Constraints for label names that are not variable labels of
+	// the vector are reported as an error upon registration. The field is
+	// ignored when creating a single metric (rather than a vector).
+	LabelConstraints map[string]LabelConstraint
+
+	// MaxLabelSets limits the number of label sets (i.e. the number of
+	// metrics) a metric vector keeps, to protect against label values
+	// that explode the number of series. Zero means no limit. What happens
+	// if a new label set is requested once the limit has been reached is
+	// determined by LabelSetOverflow. The field is ignored when creating a
+	// single metric (rather than a vector).
+	MaxLabelSets int
+	// LabelSetOverflow determines how a metric vector handles a new label
+	// set if MaxLabelSets has been reached. The default is
+	// LabelSetOverflowDrop.
+	LabelSetOverflow LabelSetOverflowPolicy
+	// LabelSetOverflowCounter, if not nil, is incremented each time a
+	// metric vector handles a new label set according to LabelSetOverflow
+	// because MaxLabelSets has been reached. It has to be registered
+	// separately.
+	LabelSetOverflowCounter Counter
+
+	// LabelSetTTL, if positive, makes a metric vector delete a label set
+	// (i.e. a metric) upon collection if the label set has not been
+	// retrieved (via WithLabelValues, With, GetMetricWithLabelValues, or
+	// GetMetricWith) within the duration. This is useful for label values
+	// that are only relevant for a short time. Note that keeping a
+	// retrieved metric to change it repeatedly does not count as a
+	// retrieval. The time is told by the DefaultClock at creation time of
+	// the vector. The field is ignored when creating a single metric
+	// (rather than a vector).
+	LabelSetTTL time.Duration
+	// LabelSetExpiredCounter, if not nil, is increased by the number of
+	// label sets deleted because of LabelSetTTL. It has to be registered
+	// separately.
+	LabelSetExpiredCounter Counter
+
 	// Objectives defines the quantile rank estimates with their respective
 	// absolute error. If Objectives[q] = e, then the value reported for q
 	// will be the φ-quantile value for some φ between q-e and q+e.  The
@@ -142,7 +205,9 @@ type SummaryOpts struct {
 	// really required. For very high observation rates, you might want to
 	// reduce the number of age buckets. With only one age bucket, you will
 	// effectively see a complete reset of the summary each time MaxAge has
-	// passed. The default value is DefAgeBuckets.
+	// passed. The default value (used if AgeBuckets is 0) is
+	// DefAgeBuckets. MaxAge divided by AgeBuckets must be at least one
+	// nanosecond.
 	AgeBuckets uint32
 
 	// BufCap defines the default sample stream buffer size.  The default
@@ -151,6 +216,13 @@ type SummaryOpts struct {
 	// is the internal buffer size of the underlying package
 	// "github.com/bmizerany/perks/quantile").
 	BufCap uint32
+
+	// Clock is used to tell the time when rotating the age buckets. The
+	// default value is the DefaultClock at creation time of the
+	// Summary. Only set it if you need deterministic timing, e.g. in tests
+	// observing at explicit points in time to check the rotation of the
+	// age buckets.
+	Clock Clock
 }
 
 // Great fuck-up with the sliding-window decay algorithm... The Merge method of
@@ -211,11 +283,20 @@ func newSummary(desc *Desc, opts SummaryOpts, labelValues ...string) Summary {
 	if opts.AgeBuckets == 0 {
 		opts.AgeBuckets = DefAgeBuckets
 	}
+	if opts.MaxAge < time.Duration(opts.AgeBuckets) {
+		panic(fmt.Errorf(
+			"max age MaxAge=%v too short for AgeBuckets=%d", opts.MaxAge, opts.AgeBuckets,
+		))
+	}
 
 	if opts.BufCap == 0 {
 		opts.BufCap = DefBufCap
 	}
 
+	if opts.Clock == nil {
+		opts.Clock = DefaultClock()
+	}
+
 	s := &summary{
 		desc: desc,
 
@@ -224,12 +305,15 @@ func newSummary(desc *Desc, opts SummaryOpts, labelValues ...string) Summary {
 
 		labelPairs: makeLabelPairs(desc, labelValues),
 
-		hotBuf:         make([]float64, 0, opts.BufCap),
+		shards:         make([]summaryShard, numSummaryShards()),
+		bufCap:         int(opts.BufCap),
 		coldBuf:        make([]float64, 0, opts.BufCap),
 		streamDuration: opts.MaxAge / time.Duration(opts.AgeBuckets),
+		maxAge:         opts.MaxAge,
+		clock:          opts.Clock,
 	}
-	s.headStreamExpTime = time.Now().Add(s.streamDuration)
-	s.hotBufExpTime = s.headStreamExpTime
+	s.headStreamExpTime = s.clock.Now().Add(s.streamDuration)
+	s.hotBufExpTime = s.headStreamExpTime.UnixNano()
 
 	for i := uint32(0); i < opts.AgeBuckets; i++ {
 		s.streams = append(s.streams, s.newStream())
@@ -245,12 +329,44 @@ func newSummary(desc *Desc, opts SummaryOpts, labelValues ...string) Summary {
 	return s
 }
 
+// maxSummaryShards limits the number of shards per summary, as each shard
+// holds its own buffer of up to BufCap observations.
+const maxSummaryShards = 8
+
+// numSummaryShards returns the number of shards to use for a new summary,
+// which is GOMAXPROCS, capped at maxSummaryShards.
+func numSummaryShards() int {
+	n := runtime.GOMAXPROCS(0)
+	if n > maxSummaryShards {
+		return maxSummaryShards
+	}
+	return n
+}
+
+// summaryShard buffers observations so that concurrent calls of Observe
+// contend for different mutexes. The buffers of all shards are flushed into
+// the shared quantile streams of the summary.
+type summaryShard struct {
+	mtx sync.Mutex
+	buf []float64
+	// Pad to a typical cache line size to avoid false sharing between
+	// neighboring shards.
+	_ [64]byte
+}
+
 type summary struct {
+	// hotBufExpTime is the expiration time of the buffered observations in
+	// nanoseconds since the epoch. It is accessed atomically and has to go
+	// first in the struct to guarantee alignment for atomic operations.
+	// http://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	hotBufExpTime int64
+	// flushing is 1 while an asynchronous flush is pending.
+	flushing uint32
+
 	selfCollector
 
-	bufMtx sync.Mutex // Protects hotBuf and hotBufExpTime.
-	mtx    sync.Mutex // Protects every other moving part.
-	// Lock bufMtx before mtx if both are needed.
+	mtx sync.Mutex // Protects every moving part not protected otherwise.
+	// Lock mtx before the mutex of a shard if both are needed.
 
 	desc *Desc
 
@@ -262,44 +378,82 @@ type summary struct {
 	sum float64
 	cnt uint64
 
-	hotBuf, coldBuf []float64
+	shards  []summaryShard
+	bufCap  int
+	coldBuf []float64
+
+	streams           []*quantile.Stream
+	streamDuration    time.Duration
+	headStream        *quantile.Stream
+	headStreamIdx     int
+	headStreamExpTime time.Time
 
-	streams                          []*quantile.Stream
-	streamDuration                   time.Duration
-	headStream                       *quantile.Stream
-	headStreamIdx                    int
-	headStreamExpTime, hotBufExpTime time.Time
+	maxAge time.Duration
+	clock  Clock
 }
 
 func (s *summary) Desc() *Desc {
 	return s.desc
 }
 
-func (s *summary) Observe(v float64) {
-	s.bufMtx.Lock()
-	defer s.bufMtx.Unlock()
+// SlidingWindow implements SlidingWindowReporter.
+func (s *summary) SlidingWindow() SlidingWindow {
+	return SlidingWindow{
+		MaxAge:         s.maxAge,
+		AgeBuckets:     uint32(len(s.streams)),
+		BucketDuration: s.streamDuration,
+	}
+}
 
-	now := time.Now()
-	if now.After(s.hotBufExpTime) {
-		s.asyncFlush(now)
+func (s *summary) Observe(v float64) {
+	now := s.clock.Now()
+	if now.UnixNano() > atomic.LoadInt64(&s.hotBufExpTime) {
+		// Flush synchronously so that v doesn't end up in an age bucket
+		// that has expired already.
+		s.mtx.Lock()
+		s.flush(now)
+		s.mtx.Unlock()
 	}
-	s.hotBuf = append(s.hotBuf, v)
-	if len(s.hotBuf) == cap(s.hotBuf) {
-		s.asyncFlush(now)
+
+	shard := &s.shards[s.shardIndex()]
+	shard.mtx.Lock()
+	shard.buf = append(shard.buf, v)
+	full := len(shard.buf) >= s.bufCap
+	shard.mtx.Unlock()
+
+	// Check flushing before the CAS to not write to it (and thereby to the
+	// cache line it shares with hotBufExpTime) while a flush is pending.
+	if full && atomic.LoadUint32(&s.flushing) == 0 && atomic.CompareAndSwapUint32(&s.flushing, 0, 1) {
+		// Unblock the goroutine that filled up the buffer. Concurrent
+		// observations are appended to the buffers beyond their
+		// capacity until the flush has happened.
+		go func() {
+			s.mtx.Lock()
+			s.flush(s.clock.Now())
+			s.mtx.Unlock()
+			atomic.StoreUint32(&s.flushing, 0)
+		}()
 	}
 }
 
+// shardIndex returns the index of the shard for an observation by the calling
+// goroutine. It is derived from the address of a local variable, i.e. from the
+// stack of the calling goroutine. Thus, consecutive observations by the same
+// goroutine usually go to the same shard, different goroutines are spread over
+// the shards, and picking a shard requires no write to shared memory.
+func (s *summary) shardIndex() int {
+	var local byte
+	// Fibonacci hashing, see https://en.wikipedia.org/wiki/Hash_function#Fibonacci_hashing
+	h := uint64(uintptr(unsafe.Pointer(&local))) * 0x9e3779b97f4a7c15
+	return int((h >> 32) % uint64(len(s.shards)))
+}
+
 func (s *summary) Write(out *dto.Metric) error {
 	sum := &dto.Summary{}
 	qs := make([]*dto.Quantile, 0, len(s.objectives))
 
-	s.bufMtx.Lock()
 	s.mtx.Lock()
-	// Swap bufs even if hotBuf is empty to set new hotBufExpTime.
-	s.swapBufs(time.Now())
-	s.bufMtx.Unlock()
-
-	s.flushColdBuf()
+	s.flush(s.clock.Now())
 	sum.SampleCount = proto.Uint64(s.cnt)
 	sum.SampleSum = proto.Float64(s.sum)
 
@@ -332,23 +486,36 @@ func (s *summary) newStream() *quantile.Stream {
 	return quantile.NewTargeted(s.objectives)
 }
 
-// asyncFlush needs bufMtx locked.
-func (s *summary) asyncFlush(now time.Time) {
-	s.mtx.Lock()
-	s.swapBufs(now)
+// flush moves the observations buffered in all shards into the streams and
+// then rotates the streams as required by now. It needs mtx locked.
+func (s *summary) flush(now time.Time) {
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mtx.Lock()
+		shard.buf, s.coldBuf = s.coldBuf, shard.buf
+		shard.mtx.Unlock()
+
+		for _, v := range s.coldBuf {
+			for _, stream := range s.streams {
+				stream.Insert(v)
+			}
+			s.cnt++
+			s.sum += v
+		}
+		s.coldBuf = s.coldBuf[0:0]
+	}
 
-	// Unblock the original goroutine that was responsible for the mutation
-	// that triggered the compaction.  But hold onto the global non-buffer
-	// state mutex until the operation finishes.
-	go func() {
-		s.flushColdBuf()
-		s.mtx.Unlock()
-	}()
+	expTime := time.Unix(0, atomic.LoadInt64(&s.hotBufExpTime))
+	for now.After(expTime) {
+		expTime = expTime.Add(s.streamDuration)
+	}
+	atomic.StoreInt64(&s.hotBufExpTime, expTime.UnixNano())
+	s.maybeRotateStreams(expTime)
 }
 
-// rotateStreams needs mtx AND bufMtx locked.
-func (s *summary) maybeRotateStreams() {
-	for !s.hotBufExpTime.Equal(s.headStreamExpTime) {
+// maybeRotateStreams needs mtx locked.
+func (s *summary) maybeRotateStreams(expTime time.Time) {
+	for !expTime.Equal(s.headStreamExpTime) {
 		s.headStream.Reset()
 		s.headStreamIdx++
 		if s.headStreamIdx >= len(s.streams) {
@@ -359,31 +526,6 @@ func (s *summary) maybeRotateStreams() {
 	}
 }
 
-// flushColdBuf needs mtx locked.
-func (s *summary) flushColdBuf() {
-	for _, v := range s.coldBuf {
-		for _, stream := range s.streams {
-			stream.Insert(v)
-		}
-		s.cnt++
-		s.sum += v
-	}
-	s.coldBuf = s.coldBuf[0:0]
-	s.maybeRotateStreams()
-}
-
-// swapBufs needs mtx AND bufMtx locked, coldBuf must be empty.
-func (s *summary) swapBufs(now time.Time) {
-	if len(s.coldBuf) != 0 {
-		panic("coldBuf is not empty")
-	}
-	s.hotBuf, s.coldBuf = s.coldBuf, s.hotBuf
-	// hotBuf is now empty and gets new expiration set.
-	for now.After(s.hotBufExpTime) {
-		s.hotBufExpTime = s.hotBufExpTime.Add(s.streamDuration)
-	}
-}
-
 type quantSort []*dto.Quantile
 
 func (s quantSort) Len() int {
@@ -417,7 +559,7 @@ func NewSummaryVec(opts SummaryOpts, labelNames []string) *SummaryVec {
 		opts.ConstLabels,
 	)
 	return &SummaryVec{
-		metricVec: newMetricVec(desc, func(lvs ...string) Metric {
+		metricVec: newMetricVec(desc, opts.vecOpts(), func(lvs ...string) Metric {
 			return newSummary(desc, opts, lvs...)
 		}),
 	}
@@ -490,6 +632,45 @@ func (m *SummaryVec) With(labels Labels) Observer {
 	return m.metricVec.with(labels).(Observer)
 }
 
+// WithPreparedLabelValues returns the Summary for the provided PreparedLabelValues
+// (see PrepareLabelValues). If the Summary does not exist (anymore), a new Summary is
+// created. It panics if the PreparedLabelValues have been prepared by a
+// different SummaryVec (curried versions of the same SummaryVec are fine).
+func (m *SummaryVec) WithPreparedLabelValues(p PreparedLabelValues) Observer {
+	return m.metricVec.withPreparedLabelValues(p).(Observer)
+}
+
+// CurryWith returns a vector curried with the provided labels, i.e. the
+// returned vector has those labels pre-set for all labeled operations performed
+// on it. The cardinality of the curried vector is reduced accordingly. The
+// order of the remaining labels stays the same (just with the curried labels
+// taken out of the sequence – which is relevant for the
+// (GetMetric)WithLabelValues methods). It is possible to curry a curried
+// vector, but only with labels not yet used for currying before.
+//
+// The metrics contained in the SummaryVec are shared between the curried and
+// uncurried vectors. They are just accessed differently. Curried and uncurried
+// vectors behave identically in terms of collection. Only one must be
+// registered with a given registry (usually the uncurried version). The Reset
+// method deletes all metrics, even if called on a curried vector.
+func (m *SummaryVec) CurryWith(labels Labels) (ObserverVec, error) {
+	vec, err := m.curryWith(labels)
+	if vec != nil {
+		return &SummaryVec{vec}, err
+	}
+	return nil, err
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *SummaryVec) MustCurryWith(labels Labels) ObserverVec {
+	vec, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return vec
+}
+
 type constSummary struct {
 	desc       *Desc
 	count      uint64
@@ -108,6 +108,17 @@ func BenchmarkSummaryObserve8(b *testing.B) {
 	benchmarkSummaryObserve(8, b)
 }
 
+func BenchmarkSummaryObserveParallel(b *testing.B) {
+	s := NewSummary(SummaryOpts{Name: "test_summary", Help: "helpless"})
+	b.RunParallel(func(pb *testing.PB) {
+		v := 0.
+		for pb.Next() {
+			s.Observe(v)
+			v++
+		}
+	})
+}
+
 func benchmarkSummaryWrite(w int, b *testing.B) {
 	b.StopTimer()
 
@@ -238,6 +249,73 @@ func TestSummaryConcurrency(t *testing.T) {
 	}
 }
 
+// TestSummaryConcurrentFlushes exercises both the asynchronous flush of full
+// shard buffers and the synchronous flush upon expiry of the buffered
+// observations concurrently. It is most useful with the race detector.
+func TestSummaryConcurrentFlushes(t *testing.T) {
+	const (
+		observers    = 8
+		observations = 2000
+	)
+	var (
+		nowMtx sync.Mutex
+		now    = time.Unix(1000, 0)
+	)
+	sum := NewSummary(SummaryOpts{
+		Name:       "test_summary",
+		Help:       "helpless",
+		MaxAge:     10 * time.Second,
+		AgeBuckets: 2,
+		BufCap:     4, // Small enough to fill up the buffers frequently.
+		Clock: ClockFunc(func() time.Time {
+			nowMtx.Lock()
+			defer nowMtx.Unlock()
+			return now
+		}),
+	})
+
+	var observersDone, ticksDone sync.WaitGroup
+	observersDone.Add(observers)
+	stop := make(chan struct{})
+	for i := 0; i < observers; i++ {
+		go func() {
+			defer observersDone.Done()
+			for j := 0; j < observations; j++ {
+				sum.Observe(1)
+			}
+		}()
+	}
+	// Advance the clock beyond the expiry of the buffered observations
+	// repeatedly and write concurrently.
+	ticksDone.Add(1)
+	go func() {
+		defer ticksDone.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			nowMtx.Lock()
+			now = now.Add(3 * time.Second)
+			nowMtx.Unlock()
+			sum.Write(&dto.Metric{})
+		}
+	}()
+	observersDone.Wait()
+	close(stop)
+	ticksDone.Wait()
+
+	m := &dto.Metric{}
+	sum.Write(m)
+	if got, want := m.GetSummary().GetSampleCount(), uint64(observers*observations); got != want {
+		t.Errorf("got sample count %d, want %d", got, want)
+	}
+	if got, want := m.GetSummary().GetSampleSum(), float64(observers*observations); got != want {
+		t.Errorf("got sample sum %f, want %f", got, want)
+	}
+}
+
 func TestSummaryVecConcurrency(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping test in short mode.")
@@ -369,6 +447,76 @@ func TestSummaryDecay(t *testing.T) {
 	}
 }
 
+func TestSummaryDecayWithClock(t *testing.T) {
+	now := time.Unix(1000, 0)
+	sum := NewSummary(SummaryOpts{
+		Name:       "test_summary",
+		Help:       "helpless",
+		MaxAge:     10 * time.Second,
+		Objectives: map[float64]float64{0.5: 0.05},
+		AgeBuckets: 2,
+		Clock:      ClockFunc(func() time.Time { return now }),
+	})
+
+	m := &dto.Metric{}
+	sum.Observe(42)
+	now = now.Add(4 * time.Second)
+	sum.Write(m)
+	if got, want := m.GetSummary().GetQuantile()[0].GetValue(), 42.; got != want {
+		t.Errorf("got %f, want %f before expiration", got, want)
+	}
+
+	m.Reset()
+	now = now.Add(7 * time.Second)
+	sum.Write(m)
+	if got := m.GetSummary().GetQuantile()[0].GetValue(); !math.IsNaN(got) {
+		t.Errorf("got %f, want NaN after expiration", got)
+	}
+	if got, want := m.GetSummary().GetSampleCount(), uint64(1); got != want {
+		t.Errorf("got sample count %d, want %d", got, want)
+	}
+}
+
+func TestSummarySlidingWindow(t *testing.T) {
+	scenarios := []struct {
+		opts SummaryOpts
+		want SlidingWindow
+	}{
+		{
+			opts: SummaryOpts{},
+			want: SlidingWindow{MaxAge: DefMaxAge, AgeBuckets: DefAgeBuckets, BucketDuration: DefMaxAge / DefAgeBuckets},
+		},
+		{
+			opts: SummaryOpts{MaxAge: time.Minute, AgeBuckets: 1},
+			want: SlidingWindow{MaxAge: time.Minute, AgeBuckets: 1, BucketDuration: time.Minute},
+		},
+		{
+			opts: SummaryOpts{MaxAge: time.Minute, AgeBuckets: 3},
+			want: SlidingWindow{MaxAge: time.Minute, AgeBuckets: 3, BucketDuration: 20 * time.Second},
+		},
+	}
+	for i, s := range scenarios {
+		s.opts.Name, s.opts.Help = "test_summary", "helpless"
+		if got := NewSummary(s.opts).(SlidingWindowReporter).SlidingWindow(); got != s.want {
+			t.Errorf("%d. got %+v, want %+v", i, got, s.want)
+		}
+	}
+}
+
+func TestSummaryAgeBucketsTooMany(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic for age buckets shorter than a nanosecond")
+		}
+	}()
+	NewSummary(SummaryOpts{
+		Name:       "test_summary",
+		Help:       "helpless",
+		MaxAge:     3 * time.Nanosecond,
+		AgeBuckets: 4,
+	})
+}
+
 func getBounds(vars []float64, q, ε float64) (min, max float64) {
 	// TODO(beorn7): This currently tolerates an error of up to 2*ε. The
 	// error must be at most ε, but for some reason, it's sometimes slightly
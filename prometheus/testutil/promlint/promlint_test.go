@@ -0,0 +1,200 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promlint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		problems []Problem
+	}{
+		{
+			name: "clean",
+			in: `
+# HELP x_bytes Test metric.
+# TYPE x_bytes gauge
+x_bytes 10
+# HELP requests_total Test counter.
+# TYPE requests_total counter
+requests_total{code="200"} 10
+`,
+		},
+		{
+			name: "no help",
+			in: `
+# TYPE go_goroutines gauge
+go_goroutines 24
+`,
+			problems: []Problem{{
+				Metric: "go_goroutines",
+				Text:   "no help text",
+			}},
+		},
+		{
+			name: "non-base unit",
+			in: `
+# HELP x_milliseconds Test metric.
+# TYPE x_milliseconds untyped
+x_milliseconds 10
+`,
+			problems: []Problem{{
+				Metric: "x_milliseconds",
+				Text:   `use base unit "seconds" instead of "milliseconds"`,
+			}},
+		},
+		{
+			name: "counter without _total",
+			in: `
+# HELP x_bytes Test metric.
+# TYPE x_bytes counter
+x_bytes 10
+`,
+			problems: []Problem{{
+				Metric: "x_bytes",
+				Text:   `counter metrics should have "_total" suffix`,
+			}},
+		},
+		{
+			name: "gauge with _total",
+			in: `
+# HELP x_bytes_total Test metric.
+# TYPE x_bytes_total gauge
+x_bytes_total 10
+`,
+			problems: []Problem{{
+				Metric: "x_bytes_total",
+				Text:   `non-counter metrics should not have "_total" suffix`,
+			}},
+		},
+		{
+			name: "reserved label and suffix",
+			in: `
+# HELP x_count Test metric.
+# TYPE x_count gauge
+x_count{le="1"} 10
+`,
+			problems: []Problem{
+				{
+					Metric: "x_count",
+					Text:   `non-histogram and non-summary metrics should not have "_count" suffix`,
+				},
+				{
+					Metric: "x_count",
+					Text:   `non-histogram metrics should not have "le" label`,
+				},
+			},
+		},
+		{
+			name: "type in name",
+			in: `
+# HELP requests_counter_total Test metric.
+# TYPE requests_counter_total counter
+requests_counter_total 10
+`,
+			problems: []Problem{{
+				Metric: "requests_counter_total",
+				Text:   "metric name should not include type 'counter'",
+			}},
+		},
+		{
+			name: "colon",
+			in: `
+# HELP x:y Test metric.
+# TYPE x:y untyped
+x:y 10
+`,
+			problems: []Problem{{
+				Metric: "x:y",
+				Text:   "metric names should not contain ':'",
+			}},
+		},
+		{
+			name: "camel case",
+			in: `
+# HELP requestCount Test metric.
+# TYPE requestCount untyped
+requestCount{httpCode="200"} 10
+`,
+			problems: []Problem{
+				{
+					Metric: "requestCount",
+					Text:   "label names should be written in 'snake_case' not 'camelCase'",
+				},
+				{
+					Metric: "requestCount",
+					Text:   "metric names should be written in 'snake_case' not 'camelCase'",
+				},
+			},
+		},
+		{
+			name: "abbreviated unit",
+			in: `
+# HELP latency_ms Test metric.
+# TYPE latency_ms untyped
+latency_ms 10
+`,
+			problems: []Problem{{
+				Metric: "latency_ms",
+				Text:   "metric names should not contain abbreviated units",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		problems, err := New(strings.NewReader(tt.in)).Lint()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tt.name, err)
+		}
+		if want, got := tt.problems, problems; !reflect.DeepEqual(want, got) {
+			t.Errorf("%s: unexpected problems:\n- want: %v\n-  got: %v", tt.name, want, got)
+		}
+	}
+}
+
+func TestLintMetricFamilies(t *testing.T) {
+	mfs := []*dto.MetricFamily{{
+		Name: proto.String("x_seconds"),
+		Type: dto.MetricType_COUNTER.Enum(),
+		Metric: []*dto.Metric{{
+			Counter: &dto.Counter{Value: proto.Float64(1)},
+		}},
+	}}
+	problems, err := NewWithMetricFamilies(mfs).Lint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Problem{
+		{Metric: "x_seconds", Text: `counter metrics should have "_total" suffix`},
+		{Metric: "x_seconds", Text: "no help text"},
+	}
+	if !reflect.DeepEqual(want, problems) {
+		t.Errorf("unexpected problems:\n- want: %v\n-  got: %v", want, problems)
+	}
+}
+
+func TestLintInvalidInput(t *testing.T) {
+	if _, err := New(strings.NewReader("invalid {")).Lint(); err == nil {
+		t.Error("expected error for invalid input")
+	}
+}
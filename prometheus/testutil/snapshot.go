@@ -0,0 +1,133 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Snapshot is the state of all series gathered from a Gatherer at one point in
+// time, mapping the string representation of each series (e.g.
+// `http_requests_total{code="200", method="get"}`) to its value. Histograms and
+// summaries are broken down into their individual series (buckets, quantiles,
+// sum, and count) as in the text exposition format. Create Snapshots with
+// TakeSnapshot and compare them with DiffSnapshots.
+type Snapshot map[string]float64
+
+// TakeSnapshot gathers from the provided Gatherer and returns the result as a
+// Snapshot.
+func TakeSnapshot(g prometheus.Gatherer) (Snapshot, error) {
+	mfs, err := g.Gather()
+	if err != nil {
+		return nil, fmt.Errorf("gathering metrics failed: %s", err)
+	}
+	samples, err := expfmt.ExtractSamples(&expfmt.DecodeOptions{}, mfs...)
+	if err != nil {
+		return nil, fmt.Errorf("extracting samples failed: %s", err)
+	}
+	s := make(Snapshot, len(samples))
+	for _, sample := range samples {
+		s[sample.Metric.String()] = float64(sample.Value)
+	}
+	return s, nil
+}
+
+// ValueChange is a series with different values in two Snapshots.
+type ValueChange struct {
+	Series        string
+	Before, After float64
+}
+
+// Delta returns the difference between the later and the earlier value.
+func (c ValueChange) Delta() float64 {
+	return c.After - c.Before
+}
+
+// SnapshotDiff is the difference between two Snapshots as returned by
+// DiffSnapshots. All slices are sorted by series.
+type SnapshotDiff struct {
+	Added   []string      // Series only present in the later Snapshot.
+	Removed []string      // Series only present in the earlier Snapshot.
+	Changed []ValueChange // Series present in both with different values.
+}
+
+// DiffSnapshots returns the difference between the provided earlier and later
+// Snapshot. It helps to detect unexpected series churn (e.g. a cardinality
+// regression caused by a new label value) in tests. Two NaN values are
+// considered equal.
+func DiffSnapshots(before, after Snapshot) SnapshotDiff {
+	var d SnapshotDiff
+	for series, b := range before {
+		a, ok := after[series]
+		if !ok {
+			d.Removed = append(d.Removed, series)
+			continue
+		}
+		if a != b && !(math.IsNaN(a) && math.IsNaN(b)) {
+			d.Changed = append(d.Changed, ValueChange{Series: series, Before: b, After: a})
+		}
+	}
+	for series := range after {
+		if _, ok := before[series]; !ok {
+			d.Added = append(d.Added, series)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Sort(valueChangeSorter(d.Changed))
+	return d
+}
+
+// Empty returns true if the compared Snapshots have been equal.
+func (d SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String returns a human-readable representation of the SnapshotDiff with one
+// line per series, prefixed by "+" for added, "-" for removed, and "~" for
+// changed series.
+func (d SnapshotDiff) String() string {
+	var buf bytes.Buffer
+	for _, series := range d.Added {
+		fmt.Fprintf(&buf, "+ %s\n", series)
+	}
+	for _, series := range d.Removed {
+		fmt.Fprintf(&buf, "- %s\n", series)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&buf, "~ %s %g -> %g (%+g)\n", c.Series, c.Before, c.After, c.Delta())
+	}
+	return buf.String()
+}
+
+type valueChangeSorter []ValueChange
+
+func (s valueChangeSorter) Len() int {
+	return len(s)
+}
+
+func (s valueChangeSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s valueChangeSorter) Less(i, j int) bool {
+	return s[i].Series < s[j].Series
+}
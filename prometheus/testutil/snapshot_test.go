@@ -0,0 +1,77 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "requests_total", Help: "help"},
+		[]string{"code", "method"},
+	)
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "temperature", Help: "help"})
+	reg.MustRegister(c, g)
+	c.WithLabelValues("200", "get").Inc()
+	c.WithLabelValues("500", "get").Inc()
+	g.Set(math.NaN())
+
+	before, err := TakeSnapshot(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(before), 3; got != want {
+		t.Errorf("got %d series, want %d", got, want)
+	}
+	if d := DiffSnapshots(before, before); !d.Empty() {
+		t.Errorf("got non-empty diff of equal snapshots:\n%s", d)
+	}
+
+	c.WithLabelValues("200", "get").Add(2)
+	c.WithLabelValues("404", "get").Inc()
+	c.DeleteLabelValues("500", "get")
+
+	after, err := TakeSnapshot(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DiffSnapshots(before, after)
+	if d.Empty() {
+		t.Fatal("got empty diff")
+	}
+	want := SnapshotDiff{
+		Added:   []string{`requests_total{code="404", method="get"}`},
+		Removed: []string{`requests_total{code="500", method="get"}`},
+		Changed: []ValueChange{{Series: `requests_total{code="200", method="get"}`, Before: 1, After: 3}},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("got diff %#v, want %#v", d, want)
+	}
+	if got, want := d.Changed[0].Delta(), 2.0; got != want {
+		t.Errorf("got delta %v, want %v", got, want)
+	}
+	wantString := `+ requests_total{code="404", method="get"}
+- requests_total{code="500", method="get"}
+~ requests_total{code="200", method="get"} 1 -> 3 (+2)
+`
+	if got := d.String(); got != wantString {
+		t.Errorf("got string\n%s\nwant\n%s", got, wantString)
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testutil provides helpers to test code using the prometheus package
+// of client_golang.
+//
+// While writing unit tests to verify correct instrumentation of your code, it's
+// a common mistake to mostly test the instrumentation library instead of your
+// own code. Rather than verifying that a prometheus.Counter's value has changed
+// as expected or that it shows up in the exposition after registration, it is
+// in general more robust and more faithful to the concept of unit tests to use
+// mock implementations of the prometheus.Counter and prometheus.Registerer
+// interfaces that simply assert that the Add or Register methods have been
+// called with the expected arguments. However, this might be overkill in
+// simple scenarios. The ToFloat64 function is provided for simple inspection
+// of a single-value metric, but it has to be used with caution.
+//
+// End-to-end tests to verify all or larger parts of the metrics exposition can
+// be implemented with the CollectAndCompare or GatherAndCompare functions. The
+// most appropriate use is not so much testing instrumentation of your code, but
+// testing custom prometheus.Collector implementations and in particular whole
+// exporters, i.e. programs that retrieve telemetry data from a 3rd party source
+// and convert it into Prometheus metrics. Exporters running as a whole can be
+// tested via HTTP with the ScrapeAndCompare function.
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/common/expfmt"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil/promlint"
+)
+
+// acceptHeader is the Accept header sent by ScrapeAndCompare, preferring the
+// protobuf format like the Prometheus server does.
+const acceptHeader = `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3`
+
+// ToFloat64 collects all Metrics from the provided Collector. It expects that
+// this results in exactly one Metric being collected, which must be a Gauge,
+// Counter, or Untyped. In all other cases, ToFloat64 panics. ToFloat64 returns
+// the value of the collected Metric.
+//
+// The Collector provided is typically a simple instance of Gauge or Counter, or
+// – less commonly – a GaugeVec or CounterVec with exactly one element. But any
+// Collector fulfilling the prerequisites described above will do.
+//
+// Use this function with caution. It is computationally very expensive and
+// therefore not suited to be used in production code. In tests, it should only
+// be used to inspect simple metrics, not as a replacement for
+// CollectAndCompare.
+func ToFloat64(c prometheus.Collector) float64 {
+	var (
+		m      prometheus.Metric
+		mCount int
+		mChan  = make(chan prometheus.Metric)
+		done   = make(chan struct{})
+	)
+
+	go func() {
+		for m = range mChan {
+			mCount++
+		}
+		close(done)
+	}()
+
+	c.Collect(mChan)
+	close(mChan)
+	<-done
+
+	if mCount != 1 {
+		panic(fmt.Errorf("collected %d metrics instead of exactly 1", mCount))
+	}
+
+	pb := &dto.Metric{}
+	m.Write(pb)
+	if pb.Gauge != nil {
+		return pb.Gauge.GetValue()
+	}
+	if pb.Counter != nil {
+		return pb.Counter.GetValue()
+	}
+	if pb.Untyped != nil {
+		return pb.Untyped.GetValue()
+	}
+	panic(fmt.Errorf("collected a non-gauge/counter/untyped metric: %s", pb))
+}
+
+// CollectAndCount registers the provided Collector with a newly created
+// pedantic Registry and returns the number of Metrics collected, counting only
+// Metrics with the provided names if any are given. As it is meant for concise
+// use in tests, it panics if registration or gathering fails.
+func CollectAndCount(c prometheus.Collector, metricNames ...string) int {
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		panic(fmt.Errorf("registering collector failed: %s", err))
+	}
+	result, err := GatherAndCount(reg, metricNames...)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// GatherAndCount gathers all metrics from the provided Gatherer and counts
+// them. It returns the number of metric children in all gathered metric
+// families together. If any metricNames are provided, only metrics with those
+// names are counted.
+func GatherAndCount(g prometheus.Gatherer, metricNames ...string) (int, error) {
+	got, err := g.Gather()
+	if err != nil {
+		return 0, fmt.Errorf("gathering metrics failed: %s", err)
+	}
+	if metricNames != nil {
+		got = filterMetrics(got, metricNames)
+	}
+
+	result := 0
+	for _, mf := range got {
+		result += len(mf.GetMetric())
+	}
+	return result, nil
+}
+
+// CollectAndCompare registers the provided Collector with a newly created
+// pedantic Registry. It then calls GatherAndCompare with that Registry and with
+// the provided metricNames.
+func CollectAndCompare(c prometheus.Collector, expected io.Reader, metricNames ...string) error {
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		return fmt.Errorf("registering collector failed: %s", err)
+	}
+	return GatherAndCompare(reg, expected, metricNames...)
+}
+
+// GatherAndCompare gathers all metrics from the provided Gatherer and compares
+// it to an expected output read from the provided Reader in the Prometheus text
+// exposition format. If any metricNames are provided, only metrics with those
+// names are compared.
+func GatherAndCompare(g prometheus.Gatherer, expected io.Reader, metricNames ...string) error {
+	got, err := g.Gather()
+	if err != nil {
+		return fmt.Errorf("gathering metrics failed: %s", err)
+	}
+	if metricNames != nil {
+		got = filterMetrics(got, metricNames)
+	}
+	var tp expfmt.TextParser
+	wantRaw, err := tp.TextToMetricFamilies(expected)
+	if err != nil {
+		return fmt.Errorf("parsing expected metrics failed: %s", err)
+	}
+	want := normalizeMetricFamilies(wantRaw)
+
+	return compare(got, want)
+}
+
+// ScrapeAndCompare scrapes the metrics exposed at the provided URL via HTTP or
+// HTTPS (using http.DefaultClient) and compares them to an expected output read
+// from the provided Reader in the Prometheus text exposition format. If any
+// metricNames are provided, only metrics with those names are compared. The
+// scraped exposition may be in the text or in the protobuf format. This is
+// meant for end-to-end tests of exporters, which can be served in any way as
+// long as they are reachable via HTTP.
+func ScrapeAndCompare(url string, expected io.Reader, metricNames ...string) error {
+	return GatherAndCompare(
+		prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return scrape(url)
+		}),
+		expected, metricNames...,
+	)
+}
+
+// scrape scrapes the metrics exposed at the provided URL. The returned
+// MetricFamilies are normalized like those returned by a prometheus.Registry.
+func scrape(url string) ([]*dto.MetricFamily, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", acceptHeader)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scraping %s returned HTTP status %s", url, resp.Status)
+	}
+
+	metricFamiliesByName := map[string]*dto.MetricFamily{}
+	dec := expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header))
+	for {
+		mf := &dto.MetricFamily{}
+		if err := dec.Decode(mf); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("decoding scraped metrics failed: %s", err)
+		}
+		metricFamiliesByName[mf.GetName()] = mf
+	}
+	return normalizeMetricFamilies(metricFamiliesByName), nil
+}
+
+// CollectAndLint registers the provided Collector with a newly created
+// pedantic Registry. It then calls GatherAndLint with that Registry and with
+// the provided metricNames.
+func CollectAndLint(c prometheus.Collector, metricNames ...string) ([]promlint.Problem, error) {
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		return nil, fmt.Errorf("registering collector failed: %s", err)
+	}
+	return GatherAndLint(reg, metricNames...)
+}
+
+// GatherAndLint gathers all metrics from the provided Gatherer and checks them
+// with the linter in the promlint package. If any metricNames are provided,
+// only metrics with those names are checked.
+func GatherAndLint(g prometheus.Gatherer, metricNames ...string) ([]promlint.Problem, error) {
+	got, err := g.Gather()
+	if err != nil {
+		return nil, fmt.Errorf("gathering metrics failed: %s", err)
+	}
+	if metricNames != nil {
+		got = filterMetrics(got, metricNames)
+	}
+	return promlint.NewWithMetricFamilies(got).Lint()
+}
+
+// compare encodes both provided slices of metric families into the text format,
+// compares their string message, and returns an error if they do not match.
+// The error contains the encoded text of both the desired and the actual
+// result.
+func compare(got, want []*dto.MetricFamily) error {
+	var gotBuf, wantBuf bytes.Buffer
+	enc := expfmt.NewEncoder(&gotBuf, expfmt.FmtText)
+	for _, mf := range got {
+		if err := enc.Encode(mf); err != nil {
+			return fmt.Errorf("encoding gathered metrics failed: %s", err)
+		}
+	}
+	enc = expfmt.NewEncoder(&wantBuf, expfmt.FmtText)
+	for _, mf := range want {
+		if err := enc.Encode(mf); err != nil {
+			return fmt.Errorf("encoding expected metrics failed: %s", err)
+		}
+	}
+
+	if wantBuf.String() != gotBuf.String() {
+		return fmt.Errorf(`
+metric output does not match expectation; want:
+
+%s
+got:
+
+%s`, wantBuf.String(), gotBuf.String())
+
+	}
+	return nil
+}
+
+func filterMetrics(metrics []*dto.MetricFamily, names []string) []*dto.MetricFamily {
+	var filtered []*dto.MetricFamily
+	for _, m := range metrics {
+		for _, name := range names {
+			if m.GetName() == name {
+				filtered = append(filtered, m)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// normalizeMetricFamilies returns a MetricFamily slice with empty
+// MetricFamilies pruned and the remaining MetricFamilies sorted by name within
+// the slice, with the contained Metrics sorted within each MetricFamily, just
+// like a prometheus.Registry would return them from Gather.
+func normalizeMetricFamilies(metricFamiliesByName map[string]*dto.MetricFamily) []*dto.MetricFamily {
+	names := make([]string, 0, len(metricFamiliesByName))
+	for name, mf := range metricFamiliesByName {
+		if len(mf.Metric) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	result := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		mf := metricFamiliesByName[name]
+		for _, m := range mf.Metric {
+			sort.Sort(prometheus.LabelPairSorter(m.Label))
+		}
+		sort.Sort(metricSorter(mf.Metric))
+		result = append(result, mf)
+	}
+	return result
+}
+
+// metricSorter is a sortable slice of *dto.Metric, ordered by label values and
+// then by timestamp, in the same way prometheus.Registry sorts them.
+type metricSorter []*dto.Metric
+
+func (s metricSorter) Len() int {
+	return len(s)
+}
+
+func (s metricSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s metricSorter) Less(i, j int) bool {
+	if len(s[i].Label) != len(s[j].Label) {
+		// This should not happen. The metrics are inconsistent. However,
+		// we have to deal with the fact, as people might use custom
+		// collectors or metric family collections from other sources.
+		return len(s[i].Label) < len(s[j].Label)
+	}
+	for n, lp := range s[i].Label {
+		vi := lp.GetValue()
+		vj := s[j].Label[n].GetValue()
+		if vi != vj {
+			return vi < vj
+		}
+	}
+	return s[i].GetTimestampMs() < s[j].GetTimestampMs()
+}
+
+// CheckCollisions checks if the provided Collectors could be registered
+// together with one and the same Registry. It applies the very same consistency
+// and uniqueness checks as prometheus.Registry.Register, but it does so with a
+// scratch Registry, i.e. nothing is registered with any Registry in use. The
+// returned error (a prometheus.MultiError if more than one problem is found)
+// lists all offending Collectors by their position in the argument list, or it
+// is nil if all Collectors compose cleanly.
+//
+// CheckCollisions is meant to be used in unit tests of packages that combine
+// Collectors from many sources, to detect name collisions before they result
+// in a panic during MustRegister.
+func CheckCollisions(cs ...prometheus.Collector) error {
+	var (
+		reg        = prometheus.NewRegistry()
+		registered []int // Positions of the Collectors registered with reg.
+		errs       prometheus.MultiError
+	)
+	for i, c := range cs {
+		err := reg.Register(c)
+		if err == nil {
+			registered = append(registered, i)
+			continue
+		}
+		if _, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			// Collectors are not necessarily comparable, so find the
+			// equal Collector by registering with a Registry of its
+			// own.
+			for _, j := range registered {
+				if isAlreadyRegistered(cs[j], c) {
+					err = fmt.Errorf("collector is equal to collector #%d", j+1)
+					break
+				}
+			}
+		}
+		errs = append(errs, fmt.Errorf("collector #%d: %s", i+1, err))
+	}
+	return errs.MaybeUnwrap()
+}
+
+// isAlreadyRegistered returns whether registering c with a Registry that has
+// existing registered results in a prometheus.AlreadyRegisteredError.
+func isAlreadyRegistered(existing, c prometheus.Collector) bool {
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(existing); err != nil {
+		return false
+	}
+	_, ok := reg.Register(c).(prometheus.AlreadyRegisteredError)
+	return ok
+}
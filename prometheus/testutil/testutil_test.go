@@ -0,0 +1,302 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestCheckCollisions(t *testing.T) {
+	var (
+		a = prometheus.NewCounter(prometheus.CounterOpts{Name: "a_total", Help: "help"})
+		b = prometheus.NewGauge(prometheus.GaugeOpts{Name: "b", Help: "help"})
+		// Same name and const labels as a.
+		aDup = prometheus.NewCounter(prometheus.CounterOpts{Name: "a_total", Help: "help"})
+		// Same name as b, but different help.
+		bOther = prometheus.NewGauge(prometheus.GaugeOpts{Name: "b", Help: "other help"})
+	)
+
+	if err := CheckCollisions(a, b); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	err := CheckCollisions(a, b, aDup, bOther)
+	if err == nil {
+		t.Fatal("expected error for colliding collectors")
+	}
+	multiErr, ok := err.(prometheus.MultiError)
+	if !ok {
+		t.Fatalf("expected MultiError, got %T: %s", err, err)
+	}
+	if want, got := 2, len(multiErr); want != got {
+		t.Errorf("want %d errors, got %d: %s", want, got, err)
+	}
+	if want, got := "collector #3: collector is equal to collector #1", multiErr[0].Error(); want != got {
+		t.Errorf("want error %q, got %q", want, got)
+	}
+}
+
+// sliceCollector is a Collector of a non-comparable type.
+type sliceCollector []prometheus.Collector
+
+func (cs sliceCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range cs {
+		c.Describe(ch)
+	}
+}
+
+func (cs sliceCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range cs {
+		c.Collect(ch)
+	}
+}
+
+func TestCheckCollisionsNonComparable(t *testing.T) {
+	newCollector := func() prometheus.Collector {
+		return sliceCollector{
+			prometheus.NewCounter(prometheus.CounterOpts{Name: "a_total", Help: "help"}),
+			prometheus.NewGauge(prometheus.GaugeOpts{Name: "b", Help: "help"}),
+		}
+	}
+	c := prometheus.NewGauge(prometheus.GaugeOpts{Name: "c", Help: "help"})
+
+	err := CheckCollisions(newCollector(), c, newCollector())
+	if err == nil {
+		t.Fatal("expected error for colliding collectors")
+	}
+	if want, got := "collector #3: collector is equal to collector #1", err.Error(); want != got {
+		t.Errorf("want error %q, got %q", want, got)
+	}
+}
+
+func TestToFloat64(t *testing.T) {
+	gaugeWithAValueSet := prometheus.NewGauge(prometheus.GaugeOpts{Name: "g", Help: "help"})
+	gaugeWithAValueSet.Set(3.14)
+
+	counterVecWithOneElement := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "c", Help: "help"}, []string{"foo"})
+	counterVecWithOneElement.WithLabelValues("bar").Inc()
+
+	counterVecWithTwoElements := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "c", Help: "help"}, []string{"foo"})
+	counterVecWithTwoElements.WithLabelValues("bar").Add(42)
+	counterVecWithTwoElements.WithLabelValues("baz").Inc()
+
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "h", Help: "help"})
+
+	scenarios := map[string]struct {
+		collector prometheus.Collector
+		panics    bool
+		want      float64
+	}{
+		"simple counter": {
+			collector: prometheus.NewCounter(prometheus.CounterOpts{Name: "c", Help: "help"}),
+			want:      0,
+		},
+		"simple gauge": {
+			collector: gaugeWithAValueSet,
+			want:      3.14,
+		},
+		"simple gauge func": {
+			collector: prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "g", Help: "help"}, func() float64 { return 3.1415 }),
+			want:      3.1415,
+		},
+		"vec with one element": {
+			collector: counterVecWithOneElement,
+			want:      1,
+		},
+		"vec with two elements": {
+			collector: counterVecWithTwoElements,
+			panics:    true,
+		},
+		"histogram": {
+			collector: histogram,
+			panics:    true,
+		},
+	}
+
+	for name, s := range scenarios {
+		func() {
+			defer func() {
+				r := recover()
+				if r == nil && s.panics {
+					t.Errorf("%s: expected panic", name)
+				}
+				if r != nil && !s.panics {
+					t.Errorf("%s: unexpected panic: %v", name, r)
+				}
+			}()
+			if got := ToFloat64(s.collector); got != s.want {
+				t.Errorf("%s: want %v, got %v", name, s.want, got)
+			}
+		}()
+	}
+}
+
+func TestCollectAndCompare(t *testing.T) {
+	const metadata = `
+		# HELP some_total A value that represents a counter.
+		# TYPE some_total counter
+	`
+
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "some_total",
+		Help: "A value that represents a counter.",
+		ConstLabels: prometheus.Labels{
+			"label1": "value1",
+		},
+	}, []string{"label2"})
+	c.WithLabelValues("b").Inc()
+	c.WithLabelValues("a").Inc()
+
+	expected := `
+		some_total{label1="value1",label2="b"} 1
+		some_total{label2="a",label1="value1"} 1
+	`
+
+	if err := CollectAndCompare(c, strings.NewReader(metadata+expected), "some_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if err := CollectAndCompare(c, strings.NewReader(metadata+expected)); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	wrong := `
+		some_total{label1="value1",label2="b"} 2
+		some_total{label1="value1",label2="a"} 1
+	`
+	if err := CollectAndCompare(c, strings.NewReader(metadata+wrong)); err == nil {
+		t.Error("expected mismatch error")
+	}
+
+	// Filtering out all metrics leaves nothing to compare.
+	if err := CollectAndCompare(c, strings.NewReader(""), "other_metric"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestGatherAndCompare(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "some_gauge", Help: "A gauge."})
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "some_total", Help: "A counter."})
+	reg.MustRegister(g, c)
+	g.Set(2)
+
+	expected := `
+		# HELP some_gauge A gauge.
+		# TYPE some_gauge gauge
+		some_gauge 2
+	`
+	if err := GatherAndCompare(reg, strings.NewReader(expected), "some_gauge"); err != nil {
+		t.Errorf("unexpected gathering result:\n%s", err)
+	}
+	if err := GatherAndCompare(reg, strings.NewReader(expected)); err == nil {
+		t.Error("expected mismatch error as some_total is not expected")
+	}
+	if err := GatherAndCompare(reg, strings.NewReader("invalid {")); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestScrapeAndCompare(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "some_gauge", Help: "A gauge."})
+	c := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "some_total", Help: "A counter."},
+		[]string{"label"},
+	)
+	reg.MustRegister(g, c)
+	g.Set(2)
+	c.WithLabelValues("b").Inc()
+	c.WithLabelValues("a").Add(3)
+
+	expected := `
+		# HELP some_gauge A gauge.
+		# TYPE some_gauge gauge
+		some_gauge 2
+		# HELP some_total A counter.
+		# TYPE some_total counter
+		some_total{label="a"} 3
+		some_total{label="b"} 1
+	`
+	for _, opts := range []promhttp.HandlerOpts{{}, {DisableProtobuf: true}} {
+		server := httptest.NewServer(promhttp.HandlerFor(reg, opts))
+		if err := ScrapeAndCompare(server.URL, strings.NewReader(expected)); err != nil {
+			t.Errorf("unexpected scraping result:\n%s", err)
+		}
+		if err := ScrapeAndCompare(server.URL, strings.NewReader(expected), "some_gauge"); err == nil {
+			t.Error("expected mismatch error as some_total is filtered out")
+		}
+		server.Close()
+	}
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	if err := ScrapeAndCompare(server.URL, strings.NewReader(expected)); err == nil {
+		t.Error("expected error for HTTP status 404")
+	}
+}
+
+func TestCollectAndCount(t *testing.T) {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "some_total",
+		Help: "A value that represents a counter.",
+	}, []string{"foo"})
+
+	if got, want := CollectAndCount(c), 0; got != want {
+		t.Errorf("unexpected metric count, got %d, want %d", got, want)
+	}
+	c.WithLabelValues("bar")
+	c.WithLabelValues("baz")
+	if got, want := CollectAndCount(c), 2; got != want {
+		t.Errorf("unexpected metric count, got %d, want %d", got, want)
+	}
+	if got, want := CollectAndCount(c, "some_total"), 2; got != want {
+		t.Errorf("unexpected metric count, got %d, want %d", got, want)
+	}
+	if got, want := CollectAndCount(c, "other_total"), 0; got != want {
+		t.Errorf("unexpected metric count, got %d, want %d", got, want)
+	}
+}
+
+func TestCollectAndLint(t *testing.T) {
+	good := prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total", Help: "help"})
+	problems, err := CollectAndLint(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+
+	bad := prometheus.NewCounter(prometheus.CounterOpts{Name: "requests", Help: "help"})
+	problems, err = CollectAndLint(bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Metric != "requests" {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+	problems, err = CollectAndLint(bad, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("unexpected problems for filtered metrics: %v", problems)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+// downstreamLabel is the label name used by a TimedCollector to partition the
+// observed durations.
+const downstreamLabel = "downstream"
+
+// TimedCollector is a Collector that wraps another Collector and additionally
+// exposes a Histogram of the durations of named sub-operations performed by the
+// wrapped Collector, partitioned by a label "downstream". It is meant for
+// composite Collectors (typically in exporters) that have to query one or
+// more downstream systems in their Collect method. The Histogram reveals which
+// downstream is making scrapes slow.
+//
+// The wrapped Collector times its sub-operations with the Time method of the
+// TimedCollector, usually like this:
+//    func (c *myCollector) Collect(ch chan<- prometheus.Metric) {
+//        timer := c.timedCollector.Time("database")
+//        // Query the database and send the resulting metrics to ch.
+//        timer.ObserveDuration()
+//    }
+// Only the TimedCollector is registered (not the wrapped Collector). See the
+// example for details.
+//
+// Use NewTimedCollector to create instances.
+type TimedCollector struct {
+	collector Collector
+	durations *HistogramVec
+}
+
+// NewTimedCollector returns a TimedCollector wrapping the provided Collector.
+// The provided HistogramOpts are used for the Histogram of the durations of
+// sub-operations. The Histogram is partitioned by the label "downstream", which
+// must therefore not be used as a constant label in the HistogramOpts.
+func NewTimedCollector(opts HistogramOpts, c Collector) *TimedCollector {
+	return &TimedCollector{
+		collector: c,
+		durations: NewHistogramVec(opts, []string{downstreamLabel}),
+	}
+}
+
+// Time returns a new Timer to time the sub-operation with the provided name,
+// which is used as the value of the "downstream" label. Call ObserveDuration on
+// the returned Timer once the sub-operation has finished.
+func (tc *TimedCollector) Time(downstream string) *Timer {
+	return NewTimer(tc.durations.WithLabelValues(downstream))
+}
+
+// Describe implements Collector.
+func (tc *TimedCollector) Describe(ch chan<- *Desc) {
+	tc.collector.Describe(ch)
+	tc.durations.Describe(ch)
+}
+
+// Collect implements Collector. It collects the wrapped Collector first so that
+// the durations observed while doing so are already included in the same
+// collection.
+func (tc *TimedCollector) Collect(ch chan<- Metric) {
+	tc.collector.Collect(ch)
+	tc.durations.Collect(ch)
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus_test
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// downstreamCollector is a Collector that has to query two downstream systems
+// to collect its metrics.
+type downstreamCollector struct {
+	timed   *prometheus.TimedCollector
+	upDesc  *prometheus.Desc
+	queries int
+}
+
+func (c *downstreamCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.upDesc
+}
+
+func (c *downstreamCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, downstream := range []string{"database", "cache"} {
+		timer := c.timed.Time(downstream)
+		// Query the downstream here...
+		c.queries++
+		timer.ObserveDuration()
+		ch <- prometheus.MustNewConstMetric(
+			c.upDesc, prometheus.GaugeValue, 1, downstream,
+		)
+	}
+}
+
+func ExampleTimedCollector() {
+	dc := &downstreamCollector{
+		upDesc: prometheus.NewDesc(
+			"downstream_up",
+			"Whether the downstream could be queried.",
+			[]string{"downstream"}, nil,
+		),
+	}
+	dc.timed = prometheus.NewTimedCollector(
+		prometheus.HistogramOpts{
+			Name: "downstream_query_duration_seconds",
+			Help: "Duration of queries to downstreams during collection.",
+		},
+		dc,
+	)
+	// Only the TimedCollector is registered.
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(dc.timed)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, mf := range mfs {
+		fmt.Println(mf.GetName())
+		for _, m := range mf.GetMetric() {
+			if h := m.GetHistogram(); h != nil {
+				fmt.Println(" ", m.GetLabel()[0].GetValue(), h.GetSampleCount())
+			}
+		}
+	}
+	// Output:
+	// downstream_query_duration_seconds
+	//   cache 1
+	//   database 1
+	// downstream_up
+}
@@ -20,6 +20,7 @@ import "time"
 type Timer struct {
 	begin    time.Time
 	observer Observer
+	clock    Clock
 }
 
 // NewTimer creates a new Timer. The provided Observer is used to observe a
@@ -31,9 +32,17 @@ type Timer struct {
 //        // Do actual work.
 //    }
 func NewTimer(o Observer) *Timer {
+	return NewTimerWithClock(o, DefaultClock())
+}
+
+// NewTimerWithClock works like NewTimer, but the Timer uses the provided Clock
+// (rather than the DefaultClock) to tell the start and end time of the timed
+// duration. This is mostly useful in tests.
+func NewTimerWithClock(o Observer, c Clock) *Timer {
 	return &Timer{
-		begin:    time.Now(),
+		begin:    c.Now(),
 		observer: o,
+		clock:    c,
 	}
 }
 
@@ -46,6 +55,52 @@ func NewTimer(o Observer) *Timer {
 // if used with Go1.9+.
 func (t *Timer) ObserveDuration() {
 	if t.observer != nil {
-		t.observer.Observe(time.Since(t.begin).Seconds())
+		t.observer.Observe(t.clock.Now().Sub(t.begin).Seconds())
+	}
+}
+
+// RecordOutcome observes the duration passed since start (in seconds) with the
+// provided Observer and increments the provided Counter. It is meant for the
+// common pattern of tracking both the latency and the number of completed
+// operations from a single call site, usually with a defer statement:
+//    func HandleRequest() {
+//        defer RecordOutcome(requestDuration, requestsTotal, DefaultClock().Now())
+//        // Do actual work.
+//    }
+// As the end of the duration is told by the DefaultClock, start must be told by
+// the DefaultClock, too (see SetDefaultClock).
+// Note that the two updates happen one after the other. A concurrent scrape
+// might therefore see the observation but not yet the increment (or vice
+// versa). Either of the Observer or the Counter may be nil, in which case it is
+// simply skipped.
+//
+// Note that this function is only guaranteed to never observe negative
+// durations if used with Go1.9+.
+func RecordOutcome(o Observer, c Counter, start time.Time) {
+	if o != nil {
+		o.Observe(DefaultClock().Now().Sub(start).Seconds())
+	}
+	if c != nil {
+		c.Inc()
+	}
+}
+
+// RecordOutcomeWithLabelValues works like RecordOutcome, but it retrieves the
+// Observer and the Counter from the provided ObserverVec and CounterVec with
+// the provided label values (e.g. the status code of a request). Both vectors
+// must be partitioned by the same label names in the same order. The function
+// panics if the label values are inconsistent with either vector (as
+// WithLabelValues would).
+func RecordOutcomeWithLabelValues(ov ObserverVec, cv *CounterVec, start time.Time, lvs ...string) {
+	var (
+		o Observer
+		c Counter
+	)
+	if ov != nil {
+		o = ov.WithLabelValues(lvs...)
+	}
+	if cv != nil {
+		c = cv.WithLabelValues(lvs...)
 	}
+	RecordOutcome(o, c, start)
 }
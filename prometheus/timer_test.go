@@ -15,6 +15,7 @@ package prometheus
 
 import (
 	"testing"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
 )
@@ -150,3 +151,70 @@ func TestTimerByOutcome(t *testing.T) {
 	}
 
 }
+
+func TestRecordOutcome(t *testing.T) {
+	var (
+		his = NewHistogram(HistogramOpts{Name: "test_histogram"})
+		cnt = NewCounter(CounterOpts{Name: "test_counter"})
+		m   = &dto.Metric{}
+	)
+
+	func() {
+		defer RecordOutcome(his, cnt, DefaultClock().Now())
+	}()
+	RecordOutcome(nil, cnt, DefaultClock().Now())
+	RecordOutcome(his, nil, DefaultClock().Now())
+
+	his.Write(m)
+	if want, got := uint64(2), m.GetHistogram().GetSampleCount(); want != got {
+		t.Errorf("want %d observations for histogram, got %d", want, got)
+	}
+	m.Reset()
+	cnt.Write(m)
+	if want, got := 2., m.GetCounter().GetValue(); want != got {
+		t.Errorf("want %f for counter, got %f", want, got)
+	}
+}
+
+func TestRecordOutcomeWithLabelValues(t *testing.T) {
+	var (
+		his = NewHistogramVec(HistogramOpts{Name: "test_histogram"}, []string{"code"})
+		cnt = NewCounterVec(CounterOpts{Name: "test_counter"}, []string{"code"})
+		m   = &dto.Metric{}
+	)
+
+	RecordOutcomeWithLabelValues(his, cnt, DefaultClock().Now(), "200")
+	RecordOutcomeWithLabelValues(his, cnt, time.Now(), "500")
+	RecordOutcomeWithLabelValues(his, cnt, time.Now(), "500")
+
+	his.WithLabelValues("500").(Histogram).Write(m)
+	if want, got := uint64(2), m.GetHistogram().GetSampleCount(); want != got {
+		t.Errorf("want %d observations for histogram, got %d", want, got)
+	}
+	m.Reset()
+	cnt.WithLabelValues("200").Write(m)
+	if want, got := 1., m.GetCounter().GetValue(); want != got {
+		t.Errorf("want %f for counter, got %f", want, got)
+	}
+}
+
+func TestTimerWithClock(t *testing.T) {
+	var (
+		his   = NewHistogram(HistogramOpts{Name: "test_histogram"})
+		start = time.Unix(1000, 0)
+		times = []time.Time{start, start.Add(1500 * time.Millisecond)}
+		clock = ClockFunc(func() time.Time {
+			now := times[0]
+			times = times[1:]
+			return now
+		})
+		m = &dto.Metric{}
+	)
+
+	NewTimerWithClock(his, clock).ObserveDuration()
+
+	his.Write(m)
+	if want, got := 1.5, m.GetHistogram().GetSampleSum(); want != got {
+		t.Errorf("want observed duration %f, got %f", want, got)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ValidationScheme determines which metric and label names are considered
+// valid.
+type ValidationScheme int
+
+const (
+	// LegacyValidation only accepts metric names matching
+	// [a-zA-Z_:][a-zA-Z0-9_:]* and label names matching
+	// [a-zA-Z_][a-zA-Z0-9_]*.
+	LegacyValidation ValidationScheme = iota
+	// UTF8Validation accepts any non-empty metric or label name that is
+	// valid UTF-8, e.g. names containing dots or dashes as common in
+	// other monitoring systems. Such names cannot be represented in the
+	// exposition formats as understood by older scrapers. Use an
+	// EscapingScheme (see EscapeName and the NameEscaping field of
+	// promhttp.HandlerOpts) to expose them to those.
+	UTF8Validation
+)
+
+// NameValidationScheme is the ValidationScheme used by NewDesc (and thereby by
+// all constructors of metrics and metric vectors in this package) to validate
+// metric and label names. Names starting with "__" are reserved as label names
+// in either case. NameValidationScheme is meant to be set once during program
+// initialization, before any Descs are created. Changing it later leads to
+// inconsistent validation.
+var NameValidationScheme = LegacyValidation
+
+// isValidMetricName returns whether the provided metric name is valid under
+// the current NameValidationScheme.
+func isValidMetricName(name string) bool {
+	if NameValidationScheme == UTF8Validation {
+		return name != "" && utf8.ValidString(name)
+	}
+	return isValidLegacyName(name, isLegacyMetricNameRune)
+}
+
+// isValidLabelName returns whether the provided label name is valid under the
+// current NameValidationScheme. Reserved label names are not rejected here.
+func isValidLabelName(name string) bool {
+	if NameValidationScheme == UTF8Validation {
+		return name != "" && utf8.ValidString(name)
+	}
+	return isValidLegacyName(name, isLegacyLabelNameRune)
+}
+
+func isValidLegacyName(name string, validRune func(r rune, i int) bool) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !validRune(r, i) {
+			return false
+		}
+	}
+	return true
+}
+
+func isLegacyMetricNameRune(r rune, i int) bool {
+	return r == ':' || isLegacyLabelNameRune(r, i)
+}
+
+func isLegacyLabelNameRune(r rune, i int) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' ||
+		(r >= '0' && r <= '9' && i > 0)
+}
+
+// EscapingScheme determines how metric and label names that are not valid
+// under LegacyValidation are converted into names that are.
+type EscapingScheme int
+
+const (
+	// NoEscaping leaves all names unchanged.
+	NoEscaping EscapingScheme = iota
+	// UnderscoreEscaping replaces each invalid character by an underscore,
+	// e.g. "http.server-duration" becomes "http_server_duration". This is
+	// lossy, i.e. different names might be escaped to the same name.
+	UnderscoreEscaping
+	// DotsEscaping replaces each dot by "_dot_", each underscore by "__",
+	// and each other invalid character by "__", e.g. "http.server_duration"
+	// becomes "http_dot_server__duration". This keeps dots recoverable.
+	DotsEscaping
+	// ValueEncodingEscaping prefixes the name with "U__", replaces each
+	// underscore by "__", and each invalid character by its Unicode code
+	// point in hex, surrounded by underscores, e.g. "http.server" becomes
+	// "U__http_2e_server". This is lossless. Names that are already valid
+	// are left unchanged.
+	ValueEncodingEscaping
+)
+
+// EscapeName escapes the provided metric name with the provided
+// EscapingScheme. Names that are valid under LegacyValidation are returned
+// unchanged by all schemes.
+func EscapeName(name string, scheme EscapingScheme) string {
+	return escapeName(name, scheme, isLegacyMetricNameRune)
+}
+
+// escapeLabelName works like EscapeName but for label names, which must not
+// contain colons under LegacyValidation.
+func escapeLabelName(name string, scheme EscapingScheme) string {
+	return escapeName(name, scheme, isLegacyLabelNameRune)
+}
+
+func escapeName(name string, scheme EscapingScheme, validRune func(r rune, i int) bool) string {
+	if scheme == NoEscaping || name == "" || isValidLegacyName(name, validRune) {
+		return name
+	}
+	var buf bytes.Buffer
+	switch scheme {
+	case UnderscoreEscaping:
+		for i, r := range name {
+			if validRune(r, i) {
+				buf.WriteRune(r)
+			} else {
+				buf.WriteByte('_')
+			}
+		}
+	case DotsEscaping:
+		for i, r := range name {
+			switch {
+			case r == '_':
+				buf.WriteString("__")
+			case r == '.':
+				buf.WriteString("_dot_")
+			case validRune(r, i):
+				buf.WriteRune(r)
+			default:
+				buf.WriteString("__")
+			}
+		}
+	case ValueEncodingEscaping:
+		buf.WriteString("U__")
+		for i, r := range name {
+			switch {
+			case r == '_':
+				buf.WriteString("__")
+			case r == utf8.RuneError:
+				buf.WriteString("_FFFD_")
+			case validRune(r, i):
+				buf.WriteRune(r)
+			default:
+				fmt.Fprintf(&buf, "_%x_", r)
+			}
+		}
+	default:
+		panic(fmt.Errorf("unknown escaping scheme %d", scheme))
+	}
+	return buf.String()
+}
+
+// EscapeMetricFamily returns the provided MetricFamily with its name and the
+// names of all labels escaped with the provided EscapingScheme. If nothing
+// needs to be escaped, the MetricFamily itself is returned. Otherwise, a copy
+// is returned, and the provided MetricFamily is left unchanged.
+func EscapeMetricFamily(mf *dto.MetricFamily, scheme EscapingScheme) *dto.MetricFamily {
+	if scheme == NoEscaping || !needsEscaping(mf) {
+		return mf
+	}
+	escaped := &dto.MetricFamily{
+		Name:   proto.String(EscapeName(mf.GetName(), scheme)),
+		Help:   mf.Help,
+		Type:   mf.Type,
+		Metric: make([]*dto.Metric, 0, len(mf.Metric)),
+	}
+	for _, m := range mf.Metric {
+		em := *m
+		em.Label = make([]*dto.LabelPair, 0, len(m.Label))
+		for _, lp := range m.Label {
+			em.Label = append(em.Label, &dto.LabelPair{
+				Name:  proto.String(escapeLabelName(lp.GetName(), scheme)),
+				Value: lp.Value,
+			})
+		}
+		escaped.Metric = append(escaped.Metric, &em)
+	}
+	return escaped
+}
+
+// needsEscaping returns whether the name or any label name of the provided
+// MetricFamily is not valid under LegacyValidation.
+func needsEscaping(mf *dto.MetricFamily) bool {
+	if !isValidLegacyName(mf.GetName(), isLegacyMetricNameRune) {
+		return true
+	}
+	for _, m := range mf.Metric {
+		for _, lp := range m.Label {
+			if !isValidLegacyName(lp.GetName(), isLegacyLabelNameRune) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestNameValidationScheme(t *testing.T) {
+	defer func(s ValidationScheme) { NameValidationScheme = s }(NameValidationScheme)
+
+	scenarios := []struct {
+		fqName      string
+		labelName   string
+		legacyValid bool
+		utf8Valid   bool
+	}{
+		{"http_requests_total", "method", true, true},
+		{"http:requests", "method", true, true},
+		{"http.server.duration", "method", false, true},
+		{"http_requests_total", "http.method", false, true},
+		{"http_requests_total", "a:b", false, true},
+		{"1st", "method", false, true},
+		{"http_requests_total", "__reserved", false, false},
+		{"invalid\xff", "method", false, false},
+	}
+	for i, s := range scenarios {
+		NameValidationScheme = LegacyValidation
+		if err := NewDesc(s.fqName, "help", []string{s.labelName}, nil).Err(); (err == nil) != s.legacyValid {
+			t.Errorf("%d. legacy validation: got error %v, want valid %t", i, err, s.legacyValid)
+		}
+		NameValidationScheme = UTF8Validation
+		if err := NewDesc(s.fqName, "help", []string{s.labelName}, nil).Err(); (err == nil) != s.utf8Valid {
+			t.Errorf("%d. UTF-8 validation: got error %v, want valid %t", i, err, s.utf8Valid)
+		}
+	}
+}
+
+func TestEscapeName(t *testing.T) {
+	scenarios := []struct {
+		name                                    string
+		underscores, dots, valueEncoding, label string
+	}{
+		{
+			name:          "http_requests_total",
+			underscores:   "http_requests_total",
+			dots:          "http_requests_total",
+			valueEncoding: "http_requests_total",
+			label:         "http_requests_total",
+		},
+		{
+			name:          "http.server_duration",
+			underscores:   "http_server_duration",
+			dots:          "http_dot_server__duration",
+			valueEncoding: "U__http_2e_server__duration",
+			label:         "http_server_duration",
+		},
+		{
+			name:          "a:b-c",
+			underscores:   "a:b_c",
+			dots:          "a:b__c",
+			valueEncoding: "U__a:b_2d_c",
+			label:         "a_b_c",
+		},
+		{
+			name:          "0ä",
+			underscores:   "__",
+			dots:          "____",
+			valueEncoding: "U___30__e4_",
+			label:         "__",
+		},
+	}
+	for i, s := range scenarios {
+		if got := EscapeName(s.name, NoEscaping); got != s.name {
+			t.Errorf("%d. no escaping: got %q, want %q", i, got, s.name)
+		}
+		if got := EscapeName(s.name, UnderscoreEscaping); got != s.underscores {
+			t.Errorf("%d. underscore escaping: got %q, want %q", i, got, s.underscores)
+		}
+		if got := EscapeName(s.name, DotsEscaping); got != s.dots {
+			t.Errorf("%d. dots escaping: got %q, want %q", i, got, s.dots)
+		}
+		if got := EscapeName(s.name, ValueEncodingEscaping); got != s.valueEncoding {
+			t.Errorf("%d. value encoding escaping: got %q, want %q", i, got, s.valueEncoding)
+		}
+		if got := escapeLabelName(s.name, UnderscoreEscaping); got != s.label {
+			t.Errorf("%d. label underscore escaping: got %q, want %q", i, got, s.label)
+		}
+	}
+}
+
+func TestEscapeMetricFamily(t *testing.T) {
+	mf := &dto.MetricFamily{
+		Name: proto.String("http.requests"),
+		Help: proto.String("help"),
+		Type: dto.MetricType_COUNTER.Enum(),
+		Metric: []*dto.Metric{{
+			Label:   []*dto.LabelPair{{Name: proto.String("http.method"), Value: proto.String("GET")}},
+			Counter: &dto.Counter{Value: proto.Float64(1)},
+		}},
+	}
+	escaped := EscapeMetricFamily(mf, UnderscoreEscaping)
+	if got, want := escaped.GetName(), "http_requests"; got != want {
+		t.Errorf("got name %q, want %q", got, want)
+	}
+	if got, want := escaped.Metric[0].Label[0].GetName(), "http_method"; got != want {
+		t.Errorf("got label name %q, want %q", got, want)
+	}
+	if got, want := escaped.Metric[0].Counter.GetValue(), 1.0; got != want {
+		t.Errorf("got value %v, want %v", got, want)
+	}
+	if got, want := mf.GetName(), "http.requests"; got != want {
+		t.Errorf("original name was modified to %q", got)
+	}
+	if got, want := mf.Metric[0].Label[0].GetName(), "http.method"; got != want {
+		t.Errorf("original label name was modified to %q", got)
+	}
+
+	valid := &dto.MetricFamily{Name: proto.String("valid")}
+	if EscapeMetricFamily(valid, UnderscoreEscaping) != valid {
+		t.Error("expected MetricFamily with valid names to be returned unchanged")
+	}
+}
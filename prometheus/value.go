@@ -14,11 +14,11 @@
 package prometheus
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sort"
 	"sync/atomic"
-	"time"
 
 	dto "github.com/prometheus/client_model/go"
 
@@ -79,7 +79,29 @@ func (v *value) Set(val float64) {
 }
 
 func (v *value) SetToCurrentTime() {
-	v.Set(float64(time.Now().UnixNano()) / 1e9)
+	v.Set(float64(DefaultClock().Now().UnixNano()) / 1e9)
+}
+
+func (v *value) SetMax(val float64) {
+	v.setIf(val, func(old float64) bool { return val > old })
+}
+
+func (v *value) SetMin(val float64) {
+	v.setIf(val, func(old float64) bool { return val < old })
+}
+
+// setIf sets v to val if cond returns true for the current value.
+func (v *value) setIf(val float64, cond func(old float64) bool) {
+	newBits := math.Float64bits(val)
+	for {
+		oldBits := atomic.LoadUint64(&v.valBits)
+		if !cond(math.Float64frombits(oldBits)) {
+			return
+		}
+		if atomic.CompareAndSwapUint64(&v.valBits, oldBits, newBits) {
+			return
+		}
+	}
 }
 
 func (v *value) Inc() {
@@ -148,6 +170,64 @@ func (v *valueFunc) Write(out *dto.Metric) error {
 	return populateMetric(v.valType, v.function(), v.labelPairs, out)
 }
 
+// contextValueFunc is like valueFunc, but its function receives a Context and
+// may return an error. It implements ContextCollector. This is a low-level
+// building block used by the library to back the implementations of
+// NewCounterFuncWithContext and NewGaugeFuncWithContext.
+type contextValueFunc struct {
+	selfCollector
+
+	desc       *Desc
+	valType    ValueType
+	function   func(context.Context) (float64, error)
+	labelPairs []*dto.LabelPair
+}
+
+// newContextValueFunc returns a newly allocated contextValueFunc with the given
+// Desc and ValueType. The value reported is determined by calling the given
+// function from within the CollectWithContext method (or from within the Write
+// method with context.Background() if the contextValueFunc is not collected as
+// a ContextCollector).
+func newContextValueFunc(desc *Desc, valueType ValueType, function func(context.Context) (float64, error)) *contextValueFunc {
+	result := &contextValueFunc{
+		desc:       desc,
+		valType:    valueType,
+		function:   function,
+		labelPairs: makeLabelPairs(desc, nil),
+	}
+	result.init(result)
+	return result
+}
+
+func (v *contextValueFunc) Desc() *Desc {
+	return v.desc
+}
+
+func (v *contextValueFunc) Write(out *dto.Metric) error {
+	val, err := v.function(context.Background())
+	if err != nil {
+		return err
+	}
+	return populateMetric(v.valType, val, v.labelPairs, out)
+}
+
+// CollectWithContext implements ContextCollector. It calls the function right
+// away and sends the result as a constant Metric or, in case of an error, as an
+// invalid Metric (see NewInvalidMetric).
+func (v *contextValueFunc) CollectWithContext(ctx context.Context, ch chan<- Metric) {
+	val, err := v.function(ctx)
+	if err != nil {
+		ch <- NewInvalidMetric(v.desc, err)
+		return
+	}
+	ch <- &constMetric{
+		desc:       v.desc,
+		valType:    v.valType,
+		val:        val,
+		labelPairs: v.labelPairs,
+	}
+}
+
 // NewConstMetric returns a metric with one fixed value that cannot be
 // changed. Users of this package will not have much use for it in regular
 // operations. However, when implementing custom Collectors, it is useful as a
@@ -14,8 +14,10 @@
 package prometheus
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/prometheus/common/model"
 )
@@ -26,23 +28,97 @@ import (
 // a given metric type, like GaugeVec, CounterVec, SummaryVec, HistogramVec, and
 // UntypedVec.
 type metricVec struct {
-	mtx      sync.RWMutex // Protects the children.
+	*metricMap
+
+	curry []curriedLabelValue
+
+	// hashAdd and hashAddByte can be replaced for testing collision handling.
+	hashAdd     func(h uint64, s string) uint64
+	hashAddByte func(h uint64, b byte) uint64
+}
+
+// metricMap holds the metrics of a metricVec. It is shared between a metricVec
+// and all metricVecs curried from it.
+type metricMap struct {
+	// accessCount is used to track the access order of the children for
+	// LabelSetOverflowEvict. It is the first field to guarantee 64-bit
+	// alignment for atomic access on 32-bit platforms.
+	accessCount uint64
+
+	mtx      sync.RWMutex // Protects the children and size.
 	children map[uint64][]metricWithLabelValues
+	size     int // Number of children.
 	desc     *Desc
 
-	newMetric   func(labelValues ...string) Metric
-	hashAdd     func(h uint64, s string) uint64 // replace hash function for testing collision handling
-	hashAddByte func(h uint64, b byte) uint64
+	newMetric func(labelValues ...string) Metric
+
+	// labelConstraints is indexed like the variable labels of desc. It is
+	// nil if there are no constraints at all, and it contains nil for each
+	// unconstrained label otherwise.
+	labelConstraints []LabelConstraint
+
+	maxLabelSets    int
+	overflow        LabelSetOverflowPolicy
+	overflowCounter Counter
+
+	labelSetTTL    time.Duration
+	expiredCounter Counter
+	clock          Clock
+}
+
+// curriedLabelValue is a label value bound by currying, together with the
+// index of its label in the variable labels of the Desc.
+type curriedLabelValue struct {
+	index int
+	value string
 }
 
-// newMetricVec returns an initialized metricVec.
-func newMetricVec(desc *Desc, newMetric func(lvs ...string) Metric) *metricVec {
+// vecOpts bundles the options of the various XXXOpts types that only apply to
+// metric vectors.
+type vecOpts struct {
+	labelConstraints map[string]LabelConstraint
+	maxLabelSets     int
+	overflow         LabelSetOverflowPolicy
+	overflowCounter  Counter
+	labelSetTTL      time.Duration
+	expiredCounter   Counter
+}
+
+// newMetricVec returns an initialized metricVec. Constraints for labels that
+// are not variable labels of desc are recorded as an error in desc.
+func newMetricVec(desc *Desc, opts vecOpts, newMetric func(lvs ...string) Metric) *metricVec {
+	var (
+		labelConstraints []LabelConstraint
+		constraints      = opts.labelConstraints
+	)
+	if len(constraints) > 0 {
+		labelConstraints = make([]LabelConstraint, len(desc.variableLabels))
+		found := 0
+		for i, name := range desc.variableLabels {
+			if c, ok := constraints[name]; ok {
+				labelConstraints[i] = c
+				found++
+			}
+		}
+		if found < len(constraints) && desc.err == nil {
+			desc.err = fmt.Errorf("%d label constraint(s) for unknown label(s)", len(constraints)-found)
+		}
+	}
 	return &metricVec{
-		children:    map[uint64][]metricWithLabelValues{},
-		desc:        desc,
-		newMetric:   newMetric,
-		hashAdd:     hashAdd,
-		hashAddByte: hashAddByte,
+		metricMap: &metricMap{
+			children:         map[uint64][]metricWithLabelValues{},
+			desc:             desc,
+			newMetric:        newMetric,
+			labelConstraints: labelConstraints,
+			maxLabelSets:     opts.maxLabelSets,
+			overflow:         opts.overflow,
+			overflowCounter:  opts.overflowCounter,
+			labelSetTTL:      opts.labelSetTTL,
+			expiredCounter:   opts.expiredCounter,
+			clock:            DefaultClock(),
+		},
+		hashAdd:     labelHashAdd,
+		hashAddByte: labelHashAddByte,
 	}
 }
 
@@ -51,16 +127,22 @@ func newMetricVec(desc *Desc, newMetric func(lvs ...string) Metric) *metricVec {
 type metricWithLabelValues struct {
 	values []string
 	metric Metric
+	// lastAccess is only set with LabelSetOverflowEvict or a LabelSetTTL.
+	lastAccess *uint64
 }
 
 // Describe implements Collector. The length of the returned slice
 // is always one.
-func (m *metricVec) Describe(ch chan<- *Desc) {
+func (m *metricMap) Describe(ch chan<- *Desc) {
 	ch <- m.desc
 }
 
 // Collect implements Collector.
-func (m *metricVec) Collect(ch chan<- Metric) {
+func (m *metricMap) Collect(ch chan<- Metric) {
+	if m.labelSetTTL > 0 {
+		m.expire()
+	}
+
 	m.mtx.RLock()
 	defer m.mtx.RUnlock()
 
@@ -71,7 +153,48 @@ func (m *metricVec) Collect(ch chan<- Metric) {
 	}
 }
 
+// curryWith returns a metricVec sharing the metrics of m with the provided
+// labels curried in addition to the labels already curried in m.
+func (m *metricVec) curryWith(labels Labels) (*metricVec, error) {
+	labels = m.constrainLabels(labels)
+
+	var (
+		newCurry []curriedLabelValue
+		oldCurry = m.curry
+		iCurry   int
+	)
+	for i, label := range m.desc.variableLabels {
+		val, ok := labels[label]
+		if iCurry < len(oldCurry) && oldCurry[iCurry].index == i {
+			if ok {
+				return nil, fmt.Errorf("label name %q is already curried", label)
+			}
+			newCurry = append(newCurry, oldCurry[iCurry])
+			iCurry++
+		} else {
+			if !ok {
+				continue // Label stays uncurried.
+			}
+			newCurry = append(newCurry, curriedLabelValue{i, val})
+		}
+	}
+	if l := len(oldCurry) + len(labels) - len(newCurry); l > 0 {
+		return nil, fmt.Errorf("%d unknown label(s) found during currying", l)
+	}
+	if err := validateValuesInLabels(labels, len(labels)); err != nil {
+		return nil, err
+	}
+
+	return &metricVec{
+		metricMap:   m.metricMap,
+		curry:       newCurry,
+		hashAdd:     m.hashAdd,
+		hashAddByte: m.hashAddByte,
+	}, nil
+}
+
 func (m *metricVec) getMetricWithLabelValues(lvs ...string) (Metric, error) {
+	lvs = m.constrainLabelValues(lvs)
 	h, err := m.hashLabelValues(lvs)
 	if err != nil {
 		return nil, err
@@ -81,6 +204,7 @@ func (m *metricVec) getMetricWithLabelValues(lvs ...string) (Metric, error) {
 }
 
 func (m *metricVec) getMetricWith(labels Labels) (Metric, error) {
+	labels = m.constrainLabels(labels)
 	h, err := m.hashLabels(labels)
 	if err != nil {
 		return nil, err
@@ -105,6 +229,77 @@ func (m *metricVec) with(labels Labels) Metric {
 	return metric
 }
 
+// PreparedLabelValues is a handle for a combination of label values of a metric
+// vector. Create it with the PrepareLabelValues method of the vector and use it
+// with the WithPreparedLabelValues method of the same vector (or of a vector
+// curried from the same vector).
+type PreparedLabelValues struct {
+	metricMap *metricMap
+	hash      uint64
+	lvs       []string // Including the curried label values.
+}
+
+// PrepareLabelValues validates, constrains, and hashes the provided label
+// values (same order as the VariableLabels in Desc, without the curried labels)
+// once and returns a handle for them. The handle retrieves the corresponding
+// metric via WithPreparedLabelValues without validating and hashing the label
+// values again. In contrast to keeping the retrieved metric itself, the handle
+// always retrieves the metric currently contained in the vector, i.e. it keeps
+// working after the metric has been deleted (by Reset, Delete, or because of
+// MaxLabelSets or LabelSetTTL). This makes the handle suitable to be stored
+// once (e.g. per request route) for use in per-request code.
+//
+// An error is returned if the number of label values is not the same as the
+// number of VariableLabels in Desc (minus the number of curried labels).
+func (m *metricVec) PrepareLabelValues(lvs ...string) (PreparedLabelValues, error) {
+	lvs = m.constrainLabelValues(lvs)
+	h, err := m.hashLabelValues(lvs)
+	if err != nil {
+		return PreparedLabelValues{}, err
+	}
+	return PreparedLabelValues{
+		metricMap: m.metricMap,
+		hash:      h,
+		lvs:       m.inlineLabelValues(lvs),
+	}, nil
+}
+
+var errPreparedLabelValuesMismatch = errors.New("label values prepared for a different metric vector")
+
+func (m *metricVec) withPreparedLabelValues(p PreparedLabelValues) Metric {
+	if p.metricMap != m.metricMap {
+		panic(errPreparedLabelValuesMismatch)
+	}
+
+	m.mtx.RLock()
+	metric, ok := m.getMetricWithHashAndAllLabelValues(p.hash, p.lvs)
+	m.mtx.RUnlock()
+	if ok {
+		return metric
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	metric, ok = m.getMetricWithHashAndAllLabelValues(p.hash, p.lvs)
+	if !ok {
+		metric = m.newChild(p.hash, p.lvs)
+	}
+	return metric
+}
+
+// getMetricWithHashAndAllLabelValues works like getMetricWithHashAndLabelValues
+// but expects the label values to include the curried ones. Must be called
+// while holding the read mutex.
+func (m *metricVec) getMetricWithHashAndAllLabelValues(h uint64, lvs []string) (Metric, bool) {
+	for _, metric := range m.children[h] {
+		if stringSlicesEqual(metric.values, lvs) {
+			m.touch(metric)
+			return metric.metric, true
+		}
+	}
+	return nil, false
+}
+
 // DeleteLabelValues removes the metric where the variable labels are the same
 // as those passed in as labels (same order as the VariableLabels in Desc). It
 // returns true if a metric was deleted.
@@ -121,6 +316,8 @@ func (m *metricVec) with(labels Labels) Metric {
 // with a performance overhead (for creating and processing the Labels map).
 // See also the CounterVec example.
 func (m *metricVec) DeleteLabelValues(lvs ...string) bool {
+	lvs = m.constrainLabelValues(lvs)
+
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
@@ -142,6 +339,8 @@ func (m *metricVec) DeleteLabelValues(lvs ...string) bool {
 // This method is used for the same purpose as DeleteLabelValues(...string). See
 // there for pros and cons of the two methods.
 func (m *metricVec) Delete(labels Labels) bool {
+	labels = m.constrainLabels(labels)
+
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
@@ -153,6 +352,40 @@ func (m *metricVec) Delete(labels Labels) bool {
 	return m.deleteByHashWithLabels(h, labels)
 }
 
+// DeletePartialMatch deletes all metrics where the variable labels contain all
+// of those passed in as labels, e.g. all metrics of a departed tenant. The
+// order of the labels does not matter. It returns the number of metrics
+// deleted.
+//
+// Labels that are not among the VariableLabels in Desc never match, so the
+// method will always return 0 in that case. On a curried vector, only metrics
+// matching the curried label values are deleted.
+func (m *metricVec) DeletePartialMatch(labels Labels) int {
+	labels = m.constrainLabels(labels)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var numDeleted int
+	for h, metrics := range m.children {
+		kept := metrics[:0]
+		for _, metric := range metrics {
+			if m.matchPartialLabels(metric.values, labels) {
+				numDeleted++
+				continue
+			}
+			kept = append(kept, metric)
+		}
+		if len(kept) == 0 {
+			delete(m.children, h)
+		} else {
+			m.children[h] = kept
+		}
+	}
+	m.size -= numDeleted
+	return numDeleted
+}
+
 // deleteByHashWithLabelValues removes the metric from the hash bucket h. If
 // there are multiple matches in the bucket, use lvs to select a metric and
 // remove only that metric.
@@ -167,11 +400,7 @@ func (m *metricVec) deleteByHashWithLabelValues(h uint64, lvs []string) bool {
 		return false
 	}
 
-	if len(metrics) > 1 {
-		m.children[h] = append(metrics[:i], metrics[i+1:]...)
-	} else {
-		delete(m.children, h)
-	}
+	m.removeChild(h, i)
 	return true
 }
 
@@ -188,49 +417,85 @@ func (m *metricVec) deleteByHashWithLabels(h uint64, labels Labels) bool {
 		return false
 	}
 
-	if len(metrics) > 1 {
-		m.children[h] = append(metrics[:i], metrics[i+1:]...)
-	} else {
-		delete(m.children, h)
-	}
+	m.removeChild(h, i)
 	return true
 }
 
 // Reset deletes all metrics in this vector.
-func (m *metricVec) Reset() {
+func (m *metricMap) Reset() {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
 	for h := range m.children {
 		delete(m.children, h)
 	}
+	m.size = 0
+}
+
+// estimateMemory implements memoryEstimator.
+func (m *metricMap) estimateMemory() (string, MemoryEstimate) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	var est MemoryEstimate
+	for _, metrics := range m.children {
+		for _, metric := range metrics {
+			est.Series++
+			for _, v := range metric.values {
+				est.Bytes += len(v)
+			}
+		}
+	}
+	return m.desc.fqName, est
 }
 
 func (m *metricVec) hashLabelValues(vals []string) (uint64, error) {
-	if err := validateLabelValues(vals, len(m.desc.variableLabels)); err != nil {
+	if err := validateLabelValues(vals, len(m.desc.variableLabels)-len(m.curry)); err != nil {
 		return 0, err
 	}
 
-	h := hashNew()
-	for _, val := range vals {
-		h = m.hashAdd(h, val)
+	var (
+		h             = hashNew()
+		curry         = m.curry
+		iVals, iCurry int
+	)
+	for i := 0; i < len(m.desc.variableLabels); i++ {
+		if iCurry < len(curry) && curry[iCurry].index == i {
+			h = m.hashAdd(h, curry[iCurry].value)
+			iCurry++
+		} else {
+			h = m.hashAdd(h, vals[iVals])
+			iVals++
+		}
 		h = m.hashAddByte(h, model.SeparatorByte)
 	}
 	return h, nil
 }
 
 func (m *metricVec) hashLabels(labels Labels) (uint64, error) {
-	if err := validateValuesInLabels(labels, len(m.desc.variableLabels)); err != nil {
+	if err := validateValuesInLabels(labels, len(m.desc.variableLabels)-len(m.curry)); err != nil {
 		return 0, err
 	}
 
-	h := hashNew()
-	for _, label := range m.desc.variableLabels {
+	var (
+		h      = hashNew()
+		curry  = m.curry
+		iCurry int
+	)
+	for i, label := range m.desc.variableLabels {
 		val, ok := labels[label]
-		if !ok {
-			return 0, fmt.Errorf("label name %q missing in label map", label)
+		if iCurry < len(curry) && curry[iCurry].index == i {
+			if ok {
+				return 0, fmt.Errorf("label name %q is already curried", label)
+			}
+			h = m.hashAdd(h, curry[iCurry].value)
+			iCurry++
+		} else {
+			if !ok {
+				return 0, fmt.Errorf("label name %q missing in label map", label)
+			}
+			h = m.hashAdd(h, val)
 		}
-		h = m.hashAdd(h, val)
 		h = m.hashAddByte(h, model.SeparatorByte)
 	}
 	return h, nil
@@ -252,11 +517,9 @@ func (m *metricVec) getOrCreateMetricWithLabelValues(hash uint64, lvs []string)
 	defer m.mtx.Unlock()
 	metric, ok = m.getMetricWithHashAndLabelValues(hash, lvs)
 	if !ok {
-		// Copy to avoid allocation in case wo don't go down this code path.
-		copiedLVs := make([]string, len(lvs))
-		copy(copiedLVs, lvs)
-		metric = m.newMetric(copiedLVs...)
-		m.children[hash] = append(m.children[hash], metricWithLabelValues{values: copiedLVs, metric: metric})
+		// Inline the curried label values, which also copies lvs to
+		// avoid allocation in case we don't go down this code path.
+		metric = m.newChild(hash, m.inlineLabelValues(lvs))
 	}
 	return metric
 }
@@ -277,9 +540,7 @@ func (m *metricVec) getOrCreateMetricWithLabels(hash uint64, labels Labels) Metr
 	defer m.mtx.Unlock()
 	metric, ok = m.getMetricWithHashAndLabels(hash, labels)
 	if !ok {
-		lvs := m.extractLabelValues(labels)
-		metric = m.newMetric(lvs...)
-		m.children[hash] = append(m.children[hash], metricWithLabelValues{values: lvs, metric: metric})
+		metric = m.newChild(hash, m.extractLabelValues(labels))
 	}
 	return metric
 }
@@ -290,6 +551,7 @@ func (m *metricVec) getMetricWithHashAndLabelValues(h uint64, lvs []string) (Met
 	metrics, ok := m.children[h]
 	if ok {
 		if i := m.findMetricWithLabelValues(metrics, lvs); i < len(metrics) {
+			m.touch(metrics[i])
 			return metrics[i].metric, true
 		}
 	}
@@ -302,6 +564,7 @@ func (m *metricVec) getMetricWithHashAndLabels(h uint64, labels Labels) (Metric,
 	metrics, ok := m.children[h]
 	if ok {
 		if i := m.findMetricWithLabels(metrics, labels); i < len(metrics) {
+			m.touch(metrics[i])
 			return metrics[i].metric, true
 		}
 	}
@@ -331,22 +594,39 @@ func (m *metricVec) findMetricWithLabels(metrics []metricWithLabelValues, labels
 }
 
 func (m *metricVec) matchLabelValues(values []string, lvs []string) bool {
-	if len(values) != len(lvs) {
+	if len(values) != len(lvs)+len(m.curry) {
 		return false
 	}
+	var iLVs, iCurry int
 	for i, v := range values {
-		if v != lvs[i] {
+		if iCurry < len(m.curry) && m.curry[iCurry].index == i {
+			if v != m.curry[iCurry].value {
+				return false
+			}
+			iCurry++
+			continue
+		}
+		if v != lvs[iLVs] {
 			return false
 		}
+		iLVs++
 	}
 	return true
 }
 
 func (m *metricVec) matchLabels(values []string, labels Labels) bool {
-	if len(labels) != len(values) {
+	if len(values) != len(labels)+len(m.curry) {
 		return false
 	}
+	iCurry := 0
 	for i, k := range m.desc.variableLabels {
+		if iCurry < len(m.curry) && m.curry[iCurry].index == i {
+			if values[i] != m.curry[iCurry].value {
+				return false
+			}
+			iCurry++
+			continue
+		}
 		if values[i] != labels[k] {
 			return false
 		}
@@ -354,10 +634,106 @@ func (m *metricVec) matchLabels(values []string, labels Labels) bool {
 	return true
 }
 
+// matchPartialLabels returns whether the provided label values (which include
+// the curried ones) match the curried label values of m and all the provided
+// labels. Labels not among the variable labels never match.
+func (m *metricVec) matchPartialLabels(values []string, labels Labels) bool {
+	for _, c := range m.curry {
+		if values[c.index] != c.value {
+			return false
+		}
+	}
+	for name, val := range labels {
+		found := false
+		for i, k := range m.desc.variableLabels {
+			if k == name {
+				if values[i] != val {
+					return false
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 func (m *metricVec) extractLabelValues(labels Labels) []string {
-	labelValues := make([]string, len(labels))
+	labelValues := make([]string, len(labels)+len(m.curry))
+	iCurry := 0
 	for i, k := range m.desc.variableLabels {
+		if iCurry < len(m.curry) && m.curry[iCurry].index == i {
+			labelValues[i] = m.curry[iCurry].value
+			iCurry++
+			continue
+		}
 		labelValues[i] = labels[k]
 	}
 	return labelValues
 }
+
+// constrainLabelValues returns the provided label values (which exclude the
+// curried ones) with the label constraints applied. If there are no
+// constraints, lvs is returned as is.
+func (m *metricVec) constrainLabelValues(lvs []string) []string {
+	if m.labelConstraints == nil {
+		return lvs
+	}
+	constrained := make([]string, len(lvs))
+	copy(constrained, lvs)
+	var iLVs, iCurry int
+	for i, c := range m.labelConstraints {
+		if iCurry < len(m.curry) && m.curry[iCurry].index == i {
+			iCurry++
+			continue
+		}
+		if iLVs >= len(constrained) {
+			// Inconsistent cardinality, reported by the caller.
+			break
+		}
+		if c != nil {
+			constrained[iLVs] = c(constrained[iLVs])
+		}
+		iLVs++
+	}
+	return constrained
+}
+
+// constrainLabels returns the provided labels with the label constraints
+// applied. If there are no constraints, labels is returned as is.
+func (m *metricVec) constrainLabels(labels Labels) Labels {
+	if m.labelConstraints == nil {
+		return labels
+	}
+	constrained := make(Labels, len(labels))
+	for name, value := range labels {
+		constrained[name] = value
+	}
+	for i, name := range m.desc.variableLabels {
+		c := m.labelConstraints[i]
+		if value, ok := constrained[name]; ok && c != nil {
+			constrained[name] = c(value)
+		}
+	}
+	return constrained
+}
+
+// inlineLabelValues returns a new slice of label values with the curried label
+// values inserted at their positions between the provided label values.
+func (m *metricVec) inlineLabelValues(lvs []string) []string {
+	labelValues := make([]string, len(lvs)+len(m.curry))
+	var iLVs, iCurry int
+	for i := range labelValues {
+		if iCurry < len(m.curry) && m.curry[iCurry].index == i {
+			labelValues[i] = m.curry[iCurry].value
+			iCurry++
+			continue
+		}
+		labelValues[i] = lvs[iLVs]
+		iLVs++
+	}
+	return labelValues
+}
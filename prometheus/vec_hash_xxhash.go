@@ -0,0 +1,35 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build xxhash
+
+package prometheus
+
+import "github.com/cespare/xxhash"
+
+// labelHashAdd and labelHashAddByte are used by metricVec to hash label
+// values. With the "xxhash" build tag, every label value is hashed with
+// xxhash, which is considerably faster than fnv64a for long label values. The
+// result is then mixed into the running hash. Collisions are still resolved by
+// comparing the stored label values.
+var (
+	labelHashAdd     = xxhashAdd
+	labelHashAddByte = hashAddByte
+)
+
+// xxhashAdd mixes the xxhash of s into h, returning the updated hash.
+func xxhashAdd(h uint64, s string) uint64 {
+	h ^= xxhash.Sum64String(s)
+	h *= prime64
+	return h
+}
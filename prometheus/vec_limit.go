@@ -0,0 +1,238 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/common/model"
+)
+
+// LabelSetOverflowPolicy determines how a metric vector handles a new label set
+// once the number of its label sets has reached MaxLabelSets (see Opts).
+type LabelSetOverflowPolicy int
+
+// Possible values for LabelSetOverflowPolicy.
+const (
+	// LabelSetOverflowDrop makes the metric vector hand out a detached
+	// metric for a new label set. The detached metric can be used as
+	// usual, but it is not exported, so all changes to it are effectively
+	// dropped.
+	LabelSetOverflowDrop LabelSetOverflowPolicy = iota
+	// LabelSetOverflowEvict makes the metric vector delete the label set
+	// used least recently (i.e. retrieved via WithLabelValues and friends
+	// least recently) to make room for the new label set. Finding that
+	// label set requires a scan over all label sets of the vector.
+	LabelSetOverflowEvict
+	// LabelSetOverflowOther makes the metric vector hand out the metric of
+	// a dedicated overflow label set instead, where all variable labels
+	// have the value OverflowLabelValue. The overflow label set is created
+	// on demand and may exceed MaxLabelSets by one.
+	LabelSetOverflowOther
+)
+
+// OverflowLabelValue is the value of all variable labels of the label set that
+// overflowing label sets are funneled into with LabelSetOverflowOther.
+const OverflowLabelValue = "overflow"
+
+// newChild creates a new metric with the provided label values (which include
+// the curried ones) and adds it under the provided hash, honoring
+// MaxLabelSets. It returns the metric to hand out for the label values. Must
+// be called with the write lock held.
+func (m *metricVec) newChild(hash uint64, lvs []string) Metric {
+	metric := m.newMetric(lvs...)
+	if m.addChildWithinLimit(hash, lvs, metric) {
+		return metric
+	}
+	if m.overflow == LabelSetOverflowOther {
+		return m.overflowChild()
+	}
+	return metric
+}
+
+// addChildWithinLimit adds the provided metric with the provided label values
+// under the provided hash unless doing so would exceed MaxLabelSets even after
+// evicting another child (as far as allowed). It returns whether the metric has
+// been added. Must be called with the write lock held.
+func (m *metricMap) addChildWithinLimit(hash uint64, lvs []string, metric Metric) bool {
+	if m.maxLabelSets > 0 && m.size >= m.maxLabelSets {
+		if m.overflowCounter != nil {
+			m.overflowCounter.Inc()
+		}
+		if m.overflow != LabelSetOverflowEvict {
+			return false
+		}
+		m.evictLeastRecentlyUsed()
+	}
+	m.addChild(hash, lvs, metric)
+	return true
+}
+
+// addChild adds the provided metric with the provided label values under the
+// provided hash. Must be called with the write lock held.
+func (m *metricMap) addChild(hash uint64, lvs []string, metric Metric) {
+	child := metricWithLabelValues{values: lvs, metric: metric}
+	if m.overflow == LabelSetOverflowEvict || m.labelSetTTL > 0 {
+		child.lastAccess = new(uint64)
+		m.touch(child)
+	}
+	m.children[hash] = append(m.children[hash], child)
+	m.size++
+}
+
+// removeChild removes the child with index i from the hash bucket h. Must be
+// called with the write lock held.
+func (m *metricMap) removeChild(h uint64, i int) {
+	metrics := m.children[h]
+	if len(metrics) > 1 {
+		m.children[h] = append(metrics[:i], metrics[i+1:]...)
+	} else {
+		delete(m.children, h)
+	}
+	m.size--
+}
+
+// touch records an access to the provided child if access tracking is enabled.
+// With a LabelSetTTL, the access time is recorded (which also serves to
+// determine the access order). Otherwise, a counter is used to determine the
+// access order. Must be called with at least the read lock held.
+func (m *metricMap) touch(child metricWithLabelValues) {
+	if child.lastAccess == nil {
+		return
+	}
+	if m.labelSetTTL > 0 {
+		atomic.StoreUint64(child.lastAccess, uint64(m.clock.Now().UnixNano()))
+		return
+	}
+	atomic.StoreUint64(child.lastAccess, atomic.AddUint64(&m.accessCount, 1))
+}
+
+// expire removes all children not accessed within the LabelSetTTL.
+func (m *metricMap) expire() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var (
+		numExpired int
+		deadline   = uint64(m.clock.Now().Add(-m.labelSetTTL).UnixNano())
+	)
+	for h, metrics := range m.children {
+		kept := metrics[:0]
+		for _, metric := range metrics {
+			if atomic.LoadUint64(metric.lastAccess) <= deadline {
+				numExpired++
+				continue
+			}
+			kept = append(kept, metric)
+		}
+		if len(kept) == 0 {
+			delete(m.children, h)
+		} else {
+			m.children[h] = kept
+		}
+	}
+	m.size -= numExpired
+	if m.expiredCounter != nil && numExpired > 0 {
+		m.expiredCounter.Add(float64(numExpired))
+	}
+}
+
+// evictLeastRecentlyUsed removes the child accessed least recently. Must be
+// called with the write lock held.
+func (m *metricMap) evictLeastRecentlyUsed() {
+	var (
+		found       bool
+		oldest      uint64
+		oldestHash  uint64
+		oldestIndex int
+	)
+	for h, metrics := range m.children {
+		for i, metric := range metrics {
+			if metric.lastAccess == nil {
+				continue
+			}
+			if t := atomic.LoadUint64(metric.lastAccess); !found || t < oldest {
+				found, oldest, oldestHash, oldestIndex = true, t, h, i
+			}
+		}
+	}
+	if found {
+		m.removeChild(oldestHash, oldestIndex)
+	}
+}
+
+// overflowChild returns the metric of the overflow label set, creating it if
+// needed. Must be called with the write lock held.
+func (m *metricVec) overflowChild() Metric {
+	lvs := make([]string, len(m.desc.variableLabels))
+	h := hashNew()
+	for i := range lvs {
+		lvs[i] = OverflowLabelValue
+		h = m.hashAdd(h, OverflowLabelValue)
+		h = m.hashAddByte(h, model.SeparatorByte)
+	}
+	for _, metric := range m.children[h] {
+		if stringSlicesEqual(metric.values, lvs) {
+			return metric.metric
+		}
+	}
+	metric := m.newMetric(lvs...)
+	m.addChild(h, lvs, metric)
+	return metric
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (o Opts) vecOpts() vecOpts {
+	return vecOpts{
+		labelConstraints: o.LabelConstraints,
+		maxLabelSets:     o.MaxLabelSets,
+		overflow:         o.LabelSetOverflow,
+		overflowCounter:  o.LabelSetOverflowCounter,
+		labelSetTTL:      o.LabelSetTTL,
+		expiredCounter:   o.LabelSetExpiredCounter,
+	}
+}
+
+func (o HistogramOpts) vecOpts() vecOpts {
+	return vecOpts{
+		labelConstraints: o.LabelConstraints,
+		maxLabelSets:     o.MaxLabelSets,
+		overflow:         o.LabelSetOverflow,
+		overflowCounter:  o.LabelSetOverflowCounter,
+		labelSetTTL:      o.LabelSetTTL,
+		expiredCounter:   o.LabelSetExpiredCounter,
+	}
+}
+
+func (o SummaryOpts) vecOpts() vecOpts {
+	return vecOpts{
+		labelConstraints: o.LabelConstraints,
+		maxLabelSets:     o.MaxLabelSets,
+		overflow:         o.LabelSetOverflow,
+		overflowCounter:  o.LabelSetOverflowCounter,
+		labelSetTTL:      o.LabelSetTTL,
+		expiredCounter:   o.LabelSetExpiredCounter,
+	}
+}
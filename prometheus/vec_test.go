@@ -16,6 +16,7 @@ package prometheus
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
 )
@@ -239,6 +240,518 @@ func TestCounterVecEndToEndWithCollision(t *testing.T) {
 	}
 }
 
+func TestCurryVec(t *testing.T) {
+	vec := NewCounterVec(
+		CounterOpts{
+			Name: "test",
+			Help: "helpless",
+		},
+		[]string{"one", "two", "three"},
+	)
+	testCurryVec(t, vec)
+}
+
+func TestCurryVecWithCollisions(t *testing.T) {
+	vec := NewCounterVec(
+		CounterOpts{
+			Name: "test",
+			Help: "helpless",
+		},
+		[]string{"one", "two", "three"},
+	)
+	vec.hashAdd = func(h uint64, s string) uint64 { return 1 }
+	vec.hashAddByte = func(h uint64, b byte) uint64 { return 1 }
+	testCurryVec(t, vec)
+}
+
+func testCurryVec(t *testing.T, vec *CounterVec) {
+	assertMetrics := func(t *testing.T) {
+		n := 0
+		for _, m := range vec.children {
+			n += len(m)
+		}
+		if n != 2 {
+			t.Error("expected two metrics, got", n)
+		}
+		m := &dto.Metric{}
+		c1, err := vec.GetMetricWithLabelValues("1", "2", "3")
+		if err != nil {
+			t.Fatal("unexpected error getting metric:", err)
+		}
+		c1.Write(m)
+		if want, got := 1., m.GetCounter().GetValue(); want != got {
+			t.Errorf("want %f as counter value, got %f", want, got)
+		}
+		m.Reset()
+		c2, err := vec.GetMetricWithLabelValues("11", "22", "33")
+		if err != nil {
+			t.Fatal("unexpected error getting metric:", err)
+		}
+		c2.Write(m)
+		if want, got := 1., m.GetCounter().GetValue(); want != got {
+			t.Errorf("want %f as counter value, got %f", want, got)
+		}
+	}
+
+	assertNoMetric := func(t *testing.T) {
+		if n := len(vec.children); n != 0 {
+			t.Error("expected no metrics, got", n)
+		}
+	}
+
+	t.Run("zero labels", func(t *testing.T) {
+		c1 := vec.MustCurryWith(nil)
+		c2 := vec.MustCurryWith(nil)
+		c1.WithLabelValues("1", "2", "3").Inc()
+		c2.With(Labels{"one": "11", "two": "22", "three": "33"}).Inc()
+		assertMetrics(t)
+		if !c1.Delete(Labels{"one": "1", "two": "2", "three": "3"}) {
+			t.Error("deletion failed")
+		}
+		if !c2.DeleteLabelValues("11", "22", "33") {
+			t.Error("deletion failed")
+		}
+		assertNoMetric(t)
+	})
+	t.Run("first label", func(t *testing.T) {
+		c1 := vec.MustCurryWith(Labels{"one": "1"})
+		c2 := vec.MustCurryWith(Labels{"one": "11"})
+		c1.WithLabelValues("2", "3").Inc()
+		c2.With(Labels{"two": "22", "three": "33"}).Inc()
+		assertMetrics(t)
+		if c1.Delete(Labels{"two": "22", "three": "33"}) {
+			t.Error("deletion unexpectedly succeeded")
+		}
+		if c2.DeleteLabelValues("2", "3") {
+			t.Error("deletion unexpectedly succeeded")
+		}
+		if !c1.Delete(Labels{"two": "2", "three": "3"}) {
+			t.Error("deletion failed")
+		}
+		if !c2.DeleteLabelValues("22", "33") {
+			t.Error("deletion failed")
+		}
+		assertNoMetric(t)
+	})
+	t.Run("middle label", func(t *testing.T) {
+		c1 := vec.MustCurryWith(Labels{"two": "2"})
+		c2 := vec.MustCurryWith(Labels{"two": "22"})
+		c1.WithLabelValues("1", "3").Inc()
+		c2.With(Labels{"one": "11", "three": "33"}).Inc()
+		assertMetrics(t)
+		if !c1.Delete(Labels{"one": "1", "three": "3"}) {
+			t.Error("deletion failed")
+		}
+		if !c2.DeleteLabelValues("11", "33") {
+			t.Error("deletion failed")
+		}
+		assertNoMetric(t)
+	})
+	t.Run("last label", func(t *testing.T) {
+		c1 := vec.MustCurryWith(Labels{"three": "3"})
+		c2 := vec.MustCurryWith(Labels{"three": "33"})
+		c1.WithLabelValues("1", "2").Inc()
+		c2.With(Labels{"one": "11", "two": "22"}).Inc()
+		assertMetrics(t)
+		if !c1.Delete(Labels{"two": "2", "one": "1"}) {
+			t.Error("deletion failed")
+		}
+		if !c2.DeleteLabelValues("11", "22") {
+			t.Error("deletion failed")
+		}
+		assertNoMetric(t)
+	})
+	t.Run("two labels", func(t *testing.T) {
+		c1 := vec.MustCurryWith(Labels{"three": "3", "one": "1"})
+		c2 := vec.MustCurryWith(Labels{"three": "33", "one": "11"})
+		c1.WithLabelValues("2").Inc()
+		c2.With(Labels{"two": "22"}).Inc()
+		assertMetrics(t)
+		if !c1.Delete(Labels{"two": "2"}) {
+			t.Error("deletion failed")
+		}
+		if !c2.DeleteLabelValues("22") {
+			t.Error("deletion failed")
+		}
+		assertNoMetric(t)
+	})
+	t.Run("all labels", func(t *testing.T) {
+		c1 := vec.MustCurryWith(Labels{"three": "3", "two": "2", "one": "1"})
+		c2 := vec.MustCurryWith(Labels{"three": "33", "one": "11", "two": "22"})
+		c1.WithLabelValues().Inc()
+		c2.With(nil).Inc()
+		assertMetrics(t)
+		if !c1.Delete(Labels{}) {
+			t.Error("deletion failed")
+		}
+		if !c2.DeleteLabelValues() {
+			t.Error("deletion failed")
+		}
+		assertNoMetric(t)
+	})
+	t.Run("double curry", func(t *testing.T) {
+		c1 := vec.MustCurryWith(Labels{"three": "3"}).MustCurryWith(Labels{"one": "1"})
+		c2 := vec.MustCurryWith(Labels{"three": "33"}).MustCurryWith(Labels{"one": "11"})
+		c1.WithLabelValues("2").Inc()
+		c2.With(Labels{"two": "22"}).Inc()
+		assertMetrics(t)
+		if !c1.Delete(Labels{"two": "2"}) {
+			t.Error("deletion failed")
+		}
+		if !c2.DeleteLabelValues("22") {
+			t.Error("deletion failed")
+		}
+		assertNoMetric(t)
+	})
+	t.Run("use already curried label", func(t *testing.T) {
+		c1 := vec.MustCurryWith(Labels{"three": "3"})
+		if _, err := c1.GetMetricWithLabelValues("1", "2", "3"); err == nil {
+			t.Error("expected error when using already curried label")
+		}
+		if _, err := c1.GetMetricWith(Labels{"one": "1", "two": "2", "three": "3"}); err == nil {
+			t.Error("expected error when using already curried label")
+		}
+		assertNoMetric(t)
+		c1.WithLabelValues("1", "2").Inc()
+		if c1.Delete(Labels{"one": "1", "two": "2", "three": "3"}) {
+			t.Error("deletion unexpectedly succeeded")
+		}
+		if !c1.Delete(Labels{"one": "1", "two": "2"}) {
+			t.Error("deletion failed")
+		}
+		assertNoMetric(t)
+	})
+	t.Run("curry already curried label", func(t *testing.T) {
+		if _, err := vec.MustCurryWith(Labels{"three": "3"}).CurryWith(Labels{"three": "33"}); err == nil {
+			t.Error("currying unexpectedly succeeded")
+		} else if err.Error() != `label name "three" is already curried` {
+			t.Error("currying returned unexpected error:", err)
+		}
+	})
+	t.Run("unknown label", func(t *testing.T) {
+		if _, err := vec.CurryWith(Labels{"foo": "bar"}); err == nil {
+			t.Error("currying unexpectedly succeeded")
+		} else if err.Error() != "1 unknown label(s) found during currying" {
+			t.Error("currying returned unexpected error:", err)
+		}
+	})
+}
+
+func TestDeletePartialMatch(t *testing.T) {
+	vec := NewGaugeVec(
+		GaugeOpts{
+			Name: "test",
+			Help: "helpless",
+		},
+		[]string{"tenant", "code"},
+	)
+	vec.WithLabelValues("a", "200").Set(1)
+	vec.WithLabelValues("a", "500").Set(2)
+	vec.WithLabelValues("b", "200").Set(3)
+
+	if got, want := vec.DeletePartialMatch(Labels{"tenant": "c"}), 0; got != want {
+		t.Errorf("got %d deleted, want %d", got, want)
+	}
+	if got, want := vec.DeletePartialMatch(Labels{"unknown": "a"}), 0; got != want {
+		t.Errorf("got %d deleted, want %d", got, want)
+	}
+	if got, want := vec.DeletePartialMatch(Labels{"tenant": "a"}), 2; got != want {
+		t.Errorf("got %d deleted, want %d", got, want)
+	}
+	if got, want := len(vec.children), 1; got != want {
+		t.Errorf("got %d remaining children, want %d", got, want)
+	}
+
+	// A curried vector only deletes within its curried label values.
+	vec.WithLabelValues("a", "200").Set(1)
+	curried := vec.MustCurryWith(Labels{"tenant": "a"})
+	if got, want := curried.DeletePartialMatch(Labels{"code": "200"}), 1; got != want {
+		t.Errorf("got %d deleted, want %d", got, want)
+	}
+	if _, ok := vec.getMetricWithHashAndLabelValues(mustHash(t, vec, "b", "200"), []string{"b", "200"}); !ok {
+		t.Error("metric of other tenant deleted")
+	}
+}
+
+func TestLabelConstraints(t *testing.T) {
+	statusClass := func(code string) string {
+		if code == "" {
+			return "unknown"
+		}
+		return code[:1] + "xx"
+	}
+	vec := NewCounterVec(
+		CounterOpts{
+			Name: "test_total",
+			Help: "helpless",
+			LabelConstraints: map[string]LabelConstraint{
+				"code":   statusClass,
+				"method": LabelValueSet("other", "GET", "POST"),
+			},
+		},
+		[]string{"code", "method", "handler"},
+	)
+
+	vec.WithLabelValues("200", "GET", "/").Inc()
+	vec.WithLabelValues("204", "GET", "/").Inc()
+	vec.With(Labels{"code": "201", "method": "GET", "handler": "/"}).Inc()
+	vec.WithLabelValues("404", "PROPFIND", "/").Inc()
+	vec.WithLabelValues("418", "BREW", "/").Inc()
+
+	if got, want := len(vec.children), 2; got != want {
+		t.Errorf("got %d children, want %d", got, want)
+	}
+	m := &dto.Metric{}
+	vec.WithLabelValues("2xx", "GET", "/").Write(m)
+	if got, want := m.GetCounter().GetValue(), 3.; got != want {
+		t.Errorf("got %v for 2xx, want %v", got, want)
+	}
+	m.Reset()
+	vec.WithLabelValues("4xx", "other", "/").Write(m)
+	if got, want := m.GetCounter().GetValue(), 2.; got != want {
+		t.Errorf("got %v for 4xx, want %v", got, want)
+	}
+
+	// Constraints also apply to currying and deletion.
+	curried := vec.MustCurryWith(Labels{"method": "DELETE"})
+	curried.WithLabelValues("500", "/").Inc()
+	if !vec.DeleteLabelValues("503", "PATCH", "/") {
+		t.Error("deletion with constrained label values failed")
+	}
+	if !vec.Delete(Labels{"code": "299", "method": "GET", "handler": "/"}) {
+		t.Error("deletion with constrained labels failed")
+	}
+	if got, want := vec.DeletePartialMatch(Labels{"code": "400"}), 1; got != want {
+		t.Errorf("got %d deleted, want %d", got, want)
+	}
+	if len(vec.children) != 0 {
+		t.Errorf("unexpected remaining children: %v", vec.children)
+	}
+
+	// Constraints for unknown labels fail the registration.
+	bad := NewGaugeVec(GaugeOpts{
+		Name:             "bad",
+		Help:             "helpless",
+		LabelConstraints: map[string]LabelConstraint{"foo": statusClass},
+	}, []string{"code"})
+	if err := NewRegistry().Register(bad); err == nil {
+		t.Error("expected registration error for constraint of unknown label")
+	}
+}
+
+func TestMaxLabelSets(t *testing.T) {
+	newVec := func(policy LabelSetOverflowPolicy) (*CounterVec, Counter) {
+		overflows := NewCounter(CounterOpts{Name: "overflows_total", Help: "helpless"})
+		return NewCounterVec(CounterOpts{
+			Name:                    "test_total",
+			Help:                    "helpless",
+			MaxLabelSets:            2,
+			LabelSetOverflow:        policy,
+			LabelSetOverflowCounter: overflows,
+		}, []string{"user", "op"}), overflows
+	}
+	value := func(c Counter) float64 {
+		m := &dto.Metric{}
+		c.Write(m)
+		return m.GetCounter().GetValue()
+	}
+	has := func(vec *CounterVec, lvs ...string) bool {
+		h, _ := vec.hashLabelValues(lvs)
+		_, ok := vec.getMetricWithHashAndLabelValues(h, lvs)
+		return ok
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		vec, overflows := newVec(LabelSetOverflowDrop)
+		vec.WithLabelValues("a", "read").Inc()
+		vec.WithLabelValues("b", "read").Inc()
+		vec.WithLabelValues("c", "read").Inc()
+		vec.WithLabelValues("a", "read").Inc()
+		if vec.size != 2 {
+			t.Errorf("got %d label sets, want 2", vec.size)
+		}
+		if has(vec, "c", "read") {
+			t.Error("dropped label set retained")
+		}
+		if got := value(vec.WithLabelValues("a", "read")); got != 2 {
+			t.Errorf("got %v for retained label set, want 2", got)
+		}
+		if got := value(overflows); got != 1 {
+			t.Errorf("got %v overflows, want 1", got)
+		}
+		// Deleting makes room again.
+		vec.DeleteLabelValues("b", "read")
+		vec.WithLabelValues("c", "read").Inc()
+		if !has(vec, "c", "read") {
+			t.Error("label set not added after deletion")
+		}
+	})
+	t.Run("evict", func(t *testing.T) {
+		vec, overflows := newVec(LabelSetOverflowEvict)
+		vec.WithLabelValues("a", "read").Inc()
+		vec.WithLabelValues("b", "read").Inc()
+		vec.WithLabelValues("a", "read").Inc()
+		vec.WithLabelValues("c", "read").Inc()
+		if vec.size != 2 {
+			t.Errorf("got %d label sets, want 2", vec.size)
+		}
+		if has(vec, "b", "read") {
+			t.Error("least recently used label set not evicted")
+		}
+		if !has(vec, "a", "read") || !has(vec, "c", "read") {
+			t.Error("recently used label set evicted")
+		}
+		if got := value(overflows); got != 1 {
+			t.Errorf("got %v overflows, want 1", got)
+		}
+	})
+	t.Run("other", func(t *testing.T) {
+		vec, overflows := newVec(LabelSetOverflowOther)
+		vec.WithLabelValues("a", "read").Inc()
+		vec.WithLabelValues("b", "read").Inc()
+		vec.WithLabelValues("c", "read").Inc()
+		vec.With(Labels{"user": "d", "op": "write"}).Inc()
+		if vec.size != 3 {
+			t.Errorf("got %d label sets, want 3", vec.size)
+		}
+		if got := value(vec.WithLabelValues(OverflowLabelValue, OverflowLabelValue)); got != 2 {
+			t.Errorf("got %v for overflow label set, want 2", got)
+		}
+		if got := value(overflows); got != 2 {
+			t.Errorf("got %v overflows, want 2", got)
+		}
+	})
+	t.Run("auto-delete gauge", func(t *testing.T) {
+		vec := NewAutoDeleteGaugeVec(GaugeOpts{
+			Name:         "test",
+			Help:         "helpless",
+			MaxLabelSets: 1,
+		}, []string{"pool"})
+		a := vec.WithLabelValues("a")
+		a.Inc()
+		a.Dec()
+		vec.WithLabelValues("b").Inc()
+		a.Inc() // Must not be re-added beyond the limit.
+		if vec.size != 1 {
+			t.Errorf("got %d label sets, want 1", vec.size)
+		}
+	})
+}
+
+func TestLabelSetTTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	expired := NewCounter(CounterOpts{Name: "expired_total", Help: "helpless"})
+	vec := NewCounterVec(CounterOpts{
+		Name:                   "test_total",
+		Help:                   "helpless",
+		LabelSetTTL:            time.Minute,
+		LabelSetExpiredCounter: expired,
+	}, []string{"path"})
+	vec.clock = ClockFunc(func() time.Time { return now })
+
+	collect := func() int {
+		ch := make(chan Metric, 10)
+		vec.Collect(ch)
+		close(ch)
+		return len(ch)
+	}
+
+	vec.WithLabelValues("/a").Inc()
+	vec.WithLabelValues("/b").Inc()
+	now = now.Add(40 * time.Second)
+	vec.WithLabelValues("/a").Inc()
+	if got := collect(); got != 2 {
+		t.Errorf("got %d metrics before expiry, want 2", got)
+	}
+	now = now.Add(30 * time.Second)
+	if got := collect(); got != 1 {
+		t.Errorf("got %d metrics after expiry of /b, want 1", got)
+	}
+	if vec.size != 1 {
+		t.Errorf("got %d label sets, want 1", vec.size)
+	}
+	m := &dto.Metric{}
+	expired.Write(m)
+	if got := m.GetCounter().GetValue(); got != 1 {
+		t.Errorf("got %v expired label sets, want 1", got)
+	}
+	now = now.Add(time.Minute)
+	if got := collect(); got != 0 {
+		t.Errorf("got %d metrics after expiry of /a, want 0", got)
+	}
+	// An expired label set starts from scratch.
+	vec.WithLabelValues("/a").Inc()
+	vec.WithLabelValues("/a").Write(m)
+	if got := m.GetCounter().GetValue(); got != 1 {
+		t.Errorf("got %v for re-created label set, want 1", got)
+	}
+}
+
+func TestPreparedLabelValues(t *testing.T) {
+	vec := NewCounterVec(CounterOpts{
+		Name: "test_total",
+		Help: "helpless",
+	}, []string{"route", "code"})
+	value := func(c Counter) float64 {
+		m := &dto.Metric{}
+		c.Write(m)
+		return m.GetCounter().GetValue()
+	}
+
+	if _, err := vec.PrepareLabelValues("/"); err != errInconsistentCardinality {
+		t.Errorf("got error %v, want %v", err, errInconsistentCardinality)
+	}
+	p, err := vec.PrepareLabelValues("/", "200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vec.WithPreparedLabelValues(p).Inc()
+	if got := value(vec.WithLabelValues("/", "200")); got != 1 {
+		t.Errorf("got %v, want 1", got)
+	}
+	vec.WithLabelValues("/", "200").Inc()
+	if got := value(vec.WithPreparedLabelValues(p)); got != 2 {
+		t.Errorf("got %v, want 2", got)
+	}
+
+	// The handle keeps working after deletion.
+	vec.Reset()
+	vec.WithPreparedLabelValues(p).Inc()
+	if got := value(vec.WithLabelValues("/", "200")); got != 1 {
+		t.Errorf("got %v after reset, want 1", got)
+	}
+
+	// Handles are shared with curried vectors.
+	curried := vec.MustCurryWith(Labels{"code": "200"})
+	pc, err := curried.PrepareLabelValues("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vec.WithPreparedLabelValues(pc).Inc()
+	if got := value(curried.WithPreparedLabelValues(p)); got != 2 {
+		t.Errorf("got %v via curried vector, want 2", got)
+	}
+
+	other := NewCounterVec(CounterOpts{
+		Name: "test_total",
+		Help: "helpless",
+	}, []string{"route", "code"})
+	defer func() {
+		if r := recover(); r != errPreparedLabelValuesMismatch {
+			t.Errorf("got panic %v, want %v", r, errPreparedLabelValuesMismatch)
+		}
+	}()
+	other.WithPreparedLabelValues(p)
+}
+
+func mustHash(t *testing.T, vec *GaugeVec, lvs ...string) uint64 {
+	h, err := vec.hashLabelValues(lvs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
 func BenchmarkMetricVecWithLabelValuesBasic(b *testing.B) {
 	benchmarkMetricVecWithLabelValues(b, map[string][]string{
 		"l1": {"onevalue"},
@@ -266,6 +779,18 @@ func BenchmarkMetricVecWithLabelValues10Keys1000ValueCardinality(b *testing.B) {
 	benchmarkMetricVecWithLabelValuesCardinality(b, 10, 1000)
 }
 
+func BenchmarkMetricVecWithLabelValuesWide(b *testing.B) {
+	labels := map[string][]string{}
+	for i := 0; i < 16; i++ {
+		vs := make([]string, 0, 10)
+		for j := 0; j < 10; j++ {
+			vs = append(vs, fmt.Sprintf("/api/v1/some/rather/long/path/segment/%d/value-%d", i, j))
+		}
+		labels[fmt.Sprintf("key-%v", i)] = vs
+	}
+	benchmarkMetricVecWithLabelValues(b, labels)
+}
+
 func benchmarkMetricVecWithLabelValuesCardinality(b *testing.B, nkeys, nvalues int) {
 	labels := map[string][]string{}
 
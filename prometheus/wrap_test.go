@@ -0,0 +1,105 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestWrap(t *testing.T) {
+	reg := NewPedanticRegistry()
+	wrapped := WrapRegistererWithPrefix("sub_", WrapRegistererWith(Labels{"instance": "a"}, reg))
+
+	cnt := NewCounter(CounterOpts{
+		Name:        "requests_total",
+		Help:        "help",
+		ConstLabels: Labels{"const": "x"},
+	})
+	cv := NewCounterVec(CounterOpts{Name: "errors_total", Help: "help"}, []string{"code"})
+	wrapped.MustRegister(cnt, cv)
+	cnt.Inc()
+	cv.WithLabelValues("500").Add(2)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*dto.MetricFamily{
+		{
+			Name: proto.String("sub_errors_total"),
+			Help: proto.String("help"),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{
+				Label: []*dto.LabelPair{
+					{Name: proto.String("code"), Value: proto.String("500")},
+					{Name: proto.String("instance"), Value: proto.String("a")},
+				},
+				Counter: &dto.Counter{Value: proto.Float64(2)},
+			}},
+		},
+		{
+			Name: proto.String("sub_requests_total"),
+			Help: proto.String("help"),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{
+				Label: []*dto.LabelPair{
+					{Name: proto.String("const"), Value: proto.String("x")},
+					{Name: proto.String("instance"), Value: proto.String("a")},
+				},
+				Counter: &dto.Counter{Value: proto.Float64(1)},
+			}},
+		},
+	}
+	if len(mfs) != len(want) {
+		t.Fatalf("got %d metric families, want %d", len(mfs), len(want))
+	}
+	for i := range want {
+		if !proto.Equal(mfs[i], want[i]) {
+			t.Errorf("got %s, want %s", mfs[i], want[i])
+		}
+	}
+
+	// Registering the same Collector again reports the unwrapped one.
+	err = wrapped.Register(cnt)
+	are, ok := err.(AlreadyRegisteredError)
+	if !ok {
+		t.Fatalf("got error %v, want AlreadyRegisteredError", err)
+	}
+	if are.ExistingCollector != cnt || are.NewCollector != cnt {
+		t.Error("AlreadyRegisteredError does not contain the unwrapped Collector")
+	}
+
+	if !wrapped.Unregister(cnt) {
+		t.Error("unregistering wrapped Collector failed")
+	}
+	if reg.Unregister(cnt) {
+		t.Error("unwrapped Collector unexpectedly registered")
+	}
+}
+
+func TestWrapConflictingLabels(t *testing.T) {
+	wrapped := WrapRegistererWith(Labels{"const": "y"}, NewRegistry())
+	err := wrapped.Register(NewCounter(CounterOpts{
+		Name:        "requests_total",
+		Help:        "help",
+		ConstLabels: Labels{"const": "x"},
+	}))
+	if err == nil {
+		t.Error("expected error registering Collector with conflicting label")
+	}
+}